@@ -0,0 +1,55 @@
+// Package cbor
+//
+// @author: xwc1125
+package cbor
+
+import (
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+)
+
+// 自定义类型的编码方式与json保持一致：
+// []byte编码为字节串，big.Int编码为带标签的大整数(tag 2/3)，
+// types.Address及types.Hash等字节数组编码为定长字节串，
+// 解码时经由其UnmarshalBinary校验长度
+func init() {
+	encOpts := cbor.CoreDetEncOptions()
+	encOpts.BigIntConvert = cbor.BigIntConvertNone
+	encOpts.ByteArray = cbor.ByteArrayToByteSlice
+	encOpts.BinaryMarshaler = cbor.BinaryMarshalerByteString
+
+	decOpts := cbor.DecOptions{
+		BigIntDec:         cbor.BigIntDecodePointer,
+		BinaryUnmarshaler: cbor.BinaryUnmarshalerByteString,
+	}
+
+	var err error
+	if encMode, err = encOpts.EncMode(); err != nil {
+		panic(err)
+	}
+	if decMode, err = decOpts.DecMode(); err != nil {
+		panic(err)
+	}
+}
+
+func Marshal(v interface{}) ([]byte, error) {
+	return encMode.Marshal(v)
+}
+
+func Unmarshal(data []byte, v interface{}) error {
+	return decMode.Unmarshal(data, v)
+}
+
+func NewEncoder(w io.Writer) *cbor.Encoder {
+	return encMode.NewEncoder(w)
+}
+
+func NewDecoder(r io.Reader) *cbor.Decoder {
+	return decMode.NewDecoder(r)
+}
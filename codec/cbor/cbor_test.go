@@ -0,0 +1,116 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/codec"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+func TestCustomTypes(t *testing.T) {
+	tests := []struct {
+		val    interface{}
+		output string
+	}{
+		{val: []byte{0x01, 0x02, 0x03}, output: "43010203"},
+		{val: []byte{}, output: "40"},
+		{val: big.NewInt(0), output: "c240"},
+		{val: big.NewInt(100), output: "c24164"},
+		{val: big.NewInt(-100), output: "c34163"},
+		{val: new(big.Int).Lsh(big.NewInt(1), 64), output: "c249010000000000000000"},
+		{val: types.Address{0x01}, output: "54" + "01" + "00000000000000000000000000000000000000"},
+		{val: types.Hash{0xff}, output: "5820" + "ff" + "00000000000000000000000000000000000000000000000000000000000000"},
+	}
+	for i, test := range tests {
+		output, err := Marshal(test.val)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode: %v", i, err)
+		}
+		if have := hex.EncodeToString(output); have != test.output {
+			t.Fatalf("test %d: output mismatch: have %s, want %s", i, have, test.output)
+		}
+		dec := reflect.New(reflect.TypeOf(test.val).Elem())
+		if reflect.TypeOf(test.val).Kind() != reflect.Ptr {
+			dec = reflect.New(reflect.TypeOf(test.val))
+		}
+		if err := Unmarshal(output, dec.Interface()); err != nil {
+			t.Fatalf("test %d: failed to decode: %v", i, err)
+		}
+		want := reflect.ValueOf(test.val)
+		if want.Kind() == reflect.Ptr {
+			want = want.Elem()
+		}
+		if !reflect.DeepEqual(dec.Elem().Interface(), want.Interface()) {
+			t.Fatalf("test %d: value mismatch: have %v, want %v", i, dec.Elem(), want)
+		}
+	}
+	// Fixed length types reject byte strings of any other length
+	invalid := []struct {
+		input string
+		dec   interface{}
+	}{
+		{input: "43010203", dec: new(types.Address)},
+		{input: "5828" + strings.Repeat("01", 40), dec: new(types.Address)},
+		{input: "43010203", dec: new(types.Hash)},
+		{input: "54" + strings.Repeat("01", 20), dec: new(types.Hash)},
+		{input: "a1" + "6141" + "43010203", dec: new(struct{ A types.Address })},
+	}
+	for i, test := range invalid {
+		input, _ := hex.DecodeString(test.input)
+		if err := Unmarshal(input, test.dec); err == nil {
+			t.Fatalf("invalid test %d: decoded %s into %T", i, test.input, test.dec)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	type tmpst struct {
+		Data    []byte
+		Num     *big.Int
+		Address types.Address
+		Hash    types.Hash
+		Values  map[string]uint64
+	}
+	tmp := &tmpst{
+		Data:    []byte{0x1, 0x2, 0x3, 0xf},
+		Num:     big.NewInt(-100),
+		Address: types.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314"),
+		Hash:    types.BytesToHash([]byte{0xaa, 0xbb}),
+		Values:  map[string]uint64{"b": 2, "a": 1, "c": 3},
+	}
+	c, err := codec.Get(codec.CBOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Encode(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Encoding is deterministic
+	for i := 0; i < 10; i++ {
+		again, _ := c.Encode(tmp)
+		if !bytes.Equal(again, b) {
+			t.Fatalf("non-deterministic encoding: %x != %x", again, b)
+		}
+	}
+	var dec tmpst
+	if err := c.Decode(b, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&dec, tmp) {
+		t.Fatalf("value mismatch: have %+v, want %+v", dec, tmp)
+	}
+
+	env, err := codec.EncodeEnvelope(codec.CBOR, tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env[0] != 0x04 || !bytes.Equal(env[1:], b) {
+		t.Fatalf("envelope mismatch: %x", env)
+	}
+}
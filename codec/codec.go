@@ -5,6 +5,14 @@ package codec
 
 import "github.com/chain5j/chain5j-pkg/codec/rlp"
 
+// 内置编解码器的名称
+const (
+	RLP      = "rlp"
+	JSON     = "json"
+	PROTOBUF = "protobuf"
+	CBOR     = "cbor"
+)
+
 var DefaultCodec = rlp.NewCodec()
 
 // Codec 编解码
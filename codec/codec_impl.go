@@ -3,24 +3,164 @@
 // @author: xwc1125
 package codec
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
 
 var (
-	once  sync.Once
-	coder Codec
+	ErrCodecNotFound = errors.New("codec: codec not found")
+	ErrNoCodecID     = errors.New("codec: codec has no envelope id")
+	ErrEmptyEnvelope = errors.New("codec: empty envelope")
 )
 
-// RegisterCodec 注册编解码器
-func RegisterCodec(_codec Codec) {
-	once.Do(func() {
-		if coder == nil {
-			coder = _codec
+// Identifier 可用于信封编码的编解码器，ID作为信封数据的首字节，在已注册的编解码器中必须唯一。
+// 内置编解码器的ID：rlp 0x01，json 0x02，protobuf 0x03，cbor 0x04
+type Identifier interface {
+	CodecID() byte
+}
+
+// entry 注册表中的编解码器
+type entry struct {
+	name  string
+	codec Codec
+	id    byte
+	hasID bool
+}
+
+var (
+	mu     sync.RWMutex
+	codecs = make(map[string]*entry)
+	ids    = make(map[byte]*entry)
+	coder  Codec // 全局默认编解码器
+)
+
+func init() {
+	Register(RLP, DefaultCodec)
+}
+
+// Register 按名称注册编解码器，同名的编解码器会被替换
+func Register(name string, c Codec) error {
+	if name == "" {
+		return errors.New("codec: empty codec name")
+	}
+	if c == nil {
+		return fmt.Errorf("codec: nil codec %q", name)
+	}
+	e := &entry{name: name, codec: c}
+	if ider, ok := c.(Identifier); ok {
+		e.id, e.hasID = ider.CodecID(), true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if e.hasID {
+		if prev := ids[e.id]; prev != nil && prev.name != name {
+			return fmt.Errorf("codec: id %#x of %q is used by %q", e.id, name, prev.name)
 		}
-	})
+	}
+	if prev := codecs[name]; prev != nil && prev.hasID {
+		delete(ids, prev.id)
+	}
+	codecs[name] = e
+	if e.hasID {
+		ids[e.id] = e
+	}
+	return nil
+}
+
+// Unregister 注销编解码器
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if e := codecs[name]; e != nil {
+		delete(codecs, name)
+		if e.hasID {
+			delete(ids, e.id)
+		}
+	}
+}
+
+// Get 按名称获取编解码器
+func Get(name string) (Codec, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if e := codecs[name]; e != nil {
+		return e.codec, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrCodecNotFound, name)
+}
+
+// Names 获取所有已注册的编解码器名称
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EncodeEnvelope 使用指定的编解码器编码，结果以编解码器的ID作为前缀
+func EncodeEnvelope(name string, v interface{}) ([]byte, error) {
+	mu.RLock()
+	e := codecs[name]
+	mu.RUnlock()
+	if e == nil {
+		return nil, fmt.Errorf("%w: %q", ErrCodecNotFound, name)
+	}
+	if !e.hasID {
+		return nil, fmt.Errorf("%w: %q", ErrNoCodecID, name)
+	}
+	data, err := e.codec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{e.id}, data...), nil
+}
+
+// DecodeEnvelope 根据前缀的ID选择编解码器解码
+func DecodeEnvelope(data []byte, structPrt interface{}) error {
+	if len(data) == 0 {
+		return ErrEmptyEnvelope
+	}
+	mu.RLock()
+	e := ids[data[0]]
+	mu.RUnlock()
+	if e == nil {
+		return fmt.Errorf("%w: id %#x", ErrCodecNotFound, data[0])
+	}
+	return e.codec.Decode(data[1:], structPrt)
+}
+
+// EnvelopeCodec 获取信封数据所使用的编解码器名称
+func EnvelopeCodec(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", ErrEmptyEnvelope
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if e := ids[data[0]]; e != nil {
+		return e.name, nil
+	}
+	return "", fmt.Errorf("%w: id %#x", ErrCodecNotFound, data[0])
+}
+
+// RegisterCodec 设置全局默认编解码器，可多次调用替换
+func RegisterCodec(_codec Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	coder = _codec
 }
 
 // Codecor 获取全局的编解码器
 func Codecor() Codec {
+	mu.RLock()
+	defer mu.RUnlock()
 	if coder == nil {
 		return DefaultCodec
 	}
@@ -0,0 +1,137 @@
+// Package codec
+//
+// @author: xwc1125
+package codec_test
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/codec"
+	"github.com/chain5j/chain5j-pkg/codec/json"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+)
+
+type testStruct struct {
+	Name  string
+	Value *big.Int
+	Data  []byte
+}
+
+// noIDCodec is a codec without envelope id.
+type noIDCodec struct{}
+
+func (noIDCodec) Encode(v interface{}) ([]byte, error)    { return rlp.EncodeToBytes(v) }
+func (noIDCodec) Decode(data []byte, v interface{}) error { return rlp.DecodeBytes(data, v) }
+
+// idCodec is a codec with a configurable envelope id.
+type idCodec struct {
+	rlp.Codec
+	id byte
+}
+
+func (c *idCodec) CodecID() byte { return c.id }
+
+func TestRegistry(t *testing.T) {
+	if c, err := codec.Get(codec.RLP); err != nil || c != codec.DefaultCodec {
+		t.Fatalf("rlp codec mismatch: have %v, %v", c, err)
+	}
+	if _, err := codec.Get(codec.JSON); err != nil {
+		t.Fatalf("json codec not registered: %v", err)
+	}
+	if _, err := codec.Get("unknown"); !errors.Is(err, codec.ErrCodecNotFound) {
+		t.Fatalf("unknown codec error mismatch: have %v, want %v", err, codec.ErrCodecNotFound)
+	}
+
+	// Registering under the same name replaces the codec
+	first, second := &idCodec{id: 0x70}, &idCodec{id: 0x71}
+	if err := codec.Register("test", first); err != nil {
+		t.Fatalf("failed to register codec: %v", err)
+	}
+	defer codec.Unregister("test")
+	if err := codec.Register("test", second); err != nil {
+		t.Fatalf("failed to replace codec: %v", err)
+	}
+	if c, _ := codec.Get("test"); c != second {
+		t.Fatalf("codec not replaced")
+	}
+	if _, err := codec.EnvelopeCodec([]byte{0x70}); !errors.Is(err, codec.ErrCodecNotFound) {
+		t.Fatalf("replaced codec id still registered: %v", err)
+	}
+	// Ids must be unique among the codecs
+	if err := codec.Register("other", &idCodec{id: 0x71}); err == nil {
+		t.Fatalf("duplicate codec id registered")
+	}
+	if err := codec.Register("", second); err == nil {
+		t.Fatalf("empty codec name registered")
+	}
+	if err := codec.Register("nil", nil); err == nil {
+		t.Fatalf("nil codec registered")
+	}
+	codec.Unregister("test")
+	if _, err := codec.Get("test"); !errors.Is(err, codec.ErrCodecNotFound) {
+		t.Fatalf("unregistered codec still available: %v", err)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	val := testStruct{Name: "test", Value: big.NewInt(1000), Data: []byte{0x01, 0x02}}
+
+	for _, name := range []string{codec.RLP, codec.JSON} {
+		enc, err := codec.EncodeEnvelope(name, &val)
+		if err != nil {
+			t.Fatalf("%s: failed to encode: %v", name, err)
+		}
+		c, _ := codec.Get(name)
+		plain, _ := c.Encode(&val)
+		if !bytes.Equal(enc[1:], plain) {
+			t.Fatalf("%s: envelope payload mismatch: have %x, want %x", name, enc[1:], plain)
+		}
+		if have, err := codec.EnvelopeCodec(enc); err != nil || have != name {
+			t.Fatalf("%s: envelope codec mismatch: have %q, %v", name, have, err)
+		}
+		var dec testStruct
+		if err := codec.DecodeEnvelope(enc, &dec); err != nil {
+			t.Fatalf("%s: failed to decode: %v", name, err)
+		}
+		if !reflect.DeepEqual(dec, val) {
+			t.Fatalf("%s: value mismatch: have %+v, want %+v", name, dec, val)
+		}
+	}
+	if err := codec.DecodeEnvelope(nil, new(testStruct)); err != codec.ErrEmptyEnvelope {
+		t.Fatalf("empty envelope error mismatch: have %v, want %v", err, codec.ErrEmptyEnvelope)
+	}
+	if err := codec.DecodeEnvelope([]byte{0xff, 0xc0}, new(testStruct)); !errors.Is(err, codec.ErrCodecNotFound) {
+		t.Fatalf("unknown id error mismatch: have %v, want %v", err, codec.ErrCodecNotFound)
+	}
+
+	if err := codec.Register("noid", noIDCodec{}); err != nil {
+		t.Fatalf("failed to register codec: %v", err)
+	}
+	defer codec.Unregister("noid")
+	if _, err := codec.EncodeEnvelope("noid", &val); !errors.Is(err, codec.ErrNoCodecID) {
+		t.Fatalf("codec without id error mismatch: have %v, want %v", err, codec.ErrNoCodecID)
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	defer codec.RegisterCodec(nil)
+
+	if codec.Codecor() != codec.DefaultCodec {
+		t.Fatalf("default codec mismatch")
+	}
+	jsonCodec := json.NewCodec()
+	codec.RegisterCodec(jsonCodec)
+	if codec.Codecor() != jsonCodec {
+		t.Fatalf("global codec not set")
+	}
+	// The global codec can be replaced
+	rlpCodec := rlp.NewCodec()
+	codec.RegisterCodec(rlpCodec)
+	if codec.Codecor() != rlpCodec {
+		t.Fatalf("global codec not replaced")
+	}
+}
@@ -9,17 +9,35 @@ import (
 
 var _ codec.Codec = &Codec{}
 
+func init() {
+	codec.Register(codec.JSON, NewCodec())
+}
+
 type Codec struct {
+	strict bool
 }
 
 func NewCodec() *Codec {
 	return &Codec{}
 }
 
+// NewStrictCodec 严格模式的编解码器，见UnmarshalStrict
+func NewStrictCodec() *Codec {
+	return &Codec{strict: true}
+}
+
 func (c *Codec) Encode(v interface{}) ([]byte, error) {
 	return Marshal(v)
 }
 
 func (c *Codec) Decode(data []byte, structPrt interface{}) error {
+	if c.strict {
+		return UnmarshalStrict(data, structPrt)
+	}
 	return Unmarshal(data, structPrt)
 }
+
+// CodecID 信封编码的ID
+func (c *Codec) CodecID() byte {
+	return 0x02
+}
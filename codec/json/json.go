@@ -1,20 +1,36 @@
 package json
 
 import (
+	"errors"
 	"io"
 	"math/big"
-	"strings"
+	"reflect"
 	"unsafe"
 
 	"github.com/chain5j/chain5j-pkg/util/hexutil"
 	"github.com/json-iterator/go"
+	"github.com/modern-go/reflect2"
 )
 
+var (
+	errNonInteger    = errors.New("non-integer number")
+	errInt64Range    = errors.New("number exceeds int64, use a hex string")
+	errBig256Range   = errors.New("number exceeds 256 bits")
+	errInvalidNumber = errors.New("invalid number")
+	errBigIntType    = errors.New("expected string or number")
+)
+
+// strictAPI 严格模式：[]byte必须为带0x前缀的偶数长度十六进制字符串，
+// big.Int必须为带0x前缀的十六进制字符串或int64范围内的数字
+var strictAPI = jsoniter.Config{EscapeHTML: true}.Froze()
+
 func init() {
 	jsoniter.RegisterTypeEncoder("[]uint8", &byteCodec{})
 	jsoniter.RegisterTypeDecoder("[]uint8", &byteCodec{})
 	jsoniter.RegisterTypeEncoder("big.Int", &bigIntCodec{})
 	jsoniter.RegisterTypeDecoder("big.Int", &bigIntCodec{})
+
+	strictAPI.RegisterExtension(&strictExtension{})
 }
 
 func Marshal(v interface{}) ([]byte, error) {
@@ -29,11 +45,52 @@ func Unmarshal(data []byte, v interface{}) error {
 	return jsoniter.Unmarshal(data, v)
 }
 
+// UnmarshalStrict 严格模式解码
+func UnmarshalStrict(data []byte, v interface{}) error {
+	return strictAPI.Unmarshal(data, v)
+}
+
 func NewDecoder(r io.Reader) *jsoniter.Decoder {
 	return jsoniter.NewDecoder(r)
 }
 
-type byteCodec struct{}
+// NewStrictDecoder 严格模式的解码器
+func NewStrictDecoder(r io.Reader) *jsoniter.Decoder {
+	return strictAPI.NewDecoder(r)
+}
+
+// strictExtension 将自定义类型的解码器替换为严格模式
+type strictExtension struct {
+	jsoniter.DummyExtension
+}
+
+func (e *strictExtension) CreateDecoder(typ reflect2.Type) jsoniter.ValDecoder {
+	// Pointers need to be handled here, otherwise the lenient decoders
+	// registered for the element types would be used.
+	if typ.Kind() == reflect.Ptr {
+		ptr := typ.(reflect2.PtrType)
+		if dec := strictDecoder(ptr.Elem()); dec != nil {
+			return &jsoniter.OptionalDecoder{ValueType: ptr.Elem(), ValueDecoder: dec}
+		}
+		return nil
+	}
+	return strictDecoder(typ)
+}
+
+func strictDecoder(typ reflect2.Type) jsoniter.ValDecoder {
+	switch typ.String() {
+	case "[]uint8":
+		return &byteCodec{strict: true}
+	case "big.Int":
+		return &bigIntCodec{strict: true}
+	default:
+		return nil
+	}
+}
+
+type byteCodec struct {
+	strict bool
+}
 
 func (codec *byteCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 	b := *((*[]byte)(ptr))
@@ -48,16 +105,40 @@ func (codec *byteCodec) IsEmpty(ptr unsafe.Pointer) bool {
 }
 
 func (codec *byteCodec) Decode(ptr unsafe.Pointer, iter *jsoniter.Iterator) {
+	if iter.ReadNil() {
+		*((*[]byte)(ptr)) = nil
+		return
+	}
 	hex := iter.ReadString()
-
+	if iter.Error != nil {
+		return
+	}
+	// Empty byte slices are encoded as empty strings.
+	if hex == "" {
+		*((*[]byte)(ptr)) = nil
+		return
+	}
+	if codec.strict {
+		if !hexutil.HasHexPrefix(hex) {
+			iter.ReportError("decode []byte", hexutil.ErrMissingPrefix.Error())
+			return
+		}
+		if len(hex)%2 == 1 {
+			iter.ReportError("decode []byte", hexutil.ErrOddLength.Error())
+			return
+		}
+	}
 	b, err := hexutil.Decode(hex)
 	if err != nil {
+		iter.ReportError("decode []byte", err.Error())
 		return
 	}
 	*((*[]byte)(ptr)) = b
 }
 
-type bigIntCodec struct{}
+type bigIntCodec struct {
+	strict bool
+}
 
 func (codec *bigIntCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 	i := *((*big.Int)(ptr))
@@ -71,29 +152,75 @@ func (codec *bigIntCodec) IsEmpty(ptr unsafe.Pointer) bool {
 }
 
 func (codec *bigIntCodec) Decode(ptr unsafe.Pointer, iter *jsoniter.Iterator) {
-	result := new(big.Int)
-
-	any := iter.ReadAny()
-	valueType := any.ValueType()
-	switch valueType {
+	var (
+		result *big.Int
+		err    error
+	)
+	switch iter.WhatIsNext() {
+	case jsoniter.NilValue:
+		iter.ReadNil()
+		return
 	case jsoniter.StringValue:
-		str := any.ToString()
-		if !strings.HasPrefix(str, "0x") {
-			result.UnmarshalText([]byte(str))
-			*((*big.Int)(ptr)) = *result
-			return
-		}
-		result, err := hexutil.DecodeBig(str)
-		if err != nil {
-			return
-		}
-
-		*((*big.Int)(ptr)) = *result
-		break
+		result, err = codec.decodeString(iter.ReadString())
 	case jsoniter.NumberValue:
-		num := any.ToInt64()
-		result = big.NewInt(num)
-		*((*big.Int)(ptr)) = *result
-		break
+		result, err = codec.decodeNumber(string(iter.ReadNumber()))
+	default:
+		iter.Skip()
+		err = errBigIntType
+	}
+	if iter.Error != nil {
+		return
+	}
+	if err != nil {
+		iter.ReportError("decode big.Int", err.Error())
+		return
+	}
+	*((*big.Int)(ptr)) = *result
+}
+
+// decodeString 解码字符串，宽松模式下支持不带0x前缀的十进制等格式
+func (codec *bigIntCodec) decodeString(str string) (*big.Int, error) {
+	if hexutil.HasHexPrefix(str) {
+		return hexutil.DecodeBig(str)
+	}
+	if codec.strict {
+		return nil, hexutil.ErrMissingPrefix
+	}
+	result, ok := new(big.Int).SetString(str, 0)
+	if !ok {
+		return nil, errInvalidNumber
+	}
+	return result, nil
+}
+
+// decodeNumber 解码任意精度的数字，严格模式下必须在int64范围内
+func (codec *bigIntCodec) decodeNumber(lit string) (*big.Int, error) {
+	result, err := parseBigNumber(lit)
+	if err != nil {
+		return nil, err
+	}
+	if codec.strict && !result.IsInt64() {
+		return nil, errInt64Range
+	}
+	return result, nil
+}
+
+// parseBigNumber parses a JSON number literal as an integer. Fractions and
+// exponents are accepted for integral values of at most 256 bits.
+func parseBigNumber(lit string) (*big.Int, error) {
+	if result, ok := new(big.Int).SetString(lit, 10); ok {
+		return result, nil
+	}
+	f, _, err := big.ParseFloat(lit, 10, 512, big.ToNearestEven)
+	if err != nil {
+		return nil, errInvalidNumber
+	}
+	if !f.IsInt() {
+		return nil, errNonInteger
+	}
+	if f.MantExp(nil) > 256 {
+		return nil, errBig256Range
 	}
+	result, _ := f.Int(nil)
+	return result, nil
 }
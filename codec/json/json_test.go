@@ -1,6 +1,7 @@
 package json
 
 import (
+	"bytes"
 	"math/big"
 	"testing"
 )
@@ -67,3 +68,90 @@ func TestBigIntCodec(t *testing.T) {
 
 	return
 }
+
+func TestDecodeErrors(t *testing.T) {
+	type tmpst struct {
+		Data []byte
+		Num  *big.Int
+	}
+	tests := []struct {
+		input  string
+		strict bool
+		data   []byte
+		num    *big.Int
+		error  bool
+	}{
+		// lenient
+		{input: `{"Data":"0x0102","Num":"0x64"}`, data: []byte{0x01, 0x02}, num: big.NewInt(100)},
+		{input: `{"Data":"0102","Num":"100"}`, data: []byte{0x01, 0x02}, num: big.NewInt(100)},
+		{input: `{"Data":"0x102"}`, data: []byte{0x01, 0x02}},
+		{input: `{"Data":"","Num":null}`},
+		{input: `{"Data":null}`},
+		{input: `{"Num":100}`, num: big.NewInt(100)},
+		{input: `{"Num":-100}`, num: big.NewInt(-100)},
+		{input: `{"Num":1e3}`, num: big.NewInt(1000)},
+		{input: `{"Num":123456789012345678901234567890}`, num: bigFromString("123456789012345678901234567890")},
+		{input: `{"Data":"0xzz"}`, error: true},
+		{input: `{"Data":"zz"}`, error: true},
+		{input: `{"Num":"0xzz"}`, error: true},
+		{input: `{"Num":"abc"}`, error: true},
+		{input: `{"Num":1.5}`, error: true},
+		{input: `{"Num":1e100}`, error: true},
+		{input: `{"Num":true}`, error: true},
+		{input: `{"Num":[1]}`, error: true},
+
+		// strict
+		{input: `{"Data":"0x0102","Num":"0x64"}`, strict: true, data: []byte{0x01, 0x02}, num: big.NewInt(100)},
+		{input: `{"Data":"","Num":9223372036854775807}`, strict: true, num: big.NewInt(9223372036854775807)},
+		{input: `{"Data":"0102"}`, strict: true, error: true},
+		{input: `{"Data":"0x102"}`, strict: true, error: true},
+		{input: `{"Data":"0xzz"}`, strict: true, error: true},
+		{input: `{"Num":"100"}`, strict: true, error: true},
+		{input: `{"Num":9223372036854775808}`, strict: true, error: true},
+	}
+	for i, test := range tests {
+		var (
+			dec tmpst
+			err error
+		)
+		if test.strict {
+			err = NewStrictCodec().Decode([]byte(test.input), &dec)
+		} else {
+			err = NewCodec().Decode([]byte(test.input), &dec)
+		}
+		if test.error {
+			if err == nil {
+				t.Errorf("test %d: expected error for %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(dec.Data, test.data) {
+			t.Errorf("test %d: data mismatch: have %x, want %x", i, dec.Data, test.data)
+		}
+		if (dec.Num == nil) != (test.num == nil) || (dec.Num != nil && dec.Num.Cmp(test.num) != 0) {
+			t.Errorf("test %d: number mismatch: have %v, want %v", i, dec.Num, test.num)
+		}
+	}
+}
+
+func TestStrictDecodeNonPointer(t *testing.T) {
+	type tmpst struct {
+		Num big.Int
+	}
+	var dec tmpst
+	if err := UnmarshalStrict([]byte(`{"Num":"100"}`), &dec); err == nil {
+		t.Fatal("decoded decimal string in strict mode")
+	}
+	if err := Unmarshal([]byte(`{"Num":"100"}`), &dec); err != nil || dec.Num.Int64() != 100 {
+		t.Fatalf("lenient decode failed: %v, %v", &dec.Num, err)
+	}
+}
+
+func bigFromString(s string) *big.Int {
+	i, _ := new(big.Int).SetString(s, 10)
+	return i
+}
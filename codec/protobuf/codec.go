@@ -0,0 +1,34 @@
+// Package protobuf
+//
+// @author: xwc1125
+package protobuf
+
+import (
+	"github.com/chain5j/chain5j-pkg/codec"
+)
+
+var _ codec.Codec = &Codec{}
+
+func init() {
+	codec.Register(codec.PROTOBUF, NewCodec())
+}
+
+type Codec struct {
+}
+
+func NewCodec() *Codec {
+	return &Codec{}
+}
+
+func (c *Codec) Encode(v interface{}) ([]byte, error) {
+	return Marshal(v)
+}
+
+func (c *Codec) Decode(data []byte, structPrt interface{}) error {
+	return Unmarshal(data, structPrt)
+}
+
+// CodecID 信封编码的ID
+func (c *Codec) CodecID() byte {
+	return 0x03
+}
@@ -0,0 +1,147 @@
+// Package protobuf
+//
+// @author: xwc1125
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/chain5j/chain5j-pkg/types"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// 非proto.Message的自定义类型的编码方式与json保持一致：
+// []byte编码为BytesValue，big.Int编码为带符号标记的大整数消息，
+// types.Address及types.Hash编码为定长的BytesValue
+const (
+	bigIntAbsField protowire.Number = 1 // 绝对值，大端字节序
+	bigIntNegField protowire.Number = 2 // 是否为负数
+)
+
+var errNilValue = errors.New("protobuf: nil value")
+
+// marshalOptions 确定性编码，map字段按key排序，相同的消息编码结果一致
+var marshalOptions = proto.MarshalOptions{Deterministic: true}
+
+// Marshal 编码proto.Message或自定义类型
+func Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case proto.Message:
+		return marshalOptions.Marshal(v)
+	case []byte:
+		return marshalOptions.Marshal(wrapperspb.Bytes(v))
+	case *[]byte:
+		if v == nil {
+			return nil, errNilValue
+		}
+		return marshalOptions.Marshal(wrapperspb.Bytes(*v))
+	case *big.Int:
+		if v == nil {
+			return nil, errNilValue
+		}
+		return marshalBigInt(v), nil
+	case types.Address:
+		return marshalOptions.Marshal(wrapperspb.Bytes(v[:]))
+	case *types.Address:
+		if v == nil {
+			return nil, errNilValue
+		}
+		return marshalOptions.Marshal(wrapperspb.Bytes(v[:]))
+	case types.Hash:
+		return marshalOptions.Marshal(wrapperspb.Bytes(v[:]))
+	case *types.Hash:
+		if v == nil {
+			return nil, errNilValue
+		}
+		return marshalOptions.Marshal(wrapperspb.Bytes(v[:]))
+	default:
+		return nil, fmt.Errorf("protobuf: unsupported type %T", v)
+	}
+}
+
+// Unmarshal 解码为proto.Message或自定义类型
+func Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case proto.Message:
+		return proto.Unmarshal(data, v)
+	case *[]byte:
+		var w wrapperspb.BytesValue
+		if err := proto.Unmarshal(data, &w); err != nil {
+			return err
+		}
+		*v = w.Value
+		return nil
+	case *big.Int:
+		return unmarshalBigInt(data, v)
+	case *types.Address:
+		return unmarshalFixedBytes(data, v[:], v)
+	case *types.Hash:
+		return unmarshalFixedBytes(data, v[:], v)
+	default:
+		return fmt.Errorf("protobuf: unsupported type %T", v)
+	}
+}
+
+// unmarshalFixedBytes 解码定长的BytesValue
+func unmarshalFixedBytes(data []byte, dst []byte, v interface{}) error {
+	var w wrapperspb.BytesValue
+	if err := proto.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	if len(w.Value) != len(dst) {
+		return fmt.Errorf("protobuf: invalid length %d for %T, want %d", len(w.Value), v, len(dst))
+	}
+	copy(dst, w.Value)
+	return nil
+}
+
+func marshalBigInt(x *big.Int) []byte {
+	var b []byte
+	if x.Sign() != 0 {
+		b = protowire.AppendTag(b, bigIntAbsField, protowire.BytesType)
+		b = protowire.AppendBytes(b, x.Bytes())
+	}
+	if x.Sign() < 0 {
+		b = protowire.AppendTag(b, bigIntNegField, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	return b
+}
+
+func unmarshalBigInt(b []byte, x *big.Int) error {
+	var (
+		abs []byte
+		neg bool
+	)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == bigIntAbsField && typ == protowire.BytesType:
+			abs, n = protowire.ConsumeBytes(b)
+		case num == bigIntNegField && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			neg = protowire.DecodeBool(v)
+		default:
+			// 跳过未知字段
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	x.SetBytes(abs)
+	if neg {
+		x.Neg(x)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package protobuf
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/codec"
+	"github.com/chain5j/chain5j-pkg/types"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMessage(t *testing.T) {
+	msg, err := structpb.NewStruct(map[string]interface{}{
+		"name":  "test",
+		"value": 100,
+		"list":  []interface{}{"a", true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := codec.Get(codec.PROTOBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec structpb.Struct
+	if err := c.Decode(b, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&dec, msg) {
+		t.Fatalf("message mismatch: have %v, want %v", &dec, msg)
+	}
+
+	env, err := codec.EncodeEnvelope(codec.PROTOBUF, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env[0] != 0x03 || !bytes.Equal(env[1:], b) {
+		t.Fatalf("envelope mismatch: %x", env)
+	}
+}
+
+func TestCustomTypes(t *testing.T) {
+	addr := types.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+	hash := types.BytesToHash([]byte{0xaa, 0xbb})
+	bigNum, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	tests := []struct {
+		val interface{}
+		dec interface{}
+	}{
+		{val: []byte{0x01, 0x02, 0x03}, dec: new([]byte)},
+		{val: big.NewInt(0), dec: new(big.Int)},
+		{val: big.NewInt(100), dec: new(big.Int)},
+		{val: bigNum, dec: new(big.Int)},
+		{val: addr, dec: new(types.Address)},
+		{val: &addr, dec: new(types.Address)},
+		{val: hash, dec: new(types.Hash)},
+		{val: types.Hash{}, dec: new(types.Hash)},
+	}
+	for i, test := range tests {
+		b, err := Marshal(test.val)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode: %v", i, err)
+		}
+		if err := Unmarshal(b, test.dec); err != nil {
+			t.Fatalf("test %d: failed to decode: %v", i, err)
+		}
+		want := reflect.ValueOf(test.val)
+		if want.Kind() == reflect.Ptr {
+			want = want.Elem()
+		}
+		if have := reflect.ValueOf(test.dec).Elem(); !reflect.DeepEqual(have.Interface(), want.Interface()) {
+			t.Fatalf("test %d: value mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	// Byte slices and fixed length types are compatible with BytesValue
+	b, _ := Marshal(addr)
+	var w wrapperspb.BytesValue
+	if err := proto.Unmarshal(b, &w); err != nil || !bytes.Equal(w.Value, addr[:]) {
+		t.Fatalf("address is not a BytesValue: %x, %v", w.Value, err)
+	}
+	if err := Unmarshal(b, new(types.Hash)); err == nil {
+		t.Fatalf("address decoded as hash")
+	}
+	if _, err := Marshal(struct{}{}); err == nil {
+		t.Fatalf("unsupported type encoded")
+	}
+	if err := Unmarshal(b, new(string)); err == nil {
+		t.Fatalf("unsupported type decoded")
+	}
+}
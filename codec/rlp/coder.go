@@ -18,3 +18,8 @@ func (c *Codec) Encode(v interface{}) ([]byte, error) {
 func (c *Codec) Decode(data []byte, structPrt interface{}) error {
 	return DecodeBytes(data, structPrt)
 }
+
+// CodecID returns the envelope id of the RLP codec.
+func (c *Codec) CodecID() byte {
+	return 0x01
+}
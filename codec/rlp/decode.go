@@ -161,6 +161,8 @@ func makeDecoder(typ reflect.Type, tags rlpstruct.Tags) (dec decoder, err error)
 		return decodeBigIntNoPtr, nil
 	case kind == reflect.Ptr:
 		return makePtrDecoder(typ, tags)
+	case kind == reflect.Map && tags.Map:
+		return makeMapDecoder(typ)
 	case reflect.PtrTo(typ).Implements(decoderInterface):
 		return decodeDecoder, nil
 	case isUint(kind):
@@ -56,7 +56,11 @@ Boolean values are encoded as the unsigned integers zero (false) and one (true).
 
 An interface value encodes as the value contained in the interface.
 
-Floating point numbers, maps, channels and functions are not supported.
+Maps are only supported for struct fields with the "map" tag and for the Map type. They
+encode as an RLP list of [key, value] pairs, sorted by key, so that equal maps always have
+the same encoding. Map keys must be strings, unsigned integers or byte arrays.
+
+Floating point numbers, untagged maps, channels and functions are not supported.
 
 
 Decoding Rules
@@ -96,8 +100,13 @@ To decode into an interface value, one of these types is stored in the value:
 	  []interface{}, for RLP lists
 	  []byte, for RLP strings
 
+To decode into a map with the "map" tag or of the Map type, the input must be a list of
+[key, value] pairs with keys in strictly ascending order, otherwise ErrCanonMap is
+returned. The resulting map always holds exactly the decoded pairs.
+
 Non-empty interface types are not supported when decoding.
-Signed integers, floating point numbers, maps, channels and functions cannot be decoded into.
+Signed integers, floating point numbers, untagged maps, channels and functions cannot be
+decoded into.
 
 
 Struct Tags
@@ -157,5 +166,13 @@ list.
 The choice of null value can be made explicit with the "nilList" and "nilString" struct
 tags. Using these tags encodes/decodes a Go nil pointer value as the empty RLP value kind
 defined by the tag.
+
+The "map" tag applies to map-typed fields only and enables their encoding as a sorted list
+of [key, value] pairs. The Map type encodes the same way, for values that cannot carry
+struct tags.
+
+    type StructWithMapField struct {
+        Balances map[types.Address]uint64 `rlp:"map"`
+    }
 */
 package rlp
@@ -143,6 +143,8 @@ func makeWriter(typ reflect.Type, ts rlpstruct.Tags) (writer, error) {
 		return writeBigIntNoPtr, nil
 	case kind == reflect.Ptr:
 		return makePtrWriter(typ, ts)
+	case kind == reflect.Map && ts.Map:
+		return makeMapWriter(typ)
 	case reflect.PtrTo(typ).Implements(encoderInterface):
 		return makeEncoderWriter(typ), nil
 	case isUint(kind):
@@ -346,7 +348,7 @@ func makeStructWriter(typ reflect.Type) (writer, error) {
 		writer = func(val reflect.Value, w *encBuffer) error {
 			lastField := len(fields) - 1
 			for ; lastField >= firstOptionalField; lastField-- {
-				if !val.Field(fields[lastField].index).IsZero() {
+				if !isOmittedOptional(val.Field(fields[lastField].index)) {
 					break
 				}
 			}
@@ -363,6 +365,16 @@ func makeStructWriter(typ reflect.Type) (writer, error) {
 	return writer, nil
 }
 
+// isOmittedOptional reports whether a trailing optional field can be left out
+// of the encoding. Maps are left out when empty, nil or not, as the encoding
+// can't tell the two apart.
+func isOmittedOptional(v reflect.Value) bool {
+	if v.Kind() == reflect.Map {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
 func makePtrWriter(typ reflect.Type, ts rlpstruct.Tags) (writer, error) {
 	nilEncoding := byte(0xC0)
 	if typeNilKind(typ.Elem(), ts) == String {
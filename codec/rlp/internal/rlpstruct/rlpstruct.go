@@ -77,6 +77,9 @@ type Tags struct {
 	// only be set for the last field, which must be of slice type.
 	Tail bool
 
+	// rlp:"map" encodes a map field as a list of [key, value] pairs sorted by key.
+	Map bool
+
 	// rlp:"-" ignores fields.
 	Ignored bool
 }
@@ -183,6 +186,11 @@ func parseTag(field Field, lastPublic int) (Tags, error) {
 			if field.Type.Kind != reflect.Slice {
 				return ts, TagError{Field: name, Tag: t, Err: "field type is not slice"}
 			}
+		case "map":
+			ts.Map = true
+			if field.Type.Kind != reflect.Map {
+				return ts, TagError{Field: name, Tag: t, Err: "field type is not map"}
+			}
 		default:
 			return ts, TagError{Field: name, Tag: t, Err: "unknown tag"}
 		}
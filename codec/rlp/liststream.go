@@ -0,0 +1,140 @@
+// Package rlp
+//
+// @author: xwc1125
+package rlp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrListElemSize is returned when a list element exceeds ListLimits.MaxElemSize.
+	ErrListElemSize = errors.New("rlp: list element exceeds size limit")
+	// ErrListTooLong is returned when a list has more than ListLimits.MaxElems elements.
+	ErrListTooLong = errors.New("rlp: list exceeds element count limit")
+)
+
+// ListLimits configures the limits enforced by DecodeListStream. A zero value
+// disables the corresponding limit.
+type ListLimits struct {
+	InputLimit  uint64 // limit of the whole input, see NewStream
+	MaxElemSize uint64 // maximum content size of a single element
+	MaxElems    int    // maximum number of elements in the list
+}
+
+// ListElemError is returned by ListStream when an element of the list cannot
+// be decoded or violates the limits.
+type ListElemError struct {
+	Index int // index of the offending element
+	Err   error
+}
+
+func (e *ListElemError) Error() string {
+	return fmt.Sprintf("rlp: list element %d: %v", e.Index, e.Err)
+}
+
+func (e *ListElemError) Unwrap() error {
+	return e.Err
+}
+
+// ListStream decodes the elements of an RLP list one at a time, so that huge
+// lists never need to be held in memory as a whole. The size of each element
+// is checked against the limits before it is read, which makes ListStream
+// suitable for input from untrusted sources.
+//
+//	it := rlp.DecodeListStream[*Transaction](conn, rlp.ListLimits{MaxElemSize: 128 * 1024, MaxElems: 10000})
+//	for it.Next() {
+//		tx := it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ListStream[T any] struct {
+	s       *Stream
+	limits  ListLimits
+	started bool
+	done    bool
+	index   int
+	value   T
+	err     error
+}
+
+// DecodeListStream creates a ListStream reading a single RLP list from r.
+func DecodeListStream[T any](r io.Reader, limits ListLimits) *ListStream[T] {
+	return &ListStream[T]{
+		s:      NewStream(r, limits.InputLimit),
+		limits: limits,
+		index:  -1,
+	}
+}
+
+// Next decodes the next element of the list. It returns false when the end of
+// the list has been reached or an error occurred, see Err.
+func (it *ListStream[T]) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if _, err := it.s.List(); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	index := it.index + 1
+	_, size, err := it.s.Kind()
+	if err == EOL {
+		it.done = true
+		it.err = it.s.ListEnd()
+		return false
+	}
+	if err == nil {
+		if it.limits.MaxElems > 0 && index >= it.limits.MaxElems {
+			err = ErrListTooLong
+		} else if it.limits.MaxElemSize > 0 && size > it.limits.MaxElemSize {
+			err = ErrListElemSize
+		}
+	}
+	if err == nil {
+		var value T
+		if err = it.s.Decode(&value); err == nil {
+			it.index, it.value = index, value
+			return true
+		}
+	}
+	it.err = &ListElemError{Index: index, Err: err}
+	return false
+}
+
+// Value returns the element decoded by the last call to Next.
+func (it *ListStream[T]) Value() T {
+	return it.value
+}
+
+// Index returns the index of the element decoded by the last call to Next.
+func (it *ListStream[T]) Index() int {
+	return it.index
+}
+
+// Err returns the error that stopped the iteration, if any. Errors concerning
+// a single element are of type *ListElemError.
+func (it *ListStream[T]) Err() error {
+	return it.err
+}
+
+// DecodeListStreamFunc decodes a single RLP list from r and calls fn for each
+// element in order. Decoding stops at the first error, including errors
+// returned by fn, which are returned unchanged.
+func DecodeListStreamFunc[T any](r io.Reader, limits ListLimits, fn func(index int, value T) error) error {
+	it := DecodeListStream[T](r, limits)
+	for it.Next() {
+		if err := fn(it.Index(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,116 @@
+package rlp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+)
+
+type listStreamElem struct {
+	A uint64
+	B []byte
+}
+
+func TestListStream(t *testing.T) {
+	input := []listStreamElem{{1, []byte{}}, {2, []byte{1, 2, 3}}, {3, bytes.Repeat([]byte{0xff}, 100)}}
+	enc, err := EncodeToBytes(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		out   []listStreamElem
+		index []int
+	)
+	// Wrap the reader to hide its length, as with a network connection.
+	it := DecodeListStream[listStreamElem](struct{ io.Reader }{bytes.NewReader(enc)}, ListLimits{})
+	for it.Next() {
+		out = append(out, it.Value())
+		index = append(index, it.Index())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, input) {
+		t.Errorf("decoded %v, want %v", out, input)
+	}
+	if !reflect.DeepEqual(index, []int{0, 1, 2}) {
+		t.Errorf("indexes %v, want [0 1 2]", index)
+	}
+	if it.Next() {
+		t.Error("Next returned true after end of list")
+	}
+}
+
+func TestListStreamErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits ListLimits
+		decode int   // number of elements decoded before the error
+		index  int   // index in ListElemError, -1 if not an element error
+		err    error // underlying error
+	}{
+		{input: "C0", decode: 0, index: -1},
+		{input: "C3010203", limits: ListLimits{MaxElems: 3}, decode: 3, index: -1},
+		{input: "C3010203", limits: ListLimits{MaxElems: 2}, decode: 2, index: 2, err: ErrListTooLong},
+		{input: "C6820102830102", limits: ListLimits{MaxElemSize: 2}, decode: 1, index: 1, err: ErrListElemSize},
+		{input: "C3B80102", decode: 0, index: 0, err: ErrCanonSize},
+		{input: "C3010203", limits: ListLimits{InputLimit: 3}, decode: 0, index: -1, err: ErrValueTooLarge},
+		{input: "C20182FFFF", decode: 1, index: 1, err: ErrElemTooLarge},
+		{input: "C30102", decode: 2, index: 2, err: io.ErrUnexpectedEOF},
+		{input: "8101", decode: 0, index: -1, err: ErrExpectedList},
+	}
+	for i, test := range tests {
+		var decoded int
+		err := DecodeListStreamFunc(struct{ io.Reader }{bytes.NewReader(hexutil.MustDecode("0x" + test.input))}, test.limits, func(index int, v uint) error {
+			if index != decoded {
+				t.Errorf("test %d: got index %d, want %d", i, index, decoded)
+			}
+			decoded++
+			return nil
+		})
+		if decoded != test.decode {
+			t.Errorf("test %d: decoded %d elements, want %d", i, decoded, test.decode)
+		}
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("test %d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("test %d: got error %v, want %v", i, err, test.err)
+		}
+		var elemErr *ListElemError
+		if errors.As(err, &elemErr) {
+			if elemErr.Index != test.index {
+				t.Errorf("test %d: got error index %d, want %d", i, elemErr.Index, test.index)
+			}
+		} else if test.index != -1 {
+			t.Errorf("test %d: expected ListElemError, got %v", i, err)
+		}
+	}
+}
+
+func TestListStreamFuncError(t *testing.T) {
+	stop := errors.New("stop")
+	enc, _ := EncodeToBytes([]uint{1, 2, 3})
+	var decoded []uint
+	err := DecodeListStreamFunc(bytes.NewReader(enc), ListLimits{}, func(index int, v uint) error {
+		decoded = append(decoded, v)
+		if index == 1 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("got error %v, want %v", err, stop)
+	}
+	if !reflect.DeepEqual(decoded, []uint{1, 2}) {
+		t.Errorf("decoded %v, want [1 2]", decoded)
+	}
+}
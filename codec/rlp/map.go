@@ -0,0 +1,205 @@
+// Package rlp
+//
+// @author: xwc1125
+package rlp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp/internal/rlpstruct"
+)
+
+// ErrCanonMap is returned when decoding a map whose keys are not in strictly
+// ascending order, which would allow multiple encodings of the same map.
+var ErrCanonMap = errors.New("rlp: non-canonical map key order")
+
+// Map is a map type encoding as an RLP list of [key, value] pairs sorted by key,
+// the same as map fields with the "map" struct tag. It can be used wherever the
+// struct tag is not available, e.g. for top-level values or slice elements.
+//
+// The key type must be a string, an unsigned integer or a byte array type.
+type Map[K comparable, V any] map[K]V
+
+// EncodeRLP implements Encoder.
+func (m Map[K, V]) EncodeRLP(w io.Writer) error {
+	writer, err := cachedMapWriter(reflect.TypeOf(m))
+	if err != nil {
+		return err
+	}
+	if buf := encBufferFromWriter(w); buf != nil {
+		return writer(reflect.ValueOf(m), buf)
+	}
+	buf := getEncBuffer()
+	defer encBufferPool.Put(buf)
+	if err := writer(reflect.ValueOf(m), buf); err != nil {
+		return err
+	}
+	return buf.writeTo(w)
+}
+
+// DecodeRLP implements Decoder.
+func (m *Map[K, V]) DecodeRLP(s *Stream) error {
+	decoder, err := cachedMapDecoder(reflect.TypeOf(*m))
+	if err != nil {
+		return err
+	}
+	return decoder(s, reflect.ValueOf(m).Elem())
+}
+
+// mapTags are the struct tags selecting the map encoding of a type.
+var mapTags = rlpstruct.Tags{Map: true}
+
+func cachedMapWriter(typ reflect.Type) (writer, error) {
+	info := theTC.infoWithTags(typ, mapTags)
+	return info.writer, info.writerErr
+}
+
+func cachedMapDecoder(typ reflect.Type) (decoder, error) {
+	info := theTC.infoWithTags(typ, mapTags)
+	return info.decoder, info.decoderErr
+}
+
+// mapSortKey returns the function converting a map key into a string ordered
+// the same way as the keys: strings as they are, unsigned integers in big endian
+// form and byte arrays as their content.
+func mapSortKey(typ reflect.Type) (func(reflect.Value) string, error) {
+	switch kind := typ.Kind(); {
+	case kind == reflect.String:
+		return func(key reflect.Value) string { return key.String() }, nil
+	case isUint(kind):
+		return func(key reflect.Value) string {
+			var enc [8]byte
+			binary.BigEndian.PutUint64(enc[:], key.Uint())
+			return string(enc[:])
+		}, nil
+	case kind == reflect.Array && isByte(typ.Elem()):
+		return func(key reflect.Value) string {
+			enc := make([]byte, key.Len())
+			reflect.Copy(reflect.ValueOf(enc), key)
+			return string(enc)
+		}, nil
+	default:
+		return nil, fmt.Errorf("rlp: map key type %v is not supported", typ)
+	}
+}
+
+func makeMapWriter(typ reflect.Type) (writer, error) {
+	sortKey, err := mapSortKey(typ.Key())
+	if err != nil {
+		return nil, err
+	}
+	kinfo := theTC.infoWhileGenerating(typ.Key(), rlpstruct.Tags{})
+	if kinfo.writerErr != nil {
+		return nil, kinfo.writerErr
+	}
+	vinfo := theTC.infoWhileGenerating(typ.Elem(), rlpstruct.Tags{})
+	if vinfo.writerErr != nil {
+		return nil, vinfo.writerErr
+	}
+	writer := func(val reflect.Value, w *encBuffer) error {
+		if val.Len() == 0 {
+			w.str = append(w.str, 0xC0)
+			return nil
+		}
+		keys := val.MapKeys()
+		order := make([]string, len(keys))
+		for i, key := range keys {
+			order[i] = sortKey(key)
+		}
+		sort.Sort(mapKeySorter{keys, order})
+
+		listOffset := w.list()
+		for _, key := range keys {
+			pairOffset := w.list()
+			if err := kinfo.writer(key, w); err != nil {
+				return err
+			}
+			if err := vinfo.writer(val.MapIndex(key), w); err != nil {
+				return err
+			}
+			w.listEnd(pairOffset)
+		}
+		w.listEnd(listOffset)
+		return nil
+	}
+	return writer, nil
+}
+
+// mapKeySorter sorts map keys by their precomputed sort keys.
+type mapKeySorter struct {
+	keys  []reflect.Value
+	order []string
+}
+
+func (s mapKeySorter) Len() int           { return len(s.keys) }
+func (s mapKeySorter) Less(i, j int) bool { return s.order[i] < s.order[j] }
+func (s mapKeySorter) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.order[i], s.order[j] = s.order[j], s.order[i]
+}
+
+func makeMapDecoder(typ reflect.Type) (decoder, error) {
+	sortKey, err := mapSortKey(typ.Key())
+	if err != nil {
+		return nil, err
+	}
+	kinfo := theTC.infoWhileGenerating(typ.Key(), rlpstruct.Tags{})
+	if kinfo.decoderErr != nil {
+		return nil, kinfo.decoderErr
+	}
+	vinfo := theTC.infoWhileGenerating(typ.Elem(), rlpstruct.Tags{})
+	if vinfo.decoderErr != nil {
+		return nil, vinfo.decoderErr
+	}
+	dec := func(s *Stream, val reflect.Value) error {
+		if _, err := s.List(); err != nil {
+			return wrapStreamError(err, val.Type())
+		}
+		m := reflect.MakeMap(val.Type())
+		for i, prev := 0, ""; ; i++ {
+			key := reflect.New(typ.Key()).Elem()
+			value := reflect.New(typ.Elem()).Elem()
+			if err := decodeMapPair(s, typ, key, value, kinfo.decoder, vinfo.decoder); err == EOL {
+				break
+			} else if err != nil {
+				return addErrorContext(err, fmt.Sprint("[", i, "]"))
+			}
+			order := sortKey(key)
+			if i > 0 && order <= prev {
+				return ErrCanonMap
+			}
+			m.SetMapIndex(key, value)
+			prev = order
+		}
+		val.Set(m)
+		return s.ListEnd()
+	}
+	return dec, nil
+}
+
+// decodeMapPair decodes a [key, value] pair of an encoded map, returning EOL if
+// the end of the map was reached.
+func decodeMapPair(s *Stream, typ reflect.Type, key, value reflect.Value, keydec, valdec decoder) error {
+	if _, err := s.List(); err != nil {
+		if err == EOL {
+			return err
+		}
+		return wrapStreamError(err, typ)
+	}
+	if err := keydec(s, key); err == EOL {
+		return &decodeError{msg: "too few elements", typ: typ}
+	} else if err != nil {
+		return addErrorContext(err, ".key")
+	}
+	if err := valdec(s, value); err == EOL {
+		return &decodeError{msg: "too few elements", typ: typ}
+	} else if err != nil {
+		return addErrorContext(err, ".value")
+	}
+	return wrapStreamError(s.ListEnd(), typ)
+}
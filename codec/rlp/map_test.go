@@ -0,0 +1,154 @@
+package rlp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type taggedMapStruct struct {
+	M map[string]uint64 `rlp:"map"`
+}
+
+type optionalMapStruct struct {
+	A uint
+	M map[string]uint64 `rlp:"map,optional"`
+}
+
+type untaggedMapStruct struct {
+	M map[string]uint64
+}
+
+type invalidMapTagStruct struct {
+	M []string `rlp:"map"`
+}
+
+func TestEncodeMap(t *testing.T) {
+	tests := []struct {
+		val    interface{}
+		output string
+	}{
+		{val: taggedMapStruct{}, output: "C1C0"},
+		{val: taggedMapStruct{M: map[string]uint64{}}, output: "C1C0"},
+		{val: taggedMapStruct{M: map[string]uint64{"b": 2, "a": 1}}, output: "C7C6C26101C26202"},
+		{val: optionalMapStruct{A: 1}, output: "C101"},
+		{val: optionalMapStruct{A: 1, M: map[string]uint64{}}, output: "C101"},
+		{val: optionalMapStruct{A: 1, M: map[string]uint64{"a": 1}}, output: "C501C3C26101"},
+		{val: Map[string, uint64](nil), output: "C0"},
+		{val: Map[uint64, string]{256: "x", 2: "y", 1: "z"}, output: "CBC2017AC20279C482010078"},
+		{val: &Map[[2]byte, uint]{{0x01, 0x00}: 2, {0x00, 0xff}: 1}, output: "CAC48200FF01C482010002"},
+		{val: []Map[string, string]{{"k": "v"}, nil}, output: "C5C3C26B76C0"},
+	}
+	for i, test := range tests {
+		output, err := EncodeToBytes(test.val)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(output, unhex(test.output)) {
+			t.Errorf("test %d: output mismatch: have %X, want %s", i, output, test.output)
+		}
+	}
+}
+
+func TestEncodeMapErrors(t *testing.T) {
+	tests := []struct {
+		val   interface{}
+		error string
+	}{
+		{val: map[string]uint64{}, error: "rlp: type map[string]uint64 is not RLP-serializable"},
+		{val: untaggedMapStruct{}, error: "rlp: type map[string]uint64 is not RLP-serializable (struct field rlp.untaggedMapStruct.M)"},
+		{val: invalidMapTagStruct{}, error: `rlp: invalid struct tag "map" for rlp.invalidMapTagStruct.M (field type is not map)`},
+		{val: Map[int, uint]{1: 1}, error: "rlp: map key type int is not supported"},
+		{val: Map[string, int]{"a": 1}, error: "rlp: type int is not RLP-serializable"},
+	}
+	for i, test := range tests {
+		_, err := EncodeToBytes(test.val)
+		if err == nil || err.Error() != test.error {
+			t.Errorf("test %d: error mismatch: have %v, want %s", i, err, test.error)
+		}
+	}
+}
+
+func TestDecodeMap(t *testing.T) {
+	tests := []struct {
+		input string
+		ptr   interface{}
+		value interface{}
+		error string
+	}{
+		{input: "C1C0", ptr: new(taggedMapStruct), value: taggedMapStruct{M: map[string]uint64{}}},
+		{input: "C7C6C26101C26202", ptr: new(taggedMapStruct), value: taggedMapStruct{M: map[string]uint64{"a": 1, "b": 2}}},
+		{input: "C101", ptr: new(optionalMapStruct), value: optionalMapStruct{A: 1}},
+		{input: "CBC2017AC20279C482010078", ptr: new(Map[uint64, string]), value: Map[uint64, string]{1: "z", 2: "y", 256: "x"}},
+		{input: "CAC48200FF01C482010002", ptr: new(Map[[2]byte, uint]), value: Map[[2]byte, uint]{{0x00, 0xff}: 1, {0x01, 0x00}: 2}},
+
+		// canonical order
+		{input: "C7C6C26202C26101", ptr: new(taggedMapStruct), error: "rlp: non-canonical map key order"},
+		{input: "C7C6C26101C26101", ptr: new(taggedMapStruct), error: "rlp: non-canonical map key order"},
+		{input: "C8C482010078C2017A", ptr: new(Map[uint64, string]), error: "rlp: non-canonical map key order"},
+
+		// malformed pairs
+		{input: "C2C161", ptr: new(Map[string, uint]), error: "rlp: too few elements for rlp.Map[string,uint], decoding into (rlp.Map[string,uint])[0]"},
+		{input: "C4C3610101", ptr: new(Map[string, uint]), error: "rlp: input list has too many elements for rlp.Map[string,uint], decoding into (rlp.Map[string,uint])[0]"},
+		{input: "C26101", ptr: new(Map[string, uint]), error: "rlp: expected input list for rlp.Map[string,uint], decoding into (rlp.Map[string,uint])[0]"},
+		{input: "C3C26180", ptr: new(Map[string, []uint]), error: "rlp: expected input list for []uint, decoding into (rlp.Map[string,[]uint])[0].value"},
+		{input: "61", ptr: new(Map[string, uint]), error: "rlp: expected input list for rlp.Map[string,uint]"},
+	}
+	for i, test := range tests {
+		err := DecodeBytes(unhex(test.input), test.ptr)
+		if test.error != "" {
+			if err == nil || err.Error() != test.error {
+				t.Errorf("test %d: error mismatch: have %v, want %s", i, err, test.error)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if have := reflect.ValueOf(test.ptr).Elem().Interface(); !reflect.DeepEqual(have, test.value) {
+			t.Errorf("test %d: value mismatch: have %#v, want %#v", i, have, test.value)
+		}
+	}
+	// Non-canonical order is reported as such
+	err := DecodeBytes(unhex("C7C6C26202C26101"), new(taggedMapStruct))
+	if !errors.Is(err, ErrCanonMap) {
+		t.Errorf("non-canonical map error mismatch: have %v, want %v", err, ErrCanonMap)
+	}
+}
+
+func TestMapRoundtrip(t *testing.T) {
+	type nested struct {
+		Name  string
+		Attrs map[string]Map[uint16, []byte] `rlp:"map"`
+	}
+	val := nested{
+		Name: "test",
+		Attrs: map[string]Map[uint16, []byte]{
+			"one":   {1: []byte{0x01}, 1000: []byte{0x02, 0x03}},
+			"two":   {},
+			"three": {7: nil},
+		},
+	}
+	enc, err := EncodeToBytes(&val)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	// Encoding must be independent of the map iteration order
+	for i := 0; i < 10; i++ {
+		again, _ := EncodeToBytes(&val)
+		if !bytes.Equal(enc, again) {
+			t.Fatalf("non-deterministic encoding: %x != %x", again, enc)
+		}
+	}
+	var dec nested
+	if err := DecodeBytes(enc, &dec); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	val.Attrs["three"][7] = []byte{} // nil byte slices decode as empty
+	if !reflect.DeepEqual(dec, val) {
+		t.Fatalf("roundtrip mismatch: have %#v, want %#v", dec, val)
+	}
+}
@@ -28,7 +28,9 @@ import (
 
 // buildContext keeps the data needed for make*Op.
 type buildContext struct {
-	topType *types.Named // the type we're creating methods for
+	pkg      *types.Package           // the package we're creating methods in
+	genTypes []*types.Named           // the types we're creating methods for
+	genSet   map[*types.TypeName]bool // set of genTypes
 
 	encoderIface *types.Interface
 	decoderIface *types.Interface
@@ -42,6 +44,7 @@ func newBuildContext(packageRLP *types.Package) *buildContext {
 	dec := packageRLP.Scope().Lookup("Decoder").Type().Underlying()
 	rawv := packageRLP.Scope().Lookup("RawValue").Type()
 	return &buildContext{
+		genSet:            make(map[*types.TypeName]bool),
 		typeToStructCache: make(map[types.Type]*rlpstruct.Type),
 		encoderIface:      enc.(*types.Interface),
 		decoderIface:      dec.(*types.Interface),
@@ -57,6 +60,25 @@ func (bctx *buildContext) isDecoder(typ types.Type) bool {
 	return types.Implements(typ, bctx.decoderIface)
 }
 
+// addType queues 'typ' for method generation, unless it is already queued.
+func (bctx *buildContext) addType(typ *types.Named) {
+	if !bctx.genSet[typ.Obj()] {
+		bctx.genSet[typ.Obj()] = true
+		bctx.genTypes = append(bctx.genTypes, typ)
+	}
+}
+
+// isGenerated checks whether methods can be generated for the named struct type
+// 'typ', i.e. whether it is a non-generic struct type declared in the package
+// we're generating.
+func (bctx *buildContext) isGenerated(typ *types.Named) bool {
+	if typ.Obj().Pkg() != bctx.pkg || typ.TypeParams().Len() > 0 || typ.TypeArgs().Len() > 0 {
+		return false
+	}
+	_, ok := typ.Underlying().(*types.Struct)
+	return ok
+}
+
 // typeToStructType converts typ to rlpstruct.Type.
 func (bctx *buildContext) typeToStructType(typ types.Type) *rlpstruct.Type {
 	if prev := bctx.typeToStructCache[typ]; prev != nil {
@@ -181,10 +203,11 @@ func (*buildContext) makeBasicOp(typ *types.Basic) (op, error) {
 		op.decResultType = typ
 		op.decUseBitSize = true
 	case kind == types.String:
+		// Stream has no string accessor, strings are decoded as bytes.
 		op.writeMethod = "WriteString"
 		op.writeArgType = types.Typ[types.String]
-		op.decMethod = "String"
-		op.decResultType = types.Typ[types.String]
+		op.decMethod = "Bytes"
+		op.decResultType = types.NewSlice(types.Typ[types.Uint8])
 	default:
 		return nil, fmt.Errorf("unhandled basic type: %v", typ)
 	}
@@ -353,10 +376,31 @@ func (op encoderDecoderOp) genDecode(ctx *genContext) (string, string) {
 	return resultV, b.String()
 }
 
+// namedEncoderOp handles non-pointer named types whose pointer type implements
+// rlp.Encoder and rlp.Decoder, including the types we're generating methods for.
+// The methods are called on the (addressable) value directly.
+type namedEncoderOp struct {
+	typ *types.Named
+}
+
+func (op namedEncoderOp) genWrite(ctx *genContext, v string) string {
+	return fmt.Sprintf("if err := %s.EncodeRLP(w); err != nil { return err }\n", v)
+}
+
+func (op namedEncoderOp) genDecode(ctx *genContext) (string, string) {
+	var resultV = ctx.temp()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "var %s %s\n", resultV, types.TypeString(op.typ, ctx.qualify))
+	fmt.Fprintf(&b, "if err := %s.DecodeRLP(dec); err != nil { return err }\n", resultV)
+	return resultV, b.String()
+}
+
 // ptrOp handles pointer types.
 type ptrOp struct {
 	elemTyp  types.Type
 	elem     op
+	elemPtr  bool // if true, elem handles the pointer itself (e.g. rlp.Encoder)
 	nilOK    bool
 	nilValue rlpstruct.NilKind
 }
@@ -389,7 +433,8 @@ func (op ptrOp) genWrite(ctx *genContext, v string) string {
 	var vv string
 	_, isStruct := op.elem.(structOp)
 	_, isByteArray := op.elem.(byteArrayOp)
-	if isStruct || isByteArray {
+	_, isNamedEncoder := op.elem.(namedEncoderOp)
+	if isStruct || isByteArray || isNamedEncoder || op.elemPtr {
 		vv = v
 	} else {
 		vv = fmt.Sprintf("(*%s)", v)
@@ -406,14 +451,25 @@ func (op ptrOp) genWrite(ctx *genContext, v string) string {
 
 func (op ptrOp) genDecode(ctx *genContext) (string, string) {
 	result, code := op.elem.genDecode(ctx)
+	if !op.elemPtr {
+		// The decoded value can be assignable to the element type without being
+		// of that type, e.g. []byte for rlp.RawValue. Convert it, so that its
+		// address has the type of the pointer.
+		if bop, ok := op.elem.(basicOp); ok && !bop.decodeNeedsConversion() && !types.Identical(bop.decResultType, op.elemTyp) {
+			conv := ctx.temp()
+			code += fmt.Sprintf("%s := %s(%s)\n", conv, types.TypeString(op.elemTyp, ctx.qualify), result)
+			result = conv
+		}
+		result = "&" + result
+	}
 	if !op.nilOK {
 		// If nil pointers are not allowed, we can just decode the element.
-		return "&" + result, code
+		return result, code
 	}
 
 	// nil is allowed, so check the kind and size first.
 	// If size is zero and kind matches the nilKind of the type,
-	// the value decodes as a nil pointer.
+	// the empty value is skipped and decodes as a nil pointer.
 	var (
 		resultV  = ctx.temp()
 		kindV    = ctx.temp()
@@ -431,7 +487,9 @@ func (op ptrOp) genDecode(ctx *genContext) (string, string) {
 	fmt.Fprintf(&b, "  return err\n")
 	fmt.Fprintf(&b, "} else if %s != 0 || %s != %s {\n", sizeV, kindV, wantKind)
 	fmt.Fprint(&b, code)
-	fmt.Fprintf(&b, "  %s = &%s\n", resultV, result)
+	fmt.Fprintf(&b, "  %s = %s\n", resultV, result)
+	fmt.Fprintf(&b, "} else if _, err := dec.Raw(); err != nil {\n")
+	fmt.Fprintf(&b, "  return err // skip the empty value\n")
 	fmt.Fprintf(&b, "}\n")
 	return resultV, b.String()
 }
@@ -473,11 +531,7 @@ func (bctx *buildContext) makeStructOp(named *types.Named, typ *types.Struct) (o
 	// Create field ops.
 	var op = structOp{named: named, typ: typ}
 	for i, field := range fields {
-		// Advanced struct tags are not supported yet.
 		tag := tags[i]
-		if err := checkUnsupportedTags(field.Name, tag); err != nil {
-			return nil, err
-		}
 		typ := typ.Field(field.Index).Type()
 		elem, err := bctx.makeOp(nil, typ, tags[i])
 		if err != nil {
@@ -493,13 +547,6 @@ func (bctx *buildContext) makeStructOp(named *types.Named, typ *types.Struct) (o
 	return op, nil
 }
 
-func checkUnsupportedTags(field string, tag rlpstruct.Tags) error {
-	if tag.Tail {
-		return fmt.Errorf(`field %s has unsupported struct tag "tail"`, field)
-	}
-	return nil
-}
-
 func (op structOp) genWrite(ctx *genContext, v string) string {
 	var b bytes.Buffer
 	var listMarker = ctx.temp()
@@ -522,7 +569,7 @@ func (op structOp) writeOptionalFields(b *bytes.Buffer, ctx *genContext, v strin
 	for i, field := range op.optionalFields {
 		selector := v + "." + field.name
 		zeroV[i] = ctx.temp()
-		fmt.Fprintf(b, "%s := %s\n", zeroV[i], nonZeroCheck(selector, field.typ, ctx.qualify))
+		fmt.Fprintf(b, "%s := %s\n", zeroV[i], nonZeroCheck(ctx, selector, field.typ))
 	}
 	// Now write the fields.
 	for i, field := range op.optionalFields {
@@ -588,14 +635,15 @@ func (op structOp) decodeOptionalFields(b *bytes.Buffer, ctx *genContext, result
 type sliceOp struct {
 	typ    *types.Slice
 	elemOp op
+	tail   bool // if true, elements are part of the enclosing struct list
 }
 
-func (bctx *buildContext) makeSliceOp(typ *types.Slice) (op, error) {
+func (bctx *buildContext) makeSliceOp(typ *types.Slice, tags rlpstruct.Tags) (op, error) {
 	elemOp, err := bctx.makeOp(nil, typ.Elem(), rlpstruct.Tags{})
 	if err != nil {
 		return nil, err
 	}
-	return sliceOp{typ: typ, elemOp: elemOp}, nil
+	return sliceOp{typ: typ, elemOp: elemOp, tail: tags.Tail}, nil
 }
 
 func (op sliceOp) genWrite(ctx *genContext, v string) string {
@@ -606,11 +654,15 @@ func (op sliceOp) genWrite(ctx *genContext, v string) string {
 	)
 
 	var b bytes.Buffer
-	fmt.Fprintf(&b, "%s := w.List()\n", listMarker)
+	if !op.tail {
+		fmt.Fprintf(&b, "%s := w.List()\n", listMarker)
+	}
 	fmt.Fprintf(&b, "for _, %s := range %s {\n", iterElemV, v)
 	fmt.Fprint(&b, elemCode)
 	fmt.Fprintf(&b, "}\n")
-	fmt.Fprintf(&b, "w.ListEnd(%s)\n", listMarker)
+	if !op.tail {
+		fmt.Fprintf(&b, "w.ListEnd(%s)\n", listMarker)
+	}
 	return b.String()
 }
 
@@ -620,15 +672,131 @@ func (op sliceOp) genDecode(ctx *genContext) (string, string) {
 
 	var b bytes.Buffer
 	fmt.Fprintf(&b, "var %s %s\n", sliceV, types.TypeString(op.typ, ctx.qualify))
-	fmt.Fprintf(&b, "if _, err := dec.List(); err != nil { return err }\n")
+	if !op.tail {
+		// Tail elements are decoded from the list of the enclosing struct.
+		fmt.Fprintf(&b, "if _, err := dec.List(); err != nil { return err }\n")
+	}
 	fmt.Fprintf(&b, "for dec.MoreDataInList() {\n")
 	fmt.Fprintf(&b, "  %s", elemCode)
 	fmt.Fprintf(&b, "  %s = append(%s, %s)\n", sliceV, sliceV, elemResult)
 	fmt.Fprintf(&b, "}\n")
-	fmt.Fprintf(&b, "if err := dec.ListEnd(); err != nil { return err }\n")
+	if !op.tail {
+		fmt.Fprintf(&b, "if err := dec.ListEnd(); err != nil { return err }\n")
+	}
 	return sliceV, b.String()
 }
 
+// mapOp handles map types with the "map" struct tag and rlp.Map.
+type mapOp struct {
+	typ       types.Type // map type, named if applicable
+	keyTyp    types.Type
+	keyOp     op
+	valueOp   op
+	byteArray bool // whether the keys are byte arrays
+}
+
+func (bctx *buildContext) makeMapOp(name *types.Named, typ *types.Map) (op, error) {
+	op := mapOp{typ: typ, keyTyp: typ.Key()}
+	if name != nil {
+		op.typ = name
+	}
+	switch key := resolveUnderlying(typ.Key()).(type) {
+	case *types.Basic:
+		if k := key.Kind(); k != types.String && (k < types.Uint8 || k > types.Uint64) {
+			return nil, fmt.Errorf("unsupported map key type: %v", typ.Key())
+		}
+	case *types.Array:
+		if !isByte(key.Elem()) || bctx.isEncoder(key.Elem()) {
+			return nil, fmt.Errorf("unsupported map key type: %v", typ.Key())
+		}
+		op.byteArray = true
+	default:
+		return nil, fmt.Errorf("unsupported map key type: %v", typ.Key())
+	}
+	var err error
+	if op.keyOp, err = bctx.makeOp(nil, typ.Key(), rlpstruct.Tags{}); err != nil {
+		return nil, err
+	}
+	if op.valueOp, err = bctx.makeOp(nil, typ.Elem(), rlpstruct.Tags{}); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// isRLPMap checks whether 'typ' is an instance of rlp.Map.
+func (bctx *buildContext) isRLPMap(typ *types.Named) bool {
+	if typ == nil {
+		return false
+	}
+	obj := typ.Origin().Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == pathOfPackageRLP && obj.Name() == "Map"
+}
+
+// keyLess returns the expression that checks whether map key 'a' sorts before 'b'.
+func (op mapOp) keyLess(ctx *genContext, a, b string) string {
+	if op.byteArray {
+		ctx.addImport("bytes")
+		return fmt.Sprintf("bytes.Compare(%s[:], %s[:]) < 0", a, b)
+	}
+	return fmt.Sprintf("%s < %s", a, b)
+}
+
+func (op mapOp) genWrite(ctx *genContext, v string) string {
+	var (
+		listMarker = ctx.temp() // holds return value of w.List()
+		keysV      = ctx.temp() // sorted keys of the map
+		iterKeyV   = ctx.temp() // iteration variable
+		pairMarker = ctx.temp() // holds return value of w.List() for the pair
+		valueV     = ctx.temp() // value of the current key
+		keyType    = types.TypeString(op.keyTyp, ctx.qualify)
+	)
+	ctx.addImport("sort")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s := w.List()\n", listMarker)
+	fmt.Fprintf(&b, "%s := make([]%s, 0, len(%s))\n", keysV, keyType, v)
+	fmt.Fprintf(&b, "for %s := range %s {\n", iterKeyV, v)
+	fmt.Fprintf(&b, "  %s = append(%s, %s)\n", keysV, keysV, iterKeyV)
+	fmt.Fprintf(&b, "}\n")
+	fmt.Fprintf(&b, "sort.Slice(%s, func(i, j int) bool { return %s })\n", keysV, op.keyLess(ctx, keysV+"[i]", keysV+"[j]"))
+	fmt.Fprintf(&b, "for _, %s := range %s {\n", iterKeyV, keysV)
+	fmt.Fprintf(&b, "  %s := w.List()\n", pairMarker)
+	fmt.Fprint(&b, op.keyOp.genWrite(ctx, iterKeyV))
+	fmt.Fprintf(&b, "  %s := %s[%s]\n", valueV, v, iterKeyV)
+	fmt.Fprint(&b, op.valueOp.genWrite(ctx, valueV))
+	fmt.Fprintf(&b, "  w.ListEnd(%s)\n", pairMarker)
+	fmt.Fprintf(&b, "}\n")
+	fmt.Fprintf(&b, "w.ListEnd(%s)\n", listMarker)
+	return b.String()
+}
+
+func (op mapOp) genDecode(ctx *genContext) (string, string) {
+	var (
+		mapV   = ctx.temp() // holds the output map
+		prevV  = ctx.temp() // previous key, to check the key order
+		indexV = ctx.temp() // index of the current pair
+	)
+	keyResult, keyCode := op.keyOp.genDecode(ctx)
+	valueResult, valueCode := op.valueOp.genDecode(ctx)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "var %s %s\n", mapV, types.TypeString(op.typ, ctx.qualify))
+	fmt.Fprintf(&b, "if _, err := dec.List(); err != nil { return err }\n")
+	fmt.Fprintf(&b, "%s = make(%s)\n", mapV, types.TypeString(op.typ, ctx.qualify))
+	fmt.Fprintf(&b, "var %s %s\n", prevV, types.TypeString(op.keyTyp, ctx.qualify))
+	fmt.Fprintf(&b, "for %s := 0; dec.MoreDataInList(); %s++ {\n", indexV, indexV)
+	fmt.Fprintf(&b, "  if _, err := dec.List(); err != nil { return err }\n")
+	fmt.Fprint(&b, keyCode)
+	fmt.Fprint(&b, valueCode)
+	fmt.Fprintf(&b, "  if err := dec.ListEnd(); err != nil { return err }\n")
+	fmt.Fprintf(&b, "  if %s > 0 && !(%s) { return rlp.ErrCanonMap }\n", indexV, op.keyLess(ctx, prevV, keyResult))
+	fmt.Fprintf(&b, "  %s[%s] = %s\n", mapV, keyResult, valueResult)
+	fmt.Fprintf(&b, "  %s = %s\n", prevV, keyResult)
+	fmt.Fprintf(&b, "}\n")
+	fmt.Fprintf(&b, "if err := dec.ListEnd(); err != nil { return err }\n")
+	return mapV, b.String()
+}
+
 func (bctx *buildContext) makeOp(name *types.Named, typ types.Type, tags rlpstruct.Tags) (op, error) {
 	switch typ := typ.(type) {
 	case *types.Named:
@@ -641,6 +809,16 @@ func (bctx *buildContext) makeOp(name *types.Named, typ types.Type, tags rlpstru
 		if bctx.isDecoder(typ) {
 			return nil, fmt.Errorf("type %v implements rlp.Decoder with non-pointer receiver", typ)
 		}
+		// Types with Encoder/Decoder methods and the types we're generating
+		// methods for are handled by calling the methods.
+		ptr := types.NewPointer(typ)
+		if !bctx.isRLPMap(typ) && bctx.isEncoder(ptr) && bctx.isDecoder(ptr) {
+			return namedEncoderOp{typ}, nil
+		}
+		if bctx.isGenerated(typ) {
+			bctx.addType(typ)
+			return namedEncoderOp{typ}, nil
+		}
 		// TODO: same check for encoder?
 		return bctx.makeOp(typ, typ.Underlying(), tags)
 	case *types.Pointer:
@@ -650,6 +828,10 @@ func (bctx *buildContext) makeOp(name *types.Named, typ types.Type, tags rlpstru
 		// Encoder/Decoder interfaces.
 		if bctx.isEncoder(typ) {
 			if bctx.isDecoder(typ) {
+				if tags.NilOK {
+					// Let ptrOp handle nil, the methods handle the rest.
+					return ptrOp{elemTyp: typ.Elem(), elem: encoderDecoderOp{typ}, elemPtr: true, nilOK: true, nilValue: tags.NilKind}, nil
+				}
 				return encoderDecoderOp{typ}, nil
 			}
 			return nil, fmt.Errorf("type %v implements rlp.Encoder but not rlp.Decoder", typ)
@@ -668,13 +850,18 @@ func (bctx *buildContext) makeOp(name *types.Named, typ types.Type, tags rlpstru
 		if isByte(etyp) && !bctx.isEncoder(etyp) {
 			return bctx.makeByteSliceOp(typ), nil
 		}
-		return bctx.makeSliceOp(typ)
+		return bctx.makeSliceOp(typ, tags)
 	case *types.Array:
 		etyp := typ.Elem()
 		if isByte(etyp) && !bctx.isEncoder(etyp) {
 			return bctx.makeByteArrayOp(name, typ), nil
 		}
 		return nil, fmt.Errorf("unhandled array type: %v", typ)
+	case *types.Map:
+		if tags.Map || bctx.isRLPMap(name) {
+			return bctx.makeMapOp(name, typ)
+		}
+		return nil, fmt.Errorf("unhandled map type: %v (missing \"map\" struct tag?)", typ)
 	default:
 		return nil, fmt.Errorf("unhandled type: %v", typ)
 	}
@@ -710,39 +897,50 @@ func generateEncoder(ctx *genContext, typ string, op op) []byte {
 	return b.Bytes()
 }
 
-func (bctx *buildContext) generate(typ *types.Named, encoder, decoder bool) ([]byte, error) {
-	bctx.topType = typ
-
-	pkg := typ.Obj().Pkg()
-	op, err := bctx.makeOp(nil, typ, rlpstruct.Tags{})
-	if err != nil {
-		return nil, err
+// generate creates the methods for the given types, and for all named struct types
+// of the same package they contain.
+func (bctx *buildContext) generate(typs []*types.Named, encoder, decoder bool) ([]byte, error) {
+	if len(typs) == 0 {
+		return nil, fmt.Errorf("no types to generate")
+	}
+	bctx.pkg = typs[0].Obj().Pkg()
+	for _, typ := range typs {
+		if !bctx.isGenerated(typ) {
+			return nil, fmt.Errorf("can't generate methods for %v", typ)
+		}
+		if bctx.isEncoder(types.NewPointer(typ)) || bctx.isDecoder(types.NewPointer(typ)) {
+			return nil, fmt.Errorf("type %v already implements rlp.Encoder or rlp.Decoder", typ)
+		}
+		bctx.addType(typ)
 	}
 
 	var (
-		ctx       = newGenContext(pkg)
-		encSource []byte
-		decSource []byte
+		ctx     = newGenContext(bctx.pkg)
+		sources [][]byte
 	)
-	if encoder {
-		encSource = generateEncoder(ctx, typ.Obj().Name(), op)
-	}
-	if decoder {
-		decSource = generateDecoder(ctx, typ.Obj().Name(), op)
+	// Note: genTypes grows while creating the ops of nested struct types.
+	for i := 0; i < len(bctx.genTypes); i++ {
+		typ := bctx.genTypes[i]
+		op, err := bctx.makeOp(typ, typ.Underlying(), rlpstruct.Tags{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", typ.Obj().Name(), err)
+		}
+		if encoder {
+			sources = append(sources, generateEncoder(ctx, typ.Obj().Name(), op))
+		}
+		if decoder {
+			sources = append(sources, generateDecoder(ctx, typ.Obj().Name(), op))
+		}
 	}
 
 	var b bytes.Buffer
-	fmt.Fprintf(&b, "package %s\n\n", pkg.Name())
+	fmt.Fprintf(&b, "package %s\n\n", bctx.pkg.Name())
 	for _, imp := range ctx.importsList() {
 		fmt.Fprintf(&b, "import %q\n", imp)
 	}
-	if encoder {
-		fmt.Fprintln(&b)
-		b.Write(encSource)
-	}
-	if decoder {
+	for _, source := range sources {
 		fmt.Fprintln(&b)
-		b.Write(decSource)
+		b.Write(source)
 	}
 
 	source := b.Bytes()
@@ -47,7 +47,7 @@ func init() {
 	}
 }
 
-var tests = []string{"uints", "nil", "rawvalue", "optional", "bigint"}
+var tests = []string{"uints", "nil", "rawvalue", "optional", "bigint", "map", "tail", "nested"}
 
 func TestOutput(t *testing.T) {
 	for _, test := range tests {
@@ -55,11 +55,11 @@ func TestOutput(t *testing.T) {
 		t.Run(test, func(t *testing.T) {
 			inputFile := filepath.Join("testdata", test+".in.txt")
 			outputFile := filepath.Join("testdata", test+".out.txt")
-			bctx, typ, err := loadTestSource(inputFile, "Test")
+			bctx, typs, err := loadTestSource(inputFile, "Test")
 			if err != nil {
 				t.Fatal("error loading test source:", err)
 			}
-			output, err := bctx.generate(typ, true, true)
+			output, err := bctx.generate(typs, true, true)
 			if err != nil {
 				t.Fatal("error in generate:", err)
 			}
@@ -77,17 +77,38 @@ func TestOutput(t *testing.T) {
 			if !bytes.Equal(output, wantOutput) {
 				t.Fatal("output mismatch:\n", string(output))
 			}
+			// Check that the output compiles together with the input.
+			if err := checkTestOutput(inputFile, outputFile, output); err != nil {
+				t.Fatal("error type-checking output:", err)
+			}
 		})
 	}
 }
 
-func loadTestSource(file string, typeName string) (*buildContext, *types.Named, error) {
+// checkTestOutput type-checks the generated code along with its test input.
+func checkTestOutput(inputFile, outputFile string, output []byte) error {
+	in, err := parser.ParseFile(testFset, inputFile, nil, 0)
+	if err != nil {
+		return err
+	}
+	out, err := parser.ParseFile(testFset, outputFile, output, 0)
+	if err != nil {
+		return err
+	}
+	conf := types.Config{Importer: testImporter}
+	_, err = conf.Check("test", testFset, []*ast.File{in, out}, nil)
+	return err
+}
+
+// loadTestSource loads the types marked for generation in the test input, or
+// the type 'typeName' if there are no marked types.
+func loadTestSource(file string, typeName string) (*buildContext, []*types.Named, error) {
 	// Load the test input.
 	content, err := os.ReadFile(file)
 	if err != nil {
 		return nil, nil, err
 	}
-	f, err := parser.ParseFile(testFset, file, content, 0)
+	f, err := parser.ParseFile(testFset, file, content, parser.ParseComments)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -97,11 +118,14 @@ func loadTestSource(file string, typeName string) (*buildContext, *types.Named,
 		return nil, nil, err
 	}
 
-	// Find the test struct.
+	// Find the test structs.
 	bctx := newBuildContext(testPackageRLP)
+	if typs, err := lookupMarkedTypes(pkg.Scope(), []*ast.File{f}); err == nil {
+		return bctx, typs, nil
+	}
 	typ, err := lookupStructType(pkg.Scope(), typeName)
 	if err != nil {
 		return nil, nil, fmt.Errorf("can't find type %s: %v", typeName, err)
 	}
-	return bctx, typ, nil
+	return bctx, []*types.Named{typ}, nil
 }
@@ -21,27 +21,38 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/token"
 	"go/types"
 	"os"
+	"strings"
 
 	"golang.org/x/tools/go/packages"
 )
 
 const pathOfPackageRLP = "github.com/chain5j/chain5j-pkg/codec/rlp"
 
+// genMarker marks the struct types to generate methods for when no type
+// names are given.
+const genMarker = "//rlp:gen"
+
 func main() {
 	var (
 		pkgdir     = flag.String("dir", ".", "input package")
 		output     = flag.String("out", "-", "output file (default is stdout)")
 		genEncoder = flag.Bool("encoder", true, "generate EncodeRLP?")
 		genDecoder = flag.Bool("decoder", false, "generate DecodeRLP?")
-		typename   = flag.String("type", "", "type to generate methods for")
+		typenames  = flag.String("type", "", "comma-separated types to generate methods for (default is types marked with "+genMarker+")")
 	)
 	flag.Parse()
 
+	var typs []string
+	if *typenames != "" {
+		typs = strings.Split(*typenames, ",")
+	}
 	cfg := Config{
 		Dir:             *pkgdir,
-		Type:            *typename,
+		Types:           typs,
 		GenerateEncoder: *genEncoder,
 		GenerateDecoder: *genDecoder,
 	}
@@ -62,8 +73,8 @@ func fatal(args ...interface{}) {
 }
 
 type Config struct {
-	Dir  string // input package directory
-	Type string
+	Dir   string   // input package directory
+	Types []string // types to generate, all marked types if empty
 
 	GenerateEncoder bool
 	GenerateDecoder bool
@@ -73,7 +84,7 @@ type Config struct {
 func (cfg *Config) process() (code []byte, err error) {
 	// Load packages.
 	pcfg := &packages.Config{
-		Mode:       packages.NeedName | packages.NeedTypes | packages.NeedImports | packages.NeedDeps,
+		Mode:       packages.NeedName | packages.NeedTypes | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax,
 		Dir:        cfg.Dir,
 		BuildFlags: []string{"-tags", "norlpgen"},
 	}
@@ -89,6 +100,7 @@ func (cfg *Config) process() (code []byte, err error) {
 	// Find the packages that were loaded.
 	var (
 		pkg        *types.Package
+		pkgFiles   []*ast.File
 		packageRLP *types.Package
 	)
 	for _, p := range ps {
@@ -99,16 +111,26 @@ func (cfg *Config) process() (code []byte, err error) {
 			packageRLP = p.Types
 		} else {
 			pkg = p.Types
+			pkgFiles = p.Syntax
 		}
 	}
 	bctx := newBuildContext(packageRLP)
 
-	// Find the type and generate.
-	typ, err := lookupStructType(pkg.Scope(), cfg.Type)
-	if err != nil {
-		return nil, fmt.Errorf("can't find %s in %s: %v", typ, pkg, err)
+	// Find the types and generate.
+	var typs []*types.Named
+	if len(cfg.Types) == 0 {
+		if typs, err = lookupMarkedTypes(pkg.Scope(), pkgFiles); err != nil {
+			return nil, fmt.Errorf("can't find types in %s: %v", pkg, err)
+		}
 	}
-	code, err = bctx.generate(typ, cfg.GenerateEncoder, cfg.GenerateDecoder)
+	for _, name := range cfg.Types {
+		typ, err := lookupStructType(pkg.Scope(), strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("can't find %s in %s: %v", name, pkg, err)
+		}
+		typs = append(typs, typ)
+	}
+	code, err = bctx.generate(typs, cfg.GenerateEncoder, cfg.GenerateDecoder)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +156,48 @@ func lookupStructType(scope *types.Scope, name string) (*types.Named, error) {
 	return typ, nil
 }
 
+// lookupMarkedTypes finds the struct types declared with the genMarker comment,
+// in declaration order.
+func lookupMarkedTypes(scope *types.Scope, files []*ast.File) ([]*types.Named, error) {
+	var typs []*types.Named
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if !hasGenMarker(gd.Doc) && !hasGenMarker(ts.Doc) {
+					continue
+				}
+				typ, err := lookupStructType(scope, ts.Name.Name)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", ts.Name.Name, err)
+				}
+				typs = append(typs, typ)
+			}
+		}
+	}
+	if len(typs) == 0 {
+		return nil, fmt.Errorf("no types marked with %s", genMarker)
+	}
+	return typs, nil
+}
+
+// hasGenMarker checks whether the comment group contains the genMarker line.
+func hasGenMarker(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == genMarker {
+			return true
+		}
+	}
+	return false
+}
+
 func lookupType(scope *types.Scope, name string) (*types.Named, error) {
 	obj := scope.Lookup(name)
 	if obj == nil {
@@ -60,7 +60,7 @@ func typeReflectKind(typ types.Type) reflect.Kind {
 }
 
 // nonZeroCheck returns the expression that checks whether 'v' is a non-zero value of type 'vtyp'.
-func nonZeroCheck(v string, vtyp types.Type, qualify types.Qualifier) string {
+func nonZeroCheck(ctx *genContext, v string, vtyp types.Type) string {
 	// Resolve type name.
 	typ := resolveUnderlying(vtyp)
 	switch typ := typ.(type) {
@@ -77,7 +77,12 @@ func nonZeroCheck(v string, vtyp types.Type, qualify types.Qualifier) string {
 			panic(fmt.Errorf("unhandled BasicKind %v", k))
 		}
 	case *types.Array, *types.Struct:
-		return fmt.Sprintf("%s != (%s{})", v, types.TypeString(vtyp, qualify))
+		if !types.Comparable(vtyp) {
+			// Can't compare against the zero value, e.g. structs containing slices.
+			ctx.addImport("reflect")
+			return fmt.Sprintf("!reflect.ValueOf(%s).IsZero()", v)
+		}
+		return fmt.Sprintf("%s != (%s{})", v, types.TypeString(vtyp, ctx.qualify))
 	case *types.Interface, *types.Pointer, *types.Signature:
 		return fmt.Sprintf("%s != nil", v)
 	case *types.Slice, *types.Map:
@@ -71,13 +71,17 @@ func cachedWriter(typ reflect.Type) (writer, error) {
 }
 
 func (c *typeCache) info(typ reflect.Type) *typeinfo {
-	key := typekey{Type: typ}
+	return c.infoWithTags(typ, rlpstruct.Tags{})
+}
+
+func (c *typeCache) infoWithTags(typ reflect.Type, tags rlpstruct.Tags) *typeinfo {
+	key := typekey{typ, tags}
 	if info := c.cur.Load().(map[typekey]*typeinfo)[key]; info != nil {
 		return info
 	}
 
 	// Not in the cache, need to generate info for this type.
-	return c.generate(typ, rlpstruct.Tags{})
+	return c.generate(typ, tags)
 }
 
 func (c *typeCache) generate(typ reflect.Type, tags rlpstruct.Tags) *typeinfo {
@@ -0,0 +1,58 @@
+// Package smt
+//
+// @author: xwc1125
+package smt
+
+import (
+	"fmt"
+	"hash"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// Domain separation prefixes of the hashed nodes, preventing a leaf from being
+// passed off as an inner node and vice versa.
+var (
+	leafPrefix  = []byte{0x00}
+	innerPrefix = []byte{0x01}
+)
+
+// hasher hashes the nodes of a tree with a configurable hash function. It is
+// not safe for concurrent use.
+type hasher struct {
+	sha hash.Hash
+}
+
+// newHasher creates a hasher from the given hash function, defaulting to
+// tree.Keccak256 if none is given.
+func newHasher(fn tree.HashFunc) (*hasher, error) {
+	if fn == nil {
+		fn = tree.Keccak256
+	}
+	sha := fn()
+	if sha.Size() != types.HashLength {
+		return nil, fmt.Errorf("unsupported hash size: have %d, want %d", sha.Size(), types.HashLength)
+	}
+	return &hasher{sha: sha}, nil
+}
+
+// digest hashes the concatenation of the given blobs.
+func (h *hasher) digest(data ...[]byte) (hash types.Hash) {
+	h.sha.Reset()
+	for _, b := range data {
+		h.sha.Write(b)
+	}
+	h.sha.Sum(hash[:0])
+	return hash
+}
+
+// leafHash calculates the hash of a leaf from its path and the hash of its value.
+func (h *hasher) leafHash(path, valueHash types.Hash) types.Hash {
+	return h.digest(leafPrefix, path[:], valueHash[:])
+}
+
+// innerHash calculates the hash of an inner node from the hashes of its children.
+func (h *hasher) innerHash(left, right types.Hash) types.Hash {
+	return h.digest(innerPrefix, left[:], right[:])
+}
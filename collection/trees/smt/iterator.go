@@ -0,0 +1,213 @@
+// Package smt
+//
+// @author: xwc1125
+package smt
+
+import (
+	"bytes"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// nodeIteratorState represents the iteration state at one particular node of
+// the tree.
+type nodeIteratorState struct {
+	hash    types.Hash // Hash of the node being iterated
+	node    node       // Resolved tree node being iterated
+	parent  types.Hash // Hash of the parent node (zero if current is the root)
+	index   int        // Child to be processed next, 0 being the left one
+	pathlen int        // Length of the path to this node
+}
+
+// nodeIterator is a pre-order iterator over the nodes of a sparse Merkle tree.
+type nodeIterator struct {
+	tree  *SparseMerkleTree
+	stack []*nodeIteratorState // Hierarchy of tree nodes persisting the iteration state
+	path  []byte               // Path to the current node, one bit per byte
+	start []byte               // Path to start the iteration at, one bit per byte
+	seek  types.Hash           // Path to start the iteration at, packed into bytes
+	err   error                // Failure set in case of an internal error in the iterator
+}
+
+// NodeIterator returns an iterator that returns nodes of the tree in pre-order,
+// the leaves being ordered by their paths. Iteration starts at the leaf with the
+// path after the given start path, which is the hash of the key, not the key.
+//
+// Path of the iterator returns the bits of the path to the current node, one
+// byte (0 or 1) per level. LeafKey returns the path of a leaf.
+func (t *SparseMerkleTree) NodeIterator(start []byte) tree.NodeIterator {
+	it := &nodeIterator{tree: t}
+	if len(start) > 0 {
+		copy(it.seek[:], start)
+
+		it.start = make([]byte, Depth)
+		for i := range it.start {
+			it.start[i] = bitAt(it.seek[:], i)
+		}
+	}
+	return it
+}
+
+// Next moves the iterator to the next node. If the parameter is false, any child
+// nodes will be skipped.
+func (it *nodeIterator) Next(descend bool) bool {
+	for {
+		if !it.step(descend) {
+			return false
+		}
+		descend = true
+		if it.start == nil {
+			return true
+		}
+		// Skip all the nodes before the start path
+		state := it.stack[len(it.stack)-1]
+		switch cmp := bytes.Compare(it.path, it.start[:len(it.path)]); {
+		case cmp < 0:
+			descend = false // Whole subtree is before the start
+		case cmp == 0:
+			leaf, ok := state.node.(*leafNode)
+			if !ok {
+				continue // Ancestor of the start path
+			}
+			if bytes.Compare(leaf.path[:], it.seek[:]) < 0 {
+				continue
+			}
+			it.start = nil
+			return true
+		default:
+			it.start = nil
+			return true
+		}
+	}
+}
+
+// step moves the iterator to the next node in pre-order.
+func (it *nodeIterator) step(descend bool) bool {
+	if it.err != nil {
+		return false
+	}
+	// Initialize the iteration if it hasn't been started yet
+	if len(it.stack) == 0 {
+		if it.path != nil || it.tree.root == nil {
+			return false // Iteration finished or empty tree
+		}
+		root, err := it.resolve(it.tree.root)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.stack = append(it.stack, &nodeIteratorState{hash: it.tree.hash(root), node: root})
+		it.path = []byte{}
+		return true
+	}
+	if !descend {
+		it.stack[len(it.stack)-1].index = 2
+	}
+	// Continue with the next child of the deepest node which has one left
+	for len(it.stack) > 0 {
+		parent := it.stack[len(it.stack)-1]
+		inner, ok := parent.node.(*innerNode)
+		for ok && parent.index < 2 {
+			bit := parent.index
+			parent.index++
+
+			child := inner.child(byte(bit))
+			if child == nil {
+				continue
+			}
+			resolved, err := it.resolve(child)
+			if err != nil {
+				it.err = err
+				return false
+			}
+			it.stack = append(it.stack, &nodeIteratorState{
+				hash:    it.tree.hash(resolved),
+				node:    resolved,
+				parent:  parent.hash,
+				pathlen: parent.pathlen + 1,
+			})
+			it.path = append(it.path[:parent.pathlen], byte(bit))
+			return true
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	it.path = it.path[:0]
+	return false
+}
+
+// resolve loads a node referenced by its hash from the database.
+func (it *nodeIterator) resolve(n node) (node, error) {
+	if hash, ok := n.(hashNode); ok {
+		return it.tree.resolve(types.Hash(hash))
+	}
+	return n, nil
+}
+
+// Error returns the error status of the iterator.
+func (it *nodeIterator) Error() error {
+	return it.err
+}
+
+// Hash returns the hash of the current node.
+func (it *nodeIterator) Hash() types.Hash {
+	if len(it.stack) == 0 {
+		return types.Hash{}
+	}
+	return it.stack[len(it.stack)-1].hash
+}
+
+// Parent returns the hash of the parent of the current node.
+func (it *nodeIterator) Parent() types.Hash {
+	if len(it.stack) == 0 {
+		return types.Hash{}
+	}
+	return it.stack[len(it.stack)-1].parent
+}
+
+// Path returns the bits of the path to the current node, one byte per level.
+func (it *nodeIterator) Path() []byte {
+	return it.path
+}
+
+// Leaf returns true iff the current node is a leaf node.
+func (it *nodeIterator) Leaf() bool {
+	if len(it.stack) == 0 {
+		return false
+	}
+	_, ok := it.stack[len(it.stack)-1].node.(*leafNode)
+	return ok
+}
+
+// LeafKey returns the path of the current leaf.
+func (it *nodeIterator) LeafKey() []byte {
+	return it.leaf().path[:]
+}
+
+// LeafBlob returns the value of the current leaf.
+func (it *nodeIterator) LeafBlob() []byte {
+	return it.leaf().value
+}
+
+// LeafProof returns the stored nodes on the path to the current leaf, starting
+// with the root.
+func (it *nodeIterator) LeafProof() [][]byte {
+	it.leaf()
+
+	proofs := make([][]byte, 0, len(it.stack))
+	for _, state := range it.stack {
+		proofs = append(proofs, it.tree.encode(state.node))
+	}
+	return proofs
+}
+
+// leaf returns the current leaf, panicking if the iterator is not positioned at
+// one.
+func (it *nodeIterator) leaf() *leafNode {
+	if len(it.stack) > 0 {
+		if leaf, ok := it.stack[len(it.stack)-1].node.(*leafNode); ok {
+			return leaf
+		}
+	}
+	panic("not at leaf")
+}
@@ -0,0 +1,10 @@
+// Package smt
+//
+// @author: xwc1125
+package smt
+
+import log "github.com/chain5j/logger"
+
+func logger() log.Logger {
+	return log.Log("smt")
+}
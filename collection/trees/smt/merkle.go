@@ -0,0 +1,146 @@
+// Package smt
+//
+// @author: xwc1125
+package smt
+
+import (
+	"errors"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// errIndexOutOfRange is returned if a proof is requested for a missing leaf.
+var errIndexOutOfRange = errors.New("leaf index out of range")
+
+// MerkleTree is a binary Merkle tree over an ordered list of leaves, following
+// the construction of RFC 6962: leaves hash as H(0x00 || data), inner nodes as
+// H(0x01 || left || right), the left subtree of n leaves containing the largest
+// power of two smaller than n. The root of an empty tree is H().
+//
+// MerkleTree is not safe for concurrent use.
+type MerkleTree struct {
+	hasher *hasher
+	leaves []types.Hash // Hashes of the leaves
+}
+
+// NewMerkleTree creates a binary Merkle tree over the given leaves, using the
+// given hash function (tree.Keccak256 if nil).
+func NewMerkleTree(leaves [][]byte, fn tree.HashFunc) (*MerkleTree, error) {
+	hasher, err := newHasher(fn)
+	if err != nil {
+		return nil, err
+	}
+	t := &MerkleTree{hasher: hasher}
+	for _, leaf := range leaves {
+		t.Append(leaf)
+	}
+	return t, nil
+}
+
+// Append adds a leaf to the end of the tree.
+func (t *MerkleTree) Append(data []byte) {
+	t.leaves = append(t.leaves, t.hasher.digest(leafPrefix, data))
+}
+
+// Len returns the number of leaves in the tree.
+func (t *MerkleTree) Len() int {
+	return len(t.leaves)
+}
+
+// Hash returns the root hash of the tree.
+func (t *MerkleTree) Hash() types.Hash {
+	if len(t.leaves) == 0 {
+		return t.hasher.digest()
+	}
+	return t.root(t.leaves)
+}
+
+// root calculates the root hash of a non-empty list of leaf hashes.
+func (t *MerkleTree) root(leaves []types.Hash) types.Hash {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return t.hasher.innerHash(t.root(leaves[:k]), t.root(leaves[k:]))
+}
+
+// Prove returns the audit path of the leaf at the given index: the hashes of
+// the siblings on the path from the leaf to the root, starting at the leaf.
+func (t *MerkleTree) Prove(index int) ([]types.Hash, error) {
+	if index < 0 || index >= len(t.leaves) {
+		return nil, errIndexOutOfRange
+	}
+	return t.prove(index, t.leaves), nil
+}
+
+// prove calculates the audit path of a leaf within a list of leaf hashes.
+func (t *MerkleTree) prove(index int, leaves []types.Hash) []types.Hash {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if index < k {
+		return append(t.prove(index, leaves[:k]), t.root(leaves[k:]))
+	}
+	return append(t.prove(index-k, leaves[k:]), t.root(leaves[:k]))
+}
+
+// VerifyMerkleProof checks that the data is the leaf at the given index of a
+// binary Merkle tree with the given number of leaves and root hash.
+func VerifyMerkleProof(rootHash types.Hash, index, total int, data []byte, proof []types.Hash, fn tree.HashFunc) error {
+	hasher, err := newHasher(fn)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= total {
+		return errIndexOutOfRange
+	}
+	root, err := rootFromProof(hasher, index, total, hasher.digest(leafPrefix, data), proof)
+	if err != nil {
+		return err
+	}
+	if root != rootHash {
+		return errors.New("root hash mismatch")
+	}
+	return nil
+}
+
+// rootFromProof calculates the root hash of a tree with the given number of
+// leaves from the hash of a leaf and its audit path.
+func rootFromProof(hasher *hasher, index, total int, leaf types.Hash, proof []types.Hash) (types.Hash, error) {
+	if total == 1 {
+		if len(proof) != 0 {
+			return types.Hash{}, errors.New("superfluous proof nodes")
+		}
+		return leaf, nil
+	}
+	if len(proof) == 0 {
+		return types.Hash{}, errors.New("missing proof nodes")
+	}
+	var (
+		k       = splitPoint(total)
+		sibling = proof[len(proof)-1]
+	)
+	if index < k {
+		left, err := rootFromProof(hasher, index, k, leaf, proof[:len(proof)-1])
+		if err != nil {
+			return types.Hash{}, err
+		}
+		return hasher.innerHash(left, sibling), nil
+	}
+	right, err := rootFromProof(hasher, index-k, total-k, leaf, proof[:len(proof)-1])
+	if err != nil {
+		return types.Hash{}, err
+	}
+	return hasher.innerHash(sibling, right), nil
+}
+
+// splitPoint returns the largest power of two smaller than n, n being at least 2.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
@@ -0,0 +1,90 @@
+package smt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/crypto/hashalg/sha3"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+)
+
+// Tests the binary Merkle tree roots against independently calculated RFC 6962
+// roots.
+func TestMerkleTreeRoot(t *testing.T) {
+	tests := []struct {
+		leaves []string
+		root   string
+	}{
+		{nil, "0xe3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{[]string{""}, "0x6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"},
+		{[]string{"a", "b", "c"}, "0x36642e73c2540ab121e3a6bf9545b0a24982cd830eb13d3cd19de3ce6c021ec1"},
+	}
+	for i, tt := range tests {
+		var leaves [][]byte
+		for _, leaf := range tt.leaves {
+			leaves = append(leaves, []byte(leaf))
+		}
+		mt, err := NewMerkleTree(leaves, tree.Sha256)
+		if err != nil {
+			t.Fatalf("test %d: failed to create tree: %v", i, err)
+		}
+		if have, want := mt.Hash(), types.HexToHash(tt.root); have != want {
+			t.Errorf("test %d: root mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
+
+func TestMerkleTreeProof(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		mt, _ := NewMerkleTree(nil, nil)
+		for i := 0; i < n; i++ {
+			mt.Append([]byte(fmt.Sprintf("leaf-%d", i)))
+		}
+		root := mt.Hash()
+		for i := 0; i < n; i++ {
+			proof, err := mt.Prove(i)
+			if err != nil {
+				t.Fatalf("%d leaves: failed to prove leaf %d: %v", n, i, err)
+			}
+			data := []byte(fmt.Sprintf("leaf-%d", i))
+			if err := VerifyMerkleProof(root, i, n, data, proof, nil); err != nil {
+				t.Fatalf("%d leaves: failed to verify leaf %d: %v", n, i, err)
+			}
+			if err := VerifyMerkleProof(root, i, n, []byte("bad"), proof, nil); err == nil {
+				t.Fatalf("%d leaves: bad leaf %d verified", n, i)
+			}
+			if n > 1 {
+				if err := VerifyMerkleProof(root, (i+1)%n, n, data, proof, nil); err == nil {
+					t.Fatalf("%d leaves: leaf %d verified at a wrong index", n, i)
+				}
+				if err := VerifyMerkleProof(root, i, n, data, proof[1:], nil); err == nil {
+					t.Fatalf("%d leaves: truncated proof of leaf %d verified", n, i)
+				}
+			}
+		}
+		if _, err := mt.Prove(n); err == nil {
+			t.Fatalf("%d leaves: proved leaf out of range", n)
+		}
+	}
+}
+
+func TestMerkleTreeHashFunc(t *testing.T) {
+	leaves := [][]byte{hexutil.MustDecode("0x01"), hexutil.MustDecode("0x02")}
+
+	roots := make(map[types.Hash]struct{})
+	for _, fn := range []tree.HashFunc{tree.Keccak256, tree.SM3, tree.Sha3, tree.Sha256, tree.Blake2b} {
+		mt, err := NewMerkleTree(leaves, fn)
+		if err != nil {
+			t.Fatalf("failed to create tree: %v", err)
+		}
+		roots[mt.Hash()] = struct{}{}
+	}
+	if len(roots) != 5 {
+		t.Fatalf("hash functions yield colliding roots: %d unique", len(roots))
+	}
+	if _, err := NewMerkleTree(leaves, sha3.NewKeccak512); err == nil {
+		t.Fatalf("64 byte hash function accepted")
+	}
+}
@@ -0,0 +1,118 @@
+// Package smt
+//
+// @author: xwc1125
+package smt
+
+import (
+	"errors"
+
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// errInvalidNode is returned if a stored node blob can't be decoded.
+var errInvalidNode = errors.New("invalid sparse merkle tree node")
+
+// node is a node of a sparse Merkle tree: a *leafNode, an *innerNode, a hashNode
+// referencing a node not yet loaded from the database, or nil for an empty
+// subtree.
+type node interface{}
+
+type (
+	// leafNode is a key-value pair, placed at the shallowest depth of the tree
+	// at which its path doesn't collide with any other leaf.
+	leafNode struct {
+		path  types.Hash
+		value []byte
+		flags nodeFlag
+	}
+	// innerNode is a branch of the tree, with nil standing for empty children.
+	innerNode struct {
+		left, right node
+		flags       nodeFlag
+	}
+	// hashNode is a reference to a persisted node.
+	hashNode types.Hash
+)
+
+// nodeFlag contains caching-related metadata about a node.
+type nodeFlag struct {
+	hash   types.Hash // Cached hash of the node, valid if hashed is set
+	hashed bool       // Whether the cached hash was calculated
+	dirty  bool       // Whether the node has changes that must be written to the database
+}
+
+// child returns the child of an inner node on the given side, 0 being the left.
+func (n *innerNode) child(bit byte) node {
+	if bit == 0 {
+		return n.left
+	}
+	return n.right
+}
+
+// withChild returns a dirty copy of the inner node with the child on the given
+// side replaced.
+func (n *innerNode) withChild(bit byte, child node) *innerNode {
+	cpy := &innerNode{left: n.left, right: n.right, flags: nodeFlag{dirty: true}}
+	if bit == 0 {
+		cpy.left = child
+	} else {
+		cpy.right = child
+	}
+	return cpy
+}
+
+// encodeLeaf returns the storage blob of a leaf: the prefix, the path and the
+// value. The blob is stored under the leaf hash, which commits to the hash of
+// the value instead of the value itself.
+func encodeLeaf(path types.Hash, value []byte) []byte {
+	blob := make([]byte, 0, 1+types.HashLength+len(value))
+	blob = append(blob, leafPrefix...)
+	blob = append(blob, path[:]...)
+	return append(blob, value...)
+}
+
+// encodeInner returns the storage blob of an inner node: the prefix and the
+// hashes of its children, the hash of an empty child being all zeroes.
+func encodeInner(left, right types.Hash) []byte {
+	blob := make([]byte, 0, 1+2*types.HashLength)
+	blob = append(blob, innerPrefix...)
+	blob = append(blob, left[:]...)
+	return append(blob, right[:]...)
+}
+
+// decodeNode parses the storage blob of a node persisted under the given hash.
+func decodeNode(hash types.Hash, blob []byte) (node, error) {
+	switch {
+	case len(blob) > 1+types.HashLength && blob[0] == leafPrefix[0]:
+		return &leafNode{
+			path:  types.BytesToHash(blob[1 : 1+types.HashLength]),
+			value: append([]byte{}, blob[1+types.HashLength:]...),
+			flags: nodeFlag{hash: hash, hashed: true},
+		}, nil
+
+	case len(blob) == 1+2*types.HashLength && blob[0] == innerPrefix[0]:
+		return &innerNode{
+			left:  decodeRef(blob[1 : 1+types.HashLength]),
+			right: decodeRef(blob[1+types.HashLength:]),
+			flags: nodeFlag{hash: hash, hashed: true},
+		}, nil
+
+	default:
+		return nil, errInvalidNode
+	}
+}
+
+// decodeRef converts a child hash of an inner node into a node reference.
+func decodeRef(blob []byte) node {
+	hash := types.BytesToHash(blob)
+	if hash == (types.Hash{}) {
+		return nil
+	}
+	return hashNode(hash)
+}
+
+// bitAt returns the bit of the path at the given depth, 0 being the most
+// significant bit of the first byte.
+func bitAt(path []byte, depth int) byte {
+	return (path[depth/8] >> (7 - uint(depth%8))) & 1
+}
@@ -0,0 +1,216 @@
+// Package smt
+//
+// @author: xwc1125
+package smt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// Prove constructs a Merkle proof for key. The result contains all stored nodes
+// on the path to the value at key. The value itself is also included in the last
+// node and can be retrieved by verifying the proof.
+//
+// If the tree does not contain a value for key, the returned proof contains all
+// nodes on the path of the key, ending with the leaf occupying the path, if any.
+// For a non-membership proof omitting the value of that leaf, see ProveCompact.
+func (t *SparseMerkleTree) Prove(key []byte, fromLevel uint, proofDb kvstore.KeyValueWriter) error {
+	nodes, err := t.walk(t.Path(key))
+	if err != nil {
+		return err
+	}
+	for i, n := range nodes {
+		if fromLevel > 0 {
+			fromLevel--
+			continue
+		}
+		hash := t.hash(n)
+		if err := proofDb.Put(hash[:], t.encode(n)); err != nil {
+			return fmt.Errorf("proof node %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// walk collects the resolved nodes on the given path, starting with the root.
+func (t *SparseMerkleTree) walk(path types.Hash) ([]node, error) {
+	var (
+		nodes []node
+		n     = t.root
+	)
+	for depth := 0; n != nil; {
+		if hash, ok := n.(hashNode); ok {
+			resolved, err := t.resolve(types.Hash(hash))
+			if err != nil {
+				return nil, err
+			}
+			n = resolved
+		}
+		nodes = append(nodes, n)
+
+		inner, ok := n.(*innerNode)
+		if !ok {
+			break
+		}
+		n, depth = inner.child(bitAt(path[:], depth)), depth+1
+	}
+	return nodes, nil
+}
+
+// VerifyProof checks a Merkle proof generated by Prove. The value for key is
+// returned if the proof proves membership, nil if it proves non-membership, and
+// an error if the proof is invalid.
+func VerifyProof(rootHash types.Hash, key []byte, proofDb kvstore.KeyValueReader, fn tree.HashFunc) (value []byte, err error) {
+	hasher, err := newHasher(fn)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		path   = hasher.digest(key)
+		wanted = rootHash
+	)
+	for depth, i := 0, 0; ; i++ {
+		if wanted == EmptyRoot {
+			return nil, nil
+		}
+		blob, _ := proofDb.Get(wanted[:])
+		if blob == nil {
+			return nil, fmt.Errorf("proof node %d (hash %064x) missing", i, wanted)
+		}
+		n, err := decodeNode(wanted, blob)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
+		}
+		switch n := n.(type) {
+		case *leafNode:
+			if hasher.leafHash(n.path, hasher.digest(n.value)) != wanted {
+				return nil, fmt.Errorf("bad proof node %d: hash mismatch", i)
+			}
+			if n.path != path {
+				return nil, nil
+			}
+			return n.value, nil
+
+		case *innerNode:
+			if hasher.digest(blob) != wanted {
+				return nil, fmt.Errorf("bad proof node %d: hash mismatch", i)
+			}
+			if depth == Depth {
+				return nil, fmt.Errorf("bad proof node %d: too deep", i)
+			}
+			child := n.child(bitAt(path[:], depth))
+			if child == nil {
+				return nil, nil
+			}
+			wanted, depth = types.Hash(child.(hashNode)), depth+1
+		}
+	}
+}
+
+// Proof is a compact Merkle proof of membership or non-membership of a key in a
+// sparse Merkle tree. Empty siblings on the path are not included in the proof,
+// only flagged in a bitmask.
+type Proof struct {
+	Depth     uint64       // Number of levels on the path proven
+	Bitmask   []byte       // Bit i is set if the sibling at depth i is empty
+	SideNodes []types.Hash // Hashes of the non-empty siblings, starting at the root
+	Leaf      []byte       // Path and value hash of another leaf occupying the path, if any
+}
+
+// ProveCompact constructs a compact Merkle proof for key. If the tree contains
+// the key, the proof proves its membership. Otherwise it proves that the path of
+// the key ends either in an empty subtree or in another leaf, which is included
+// in the proof by its path and value hash only.
+func (t *SparseMerkleTree) ProveCompact(key []byte) (*Proof, error) {
+	path := t.Path(key)
+	nodes, err := t.walk(path)
+	if err != nil {
+		return nil, err
+	}
+	proof := &Proof{Bitmask: make([]byte, (len(nodes)+7)/8)}
+	for depth, n := range nodes {
+		switch n := n.(type) {
+		case *innerNode:
+			sibling := n.child(1 - bitAt(path[:], depth))
+			if sibling == nil {
+				proof.Bitmask[depth/8] |= 1 << (7 - uint(depth%8))
+			} else {
+				proof.SideNodes = append(proof.SideNodes, t.hash(sibling))
+			}
+			proof.Depth++
+
+		case *leafNode:
+			if n.path != path {
+				valueHash := t.hasher.digest(n.value)
+				proof.Leaf = append(append([]byte{}, n.path[:]...), valueHash[:]...)
+			}
+		}
+	}
+	proof.Bitmask = proof.Bitmask[:(proof.Depth+7)/8]
+	return proof, nil
+}
+
+// VerifyCompactProof checks a compact Merkle proof generated by ProveCompact. If
+// value is empty, the proof is checked for the non-membership of key, otherwise
+// for the membership of key with the given value.
+func VerifyCompactProof(rootHash types.Hash, key, value []byte, proof *Proof, fn tree.HashFunc) error {
+	hasher, err := newHasher(fn)
+	if err != nil {
+		return err
+	}
+	if proof.Depth > Depth || uint64(len(proof.Bitmask)) < (proof.Depth+7)/8 {
+		return errors.New("invalid proof depth")
+	}
+	path := hasher.digest(key)
+
+	// Calculate the hash of the subtree the path ends in
+	var current types.Hash
+	switch {
+	case len(value) > 0:
+		current = hasher.leafHash(path, hasher.digest(value))
+
+	case len(proof.Leaf) > 0:
+		if len(proof.Leaf) != 2*types.HashLength {
+			return errors.New("invalid proof leaf")
+		}
+		other := types.BytesToHash(proof.Leaf[:types.HashLength])
+		if other == path {
+			return errors.New("proof leaf is the key itself")
+		}
+		for depth := 0; depth < int(proof.Depth); depth++ {
+			if bitAt(other[:], depth) != bitAt(path[:], depth) {
+				return errors.New("proof leaf not on the key path")
+			}
+		}
+		current = hasher.leafHash(other, types.BytesToHash(proof.Leaf[types.HashLength:]))
+	}
+	// Hash the subtree up to the root, filling in the empty siblings
+	sides := len(proof.SideNodes)
+	for depth := int(proof.Depth) - 1; depth >= 0; depth-- {
+		var sibling types.Hash
+		if proof.Bitmask[depth/8]&(1<<(7-uint(depth%8))) == 0 {
+			if sides == 0 {
+				return errors.New("missing proof side nodes")
+			}
+			sides--
+			sibling = proof.SideNodes[sides]
+		}
+		if bitAt(path[:], depth) == 0 {
+			current = hasher.innerHash(current, sibling)
+		} else {
+			current = hasher.innerHash(sibling, current)
+		}
+	}
+	if sides != 0 {
+		return errors.New("superfluous proof side nodes")
+	}
+	if current != rootHash {
+		return errors.New("root hash mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package smt
+
+import (
+	"bytes"
+	mrand "math/rand"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+func TestProof(t *testing.T) {
+	smt, content := makeTestTree(t, 500)
+	root := smt.Hash()
+
+	for key, val := range content {
+		proof := memorydb.New()
+		if err := smt.Prove([]byte(key), 0, proof); err != nil {
+			t.Fatalf("failed to prove %x: %v", key, err)
+		}
+		have, err := VerifyProof(root, []byte(key), proof, nil)
+		if err != nil {
+			t.Fatalf("failed to verify proof of %x: %v", key, err)
+		}
+		if !bytes.Equal(have, val) {
+			t.Fatalf("proven value mismatch for %x: have %x, want %x", key, have, val)
+		}
+	}
+	// Prove some missing keys as well
+	for i := 0; i < 100; i++ {
+		key := randBytes(20)
+		proof := memorydb.New()
+		if err := smt.Prove(key, 0, proof); err != nil {
+			t.Fatalf("failed to prove missing %x: %v", key, err)
+		}
+		if val, err := VerifyProof(root, key, proof, nil); val != nil || err != nil {
+			t.Fatalf("missing key %x proven: %x, %v", key, val, err)
+		}
+	}
+}
+
+func TestBadProof(t *testing.T) {
+	smt, content := makeTestTree(t, 100)
+	root := smt.Hash()
+
+	for key := range content {
+		proof := memorydb.New()
+		smt.Prove([]byte(key), 0, proof)
+
+		// Corrupt a random node of the proof
+		it := proof.NewIterator()
+		for i, d := 0, mrand.Intn(proof.Len()); i <= d; i++ {
+			it.Next()
+		}
+		nodeKey, node := it.Key(), append([]byte{}, it.Value()...)
+		it.Release()
+
+		node[len(node)-1] ^= 0x01
+		proof.Put(nodeKey, node)
+		if _, err := VerifyProof(root, []byte(key), proof, nil); err == nil {
+			t.Fatalf("corrupted proof of %x verified", key)
+		}
+	}
+	// Skipping the root must make the proof unverifiable
+	for key := range content {
+		proof := memorydb.New()
+		smt.Prove([]byte(key), 1, proof)
+		if _, err := VerifyProof(root, []byte(key), proof, nil); err == nil {
+			t.Fatalf("proof without root verified")
+		}
+		break
+	}
+}
+
+func TestCompactProof(t *testing.T) {
+	smt, content := makeTestTree(t, 500)
+	root := smt.Hash()
+
+	for key, val := range content {
+		proof, err := smt.ProveCompact([]byte(key))
+		if err != nil {
+			t.Fatalf("failed to prove %x: %v", key, err)
+		}
+		if err := VerifyCompactProof(root, []byte(key), val, proof, nil); err != nil {
+			t.Fatalf("failed to verify membership of %x: %v", key, err)
+		}
+		if err := VerifyCompactProof(root, []byte(key), []byte("bad"), proof, nil); err == nil {
+			t.Fatalf("bad value of %x verified", key)
+		}
+		if err := VerifyCompactProof(root, []byte(key), nil, proof, nil); err == nil {
+			t.Fatalf("non-membership of existing %x verified", key)
+		}
+		// Ensure the proof survives a round trip through RLP
+		blob, err := rlp.EncodeToBytes(proof)
+		if err != nil {
+			t.Fatalf("failed to encode proof: %v", err)
+		}
+		var dec Proof
+		if err := rlp.DecodeBytes(blob, &dec); err != nil {
+			t.Fatalf("failed to decode proof: %v", err)
+		}
+		if err := VerifyCompactProof(root, []byte(key), val, &dec, nil); err != nil {
+			t.Fatalf("failed to verify decoded proof of %x: %v", key, err)
+		}
+	}
+	var leaves int
+	for i := 0; i < 500; i++ {
+		key := randBytes(20)
+		proof, err := smt.ProveCompact(key)
+		if err != nil {
+			t.Fatalf("failed to prove missing %x: %v", key, err)
+		}
+		if len(proof.Leaf) > 0 {
+			leaves++
+		}
+		if err := VerifyCompactProof(root, key, nil, proof, nil); err != nil {
+			t.Fatalf("failed to verify non-membership of %x: %v", key, err)
+		}
+		if err := VerifyCompactProof(root, key, []byte("value"), proof, nil); err == nil {
+			t.Fatalf("membership of missing %x verified", key)
+		}
+		if err := VerifyCompactProof(types.Hash{0x01}, key, nil, proof, nil); err == nil {
+			t.Fatalf("non-membership of %x verified against wrong root", key)
+		}
+	}
+	if leaves == 0 {
+		t.Fatalf("no non-membership proof ended in a leaf")
+	}
+	// An empty tree proves the non-membership of everything
+	empty, _ := NewSparseMerkleTree(types.Hash{}, nil, nil)
+	proof, _ := empty.ProveCompact([]byte("key"))
+	if err := VerifyCompactProof(EmptyRoot, []byte("key"), nil, proof, nil); err != nil {
+		t.Fatalf("failed to verify non-membership in empty tree: %v", err)
+	}
+}
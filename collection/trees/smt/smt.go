@@ -0,0 +1,401 @@
+// Package smt
+//
+// @author: xwc1125
+package smt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// Depth is the depth of a sparse Merkle tree, the number of bits of a path.
+const Depth = 8 * types.HashLength
+
+// EmptyRoot is the root hash of an empty sparse Merkle tree, regardless of the
+// hash function used.
+var EmptyRoot = types.Hash{}
+
+var _ tree.Tree = (*SparseMerkleTree)(nil)
+
+// SparseMerkleTree is a 256-bit sparse Merkle tree. Every key is placed at the
+// path given by its hash, with the subtrees not containing any key hashing to
+// zero. A subtree containing a single leaf is replaced by the leaf itself, so
+// the tree only has a depth logarithmic to the number of keys, while proofs of
+// membership and non-membership stay compact.
+//
+// Leaves hash as H(0x00 || path || H(value)), inner nodes as H(0x01 || left ||
+// right). Nodes are persisted into the database keyed by their hash.
+//
+// SparseMerkleTree is not safe for concurrent use.
+type SparseMerkleTree struct {
+	db     kvstore.KeyValueStore
+	root   node
+	hasher *hasher
+}
+
+// NewSparseMerkleTree creates a sparse Merkle tree with an existing root node
+// from db, using the given hash function (tree.Keccak256 if nil).
+//
+// If root is the zero hash, the tree is initially empty. Otherwise New will
+// return a *tree.MissingNodeError if the root node can't be found in db. The db
+// may be nil for a purely in-memory tree, which can't be committed.
+func NewSparseMerkleTree(root types.Hash, db kvstore.KeyValueStore, fn tree.HashFunc) (*SparseMerkleTree, error) {
+	hasher, err := newHasher(fn)
+	if err != nil {
+		return nil, err
+	}
+	t := &SparseMerkleTree{
+		db:     db,
+		hasher: hasher,
+	}
+	if root != EmptyRoot {
+		rootnode, err := t.resolve(root)
+		if err != nil {
+			return nil, err
+		}
+		t.root = rootnode
+	}
+	return t, nil
+}
+
+// Path returns the path of a key in the tree, the hash of the key.
+func (t *SparseMerkleTree) Path(key []byte) types.Hash {
+	return t.hasher.digest(key)
+}
+
+// Get returns the value for key stored in the tree.
+// The value bytes must not be modified by the caller.
+func (t *SparseMerkleTree) Get(key []byte) []byte {
+	res, err := t.TryGet(key)
+	if err != nil {
+		logger().Error(fmt.Sprintf("Unhandled tree error: %v", err))
+	}
+	return res
+}
+
+// TryGet returns the value for key stored in the tree. The value bytes must not
+// be modified by the caller. If a node was not found in the database, a
+// *tree.MissingNodeError is returned.
+func (t *SparseMerkleTree) TryGet(key []byte) ([]byte, error) {
+	path := t.Path(key)
+
+	n, depth := t.root, 0
+	for {
+		switch cur := n.(type) {
+		case nil:
+			return nil, nil
+
+		case hashNode:
+			resolved, err := t.resolve(types.Hash(cur))
+			if err != nil {
+				return nil, err
+			}
+			n = resolved
+
+		case *leafNode:
+			if cur.path != path {
+				return nil, nil
+			}
+			return cur.value, nil
+
+		case *innerNode:
+			n, depth = cur.child(bitAt(path[:], depth)), depth+1
+
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		}
+	}
+}
+
+// Update associates key with value in the tree. If value has length zero, any
+// existing value is deleted from the tree.
+func (t *SparseMerkleTree) Update(key, value []byte) {
+	if err := t.TryUpdate(key, value); err != nil {
+		logger().Error(fmt.Sprintf("Unhandled tree error: %v", err))
+	}
+}
+
+// TryUpdate associates key with value in the tree. If value has length zero, any
+// existing value is deleted from the tree. If a node was not found in the
+// database, a *tree.MissingNodeError is returned.
+func (t *SparseMerkleTree) TryUpdate(key, value []byte) error {
+	if len(value) == 0 {
+		return t.TryDelete(key)
+	}
+	leaf := &leafNode{
+		path:  t.Path(key),
+		value: append([]byte{}, value...),
+		flags: nodeFlag{dirty: true},
+	}
+	n, err := t.insert(t.root, 0, leaf)
+	if err != nil {
+		return err
+	}
+	t.root = n
+	return nil
+}
+
+// insert places the leaf into the subtree at the given depth, returning the
+// updated subtree.
+func (t *SparseMerkleTree) insert(n node, depth int, leaf *leafNode) (node, error) {
+	switch n := n.(type) {
+	case nil:
+		return leaf, nil
+
+	case hashNode:
+		resolved, err := t.resolve(types.Hash(n))
+		if err != nil {
+			return nil, err
+		}
+		return t.insert(resolved, depth, leaf)
+
+	case *leafNode:
+		if n.path == leaf.path {
+			if bytes.Equal(n.value, leaf.value) {
+				return n, nil
+			}
+			return leaf, nil
+		}
+		return split(n, leaf, depth), nil
+
+	case *innerNode:
+		bit := bitAt(leaf.path[:], depth)
+		child, err := t.insert(n.child(bit), depth+1, leaf)
+		if err != nil {
+			return nil, err
+		}
+		return n.withChild(bit, child), nil
+
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// split creates the subtree at the given depth containing two leaves, which
+// share the path up to the depth but differ in their full paths.
+func split(a, b *leafNode, depth int) node {
+	abit, bbit := bitAt(a.path[:], depth), bitAt(b.path[:], depth)
+	if abit == bbit {
+		// The paths don't diverge yet, push both leaves one level down
+		n := &innerNode{flags: nodeFlag{dirty: true}}
+		return n.withChild(abit, split(a, b, depth+1))
+	}
+	n := &innerNode{flags: nodeFlag{dirty: true}}
+	if abit == 0 {
+		n.left, n.right = a, b
+	} else {
+		n.left, n.right = b, a
+	}
+	return n
+}
+
+// Delete removes any existing value for key from the tree.
+func (t *SparseMerkleTree) Delete(key []byte) {
+	if err := t.TryDelete(key); err != nil {
+		logger().Error(fmt.Sprintf("Unhandled tree error: %v", err))
+	}
+}
+
+// TryDelete removes any existing value for key from the tree. If a node was not
+// found in the database, a *tree.MissingNodeError is returned.
+func (t *SparseMerkleTree) TryDelete(key []byte) error {
+	n, _, err := t.delete(t.root, 0, t.Path(key))
+	if err != nil {
+		return err
+	}
+	t.root = n
+	return nil
+}
+
+// delete removes the leaf with the given path from the subtree at the given
+// depth, returning the updated subtree and whether anything was removed. A
+// subtree left with a single leaf is collapsed into the leaf itself.
+func (t *SparseMerkleTree) delete(n node, depth int, path types.Hash) (node, bool, error) {
+	switch n := n.(type) {
+	case nil:
+		return nil, false, nil
+
+	case hashNode:
+		resolved, err := t.resolve(types.Hash(n))
+		if err != nil {
+			return nil, false, err
+		}
+		dirty, changed, err := t.delete(resolved, depth, path)
+		if !changed || err != nil {
+			return n, false, err
+		}
+		return dirty, true, nil
+
+	case *leafNode:
+		if n.path != path {
+			return n, false, nil
+		}
+		return nil, true, nil
+
+	case *innerNode:
+		bit := bitAt(path[:], depth)
+		child, changed, err := t.delete(n.child(bit), depth+1, path)
+		if !changed || err != nil {
+			return n, false, err
+		}
+		sibling := n.child(1 - bit)
+
+		// If the remaining content of the subtree is a single leaf, move it up
+		if sibling == nil {
+			if _, ok := child.(*leafNode); ok || child == nil {
+				return child, true, nil
+			}
+		}
+		if child == nil {
+			if hash, ok := sibling.(hashNode); ok {
+				resolved, err := t.resolve(types.Hash(hash))
+				if err != nil {
+					return n, false, err
+				}
+				sibling = resolved
+			}
+			if leaf, ok := sibling.(*leafNode); ok {
+				return leaf, true, nil
+			}
+		}
+		return n.withChild(bit, child), true, nil
+
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// Hash returns the root hash of the tree. It does not write to the database and
+// can be used even if the tree doesn't have one.
+func (t *SparseMerkleTree) Hash() types.Hash {
+	return t.hash(t.root)
+}
+
+// hash calculates the hash of a subtree, caching the hashes of its nodes.
+func (t *SparseMerkleTree) hash(n node) types.Hash {
+	switch n := n.(type) {
+	case nil:
+		return EmptyRoot
+
+	case hashNode:
+		return types.Hash(n)
+
+	case *leafNode:
+		if !n.flags.hashed {
+			n.flags.hash, n.flags.hashed = t.hasher.leafHash(n.path, t.hasher.digest(n.value)), true
+		}
+		return n.flags.hash
+
+	case *innerNode:
+		if !n.flags.hashed {
+			n.flags.hash, n.flags.hashed = t.hasher.innerHash(t.hash(n.left), t.hash(n.right)), true
+		}
+		return n.flags.hash
+
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// Commit writes all the modified nodes of the tree into the database and
+// returns the root hash. Unlike the Patricia trie, there is no intermediate
+// memory database, the nodes are written out directly. The leaf callback is
+// invoked for every written leaf with its value and the hash of its parent.
+func (t *SparseMerkleTree) Commit(onleaf tree.LeafCallback) (types.Hash, error) {
+	if t.db == nil {
+		return types.Hash{}, errors.New("commit called on sparse merkle tree with nil database")
+	}
+	root := t.Hash()
+	if t.root == nil {
+		return root, nil
+	}
+	batch := t.db.NewBatch()
+	if err := t.commit(t.root, types.Hash{}, batch, onleaf); err != nil {
+		return types.Hash{}, err
+	}
+	if err := batch.Write(); err != nil {
+		return types.Hash{}, err
+	}
+	t.root = hashNode(root)
+	return root, nil
+}
+
+// commit writes the dirty nodes of a subtree into the batch, flushing it when
+// it grows large enough.
+func (t *SparseMerkleTree) commit(n node, parent types.Hash, batch kvstore.Batch, onleaf tree.LeafCallback) error {
+	var blob []byte
+	switch n := n.(type) {
+	case *leafNode:
+		if !n.flags.dirty {
+			return nil
+		}
+		if onleaf != nil {
+			if err := onleaf(n.value, parent); err != nil {
+				return err
+			}
+		}
+		blob = encodeLeaf(n.path, n.value)
+		n.flags.dirty = false
+
+	case *innerNode:
+		if !n.flags.dirty {
+			return nil
+		}
+		hash := t.hash(n)
+		if err := t.commit(n.left, hash, batch, onleaf); err != nil {
+			return err
+		}
+		if err := t.commit(n.right, hash, batch, onleaf); err != nil {
+			return err
+		}
+		blob = encodeInner(t.hash(n.left), t.hash(n.right))
+		n.flags.dirty = false
+
+	default:
+		return nil // Empty or already persisted
+	}
+	hash := t.hash(n)
+	if err := batch.Put(hash[:], blob); err != nil {
+		return err
+	}
+	if batch.ValueSize() >= kvstore.IdealBatchSize {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	return nil
+}
+
+// resolve loads the node with the given hash from the database.
+func (t *SparseMerkleTree) resolve(hash types.Hash) (node, error) {
+	if t.db == nil {
+		return nil, &tree.MissingNodeError{NodeHash: hash}
+	}
+	blob, err := t.db.Get(hash[:])
+	if err != nil || len(blob) == 0 {
+		return nil, &tree.MissingNodeError{NodeHash: hash}
+	}
+	n, err := decodeNode(hash, blob)
+	if err != nil {
+		return nil, fmt.Errorf("node %x: %v", hash, err)
+	}
+	return n, nil
+}
+
+// encode returns the storage blob of a node.
+func (t *SparseMerkleTree) encode(n node) []byte {
+	switch n := n.(type) {
+	case *leafNode:
+		return encodeLeaf(n.path, n.value)
+	case *innerNode:
+		return encodeInner(t.hash(n.left), t.hash(n.right))
+	default:
+		panic(fmt.Sprintf("%T: can't encode node: %v", n, n))
+	}
+}
@@ -0,0 +1,257 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+func randBytes(n int) []byte {
+	r := make([]byte, n)
+	rand.Read(r)
+	return r
+}
+
+// makeTestTree creates a tree with the given number of random entries.
+func makeTestTree(t *testing.T, n int) (*SparseMerkleTree, map[string][]byte) {
+	smt, err := NewSparseMerkleTree(types.Hash{}, memorydb.New(), nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	content := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		key, val := randBytes(20), randBytes(1+mrand.Intn(64))
+		smt.Update(key, val)
+		content[string(key)] = val
+	}
+	return smt, content
+}
+
+func TestEmptyTree(t *testing.T) {
+	smt, _ := NewSparseMerkleTree(types.Hash{}, nil, nil)
+	if have := smt.Hash(); have != EmptyRoot {
+		t.Errorf("empty root mismatch: have %x, want %x", have, EmptyRoot)
+	}
+	if val, err := smt.TryGet([]byte("key")); val != nil || err != nil {
+		t.Errorf("empty tree returned %x, %v", val, err)
+	}
+	if err := smt.TryDelete([]byte("key")); err != nil {
+		t.Errorf("failed to delete from empty tree: %v", err)
+	}
+	if _, err := smt.Commit(nil); err == nil {
+		t.Errorf("committed tree without database")
+	}
+}
+
+func TestMissingRoot(t *testing.T) {
+	root := types.BytesToHash(randBytes(32))
+	smt, err := NewSparseMerkleTree(root, memorydb.New(), nil)
+	if smt != nil {
+		t.Error("New returned non-nil tree for invalid root")
+	}
+	var missing *tree.MissingNodeError
+	if !errors.As(err, &missing) {
+		t.Errorf("New returned wrong error: %v", err)
+	}
+}
+
+func TestUpdateGetDelete(t *testing.T) {
+	smt, content := makeTestTree(t, 500)
+	for key, val := range content {
+		if have := smt.Get([]byte(key)); !bytes.Equal(have, val) {
+			t.Fatalf("value mismatch for %x: have %x, want %x", key, have, val)
+		}
+	}
+	if have := smt.Get(randBytes(20)); have != nil {
+		t.Fatalf("non-existent key returned %x", have)
+	}
+	// Overwrite some values and delete others
+	deleted := 0
+	for key := range content {
+		if deleted%2 == 0 {
+			smt.Delete([]byte(key))
+			delete(content, key)
+		} else {
+			content[key] = []byte(fmt.Sprintf("updated-%d", deleted))
+			smt.Update([]byte(key), content[key])
+		}
+		deleted++
+		if deleted == 200 {
+			break
+		}
+	}
+	for key, val := range content {
+		if have := smt.Get([]byte(key)); !bytes.Equal(have, val) {
+			t.Fatalf("value mismatch for %x: have %x, want %x", key, have, val)
+		}
+	}
+	// Ensure the tree is the same as one built from the remaining content
+	fresh, _ := NewSparseMerkleTree(types.Hash{}, nil, nil)
+	for key, val := range content {
+		fresh.Update([]byte(key), val)
+	}
+	if have, want := smt.Hash(), fresh.Hash(); have != want {
+		t.Fatalf("root mismatch after deletions: have %x, want %x", have, want)
+	}
+}
+
+// Tests that the tree is canonical: the root hash only depends on the content,
+// not on the order of the updates or deleted intermediate entries.
+func TestCanonicalRoot(t *testing.T) {
+	keys := make([][]byte, 200)
+	for i := range keys {
+		keys[i] = randBytes(8)
+	}
+	var want types.Hash
+	for round := 0; round < 5; round++ {
+		smt, _ := NewSparseMerkleTree(types.Hash{}, nil, nil)
+		for _, i := range mrand.Perm(len(keys)) {
+			smt.Update(keys[i], keys[i])
+		}
+		// Insert and remove some extra junk
+		junk := make([][]byte, 50)
+		for i := range junk {
+			junk[i] = randBytes(8)
+			smt.Update(junk[i], junk[i])
+		}
+		for _, key := range junk {
+			smt.Delete(key)
+		}
+		if round == 0 {
+			want = smt.Hash()
+		} else if have := smt.Hash(); have != want {
+			t.Fatalf("round %d: root mismatch: have %x, want %x", round, have, want)
+		}
+	}
+}
+
+func TestCommitAndReload(t *testing.T) {
+	diskdb := memorydb.New()
+	smt, _ := NewSparseMerkleTree(types.Hash{}, diskdb, tree.Sha256)
+
+	content := make(map[string][]byte)
+	for i := 0; i < 300; i++ {
+		key, val := []byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))
+		smt.Update(key, val)
+		content[string(key)] = val
+	}
+	leaves := 0
+	root, err := smt.Commit(func(leaf []byte, parent types.Hash) error { leaves++; return nil })
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if leaves != len(content) {
+		t.Errorf("leaf callback count mismatch: have %d, want %d", leaves, len(content))
+	}
+	if root != smt.Hash() {
+		t.Errorf("root mismatch after commit: have %x, want %x", smt.Hash(), root)
+	}
+	// Modify the committed tree, only touching the changed leaves
+	smt.Update([]byte("key-0"), []byte("changed"))
+	smt.Delete([]byte("key-1"))
+
+	leaves = 0
+	root2, err := smt.Commit(func(leaf []byte, parent types.Hash) error { leaves++; return nil })
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if leaves > 2 {
+		t.Errorf("unchanged leaves committed again: %d", leaves)
+	}
+	// Both versions must be readable from disk
+	first, err := NewSparseMerkleTree(root, diskdb, tree.Sha256)
+	if err != nil {
+		t.Fatalf("failed to open first version: %v", err)
+	}
+	for key, val := range content {
+		if have := first.Get([]byte(key)); !bytes.Equal(have, val) {
+			t.Fatalf("value mismatch for %s: have %x, want %x", key, have, val)
+		}
+	}
+	second, err := NewSparseMerkleTree(root2, diskdb, tree.Sha256)
+	if err != nil {
+		t.Fatalf("failed to open second version: %v", err)
+	}
+	if have := second.Get([]byte("key-0")); string(have) != "changed" {
+		t.Fatalf("updated value mismatch: have %q", have)
+	}
+	if have := second.Get([]byte("key-1")); have != nil {
+		t.Fatalf("deleted value retained: %q", have)
+	}
+	if have, want := second.Hash(), root2; have != want {
+		t.Fatalf("reloaded root mismatch: have %x, want %x", have, want)
+	}
+	// Opening the tree with a different hash function yields different paths
+	other, _ := NewSparseMerkleTree(root, diskdb, tree.Keccak256)
+	if have := other.Get([]byte("key-2")); have != nil {
+		t.Fatalf("value found with mismatching hash function: %q", have)
+	}
+}
+
+func TestIterator(t *testing.T) {
+	smt, content := makeTestTree(t, 300)
+	root, _ := smt.Commit(nil)
+	smt, _ = NewSparseMerkleTree(root, smt.db, nil)
+
+	var (
+		paths [][]byte
+		found = make(map[types.Hash][]byte)
+		it    = smt.NodeIterator(nil)
+	)
+	for it.Next(true) {
+		if has, _ := smt.db.Has(it.Hash().Bytes()); !has {
+			t.Fatalf("iterated node %x not in database", it.Hash())
+		}
+		if it.Leaf() {
+			paths = append(paths, append([]byte{}, it.LeafKey()...))
+			found[types.BytesToHash(it.LeafKey())] = it.LeafBlob()
+
+			if len(it.LeafProof()) != len(it.Path())+1 {
+				t.Fatalf("leaf proof length mismatch: have %d, want %d", len(it.LeafProof()), len(it.Path())+1)
+			}
+		}
+	}
+	if it.Error() != nil {
+		t.Fatalf("iteration failed: %v", it.Error())
+	}
+	if len(found) != len(content) {
+		t.Fatalf("leaf count mismatch: have %d, want %d", len(found), len(content))
+	}
+	for key, val := range content {
+		if have := found[smt.Path([]byte(key))]; !bytes.Equal(have, val) {
+			t.Fatalf("leaf value mismatch for %x: have %x, want %x", key, have, val)
+		}
+	}
+	for i := 1; i < len(paths); i++ {
+		if bytes.Compare(paths[i-1], paths[i]) >= 0 {
+			t.Fatalf("leaves out of order: %x >= %x", paths[i-1], paths[i])
+		}
+	}
+	// Start the iteration in the middle, both at an existing and a missing path
+	for _, start := range [][]byte{paths[100], append(append([]byte{}, paths[100]...), 0x00)[:31]} {
+		var rest [][]byte
+		for it := smt.NodeIterator(start); it.Next(true); {
+			if it.Leaf() {
+				rest = append(rest, append([]byte{}, it.LeafKey()...))
+			}
+		}
+		want := 0
+		for _, path := range paths {
+			var padded types.Hash
+			copy(padded[:], start)
+			if bytes.Compare(path, padded[:]) >= 0 {
+				want++
+			}
+		}
+		if len(rest) != want {
+			t.Fatalf("start %x: leaf count mismatch: have %d, want %d", start, len(rest), want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package snapshot
+//
+// @author: xwc1125
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// diskLayer is a low level persistent snapshot built on top of a key-value store.
+type diskLayer struct {
+	diskdb kvstore.KeyValueStore // Key-value store containing the base snapshot
+	triedb *tree.Database        // Trie node cache for reconstructing purposes
+	cache  *fastcache.Cache      // Cache to avoid hitting the disk for direct access, nil if disabled
+
+	root  types.Hash // Root hash of the base snapshot
+	stale bool       // Signals that the layer became stale (state progressed)
+
+	lock sync.RWMutex
+}
+
+// Root returns the root hash for which this snapshot was made.
+func (dl *diskLayer) Root() types.Hash {
+	return dl.root
+}
+
+// Parent always returns nil as there's no layer below the disk.
+func (dl *diskLayer) Parent() snapshot {
+	return nil
+}
+
+// Stale return whether this layer has become stale (was flattened across) or if
+// it's still live.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// Account directly retrieves the account trie value associated with a particular
+// hash in the snapshot.
+func (dl *diskLayer) Account(hash types.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	// If the layer was flattened into, consider it invalid (any live reference to
+	// the original should be marked as unusable).
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	// Try to retrieve the account from the memory cache
+	if blob, found := dl.cacheGet(hash[:]); found {
+		return blob, nil
+	}
+	// Cache doesn't contain account, pull from disk and cache for later
+	blob := readAccountSnapshot(dl.diskdb, hash)
+	dl.cacheSet(hash[:], blob)
+
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	return blob, nil
+}
+
+// Storage directly retrieves the storage trie value associated with a particular
+// hash, within a particular account.
+func (dl *diskLayer) Storage(accountHash, storageHash types.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	// If the layer was flattened into, consider it invalid (any live reference to
+	// the original should be marked as unusable).
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	key := append(accountHash[:], storageHash[:]...)
+
+	// Try to retrieve the storage slot from the memory cache
+	if blob, found := dl.cacheGet(key); found {
+		return blob, nil
+	}
+	// Cache doesn't contain storage slot, pull from disk and cache for later
+	blob := readStorageSnapshot(dl.diskdb, accountHash, storageHash)
+	dl.cacheSet(key, blob)
+
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	return blob, nil
+}
+
+// Update creates a new layer on top of the existing snapshot diff tree with
+// the specified data items. Note, the maps are retained by the method to avoid
+// copying everything.
+func (dl *diskLayer) Update(blockHash types.Hash, destructs map[types.Hash]struct{}, accounts map[types.Hash][]byte, storage map[types.Hash]map[types.Hash][]byte) *diffLayer {
+	return newDiffLayer(dl, blockHash, destructs, accounts, storage)
+}
+
+// cacheGet retrieves an entry from the memory cache, reporting whether it was
+// found. Deleted entries are cached as empty blobs.
+func (dl *diskLayer) cacheGet(key []byte) ([]byte, bool) {
+	if dl.cache == nil {
+		return nil, false
+	}
+	blob, found := dl.cache.HasGet(nil, key)
+	if len(blob) == 0 {
+		blob = nil
+	}
+	return blob, found
+}
+
+// cacheSet inserts an entry into the memory cache, if enabled.
+func (dl *diskLayer) cacheSet(key []byte, blob []byte) {
+	if dl.cache != nil {
+		dl.cache.Set(key, blob)
+	}
+}
+
+// cacheDel removes an entry from the memory cache, if enabled.
+func (dl *diskLayer) cacheDel(key []byte) {
+	if dl.cache != nil {
+		dl.cache.Del(key)
+	}
+}
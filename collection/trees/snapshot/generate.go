@@ -0,0 +1,124 @@
+// Package snapshot
+//
+// @author: xwc1125
+package snapshot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// generateSnapshot wipes any previous snapshot data from the database and
+// regenerates the disk layer of the given root from the tries.
+func generateSnapshot(config Config, diskdb kvstore.KeyValueStore, triedb *tree.Database, root types.Hash) error {
+	var (
+		start    = time.Now()
+		batch    = diskdb.NewBatch()
+		accounts int
+		slots    int
+	)
+	flush := func(force bool) error {
+		if !force && batch.ValueSize() < kvstore.IdealBatchSize {
+			return nil
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		return nil
+	}
+	// Invalidate the old snapshot first, so a crash during the generation never
+	// leaves a half generated one behind
+	if err := diskdb.Delete(snapshotRootKey); err != nil {
+		return err
+	}
+	if err := wipeSnapshot(diskdb); err != nil {
+		return err
+	}
+	accTrie, err := tree.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	accIt := tree.NewIterator(accTrie.NodeIterator(nil))
+	for accIt.Next() {
+		if len(accIt.Key) != types.HashLength {
+			return fmt.Errorf("invalid account key %x: not a hash", accIt.Key)
+		}
+		accountHash := types.BytesToHash(accIt.Key)
+		batch.Put(accountSnapshotKey(accountHash), accIt.Value)
+		accounts++
+
+		if config.StorageRoot != nil {
+			storageRoot, err := config.StorageRoot(accIt.Value)
+			if err != nil {
+				return fmt.Errorf("invalid account %x: %v", accIt.Key, err)
+			}
+			storeTrie, err := tree.New(storageRoot, triedb)
+			if err != nil {
+				return err
+			}
+			storeIt := tree.NewIterator(storeTrie.NodeIterator(nil))
+			for storeIt.Next() {
+				if len(storeIt.Key) != types.HashLength {
+					return fmt.Errorf("invalid storage key %x of account %x: not a hash", storeIt.Key, accIt.Key)
+				}
+				batch.Put(storageSnapshotKey(accountHash, types.BytesToHash(storeIt.Key)), storeIt.Value)
+				slots++
+
+				if err := flush(false); err != nil {
+					return err
+				}
+			}
+			if storeIt.Err != nil {
+				return storeIt.Err
+			}
+		}
+		if err := flush(false); err != nil {
+			return err
+		}
+	}
+	if accIt.Err != nil {
+		return accIt.Err
+	}
+	// Everything was generated, mark the snapshot complete
+	batch.Put(snapshotRootKey, root[:])
+	if err := flush(true); err != nil {
+		return err
+	}
+	logger().Info("Generated state snapshot", "root", root, "accounts", accounts, "slots", slots, "elapsed", time.Since(start))
+	return nil
+}
+
+// wipeSnapshot deletes all the account and storage entries of the snapshot from
+// the database.
+func wipeSnapshot(db kvstore.KeyValueStore) error {
+	batch := db.NewBatch()
+	for _, wipe := range []struct {
+		prefix []byte
+		keyLen int
+	}{
+		{accountSnapshotPrefix, len(accountSnapshotPrefix) + types.HashLength},
+		{storageSnapshotPrefix, len(storageSnapshotPrefix) + 2*types.HashLength},
+	} {
+		it := db.NewIteratorWithPrefix(wipe.prefix)
+		for it.Next() {
+			if len(it.Key()) != wipe.keyLen {
+				continue
+			}
+			batch.Delete(it.Key())
+			if batch.ValueSize() >= kvstore.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					it.Release()
+					return err
+				}
+				batch.Reset()
+			}
+		}
+		it.Release()
+	}
+	return batch.Write()
+}
@@ -0,0 +1,410 @@
+// Package snapshot
+//
+// @author: xwc1125
+package snapshot
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// Iterator is an iterator to step over all the accounts or the specific
+// storage in a snapshot which may or may not be composed of multiple layers.
+type Iterator interface {
+	// Next steps the iterator forward one element, returning false if exhausted,
+	// or an error if iteration failed for some reason (e.g. root being iterated
+	// becomes stale and garbage collected).
+	Next() bool
+
+	// Error returns any failure that occurred during iteration, which might have
+	// caused a premature iteration exit (e.g. snapshot stack becoming stale).
+	Error() error
+
+	// Hash returns the hash of the account or storage slot the iterator is
+	// currently at.
+	Hash() types.Hash
+
+	// Release releases associated resources. Release should always succeed and
+	// can be called multiple times without causing error.
+	Release()
+}
+
+// AccountIterator is an iterator to step over all the accounts in a snapshot,
+// which may or may not be composed of multiple layers.
+type AccountIterator interface {
+	Iterator
+
+	// Account returns the account trie value the iterator is currently at.
+	Account() []byte
+}
+
+// StorageIterator is an iterator to step over the specific storage in a snapshot,
+// which may or may not be composed of multiple layers.
+type StorageIterator interface {
+	Iterator
+
+	// Slot returns the storage trie value the iterator is currently at.
+	Slot() []byte
+}
+
+// layerIterator is an iterator over the entries of a single snapshot layer (or
+// a merged set of layers). Entries deleted by a diff layer are yielded with an
+// empty value to hide the entries of the layers below.
+type layerIterator interface {
+	Iterator
+
+	// value returns the trie value the iterator is currently at.
+	value() []byte
+}
+
+// diffIterator is an iterator over the accounts or the storage slots of a single
+// account in a diff layer.
+type diffIterator struct {
+	layer   *diffLayer   // Layer to retrieve the values from
+	account *types.Hash  // Account whose storage is iterated, nil for the accounts
+	keys    []types.Hash // Keys left in the layer to iterate
+	curHash types.Hash   // Current hash the iterator is positioned on
+	fail    error        // Any failures encountered (stale)
+}
+
+// newDiffAccountIterator creates an account iterator over a single diff layer.
+func (dl *diffLayer) newDiffAccountIterator(seek types.Hash) *diffIterator {
+	return &diffIterator{
+		layer: dl,
+		keys:  seekHashes(dl.AccountList(), seek),
+	}
+}
+
+// newDiffStorageIterator creates a storage iterator over a single diff layer,
+// also returning whether the storage of the account was wiped in this layer.
+func (dl *diffLayer) newDiffStorageIterator(account types.Hash, seek types.Hash) (*diffIterator, bool) {
+	keys, destructed := dl.StorageList(account)
+	return &diffIterator{
+		layer:   dl,
+		account: &account,
+		keys:    seekHashes(keys, seek),
+	}, destructed
+}
+
+// Next steps the iterator forward one element, returning false if exhausted.
+func (it *diffIterator) Next() bool {
+	// If the iterator was already stale, consider it a programmer error. Although
+	// we could just return false here, triggering this path would probably mean
+	// somebody forgot to check for Error, so lets blow up instead of undefined
+	// behavior that's hard to debug.
+	if it.fail != nil {
+		panic("snapshot: iterator called after failure")
+	}
+	// Stop iterating if all keys were exhausted
+	if len(it.keys) == 0 {
+		return false
+	}
+	if it.layer.Stale() {
+		it.fail, it.keys = ErrSnapshotStale, nil
+		return false
+	}
+	// Iterator seems to be still alive, retrieve and cache the live hash
+	it.curHash = it.keys[0]
+	it.keys = it.keys[1:]
+	return true
+}
+
+// Error returns any failure that occurred during iteration, which might have
+// caused a premature iteration exit (e.g. snapshot stack becoming stale).
+func (it *diffIterator) Error() error {
+	return it.fail
+}
+
+// Hash returns the hash of the entry the iterator is currently at.
+func (it *diffIterator) Hash() types.Hash {
+	return it.curHash
+}
+
+// value returns the trie value the iterator is currently at, an empty one if it
+// was deleted in this layer.
+func (it *diffIterator) value() []byte {
+	it.layer.lock.RLock()
+	defer it.layer.lock.RUnlock()
+
+	if it.account == nil {
+		return it.layer.accountData[it.curHash]
+	}
+	return it.layer.storageData[*it.account][it.curHash]
+}
+
+// Release is a noop for diff iterators as there are no held resources.
+func (it *diffIterator) Release() {}
+
+// diskIterator is an iterator over the accounts or the storage slots of a single
+// account in the disk layer.
+type diskIterator struct {
+	layer  *diskLayer
+	prefix []byte
+	it     kvstore.Iterator
+	fail   error
+}
+
+// newDiskAccountIterator creates an account iterator over the disk layer.
+func (dl *diskLayer) newDiskAccountIterator(seek types.Hash) *diskIterator {
+	return dl.newDiskIterator(accountSnapshotPrefix, seek)
+}
+
+// newDiskStorageIterator creates a storage iterator over the disk layer.
+func (dl *diskLayer) newDiskStorageIterator(account types.Hash, seek types.Hash) *diskIterator {
+	return dl.newDiskIterator(storageSnapshotsKey(account), seek)
+}
+
+// newDiskIterator creates an iterator over the snapshot entries with the given
+// key prefix, starting at the seek hash.
+func (dl *diskLayer) newDiskIterator(prefix []byte, seek types.Hash) *diskIterator {
+	start := append(append([]byte{}, prefix...), seek[:]...)
+	return &diskIterator{
+		layer:  dl,
+		prefix: prefix,
+		it:     dl.diskdb.NewIteratorWithStart(start),
+	}
+}
+
+// Next steps the iterator forward one element, returning false if exhausted.
+func (it *diskIterator) Next() bool {
+	// If the iterator was already exhausted, don't bother
+	if it.it == nil {
+		return false
+	}
+	if it.layer.Stale() {
+		it.fail = ErrSnapshotStale
+		it.Release()
+		return false
+	}
+	for it.it.Next() {
+		key := it.it.Key()
+		if !bytes.HasPrefix(key, it.prefix) {
+			break
+		}
+		// Skip any unrelated entries sharing the prefix
+		if len(key) == len(it.prefix)+types.HashLength {
+			return true
+		}
+	}
+	it.fail = it.it.Error()
+	it.Release()
+	return false
+}
+
+// Error returns any failure that occurred during iteration, which might have
+// caused a premature iteration exit (e.g. snapshot stack becoming stale).
+func (it *diskIterator) Error() error {
+	return it.fail
+}
+
+// Hash returns the hash of the entry the iterator is currently at.
+func (it *diskIterator) Hash() types.Hash {
+	if it.it == nil {
+		return types.Hash{}
+	}
+	return types.BytesToHash(it.it.Key()[len(it.prefix):])
+}
+
+// value returns the trie value the iterator is currently at.
+func (it *diskIterator) value() []byte {
+	if it.it == nil {
+		return nil
+	}
+	return it.it.Value()
+}
+
+// Release releases the database snapshot held during iteration.
+func (it *diskIterator) Release() {
+	// The iterator is auto-released on exhaustion, so make sure it's still alive
+	if it.it != nil {
+		it.it.Release()
+		it.it = nil
+	}
+}
+
+// binaryIterator is a simplistic iterator to step over the entries in a snapshot,
+// which may or may not be composed of multiple layers. It merges the entries of
+// a layer with the merged entries of the layers below, the upper layer taking
+// precedence, and skips the deleted ones.
+type binaryIterator struct {
+	a     layerIterator // Iterator of the upper layer, might yield deletions
+	b     layerIterator // Iterator of the layers below, nil if there are none
+	aDone bool
+	bDone bool
+	k     types.Hash
+	v     []byte
+	fail  error
+}
+
+// newBinaryIterator creates a merged iterator of an upper and a lower iterator.
+// The lower iterator may be nil if the upper layer hides everything below.
+func newBinaryIterator(a, b layerIterator) *binaryIterator {
+	it := &binaryIterator{a: a, b: b}
+	it.aDone = !it.a.Next()
+	it.bDone = b == nil || !it.b.Next()
+	return it
+}
+
+// newBinaryAccountIterator creates a simplistic account iterator over the diff
+// layers down to the disk layer.
+func (dl *diffLayer) newBinaryAccountIterator(seek types.Hash) *binaryIterator {
+	var below layerIterator
+	switch parent := dl.Parent().(type) {
+	case *diffLayer:
+		below = parent.newBinaryAccountIterator(seek)
+	case *diskLayer:
+		below = parent.newDiskAccountIterator(seek)
+	}
+	return newBinaryIterator(dl.newDiffAccountIterator(seek), below)
+}
+
+// newBinaryStorageIterator creates a simplistic storage iterator over the diff
+// layers down to the disk layer.
+func (dl *diffLayer) newBinaryStorageIterator(account types.Hash, seek types.Hash) *binaryIterator {
+	diff, destructed := dl.newDiffStorageIterator(account, seek)
+	if destructed {
+		// The storage was wiped in this layer, nothing below is relevant
+		return newBinaryIterator(diff, nil)
+	}
+	var below layerIterator
+	switch parent := dl.Parent().(type) {
+	case *diffLayer:
+		below = parent.newBinaryStorageIterator(account, seek)
+	case *diskLayer:
+		below = parent.newDiskStorageIterator(account, seek)
+	}
+	return newBinaryIterator(diff, below)
+}
+
+// AccountIterator creates an account iterator over a diff layer and all the
+// layers below.
+func (dl *diffLayer) AccountIterator(seek types.Hash) AccountIterator {
+	return dl.newBinaryAccountIterator(seek)
+}
+
+// StorageIterator creates a storage iterator over a diff layer and all the
+// layers below.
+func (dl *diffLayer) StorageIterator(account types.Hash, seek types.Hash) StorageIterator {
+	return dl.newBinaryStorageIterator(account, seek)
+}
+
+// AccountIterator creates an account iterator over the disk layer.
+func (dl *diskLayer) AccountIterator(seek types.Hash) AccountIterator {
+	return newBinaryIterator(dl.newDiskAccountIterator(seek), nil)
+}
+
+// StorageIterator creates a storage iterator over the disk layer.
+func (dl *diskLayer) StorageIterator(account types.Hash, seek types.Hash) StorageIterator {
+	return newBinaryIterator(dl.newDiskStorageIterator(account, seek), nil)
+}
+
+// Next steps the iterator forward one element, returning false if exhausted,
+// or an error if iteration failed for some reason (e.g. root being iterated
+// becomes stale and garbage collected).
+func (it *binaryIterator) Next() bool {
+	for {
+		if it.fail != nil {
+			return false
+		}
+		if it.aDone && it.bDone {
+			return false
+		}
+		// Pick the lowest entry, the upper layer overriding the ones below
+		var advanceA, advanceB bool
+		switch {
+		case it.bDone:
+			advanceA = true
+		case it.aDone:
+			advanceB = true
+		default:
+			diff := compareHash(it.a.Hash(), it.b.Hash())
+			advanceA, advanceB = diff <= 0, diff >= 0
+		}
+		// The values of the disk iterators are only valid until the next step,
+		// copy them before stepping could invalidate them
+		var (
+			hash  types.Hash
+			value []byte
+		)
+		if advanceA {
+			hash, value = it.a.Hash(), it.a.value()
+		} else {
+			hash, value = it.b.Hash(), it.b.value()
+		}
+		if len(value) > 0 {
+			value = append([]byte{}, value...)
+		}
+		if advanceA {
+			it.aDone = !it.a.Next()
+		}
+		if advanceB {
+			it.bDone = !it.b.Next()
+		}
+		if err := it.a.Error(); err != nil {
+			it.fail = err
+			return false
+		}
+		if it.b != nil {
+			if err := it.b.Error(); err != nil {
+				it.fail = err
+				return false
+			}
+		}
+		// Skip the entries deleted in an upper layer
+		if len(value) == 0 {
+			continue
+		}
+		it.k, it.v = hash, value
+		return true
+	}
+}
+
+// Error returns any failure that occurred during iteration, which might have
+// caused a premature iteration exit (e.g. snapshot stack becoming stale).
+func (it *binaryIterator) Error() error {
+	return it.fail
+}
+
+// Hash returns the hash of the entry the iterator is currently at.
+func (it *binaryIterator) Hash() types.Hash {
+	return it.k
+}
+
+// Account returns the account trie value the iterator is currently at.
+func (it *binaryIterator) Account() []byte {
+	return it.v
+}
+
+// Slot returns the storage trie value the iterator is currently at.
+func (it *binaryIterator) Slot() []byte {
+	return it.v
+}
+
+// value returns the trie value the iterator is currently at.
+func (it *binaryIterator) value() []byte {
+	return it.v
+}
+
+// Release recursively releases all the iterators in the stack.
+func (it *binaryIterator) Release() {
+	it.a.Release()
+	if it.b != nil {
+		it.b.Release()
+	}
+}
+
+// seekHashes returns the part of a sorted hash list starting at the seek hash.
+func seekHashes(hashes []types.Hash, seek types.Hash) []types.Hash {
+	index := sort.Search(len(hashes), func(i int) bool {
+		return compareHash(hashes[i], seek) >= 0
+	})
+	return hashes[index:]
+}
+
+// compareHash compares two hashes lexicographically.
+func compareHash(a, b types.Hash) int {
+	return bytes.Compare(a[:], b[:])
+}
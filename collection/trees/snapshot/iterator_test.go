@@ -0,0 +1,208 @@
+package snapshot
+
+import (
+	"bytes"
+	mrand "math/rand"
+	"sort"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// collectIterator drains an iterator into a list of hashes and a map of values.
+func collectIterator(t *testing.T, it Iterator, value func() []byte) ([]types.Hash, map[types.Hash][]byte) {
+	t.Helper()
+	defer it.Release()
+
+	var (
+		hashes []types.Hash
+		values = make(map[types.Hash][]byte)
+	)
+	for it.Next() {
+		hashes = append(hashes, it.Hash())
+		values[it.Hash()] = value()
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	return hashes, values
+}
+
+// checkIterated checks that the iterated entries are the non-deleted entries of
+// the expected content in ascending order, starting at seek.
+func checkIterated(t *testing.T, hashes []types.Hash, values map[types.Hash][]byte, want map[types.Hash][]byte, seek types.Hash) {
+	t.Helper()
+
+	var expected []types.Hash
+	for hash, value := range want {
+		if len(value) > 0 && compareHash(hash, seek) >= 0 {
+			expected = append(expected, hash)
+		}
+	}
+	sortHashes(expected)
+
+	if len(hashes) != len(expected) {
+		t.Fatalf("iterated entry count mismatch: have %d, want %d", len(hashes), len(expected))
+	}
+	for i, hash := range hashes {
+		if hash != expected[i] {
+			t.Fatalf("entry %d mismatch: have %x, want %x", i, hash, expected[i])
+		}
+		if !bytes.Equal(values[hash], want[hash]) {
+			t.Fatalf("entry %x value mismatch: have %x, want %x", hash, values[hash], want[hash])
+		}
+	}
+}
+
+// Tests that iterating over a stack of diff layers yields the merged content of
+// all of them, in order and without the deleted entries.
+func TestIterators(t *testing.T) {
+	triedb, root, state := makeTestState(t, 100, 10)
+	snaps, err := New(testConfig, memorydb.New(), triedb, root)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	var (
+		accounts = make(map[types.Hash][]byte)
+		storage  = make(map[types.Hash]map[types.Hash][]byte)
+		known    []types.Hash
+	)
+	for account, blob := range state.accounts {
+		accounts[account] = blob
+		storage[account] = make(map[types.Hash][]byte)
+		for slot, value := range state.storage[account] {
+			storage[account][slot] = value
+		}
+		known = append(known, account)
+	}
+	sort.Slice(known, func(i, j int) bool { return compareHash(known[i], known[j]) < 0 })
+
+	for layer := 0; layer < 8; layer++ {
+		var (
+			destructs = make(map[types.Hash]struct{})
+			diffAccs  = make(map[types.Hash][]byte)
+			diffStore = make(map[types.Hash]map[types.Hash][]byte)
+		)
+		for i := 0; i < 20; i++ {
+			account := known[mrand.Intn(len(known))]
+			switch mrand.Intn(4) {
+			case 0:
+				// Delete the account along with its storage
+				destructs[account] = struct{}{}
+				diffAccs[account] = nil
+				delete(diffStore, account)
+				accounts[account] = nil
+				storage[account] = make(map[types.Hash][]byte)
+			case 1:
+				// Create a brand new account
+				account = randomHash()
+				known = append(known, account)
+				diffAccs[account] = randomValue()
+				accounts[account] = diffAccs[account]
+				storage[account] = map[types.Hash][]byte{randomHash(): randomValue()}
+				diffStore[account] = make(map[types.Hash][]byte)
+				for slot, value := range storage[account] {
+					diffStore[account][slot] = value
+				}
+			default:
+				// Update the account and some of its slots
+				diffAccs[account] = randomValue()
+				accounts[account] = diffAccs[account]
+				if diffStore[account] == nil {
+					diffStore[account] = make(map[types.Hash][]byte)
+				}
+				for slot := range storage[account] {
+					if mrand.Intn(3) == 0 {
+						diffStore[account][slot] = nil
+						storage[account][slot] = nil
+					}
+				}
+				slot := randomHash()
+				diffStore[account][slot] = randomValue()
+				storage[account][slot] = diffStore[account][slot]
+			}
+		}
+		parent := root
+		root = randomHash()
+		if err := snaps.Update(root, parent, destructs, diffAccs, diffStore); err != nil {
+			t.Fatalf("failed to create layer %d: %v", layer, err)
+		}
+		// Iterate the accounts from the start and from a random position
+		for _, seek := range []types.Hash{{}, randomHash()} {
+			it, err := snaps.AccountIterator(root, seek)
+			if err != nil {
+				t.Fatalf("failed to create account iterator: %v", err)
+			}
+			hashes, values := collectIterator(t, it, it.Account)
+			checkIterated(t, hashes, values, accounts, seek)
+		}
+		// Iterate the storage of a few accounts
+		for i := 0; i < 10; i++ {
+			account, seek := known[mrand.Intn(len(known))], types.Hash{}
+			if i%2 == 1 {
+				seek = randomHash()
+			}
+			it, err := snaps.StorageIterator(root, account, seek)
+			if err != nil {
+				t.Fatalf("failed to create storage iterator: %v", err)
+			}
+			hashes, values := collectIterator(t, it, it.Slot)
+			checkIterated(t, hashes, values, storage[account], seek)
+		}
+	}
+	// Flatten some of the layers and ensure the iteration is unaffected
+	if err := snaps.Cap(root, 3); err != nil {
+		t.Fatalf("failed to cap: %v", err)
+	}
+	it, _ := snaps.AccountIterator(root, types.Hash{})
+	hashes, values := collectIterator(t, it, it.Account)
+	checkIterated(t, hashes, values, accounts, types.Hash{})
+
+	for account := range accounts {
+		it, _ := snaps.StorageIterator(root, account, types.Hash{})
+		hashes, values := collectIterator(t, it, it.Slot)
+		checkIterated(t, hashes, values, storage[account], types.Hash{})
+	}
+}
+
+// Tests that iterators over layers becoming stale abort with an error.
+func TestIteratorStale(t *testing.T) {
+	triedb, root, state := makeTestState(t, 50, 1)
+	snaps, err := New(testConfig, memorydb.New(), triedb, root)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	var accounts []types.Hash
+	for account := range state.accounts {
+		accounts = append(accounts, account)
+	}
+	roots := []types.Hash{root}
+	for i := 0; i < 3; i++ {
+		roots = append(roots, randomHash())
+		snaps.Update(roots[i+1], roots[i], nil, map[types.Hash][]byte{accounts[i]: {byte(i)}}, nil)
+	}
+	diskIt, _ := snaps.AccountIterator(roots[0], types.Hash{})
+	diffIt, _ := snaps.AccountIterator(roots[1], types.Hash{})
+	defer diskIt.Release()
+	defer diffIt.Release()
+
+	if !diskIt.Next() || !diffIt.Next() {
+		t.Fatalf("iterators empty")
+	}
+	if err := snaps.Cap(roots[3], 1); err != nil {
+		t.Fatalf("failed to cap: %v", err)
+	}
+	for _, it := range []AccountIterator{diskIt, diffIt} {
+		for it.Next() {
+		}
+		if err := it.Error(); err != ErrSnapshotStale {
+			t.Fatalf("stale iterator error mismatch: have %v, want %v", err, ErrSnapshotStale)
+		}
+	}
+	// Iterators of the live layers must be unaffected
+	it, _ := snaps.AccountIterator(roots[3], types.Hash{})
+	if hashes, _ := collectIterator(t, it, it.Account); len(hashes) != len(accounts) {
+		t.Fatalf("live iterator entry count mismatch: have %d, want %d", len(hashes), len(accounts))
+	}
+}
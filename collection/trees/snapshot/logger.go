@@ -0,0 +1,10 @@
+// Package snapshot
+//
+// @author: xwc1125
+package snapshot
+
+import log "github.com/chain5j/logger"
+
+func logger() log.Logger {
+	return log.Log("snapshot")
+}
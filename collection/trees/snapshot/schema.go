@@ -0,0 +1,55 @@
+// Package snapshot
+//
+// @author: xwc1125
+package snapshot
+
+import (
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+var (
+	// snapshotRootKey tracks the hash of the trie root the persisted disk layer
+	// of the snapshot is at.
+	snapshotRootKey = []byte("SnapshotRoot")
+
+	accountSnapshotPrefix = []byte("a") // accountSnapshotPrefix + account hash -> account trie value
+	storageSnapshotPrefix = []byte("o") // storageSnapshotPrefix + account hash + storage hash -> storage trie value
+)
+
+// accountSnapshotKey = accountSnapshotPrefix + hash
+func accountSnapshotKey(hash types.Hash) []byte {
+	return append(append([]byte{}, accountSnapshotPrefix...), hash[:]...)
+}
+
+// storageSnapshotKey = storageSnapshotPrefix + account hash + storage hash
+func storageSnapshotKey(accountHash, storageHash types.Hash) []byte {
+	return append(storageSnapshotsKey(accountHash), storageHash[:]...)
+}
+
+// storageSnapshotsKey = storageSnapshotPrefix + account hash
+func storageSnapshotsKey(accountHash types.Hash) []byte {
+	return append(append([]byte{}, storageSnapshotPrefix...), accountHash[:]...)
+}
+
+// readSnapshotRoot retrieves the root of the persisted disk layer, or an empty
+// hash if no snapshot is available.
+func readSnapshotRoot(db kvstore.KeyValueReader) types.Hash {
+	data, _ := db.Get(snapshotRootKey)
+	if len(data) != types.HashLength {
+		return types.Hash{}
+	}
+	return types.BytesToHash(data)
+}
+
+// readAccountSnapshot retrieves the snapshot entry of an account trie leaf.
+func readAccountSnapshot(db kvstore.KeyValueReader, hash types.Hash) []byte {
+	data, _ := db.Get(accountSnapshotKey(hash))
+	return data
+}
+
+// readStorageSnapshot retrieves the snapshot entry of a storage trie leaf.
+func readStorageSnapshot(db kvstore.KeyValueReader, accountHash, storageHash types.Hash) []byte {
+	data, _ := db.Get(storageSnapshotKey(accountHash, storageHash))
+	return data
+}
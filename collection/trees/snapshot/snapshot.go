@@ -0,0 +1,475 @@
+// Package snapshot
+//
+// @author: xwc1125
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+var (
+	// ErrSnapshotStale is returned from data accessors if the underlying snapshot
+	// layer had been invalidated due to the chain progressing forward far enough
+	// to not maintain the layer's original state.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// errSnapshotCycle is returned if a snapshot is attempted to be inserted
+	// that forms a cycle in the snapshot tree.
+	errSnapshotCycle = errors.New("snapshot cycle")
+)
+
+// Snapshot represents the functionality supported by a snapshot storage layer.
+//
+// The keys of the snapshot are the leaf keys of the tries, so for secure tries
+// the hashes of the original keys, and the values are the raw leaf values.
+type Snapshot interface {
+	// Root returns the root hash for which this snapshot was made.
+	Root() types.Hash
+
+	// Account directly retrieves the account trie value associated with a
+	// particular hash in the snapshot. A nil value means the account does not
+	// exist.
+	Account(hash types.Hash) ([]byte, error)
+
+	// Storage directly retrieves the storage trie value associated with a
+	// particular hash, within a particular account.
+	Storage(accountHash, storageHash types.Hash) ([]byte, error)
+}
+
+// snapshot is the internal version of the snapshot data layer that supports some
+// additional methods compared to the public API.
+type snapshot interface {
+	Snapshot
+
+	// Parent returns the subsequent layer of a snapshot, or nil if the base was
+	// reached.
+	Parent() snapshot
+
+	// Update creates a new layer on top of the existing snapshot diff tree with
+	// the specified data items.
+	//
+	// Note, the maps are retained by the method to avoid copying everything.
+	Update(blockRoot types.Hash, destructs map[types.Hash]struct{}, accounts map[types.Hash][]byte, storage map[types.Hash]map[types.Hash][]byte) *diffLayer
+
+	// Stale return whether this layer has become stale (was flattened across) or
+	// if it's still live.
+	Stale() bool
+
+	// AccountIterator creates an account iterator over the account trie given by
+	// the root of this layer.
+	AccountIterator(seek types.Hash) AccountIterator
+
+	// StorageIterator creates a storage iterator over the storage trie of the
+	// given account, as of this layer.
+	StorageIterator(account types.Hash, seek types.Hash) StorageIterator
+}
+
+// Config contains the settings of the snapshot tree.
+type Config struct {
+	CacheSize int // Memory allowance (MB) to use for caching the disk layer entries
+
+	// StorageRoot extracts the root of the storage trie from an account trie
+	// value. If nil, only the account trie is tracked by the snapshot. An empty
+	// hash or the empty root of the trie means the account has no storage.
+	StorageRoot func(account []byte) (types.Hash, error)
+}
+
+// Tree is a snapshot tree of an account trie and its storage tries. It consists
+// of one persistent base layer backed by a key-value store, on top of which
+// arbitrarily many in-memory diff layers are topped. The memory diffs can form a tree with branching, but
+// the disk layer is singleton and common to all. If a reorg goes deeper than the
+// disk layer, everything needs to be deleted.
+//
+// The goal of a state snapshot is twofold: to allow direct access to account and
+// storage data to avoid expensive multi-level trie lookups; and to allow sorted,
+// cheap iteration of the account/storage tries for sync aid. The tries remain
+// the authoritative data, the snapshot can be regenerated from them at any time.
+type Tree struct {
+	config Config                  // Snapshots configurations
+	diskdb kvstore.KeyValueStore   // Persistent database to store the snapshot
+	triedb *tree.Database          // In-memory cache to access the trie through
+	layers map[types.Hash]snapshot // Collection of all known layers
+	lock   sync.RWMutex
+}
+
+// New attempts to load an already existing snapshot from a persistent key-value
+// store. If the snapshot is missing or its root doesn't match the given one, the
+// snapshot is regenerated from the tries in triedb. The diff layers are kept in
+// memory only, they are lost on restart.
+//
+// Note, the generation iterates all the tries synchronously, which may take a
+// long time for large states.
+func New(config Config, diskdb kvstore.KeyValueStore, triedb *tree.Database, root types.Hash) (*Tree, error) {
+	snap := &Tree{
+		config: config,
+		diskdb: diskdb,
+		triedb: triedb,
+		layers: make(map[types.Hash]snapshot),
+	}
+	var cache *fastcache.Cache
+	if config.CacheSize > 0 {
+		cache = fastcache.New(config.CacheSize * 1024 * 1024)
+	}
+	if readSnapshotRoot(diskdb) != root {
+		if err := generateSnapshot(config, diskdb, triedb, root); err != nil {
+			return nil, err
+		}
+	}
+	base := &diskLayer{
+		diskdb: diskdb,
+		triedb: triedb,
+		cache:  cache,
+		root:   root,
+	}
+	snap.layers[root] = base
+	return snap, nil
+}
+
+// Snapshot retrieves a snapshot belonging to the given block root, or nil if no
+// snapshot is maintained for that block.
+func (t *Tree) Snapshot(blockRoot types.Hash) Snapshot {
+	if snap := t.layer(blockRoot); snap != nil {
+		return snap
+	}
+	return nil
+}
+
+// layer retrieves the internal snapshot layer belonging to the given block root.
+func (t *Tree) layer(blockRoot types.Hash) snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.layers[blockRoot]
+}
+
+// DiskRoot returns the root of the persisted disk layer.
+func (t *Tree) DiskRoot() types.Hash {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for _, layer := range t.layers {
+		if disk, ok := layer.(*diskLayer); ok {
+			return disk.Root()
+		}
+	}
+	return types.Hash{}
+}
+
+// Update adds a new snapshot into the tree, if that can be linked to an existing
+// old parent. It is disallowed to insert a disk layer (the origin of all).
+//
+// The destructs are the accounts whose storage was wiped, accounts and storage
+// hold the changed trie values, an empty value meaning a deletion.
+func (t *Tree) Update(blockRoot types.Hash, parentRoot types.Hash, destructs map[types.Hash]struct{}, accounts map[types.Hash][]byte, storage map[types.Hash]map[types.Hash][]byte) error {
+	// Reject noop updates to avoid self-loops in the snapshot tree. This is a
+	// special case that can only happen for empty blocks, which must not be
+	// tracked by a new layer.
+	if blockRoot == parentRoot {
+		return errSnapshotCycle
+	}
+	// Generate a new snapshot on top of the parent
+	parent := t.layer(parentRoot)
+	if parent == nil {
+		return fmt.Errorf("parent [%#x] snapshot missing", parentRoot)
+	}
+	snap := parent.Update(blockRoot, destructs, accounts, storage)
+
+	// Save the new snapshot for later
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.layers[snap.root] = snap
+	return nil
+}
+
+// Cap traverses downwards the snapshot tree from a head block hash until the
+// number of allowed layers are crossed. All layers beyond the permitted number
+// are flattened downwards and persisted into the disk layer, any fork branching
+// off below the new disk layer is discarded. Zero layers flatten everything.
+func (t *Tree) Cap(root types.Hash, layers int) error {
+	// Retrieve the head snapshot to cap from
+	snap := t.layer(root)
+	if snap == nil {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	diff, ok := snap.(*diffLayer)
+	if !ok {
+		return fmt.Errorf("snapshot [%#x] is disk layer", root)
+	}
+	// Run the internal capping and discard all stale layers
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if layers == 0 {
+		// If full commit was requested, flatten the diffs and merge onto disk
+		diff.lock.RLock()
+		base, err := diffToDisk(diff.flatten().(*diffLayer))
+		diff.lock.RUnlock()
+		if err != nil {
+			return err
+		}
+		// Replace the entire snapshot tree with the flat base
+		t.layers = map[types.Hash]snapshot{base.root: base}
+		return nil
+	}
+	base, err := t.cap(diff, layers)
+	if err != nil {
+		return err
+	}
+	if base == nil {
+		return nil
+	}
+	// Remove any layer that is stale or links into a stale layer, which also
+	// drops the forks that branched off below the new disk layer.
+	for root, layer := range t.layers {
+		if !linked(layer, base) {
+			delete(t.layers, root)
+		}
+	}
+	return nil
+}
+
+// cap traverses downwards the diff tree until the number of allowed layers are
+// crossed. All diffs beyond the permitted number are flattened downwards and
+// persisted into a new disk layer, which is returned. If no capping was needed,
+// nil is returned.
+func (t *Tree) cap(diff *diffLayer, layers int) (*diskLayer, error) {
+	// Dive until we run out of layers or reach the persistent database
+	for i := 0; i < layers-1; i++ {
+		// If we still have diff layers below, continue down
+		if parent, ok := diff.parent.(*diffLayer); ok {
+			diff = parent
+		} else {
+			// Diff stack too shallow, return without modifications
+			return nil, nil
+		}
+	}
+	parent, ok := diff.parent.(*diffLayer)
+	if !ok {
+		// The parent is the disk layer, nothing to cap
+		return nil, nil
+	}
+	// Hold the write lock until the new disk layer is linked correctly
+	diff.lock.Lock()
+	defer diff.lock.Unlock()
+
+	// Flatten the parent into the bottom-most diff layer and persist that
+	base, err := diffToDisk(parent.flatten().(*diffLayer))
+	if err != nil {
+		return nil, err
+	}
+	t.layers[base.root] = base
+	diff.parent = base
+	return base, nil
+}
+
+// linked reports whether a snapshot layer is still live, reaching the given disk
+// layer through non-stale layers only.
+func linked(layer snapshot, base *diskLayer) bool {
+	for ; layer != nil; layer = layer.Parent() {
+		if layer.Stale() {
+			return false
+		}
+		if disk, ok := layer.(*diskLayer); ok {
+			return disk == base
+		}
+	}
+	return false
+}
+
+// diffToDisk merges a bottom-most diff into the persistent disk layer underneath
+// it. The method will panic if called onto a non-bottom-most diff layer.
+func diffToDisk(bottom *diffLayer) (*diskLayer, error) {
+	var (
+		base  = bottom.parent.(*diskLayer)
+		batch = base.diskdb.NewBatch()
+	)
+	flush := func() error {
+		if batch.ValueSize() < kvstore.IdealBatchSize {
+			return nil
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		return nil
+	}
+	// Start by temporarily deleting the current snapshot root marker. This
+	// ensures that in the case of a crash, the entire snapshot is invalidated.
+	if err := batch.Delete(snapshotRootKey); err != nil {
+		return nil, err
+	}
+	// Mark the original base as stale as we're going to create a new wrapper
+	base.lock.Lock()
+	if base.stale {
+		panic("parent disk layer is stale") // we've committed into the same base from two children, boo
+	}
+	base.stale = true
+	base.lock.Unlock()
+
+	// Destroy all the destructed accounts from the database
+	for hash := range bottom.destructSet {
+		batch.Delete(accountSnapshotKey(hash))
+		base.cacheDel(hash[:])
+
+		prefix := storageSnapshotsKey(hash)
+		it := base.diskdb.NewIteratorWithPrefix(prefix)
+		for it.Next() {
+			if key := it.Key(); len(key) == len(prefix)+types.HashLength {
+				batch.Delete(key)
+				base.cacheDel(key[len(storageSnapshotPrefix):])
+			}
+			if err := flush(); err != nil {
+				it.Release()
+				return nil, err
+			}
+		}
+		if err := it.Error(); err != nil {
+			it.Release()
+			return nil, err
+		}
+		it.Release()
+	}
+	// Push all updated accounts into the database
+	for hash, data := range bottom.accountData {
+		if len(data) > 0 {
+			batch.Put(accountSnapshotKey(hash), data)
+		} else {
+			batch.Delete(accountSnapshotKey(hash))
+		}
+		base.cacheSet(hash[:], data)
+
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	// Push all the storage slots into the database
+	for accountHash, storage := range bottom.storageData {
+		for storageHash, data := range storage {
+			key := storageSnapshotKey(accountHash, storageHash)
+			if len(data) > 0 {
+				batch.Put(key, data)
+			} else {
+				batch.Delete(key)
+			}
+			base.cacheSet(key[len(storageSnapshotPrefix):], data)
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	// Update the snapshot root marker and write any remainder data
+	batch.Put(snapshotRootKey, bottom.root[:])
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	logger().Debug("Journalled disk layer", "root", bottom.root)
+
+	bottom.markStale()
+	return &diskLayer{
+		root:   bottom.root,
+		cache:  base.cache,
+		diskdb: base.diskdb,
+		triedb: base.triedb,
+	}, nil
+}
+
+// AccountIterator creates a new account iterator for the specified root hash and
+// seeks to a starting account hash.
+func (t *Tree) AccountIterator(root types.Hash, seek types.Hash) (AccountIterator, error) {
+	snap := t.layer(root)
+	if snap == nil {
+		return nil, fmt.Errorf("unknown snapshot: %x", root)
+	}
+	return snap.AccountIterator(seek), nil
+}
+
+// StorageIterator creates a new storage iterator for the specified root hash and
+// account. The iterator will be moved to the specific start position.
+func (t *Tree) StorageIterator(root types.Hash, account types.Hash, seek types.Hash) (StorageIterator, error) {
+	snap := t.layer(root)
+	if snap == nil {
+		return nil, fmt.Errorf("unknown snapshot: %x", root)
+	}
+	return snap.StorageIterator(account, seek), nil
+}
+
+// Verify iterates the whole state (all the accounts as well as the corresponding
+// storages) with the specific root and compares the re-computed hash with the
+// original one.
+func (t *Tree) Verify(root types.Hash) error {
+	acctIt, err := t.AccountIterator(root, types.Hash{})
+	if err != nil {
+		return err
+	}
+	defer acctIt.Release()
+
+	got, err := t.stackRoot(acctIt, acctIt.Account, func(account types.Hash, blob []byte) error {
+		if t.config.StorageRoot == nil {
+			return nil
+		}
+		want, err := t.config.StorageRoot(blob)
+		if err != nil {
+			return err
+		}
+		storageIt, err := t.StorageIterator(root, account, types.Hash{})
+		if err != nil {
+			return err
+		}
+		defer storageIt.Release()
+
+		have, err := t.stackRoot(storageIt, storageIt.Slot, nil)
+		if err != nil {
+			return err
+		}
+		if have != want && !(want == (types.Hash{}) && have == t.emptyRoot()) {
+			return fmt.Errorf("storage root mismatch for account %#x: have %#x, want %#x", account, have, want)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if got != root {
+		return fmt.Errorf("state root hash mismatch: got %x, want %x", got, root)
+	}
+	return nil
+}
+
+// stackRoot computes the root hash of the trie the entries of an iterator were
+// taken from, calling onleaf for every entry.
+func (t *Tree) stackRoot(it Iterator, value func() []byte, onleaf func(hash types.Hash, blob []byte) error) (types.Hash, error) {
+	st, err := tree.NewStackTrieWithHasher(nil, t.triedb.HashFunc())
+	if err != nil {
+		return types.Hash{}, err
+	}
+	for it.Next() {
+		hash, blob := it.Hash(), value()
+		if onleaf != nil {
+			if err := onleaf(hash, blob); err != nil {
+				return types.Hash{}, err
+			}
+		}
+		if err := st.TryUpdate(hash[:], blob); err != nil {
+			return types.Hash{}, err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return types.Hash{}, err
+	}
+	return st.Hash(), nil
+}
+
+// emptyRoot returns the root hash of an empty trie with the hash function of the
+// trie database.
+func (t *Tree) emptyRoot() types.Hash {
+	st, _ := tree.NewStackTrieWithHasher(nil, t.triedb.HashFunc())
+	return st.Hash()
+}
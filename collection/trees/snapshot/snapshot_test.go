@@ -0,0 +1,431 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// testAccount is the account trie value used by the tests, pointing to the root
+// of its storage trie.
+type testAccount struct {
+	Nonce uint64
+	Root  types.Hash
+}
+
+func testStorageRoot(blob []byte) (types.Hash, error) {
+	var account testAccount
+	if err := rlp.DecodeBytes(blob, &account); err != nil {
+		return types.Hash{}, err
+	}
+	return account.Root, nil
+}
+
+var testConfig = Config{CacheSize: 16, StorageRoot: testStorageRoot}
+
+func randomHash() types.Hash {
+	var hash types.Hash
+	rand.Read(hash[:])
+	return hash
+}
+
+func randomValue() []byte {
+	value := make([]byte, 16)
+	rand.Read(value)
+	return value
+}
+
+// testState is the expected flat content of a state.
+type testState struct {
+	accounts map[types.Hash][]byte
+	storage  map[types.Hash]map[types.Hash][]byte
+}
+
+// makeTestState creates an account trie with the given number of accounts, each
+// with a storage trie of the given number of slots, committed into a fresh trie
+// database.
+func makeTestState(t *testing.T, accounts, slots int) (*tree.Database, types.Hash, *testState) {
+	triedb := tree.NewDatabase(memorydb.New())
+	state := &testState{
+		accounts: make(map[types.Hash][]byte),
+		storage:  make(map[types.Hash]map[types.Hash][]byte),
+	}
+	for i := 0; i < accounts; i++ {
+		state.accounts[randomHash()] = nil
+	}
+	for account := range state.accounts {
+		state.storage[account] = make(map[types.Hash][]byte)
+		for i := 0; i < slots; i++ {
+			state.storage[account][randomHash()] = randomValue()
+		}
+	}
+	root := commitTestState(t, triedb, types.Hash{}, state, state)
+	return triedb, root, state
+}
+
+// commitTestState applies the changed storage slots of the accounts in diff to
+// the tries of root, filling in the new account trie values in both the diff and
+// the full state, and returns the new root.
+func commitTestState(t *testing.T, triedb *tree.Database, root types.Hash, state *testState, diff *testState) types.Hash {
+	accTrie, err := tree.New(root, triedb)
+	if err != nil {
+		t.Fatalf("failed to open account trie: %v", err)
+	}
+	for account := range diff.accounts {
+		var storageRoot types.Hash
+		if blob := accTrie.Get(account[:]); blob != nil {
+			storageRoot, _ = testStorageRoot(blob)
+		}
+		storeTrie, err := tree.New(storageRoot, triedb)
+		if err != nil {
+			t.Fatalf("failed to open storage trie: %v", err)
+		}
+		for slot, value := range diff.storage[account] {
+			storeTrie.Update(slot[:], value)
+		}
+		if storageRoot, err = storeTrie.Commit(nil); err != nil {
+			t.Fatalf("failed to commit storage trie: %v", err)
+		}
+		blob, _ := rlp.EncodeToBytes(&testAccount{Nonce: uint64(len(state.accounts)), Root: storageRoot})
+		accTrie.Update(account[:], blob)
+		state.accounts[account] = blob
+		diff.accounts[account] = blob
+	}
+	root, err = accTrie.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit account trie: %v", err)
+	}
+	return root
+}
+
+// checkSnapshot checks that a snapshot layer contains exactly the given state.
+func checkSnapshot(t *testing.T, snap Snapshot, state *testState) {
+	t.Helper()
+
+	for account, want := range state.accounts {
+		have, err := snap.Account(account)
+		if err != nil {
+			t.Fatalf("failed to retrieve account %x: %v", account, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("account %x mismatch: have %x, want %x", account, have, want)
+		}
+		for slot, want := range state.storage[account] {
+			have, err := snap.Storage(account, slot)
+			if err != nil {
+				t.Fatalf("failed to retrieve slot %x of %x: %v", slot, account, err)
+			}
+			if len(want) == 0 {
+				want = nil
+			}
+			if !bytes.Equal(have, want) {
+				t.Fatalf("slot %x of %x mismatch: have %x, want %x", slot, account, have, want)
+			}
+		}
+	}
+	if have, err := snap.Account(randomHash()); have != nil || err != nil {
+		t.Fatalf("missing account returned %x, %v", have, err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	triedb, root, state := makeTestState(t, 100, 10)
+
+	diskdb := memorydb.New()
+	snaps, err := New(testConfig, diskdb, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	if have := snaps.DiskRoot(); have != root {
+		t.Fatalf("disk root mismatch: have %x, want %x", have, root)
+	}
+	checkSnapshot(t, snaps.Snapshot(root), state)
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("failed to verify snapshot: %v", err)
+	}
+	// A snapshot at the requested root must be loaded without touching the tries
+	if _, err := New(testConfig, diskdb, tree.NewDatabase(memorydb.New()), root); err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	// Regenerating for a missing root must fail and invalidate the snapshot
+	if _, err := New(testConfig, diskdb, triedb, randomHash()); err == nil {
+		t.Fatalf("generated snapshot for missing root")
+	}
+	if have := readSnapshotRoot(diskdb); have != (types.Hash{}) {
+		t.Fatalf("invalid snapshot root retained: %x", have)
+	}
+	// Regenerating must wipe the leftovers of the previous snapshot
+	stale := randomHash()
+	diskdb.Put(accountSnapshotKey(stale), []byte("stale"))
+	snaps, err = New(testConfig, diskdb, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to regenerate snapshot: %v", err)
+	}
+	if have, _ := snaps.Snapshot(root).Account(stale); have != nil {
+		t.Fatalf("stale account retained: %x", have)
+	}
+	checkSnapshot(t, snaps.Snapshot(root), state)
+}
+
+func TestGenerateAccountsOnly(t *testing.T) {
+	triedb, root, state := makeTestState(t, 50, 5)
+
+	snaps, err := New(Config{}, memorydb.New(), triedb, root)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	snap := snaps.Snapshot(root)
+	for account, want := range state.accounts {
+		if have, _ := snap.Account(account); !bytes.Equal(have, want) {
+			t.Fatalf("account %x mismatch: have %x, want %x", account, have, want)
+		}
+		for slot := range state.storage[account] {
+			if have, _ := snap.Storage(account, slot); have != nil {
+				t.Fatalf("untracked slot %x of %x returned %x", slot, account, have)
+			}
+		}
+	}
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("failed to verify snapshot: %v", err)
+	}
+}
+
+func TestDiffLayers(t *testing.T) {
+	triedb, root, state := makeTestState(t, 20, 5)
+	snaps, err := New(testConfig, memorydb.New(), triedb, root)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	var accounts []types.Hash
+	for account := range state.accounts {
+		accounts = append(accounts, account)
+	}
+	var (
+		updated   = accounts[0]
+		deleted   = accounts[1]
+		destroyed = accounts[2]
+		created   = randomHash()
+		slot      = randomHash()
+	)
+	// Create a layer updating, deleting, destroying and creating accounts
+	root1 := randomHash()
+	err = snaps.Update(root1, root, map[types.Hash]struct{}{deleted: {}, destroyed: {}}, map[types.Hash][]byte{
+		updated:   []byte("updated"),
+		destroyed: []byte("recreated"),
+		created:   []byte("created"),
+	}, map[types.Hash]map[types.Hash][]byte{
+		created:   {slot: []byte("slot")},
+		destroyed: {slot: []byte("fresh")},
+	})
+	if err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	// Create a child layer on top overwriting some of the changes
+	root2 := randomHash()
+	err = snaps.Update(root2, root1, nil, map[types.Hash][]byte{created: nil}, map[types.Hash]map[types.Hash][]byte{
+		updated: {slot: []byte("new slot")},
+	})
+	if err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	tests := []struct {
+		root    types.Hash
+		account types.Hash
+		slot    types.Hash
+		value   []byte
+		stored  []byte
+	}{
+		{root1, updated, slot, []byte("updated"), nil},
+		{root1, deleted, slot, nil, nil},
+		{root1, destroyed, slot, []byte("recreated"), []byte("fresh")},
+		{root1, created, slot, []byte("created"), []byte("slot")},
+		{root2, updated, slot, []byte("updated"), []byte("new slot")},
+		{root2, deleted, slot, nil, nil},
+		{root2, created, slot, nil, []byte("slot")},
+	}
+	for i, tt := range tests {
+		snap := snaps.Snapshot(tt.root)
+		if have, err := snap.Account(tt.account); err != nil || !bytes.Equal(have, tt.value) {
+			t.Errorf("test %d: account mismatch: have %q, %v, want %q", i, have, err, tt.value)
+		}
+		if have, err := snap.Storage(tt.account, tt.slot); err != nil || !bytes.Equal(have, tt.stored) {
+			t.Errorf("test %d: slot mismatch: have %q, %v, want %q", i, have, err, tt.stored)
+		}
+	}
+	// The storage of the destroyed account must be gone, the one of the others
+	// retained
+	snap := snaps.Snapshot(root2)
+	for old := range state.storage[destroyed] {
+		if have, _ := snap.Storage(destroyed, old); have != nil {
+			t.Fatalf("destroyed slot %x retained: %x", old, have)
+		}
+	}
+	for old, want := range state.storage[updated] {
+		if have, _ := snap.Storage(updated, old); !bytes.Equal(have, want) {
+			t.Fatalf("slot %x mismatch: have %x, want %x", old, have, want)
+		}
+	}
+	// The disk layer must be unaffected
+	checkSnapshot(t, snaps.Snapshot(root), state)
+}
+
+func TestUpdateErrors(t *testing.T) {
+	triedb, root, _ := makeTestState(t, 1, 1)
+	snaps, _ := New(testConfig, memorydb.New(), triedb, root)
+
+	if err := snaps.Update(root, root, nil, nil, nil); err != errSnapshotCycle {
+		t.Errorf("cycle error mismatch: have %v, want %v", err, errSnapshotCycle)
+	}
+	if err := snaps.Update(randomHash(), randomHash(), nil, nil, nil); err == nil {
+		t.Errorf("layer created on missing parent")
+	}
+	if err := snaps.Cap(root, 1); err == nil {
+		t.Errorf("disk layer capped")
+	}
+	if err := snaps.Cap(randomHash(), 1); err == nil {
+		t.Errorf("missing layer capped")
+	}
+}
+
+func TestCap(t *testing.T) {
+	triedb, root, _ := makeTestState(t, 20, 5)
+
+	diskdb := memorydb.New()
+	snaps, err := New(testConfig, diskdb, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	// Stack a few layers on top of each other, each updating a single account
+	var (
+		account = randomHash()
+		roots   = []types.Hash{root}
+	)
+	for i := 0; i < 5; i++ {
+		roots = append(roots, randomHash())
+		err := snaps.Update(roots[i+1], roots[i], nil, map[types.Hash][]byte{account: {byte(i + 1)}}, map[types.Hash]map[types.Hash][]byte{
+			account: {types.Hash{byte(i)}: {byte(i + 1)}},
+		})
+		if err != nil {
+			t.Fatalf("failed to create layer %d: %v", i, err)
+		}
+	}
+	// Create a fork off the first layer, which is discarded by the capping
+	fork := randomHash()
+	snaps.Update(fork, roots[1], nil, map[types.Hash][]byte{account: []byte("fork")}, nil)
+	stale := snaps.Snapshot(roots[1])
+
+	if err := snaps.Cap(roots[5], 2); err != nil {
+		t.Fatalf("failed to cap: %v", err)
+	}
+	if have := snaps.DiskRoot(); have != roots[3] {
+		t.Fatalf("disk root mismatch: have %x, want %x", have, roots[3])
+	}
+	for i, root := range roots {
+		if have := snaps.Snapshot(root) != nil; have != (i >= 3) {
+			t.Errorf("layer %d availability mismatch: have %v", i, have)
+		}
+	}
+	if snaps.Snapshot(fork) != nil {
+		t.Errorf("fork below the disk layer retained")
+	}
+	if _, err := stale.Account(account); err != ErrSnapshotStale {
+		t.Errorf("stale layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	// The persisted data must be the flattened one
+	if have := readAccountSnapshot(diskdb, account); !bytes.Equal(have, []byte{3}) {
+		t.Errorf("persisted account mismatch: have %x", have)
+	}
+	checkLayers := func() {
+		snap := snaps.Snapshot(roots[5])
+		if have, err := snap.Account(account); err != nil || !bytes.Equal(have, []byte{5}) {
+			t.Fatalf("account mismatch: have %x, %v", have, err)
+		}
+		for i := 0; i < 5; i++ {
+			if have, err := snap.Storage(account, types.Hash{byte(i)}); err != nil || !bytes.Equal(have, []byte{byte(i + 1)}) {
+				t.Fatalf("slot %d mismatch: have %x, %v", i, have, err)
+			}
+		}
+	}
+	checkLayers()
+
+	// Flatten everything and reload from disk
+	if err := snaps.Cap(roots[5], 0); err != nil {
+		t.Fatalf("failed to cap: %v", err)
+	}
+	if have := snaps.DiskRoot(); have != roots[5] {
+		t.Fatalf("disk root mismatch: have %x, want %x", have, roots[5])
+	}
+	checkLayers()
+
+	snaps, err = New(testConfig, diskdb, tree.NewDatabase(memorydb.New()), roots[5])
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	checkLayers()
+}
+
+// Tests that a snapshot tracking the changes of the tries verifies against them,
+// both in memory and persisted.
+func TestVerifyDiffs(t *testing.T) {
+	triedb, root, state := makeTestState(t, 50, 10)
+
+	diskdb := memorydb.New()
+	snaps, err := New(testConfig, diskdb, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	var accounts []types.Hash
+	for account := range state.accounts {
+		accounts = append(accounts, account)
+	}
+	for i := 0; i < 3; i++ {
+		diff := &testState{
+			accounts: make(map[types.Hash][]byte),
+			storage:  make(map[types.Hash]map[types.Hash][]byte),
+		}
+		// Update some slots of an existing account and add a new one
+		for _, account := range []types.Hash{accounts[i], randomHash()} {
+			diff.accounts[account] = nil
+			diff.storage[account] = map[types.Hash][]byte{randomHash(): randomValue()}
+			if state.storage[account] == nil {
+				state.storage[account] = make(map[types.Hash][]byte)
+			}
+			for slot, value := range diff.storage[account] {
+				state.storage[account][slot] = value
+			}
+		}
+		for slot := range state.storage[accounts[i]] {
+			diff.storage[accounts[i]][slot] = nil
+			state.storage[accounts[i]][slot] = nil
+			break
+		}
+		parent := root
+		root = commitTestState(t, triedb, root, state, diff)
+		if err := snaps.Update(root, parent, nil, diff.accounts, diff.storage); err != nil {
+			t.Fatalf("failed to create layer %d: %v", i, err)
+		}
+		if err := snaps.Verify(root); err != nil {
+			t.Fatalf("failed to verify layer %d: %v", i, err)
+		}
+		checkSnapshot(t, snaps.Snapshot(root), state)
+	}
+	if err := snaps.Cap(root, 1); err != nil {
+		t.Fatalf("failed to cap: %v", err)
+	}
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("failed to verify capped snapshot: %v", err)
+	}
+	// Corrupt a persisted slot and ensure it's detected
+	for slot := range state.storage[accounts[10]] {
+		diskdb.Put(storageSnapshotKey(accounts[10], slot), []byte("corrupt"))
+		break
+	}
+	if err := snaps.Verify(root); err == nil {
+		t.Fatalf("corrupted snapshot verified")
+	}
+}
@@ -47,6 +47,7 @@ const secureKeyLength = 11 + 32
 // servers even while the trie is executing expensive garbage collection.
 type Database struct {
 	diskdb kvstore.KeyValueStore // Persistent storage for matured trie nodes
+	scheme *hashScheme           // Hash scheme of the tries opened without an explicit one
 
 	cleans  *fastcache.Cache           // GC friendly memory cache of clean node RLPs
 	dirties map[types.Hash]*cachedNode // Data and references relationships of dirty nodes
@@ -68,6 +69,10 @@ type Database struct {
 	childrenSize  types.StorageSize // Storage size of the external children tracking
 	preimagesSize types.StorageSize // Storage size of the preimages cache
 
+	recording   uint32                // Flag whether accessed nodes are recorded into the witness (atomic)
+	witness     map[types.Hash][]byte // Nodes accessed since the witness recording started
+	witnessLock sync.Mutex            // Lock protecting the witness
+
 	lock sync.RWMutex
 }
 
@@ -262,6 +267,23 @@ func NewDatabase(diskdb kvstore.KeyValueStore) *Database {
 // before its written out to disk or garbage collected. It also acts as a read cache
 // for nodes loaded from disk.
 func NewDatabaseWithCache(diskdb kvstore.KeyValueStore, cache int) *Database {
+	return newDatabase(diskdb, cache, keccakScheme)
+}
+
+// NewDatabaseWithHasher creates a new trie database with a read cache, whose
+// tries hash their nodes with the given hash function instead of Keccak256. The
+// hash function must produce 32 byte digests.
+func NewDatabaseWithHasher(diskdb kvstore.KeyValueStore, cache int, fn HashFunc) (*Database, error) {
+	scheme, err := hashSchemeOf(fn)
+	if err != nil {
+		return nil, err
+	}
+	return newDatabase(diskdb, cache, scheme), nil
+}
+
+// newDatabase creates a new trie database with the given read cache size and
+// hash scheme.
+func newDatabase(diskdb kvstore.KeyValueStore, cache int, scheme *hashScheme) *Database {
 	var cleans *fastcache.Cache
 	if cache > 0 {
 		cleans = fastcache.New(cache * 1024 * 1024)
@@ -269,6 +291,7 @@ func NewDatabaseWithCache(diskdb kvstore.KeyValueStore, cache int) *Database {
 
 	return &Database{
 		diskdb: diskdb,
+		scheme: scheme,
 		cleans: cleans,
 		dirties: map[types.Hash]*cachedNode{{}: {
 			children: make(map[types.Hash]uint16),
@@ -277,6 +300,12 @@ func NewDatabaseWithCache(diskdb kvstore.KeyValueStore, cache int) *Database {
 	}
 }
 
+// HashFunc returns the hash function of the tries opened on the database
+// without an explicit one.
+func (db *Database) HashFunc() HashFunc {
+	return db.scheme.fn
+}
+
 // DiskDB retrieves the persistent storage backing the trie database.
 func (db *Database) DiskDB() kvstore.KeyValueStore {
 	return db.diskdb
@@ -338,12 +367,14 @@ func (db *Database) insertPreimage(hash types.Hash, preimage []byte) {
 }
 
 // node retrieves a cached trie node from memory, or returns nil if none can be
-// found in the memory cache.
-func (db *Database) node(hash types.Hash) node {
+// found in the memory cache. If withBlob is set, the encoding of the node is
+// returned too.
+func (db *Database) node(hash types.Hash, withBlob bool) (node, []byte) {
 	// Retrieve the node from the clean cache if available
 	if db.cleans != nil {
 		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
-			return mustDecodeNode(hash[:], enc)
+			db.recordWitness(hash, enc)
+			return mustDecodeNode(hash[:], enc), enc
 		}
 	}
 	// Retrieve the node from the dirty cache if available
@@ -352,18 +383,24 @@ func (db *Database) node(hash types.Hash) node {
 	db.lock.RUnlock()
 
 	if dirty != nil {
-		return dirty.obj(hash)
+		var enc []byte
+		if withBlob || db.witnessing() {
+			enc = dirty.rlp()
+			db.recordWitness(hash, enc)
+		}
+		return dirty.obj(hash), enc
 	}
 
 	// Content unavailable in memory, attempt to retrieve from disk
 	enc, err := db.diskdb.Get(hash[:])
 	if err != nil || enc == nil {
-		return nil
+		return nil, nil
 	}
 	if db.cleans != nil {
 		db.cleans.Set(hash[:], enc)
 	}
-	return mustDecodeNode(hash[:], enc)
+	db.recordWitness(hash, enc)
+	return mustDecodeNode(hash[:], enc), enc
 }
 
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
@@ -376,6 +413,7 @@ func (db *Database) Node(hash types.Hash) ([]byte, error) {
 	// Retrieve the node from the clean cache if available
 	if db.cleans != nil {
 		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
+			db.recordWitness(hash, enc)
 			return enc, nil
 		}
 	}
@@ -385,7 +423,9 @@ func (db *Database) Node(hash types.Hash) ([]byte, error) {
 	db.lock.RUnlock()
 
 	if dirty != nil {
-		return dirty.rlp(), nil
+		enc := dirty.rlp()
+		db.recordWitness(hash, enc)
+		return enc, nil
 	}
 
 	// Content unavailable in memory, attempt to retrieve from disk
@@ -394,6 +434,7 @@ func (db *Database) Node(hash types.Hash) ([]byte, error) {
 		if db.cleans != nil {
 			db.cleans.Set(hash[:], enc)
 		}
+		db.recordWitness(hash, enc)
 	}
 	return enc, err
 }
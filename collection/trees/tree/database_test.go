@@ -19,6 +19,7 @@ package tree
 import (
 	"testing"
 
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
 	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
 	"github.com/chain5j/chain5j-pkg/types"
 )
@@ -31,3 +32,36 @@ func TestDatabaseMetarootFetch(t *testing.T) {
 		t.Fatalf("metaroot retrieval succeeded")
 	}
 }
+
+// Tests that a trie database can be served from a point-in-time snapshot of the
+// backing store, unaffected by later writes.
+func TestDatabaseSnapshotRead(t *testing.T) {
+	diskdb := memorydb.New()
+	triedb := NewDatabase(diskdb)
+
+	trie, _ := New(types.Hash{}, triedb)
+	trie.Update([]byte("key"), []byte("old"))
+	root, _ := trie.Commit(nil)
+	triedb.Commit(root, false)
+
+	snap, err := diskdb.NewSnapshot()
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	defer snap.Release()
+
+	// Overwrite every node in the disk database with garbage
+	it := diskdb.NewIterator()
+	for it.Next() {
+		diskdb.Put(it.Key(), []byte{0xde, 0xad})
+	}
+	it.Release()
+
+	frozen, err := New(root, NewDatabase(kvstore.NewSnapshotStore(snap)))
+	if err != nil {
+		t.Fatalf("failed to open trie from snapshot: %v", err)
+	}
+	if val := frozen.Get([]byte("key")); string(val) != "old" {
+		t.Fatalf("snapshot value mismatch: have %q, want %q", val, "old")
+	}
+}
@@ -0,0 +1,181 @@
+// Package tree
+//
+// @author: xwc1125
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// exportMagic and exportVersion identify the format of a trie export.
+const (
+	exportMagic   = "trie-export"
+	exportVersion = 1
+)
+
+// Record kinds of the body of a trie export.
+const (
+	exportLeaf = iota // Leaf of the trie, the key and the value
+	exportEnd         // End of the export, the leaf count and the checksum
+)
+
+var (
+	// errExportFormat is returned if the imported stream is not a trie export.
+	errExportFormat = errors.New("not a trie export")
+
+	// errExportChecksum is returned if the checksum of an imported stream does
+	// not match its content.
+	errExportChecksum = errors.New("trie export checksum mismatch")
+)
+
+// exportHeader is the first record of a trie export.
+type exportHeader struct {
+	Magic   string
+	Version uint64
+	Root    types.Hash // Root hash of the exported trie
+}
+
+// exportRecord is a record of the body of a trie export.
+type exportRecord struct {
+	Kind  uint8
+	Key   []byte
+	Value []byte
+}
+
+// Export streams the leaves of the trie identified by root into w, in a portable
+// format independent of the storage engine.
+//
+// The export is a sequence of RLP records: a header holding the root hash, the
+// leaves in ascending key order and a trailer holding the leaf count and the
+// SHA-256 checksum of all the preceding records.
+func Export(root types.Hash, db *Database, w io.Writer) error {
+	trie, err := New(root, db)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.New()
+	write := func(val interface{}) error {
+		blob, err := rlp.EncodeToBytes(val)
+		if err != nil {
+			return err
+		}
+		checksum.Write(blob)
+		_, err = w.Write(blob)
+		return err
+	}
+	if err := write(&exportHeader{Magic: exportMagic, Version: exportVersion, Root: trie.Hash()}); err != nil {
+		return err
+	}
+	var (
+		count uint64
+		it    = NewIterator(trie.NodeIterator(nil))
+	)
+	for it.Next() {
+		if err := write(&exportRecord{Kind: exportLeaf, Key: it.Key, Value: it.Value}); err != nil {
+			return err
+		}
+		count++
+	}
+	if it.Err != nil {
+		return it.Err
+	}
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], count)
+
+	return write(&exportRecord{Kind: exportEnd, Key: enc[:], Value: checksum.Sum(nil)})
+}
+
+// Import reads a trie export from r, rebuilds the trie and persists its nodes
+// into the disk database of db, returning the root hash. The rebuilt trie is
+// verified against the root of the export, the nodes are hashed with the hash
+// function of db. The nodes are held in the memory cache of db until the
+// verification passes, nothing is written into the disk database if the import
+// fails.
+func Import(r io.Reader, db *Database) (types.Hash, error) {
+	var (
+		stream   = rlp.NewStream(r, 0)
+		checksum = sha256.New()
+	)
+	read := func(val interface{}) (bool, error) {
+		blob, err := stream.Raw()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return false, err
+		}
+		if err := rlp.DecodeBytes(blob, val); err != nil {
+			return false, err
+		}
+		if record, ok := val.(*exportRecord); ok && record.Kind == exportEnd {
+			return true, nil
+		}
+		checksum.Write(blob)
+		return false, nil
+	}
+	var header exportHeader
+	if _, err := read(&header); err != nil {
+		return types.Hash{}, fmt.Errorf("%w: %v", errExportFormat, err)
+	}
+	if header.Magic != exportMagic {
+		return types.Hash{}, errExportFormat
+	}
+	if header.Version != exportVersion {
+		return types.Hash{}, fmt.Errorf("unsupported trie export version %d", header.Version)
+	}
+	// Rebuild the trie from the leaves. The nodes are staged in the memory cache
+	// and only flushed once the root is verified, so that a corrupt or forged
+	// export leaves nothing behind in the disk database.
+	trie, err := New(types.Hash{}, db)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	var count uint64
+	for {
+		var record exportRecord
+		end, err := read(&record)
+		if err != nil {
+			return types.Hash{}, err
+		}
+		if end {
+			if len(record.Key) != 8 || binary.BigEndian.Uint64(record.Key) != count {
+				return types.Hash{}, fmt.Errorf("trie export leaf count mismatch: have %d", count)
+			}
+			if !bytes.Equal(checksum.Sum(nil), record.Value) {
+				return types.Hash{}, errExportChecksum
+			}
+			break
+		}
+		if record.Kind != exportLeaf {
+			return types.Hash{}, fmt.Errorf("unknown trie export record kind %d", record.Kind)
+		}
+		if err := trie.TryUpdate(record.Key, record.Value); err != nil {
+			return types.Hash{}, fmt.Errorf("invalid leaf #%d: %v", count, err)
+		}
+		count++
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	if root != header.Root {
+		db.Dereference(root)
+		return types.Hash{}, fmt.Errorf("trie export root mismatch: have %x, want %x", root, header.Root)
+	}
+	// An empty trie has no nodes to persist
+	if count > 0 {
+		if err := db.Commit(root, false); err != nil {
+			return types.Hash{}, err
+		}
+	}
+	logger().Info("Imported trie", "root", root, "leaves", count)
+	return root, nil
+}
@@ -0,0 +1,164 @@
+package tree
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+func TestExportImport(t *testing.T) {
+	for name, fn := range map[string]HashFunc{"keccak": nil, "sm3": SM3} {
+		srcDb, root, content := makeHashedTrie(t, fn)
+
+		var buf bytes.Buffer
+		if err := Export(root, srcDb, &buf); err != nil {
+			t.Fatalf("%s: failed to export trie: %v", name, err)
+		}
+		dstDb, _ := NewDatabaseWithHasher(memorydb.New(), 0, fn)
+		imported, err := Import(bytes.NewReader(buf.Bytes()), dstDb)
+		if err != nil {
+			t.Fatalf("%s: failed to import trie: %v", name, err)
+		}
+		if imported != root {
+			t.Fatalf("%s: imported root mismatch: have %x, want %x", name, imported, root)
+		}
+		// The nodes must have been persisted, not just cached
+		checkTrieContents(t, reopenDatabase(t, dstDb, fn), root[:], content)
+
+		// Importing with a different hash function must fail the root check
+		other, _ := NewDatabaseWithHasher(memorydb.New(), 0, Blake2b)
+		if _, err := Import(bytes.NewReader(buf.Bytes()), other); err == nil {
+			t.Fatalf("%s: import with mismatching hash function succeeded", name)
+		}
+	}
+}
+
+func TestExportImportSecure(t *testing.T) {
+	srcDb, srcTrie, content := makeTestSecureTrie()
+	root, _ := srcTrie.Commit(nil)
+
+	var buf bytes.Buffer
+	if err := Export(root, srcDb, &buf); err != nil {
+		t.Fatalf("failed to export trie: %v", err)
+	}
+	dstDb := NewDatabase(memorydb.New())
+	if _, err := Import(&buf, dstDb); err != nil {
+		t.Fatalf("failed to import trie: %v", err)
+	}
+	trie, err := NewSecure(root, dstDb)
+	if err != nil {
+		t.Fatalf("failed to open imported trie: %v", err)
+	}
+	for key, val := range content {
+		if have := trie.Get([]byte(key)); !bytes.Equal(have, val) {
+			t.Fatalf("entry %x: content mismatch: have %x, want %x", key, have, val)
+		}
+	}
+}
+
+// Tests that tries with keys being prefixes of each other survive the round trip.
+func TestExportImportPrefixKeys(t *testing.T) {
+	srcDb := NewDatabase(memorydb.New())
+	trie, _ := New(types.Hash{}, srcDb)
+	content := map[string][]byte{"a": []byte("value-a"), "ab": []byte("value-ab"), "abc": []byte("value-abc")}
+	for key, val := range content {
+		trie.Update([]byte(key), val)
+	}
+	root, _ := trie.Commit(nil)
+
+	var buf bytes.Buffer
+	if err := Export(root, srcDb, &buf); err != nil {
+		t.Fatalf("failed to export trie: %v", err)
+	}
+	dstDb := NewDatabase(memorydb.New())
+	imported, err := Import(&buf, dstDb)
+	if err != nil {
+		t.Fatalf("failed to import trie: %v", err)
+	}
+	if imported != root {
+		t.Fatalf("imported root mismatch: have %x, want %x", imported, root)
+	}
+	checkTrieContents(t, reopenDatabase(t, dstDb, nil), root[:], content)
+}
+
+func TestExportImportEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(types.Hash{}, NewDatabase(memorydb.New()), &buf); err != nil {
+		t.Fatalf("failed to export empty trie: %v", err)
+	}
+	diskdb := memorydb.New()
+	root, err := Import(&buf, NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("failed to import empty trie: %v", err)
+	}
+	if root != emptyRoot {
+		t.Fatalf("empty root mismatch: have %x, want %x", root, emptyRoot)
+	}
+	if diskdb.Len() != 0 {
+		t.Fatalf("empty trie persisted %d nodes", diskdb.Len())
+	}
+}
+
+// Tests that a failed import leaves no nodes behind, even if the trie is large
+// enough to need several batches.
+func TestImportFailedNoWrites(t *testing.T) {
+	srcDb := NewDatabase(memorydb.New())
+	trie, _ := New(types.Hash{}, srcDb)
+	for i := 0; i < 4096; i++ {
+		trie.Update(randBytes(32), randBytes(64))
+	}
+	root, _ := trie.Commit(nil)
+	if err := srcDb.Commit(root, false); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Export(root, srcDb, &buf); err != nil {
+		t.Fatalf("failed to export trie: %v", err)
+	}
+	// A different hash function yields a root mismatch once all leaves are read
+	diskdb := memorydb.New()
+	dstDb, _ := NewDatabaseWithHasher(diskdb, 0, Blake2b)
+	if _, err := Import(&buf, dstDb); err == nil {
+		t.Fatalf("import with mismatching hash function succeeded")
+	}
+	if diskdb.Len() != 0 {
+		t.Fatalf("failed import persisted %d nodes", diskdb.Len())
+	}
+}
+
+func TestImportCorrupted(t *testing.T) {
+	srcDb, root, _ := makeHashedTrie(t, nil)
+
+	var buf bytes.Buffer
+	if err := Export(root, srcDb, &buf); err != nil {
+		t.Fatalf("failed to export trie: %v", err)
+	}
+	export := buf.Bytes()
+
+	// Truncated exports must be rejected, wherever cut
+	for _, n := range []int{0, 10, len(export) / 2, len(export) - 1} {
+		if _, err := Import(bytes.NewReader(export[:n]), NewDatabase(memorydb.New())); err == nil {
+			t.Fatalf("export truncated to %d bytes imported", n)
+		}
+	}
+	// Flipping any bit of the content must be detected
+	for _, pos := range []int{20, len(export) / 3, len(export) / 2, len(export) - 5} {
+		corrupt := append([]byte{}, export...)
+		corrupt[pos] ^= 0x01
+		if _, err := Import(bytes.NewReader(corrupt), NewDatabase(memorydb.New())); err == nil {
+			t.Fatalf("export corrupted at %d imported", pos)
+		}
+	}
+	// Random data is not an export
+	if _, err := Import(bytes.NewReader(randBytes(100)), NewDatabase(memorydb.New())); err == nil {
+		t.Fatalf("random data imported")
+	}
+	// Trailing data after the export is left unread
+	r := io.MultiReader(bytes.NewReader(export), bytes.NewReader([]byte("trailing")))
+	if _, err := Import(r, NewDatabase(memorydb.New())); err != nil {
+		t.Fatalf("failed to import export with trailing data: %v", err)
+	}
+}
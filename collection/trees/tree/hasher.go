@@ -23,13 +23,14 @@ import (
 	"github.com/chain5j/chain5j-pkg/codec/rlp"
 	"github.com/chain5j/chain5j-pkg/types"
 	"github.com/chain5j/chain5j-pkg/util/hexutil"
-	"golang.org/x/crypto/sha3"
 )
 
 type hasher struct {
-	tmp    sliceBuffer
-	sha    keccakState
-	onleaf LeafCallback
+	tmp      sliceBuffer
+	sha      hash.Hash
+	scheme   *hashScheme // Hash scheme the hasher belongs to
+	onleaf   LeafCallback
+	parallel bool // Whether to hash the children of the first full node concurrently
 }
 
 // keccakState wraps sha3.state. In addition to the usual hash methods, it also supports
@@ -51,24 +52,16 @@ func (b *sliceBuffer) Reset() {
 	*b = (*b)[:0]
 }
 
-// hashers live in a global db.
-var hasherPool = sync.Pool{
-	New: func() interface{} {
-		return &hasher{
-			tmp: make(sliceBuffer, 0, 550), // cap is as large as a full fullNode.
-			sha: sha3.NewLegacyKeccak256().(keccakState),
-		}
-	},
-}
-
-func newHasher(onleaf LeafCallback) *hasher {
-	h := hasherPool.Get().(*hasher)
+// newHasher retrieves a hasher of the scheme from its pool.
+func (s *hashScheme) newHasher(onleaf LeafCallback) *hasher {
+	h := s.pool.Get().(*hasher)
 	h.onleaf = onleaf
+	h.parallel = false
 	return h
 }
 
 func returnHasherToPool(h *hasher) {
-	hasherPool.Put(h)
+	h.scheme.pool.Put(h)
 }
 
 // hash collapses a node down into a hash node, also returning a copy of the
@@ -141,11 +134,17 @@ func (h *hasher) hashChildren(original node, db *Database) (node, node, error) {
 		// Hash the full node's children, caching the newly hashed subtrees
 		collapsed, cached := n.copy(), n.copy()
 
-		for i := 0; i < 16; i++ {
-			if n.Children[i] != nil {
-				collapsed.Children[i], cached.Children[i], err = h.hash(n.Children[i], db, false)
-				if err != nil {
-					return original, original, err
+		if h.parallel {
+			if err := h.hashChildrenParallel(n, collapsed, cached, db); err != nil {
+				return original, original, err
+			}
+		} else {
+			for i := 0; i < 16; i++ {
+				if n.Children[i] != nil {
+					collapsed.Children[i], cached.Children[i], err = h.hash(n.Children[i], db, false)
+					if err != nil {
+						return original, original, err
+					}
 				}
 			}
 		}
@@ -158,6 +157,47 @@ func (h *hasher) hashChildren(original node, db *Database) (node, node, error) {
 	}
 }
 
+// hashChildrenParallel hashes the children of a full node concurrently, each on
+// its own sequential hasher, filling in the collapsed and cached nodes. Nodes are
+// inserted into the database under its lock and the leaf callback is serialized,
+// so the result is identical to hashing the children one after the other.
+func (h *hasher) hashChildrenParallel(n, collapsed, cached *fullNode, db *Database) error {
+	var (
+		wg     sync.WaitGroup
+		errs   [16]error
+		onleaf = h.onleaf
+	)
+	if onleaf != nil {
+		var lock sync.Mutex
+		onleaf = func(leaf []byte, parent types.Hash) error {
+			lock.Lock()
+			defer lock.Unlock()
+			return h.onleaf(leaf, parent)
+		}
+	}
+	for i := 0; i < 16; i++ {
+		if n.Children[i] == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			hasher := h.scheme.newHasher(onleaf)
+			collapsed.Children[i], cached.Children[i], errs[i] = hasher.hash(n.Children[i], db, false)
+			returnHasherToPool(hasher)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // store hashes the node n and if we have a storage layer specified, it writes
 // the key/value pair to it and tracks any node->child references as well as any
 // node->external trie references.
@@ -211,6 +251,10 @@ func (h *hasher) makeHashNode(data []byte) hashNode {
 	n := make(hashNode, h.sha.Size())
 	h.sha.Reset()
 	h.sha.Write(data)
-	h.sha.Read(n)
+	if ks, ok := h.sha.(keccakState); ok {
+		ks.Read(n)
+	} else {
+		h.sha.Sum(n[:0])
+	}
 	return n
 }
@@ -0,0 +1,96 @@
+// Package tree
+//
+// @author: xwc1125
+package tree
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sync"
+
+	"github.com/chain5j/chain5j-pkg/crypto/hashalg/blake2b"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/tjfoc/gmsm/sm3"
+	"golang.org/x/crypto/sha3"
+)
+
+// HashFunc creates the hash function used for hashing the trie nodes and, in a
+// secure trie, the keys. The hash function must produce 32 byte digests.
+type HashFunc func() hash.Hash
+
+var (
+	// Keccak256 is the legacy Keccak-256 hash, the default of all tries.
+	Keccak256 HashFunc = func() hash.Hash { return sha3.NewLegacyKeccak256() }
+
+	// SM3 is the Chinese national standard SM3 hash.
+	SM3 HashFunc = func() hash.Hash { return sm3.New() }
+
+	// Sha3 is the standard SHA3-256 hash.
+	Sha3 HashFunc = sha3.New256
+
+	// Sha256 is the SHA-256 hash.
+	Sha256 HashFunc = sha256.New
+
+	// Blake2b is the unkeyed BLAKE2b-256 hash.
+	Blake2b HashFunc = func() hash.Hash {
+		h, _ := blake2b.New256(nil)
+		return h
+	}
+)
+
+// keccakScheme is the default hash scheme of the tries.
+var keccakScheme = mustHashScheme(Keccak256)
+
+// hashScheme bundles a hash function with the well known hashes derived from it
+// and a pool of node hashers using it.
+type hashScheme struct {
+	fn         HashFunc
+	emptyRoot  types.Hash // Root hash of an empty trie, the hash of an empty RLP string
+	emptyState types.Hash // Hash of an empty state entry, the hash of no data
+	pool       sync.Pool
+}
+
+// hashSchemeOf returns the hash scheme of the given hash function, the default
+// Keccak scheme if none is given.
+func hashSchemeOf(fn HashFunc) (*hashScheme, error) {
+	if fn == nil {
+		return keccakScheme, nil
+	}
+	return newHashScheme(fn)
+}
+
+// newHashScheme creates a hash scheme from the given hash function.
+func newHashScheme(fn HashFunc) (*hashScheme, error) {
+	if size := fn().Size(); size != types.HashLength {
+		return nil, fmt.Errorf("unsupported hash size: have %d, want %d", size, types.HashLength)
+	}
+	s := &hashScheme{fn: fn}
+	s.pool.New = func() interface{} {
+		return &hasher{
+			tmp:    make(sliceBuffer, 0, 550), // cap is as large as a full fullNode.
+			sha:    fn(),
+			scheme: s,
+		}
+	}
+	s.emptyRoot = s.hash([]byte{0x80})
+	s.emptyState = s.hash(nil)
+	return s, nil
+}
+
+// mustHashScheme creates a hash scheme, panicking on an invalid hash function.
+func mustHashScheme(fn HashFunc) *hashScheme {
+	s, err := newHashScheme(fn)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// hash calculates the hash of a blob.
+func (s *hashScheme) hash(blob []byte) types.Hash {
+	h := s.newHasher(nil)
+	defer returnHasherToPool(h)
+
+	return types.BytesToHash(h.makeHashNode(blob))
+}
@@ -0,0 +1,316 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/crypto/signature/gmsm"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+var testHashFuncs = map[string]HashFunc{
+	"sm3":     SM3,
+	"sha256":  Sha256,
+	"blake2b": Blake2b,
+}
+
+// makeHashedTrie creates a trie with the given hash function, filled with some
+// arbitrary data and committed into its database.
+func makeHashedTrie(t *testing.T, fn HashFunc) (*Database, types.Hash, map[string][]byte) {
+	triedb, err := NewDatabaseWithHasher(memorydb.New(), 0, fn)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	trie, _ := New(types.Hash{}, triedb)
+
+	content := make(map[string][]byte)
+	for i := 0; i < 500; i++ {
+		key, val := []byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i))
+		trie.Update(key, val)
+		content[string(key)] = val
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	return triedb, root, content
+}
+
+// Tests that tries hash their nodes with the configured hash function, which
+// also ends up in the database keys.
+func TestHashFuncTrie(t *testing.T) {
+	_, keccakRoot, _ := makeHashedTrie(t, nil)
+	if keccakRoot == (types.Hash{}) {
+		t.Fatalf("empty default root")
+	}
+	for name, fn := range testHashFuncs {
+		triedb, root, content := makeHashedTrie(t, fn)
+		if root == keccakRoot {
+			t.Errorf("%s: root matches the keccak one", name)
+		}
+		// The empty root must be derived from the hash function as well
+		empty, _ := New(types.Hash{}, triedb)
+		if have, want := empty.Hash(), types.BytesToHash(hashWith(fn, []byte{0x80})); have != want {
+			t.Errorf("%s: empty root mismatch: have %x, want %x", name, have, want)
+		}
+		if _, err := New(empty.Hash(), triedb); err != nil {
+			t.Errorf("%s: failed to open empty trie: %v", name, err)
+		}
+		// Flush the trie and check that every node is keyed by its hash
+		if err := triedb.Commit(root, false); err != nil {
+			t.Fatalf("%s: failed to flush trie: %v", name, err)
+		}
+		it := triedb.DiskDB().NewIterator()
+		for it.Next() {
+			if have := hashWith(fn, it.Value()); !bytes.Equal(have, it.Key()) {
+				t.Fatalf("%s: node %x hash mismatch: have %x", name, it.Key(), have)
+			}
+		}
+		it.Release()
+
+		checkTrieContents(t, reopenDatabase(t, triedb, fn), root[:], content)
+
+		// A trie opened with an explicit hash function must yield the same root
+		trie, err := NewWithHasher(types.Hash{}, NewDatabase(memorydb.New()), fn)
+		if err != nil {
+			t.Fatalf("%s: failed to create trie: %v", name, err)
+		}
+		for key, val := range content {
+			trie.Update([]byte(key), val)
+		}
+		if have := trie.Hash(); have != root {
+			t.Errorf("%s: explicit hasher root mismatch: have %x, want %x", name, have, root)
+		}
+	}
+}
+
+// Tests that the SM3 trie hashes nodes exactly as the gmsm package does.
+func TestHashFuncSM3(t *testing.T) {
+	trie, _ := NewWithHasher(types.Hash{}, NewDatabase(memorydb.New()), SM3)
+	trie.Update([]byte("hello"), bytes.Repeat([]byte("world"), 10))
+
+	enc := mustEncodeRoot(t, trie)
+	if have, want := trie.Hash(), gmsm.Gm3Hash(enc); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+}
+
+func TestHashFuncSecureTrie(t *testing.T) {
+	for name, fn := range testHashFuncs {
+		trie, err := NewSecureWithHasher(types.Hash{}, NewDatabase(memorydb.New()), fn)
+		if err != nil {
+			t.Fatalf("%s: failed to create trie: %v", name, err)
+		}
+		trie.Update([]byte("foo"), []byte("bar"))
+
+		it := NewIterator(trie.NodeIterator(nil))
+		if !it.Next() {
+			t.Fatalf("%s: no leaf in trie", name)
+		}
+		if have, want := it.Key, hashWith(fn, []byte("foo")); !bytes.Equal(have, want) {
+			t.Errorf("%s: hashed key mismatch: have %x, want %x", name, have, want)
+		}
+		if have := trie.Get([]byte("foo")); string(have) != "bar" {
+			t.Errorf("%s: value mismatch: have %q", name, have)
+		}
+	}
+}
+
+func TestHashFuncProof(t *testing.T) {
+	for name, fn := range testHashFuncs {
+		triedb, root, content := makeHashedTrie(t, fn)
+		trie, _ := New(root, triedb)
+
+		for key, val := range content {
+			proof := memorydb.New()
+			if err := trie.Prove([]byte(key), 0, proof); err != nil {
+				t.Fatalf("%s: failed to prove %x: %v", name, key, err)
+			}
+			have, _, err := VerifyProofWithHasher(root, []byte(key), proof, fn)
+			if err != nil {
+				t.Fatalf("%s: failed to verify proof of %x: %v", name, key, err)
+			}
+			if !bytes.Equal(have, val) {
+				t.Fatalf("%s: proven value mismatch: have %x, want %x", name, have, val)
+			}
+			if _, _, err := VerifyProof(root, []byte(key), proof); err == nil {
+				t.Fatalf("%s: proof verified with the wrong hash function", name)
+			}
+		}
+		// Verify a range proof over the middle of the trie
+		var entries entrySlice
+		for key, val := range content {
+			entries = append(entries, &kv{k: []byte(key), v: val})
+		}
+		sort.Sort(entries)
+
+		var keys, vals [][]byte
+		for _, entry := range entries[100:200] {
+			keys, vals = append(keys, entry.k), append(vals, entry.v)
+		}
+		proof := memorydb.New()
+		if err := trie.ProveRange(keys[0], keys[len(keys)-1], proof); err != nil {
+			t.Fatalf("%s: failed to prove range: %v", name, err)
+		}
+		if _, err := VerifyRangeProofWithHasher(root, keys[0], keys[len(keys)-1], keys, vals, proof, fn); err != nil {
+			t.Fatalf("%s: failed to verify range proof: %v", name, err)
+		}
+		if _, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, vals, proof); err == nil {
+			t.Fatalf("%s: range proof verified with the wrong hash function", name)
+		}
+	}
+}
+
+func TestHashFuncSync(t *testing.T) {
+	for name, fn := range testHashFuncs {
+		srcDb, root, content := makeHashedTrie(t, fn)
+
+		diskdb := memorydb.New()
+		sched, err := NewSyncWithHasher(root, diskdb, nil, NewSyncBloom(1, diskdb), fn)
+		if err != nil {
+			t.Fatalf("%s: failed to create sync: %v", name, err)
+		}
+		queue := append([]types.Hash{}, sched.Missing(100)...)
+		for len(queue) > 0 {
+			results := make([]SyncResult, len(queue))
+			for i, hash := range queue {
+				data, err := srcDb.Node(hash)
+				if err != nil {
+					t.Fatalf("%s: failed to retrieve node data for %x: %v", name, hash, err)
+				}
+				results[i] = SyncResult{hash, data}
+			}
+			// Ensure corrupted data is rejected before delivering the real one
+			corrupt := []SyncResult{{results[0].Hash, append([]byte{0xc0}, results[0].Data...)}}
+			if _, _, err := sched.Process(corrupt); err != ErrHashMismatch {
+				t.Fatalf("%s: corrupted data error mismatch: have %v, want %v", name, err, ErrHashMismatch)
+			}
+			if _, index, err := sched.Process(results); err != nil {
+				t.Fatalf("%s: failed to process result #%d: %v", name, index, err)
+			}
+			batch := diskdb.NewBatch()
+			if err := sched.Commit(batch); err != nil {
+				t.Fatalf("%s: failed to commit data: %v", name, err)
+			}
+			batch.Write()
+			queue = append(queue[:0], sched.Missing(100)...)
+		}
+		triedb, _ := NewDatabaseWithHasher(diskdb, 0, fn)
+		checkTrieContents(t, triedb, root[:], content)
+	}
+}
+
+func TestHashFuncStackTrie(t *testing.T) {
+	for name, fn := range testHashFuncs {
+		entries := make([]kv, 300)
+		for i := range entries {
+			entries[i] = kv{k: randBytes(32), v: randBytes(20)}
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+
+		st, err := NewStackTrieWithHasher(nil, fn)
+		if err != nil {
+			t.Fatalf("%s: failed to create stack trie: %v", name, err)
+		}
+		trie, _ := NewWithHasher(types.Hash{}, NewDatabase(memorydb.New()), fn)
+		for _, entry := range entries {
+			st.Update(entry.k, entry.v)
+			trie.Update(entry.k, entry.v)
+		}
+		if have, want := st.Hash(), trie.Hash(); have != want {
+			t.Errorf("%s: root mismatch: have %x, want %x", name, have, want)
+		}
+	}
+}
+
+func TestHashFuncPruner(t *testing.T) {
+	for name, fn := range testHashFuncs {
+		triedb, root, content := makeHashedTrie(t, fn)
+		triedb.Commit(root, false)
+
+		// Create a stale version of the trie to get rid of
+		trie, _ := New(root, triedb)
+		trie.Update([]byte("key-0000"), []byte("stale"))
+		stale, _ := trie.Commit(nil)
+		triedb.Commit(stale, false)
+
+		if err := NewPruner(triedb, PrunerConfig{}).Prune([]types.Hash{root}); err != nil {
+			t.Fatalf("%s: failed to prune: %v", name, err)
+		}
+		if has, _ := triedb.DiskDB().Has(stale[:]); has {
+			t.Errorf("%s: stale root retained", name)
+		}
+		checkTrieContents(t, reopenDatabase(t, triedb, fn), root[:], content)
+	}
+}
+
+// Tests that a trie created without an explicit hash function uses the one of
+// the database.
+func TestHashFuncDefaultsToDatabase(t *testing.T) {
+	triedb, _ := NewDatabaseWithHasher(memorydb.New(), 0, SM3)
+	want, _ := New(types.Hash{}, triedb)
+	want.Update([]byte("hello"), []byte("world"))
+
+	trie, err := NewWithHasher(types.Hash{}, triedb, nil)
+	if err != nil {
+		t.Fatalf("failed to create trie: %v", err)
+	}
+	trie.Update([]byte("hello"), []byte("world"))
+	if have, want := trie.Hash(), want.Hash(); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	secure, err := NewSecureWithHasher(types.Hash{}, triedb, nil)
+	if err != nil {
+		t.Fatalf("failed to create secure trie: %v", err)
+	}
+	if have, want := secure.Hash(), triedb.scheme.emptyRoot; have != want {
+		t.Fatalf("empty root mismatch: have %x, want %x", have, want)
+	}
+}
+
+func TestHashFuncInvalid(t *testing.T) {
+	if _, err := NewDatabaseWithHasher(memorydb.New(), 0, sha512.New); err == nil {
+		t.Errorf("database accepted 64 byte hash")
+	}
+	if _, err := NewWithHasher(types.Hash{}, NewDatabase(memorydb.New()), sha512.New); err == nil {
+		t.Errorf("trie accepted 64 byte hash")
+	}
+	if _, err := NewStackTrieWithHasher(nil, sha512.New); err == nil {
+		t.Errorf("stack trie accepted 64 byte hash")
+	}
+}
+
+// reopenDatabase opens a fresh trie database over the disk database of db,
+// with the given hash function.
+func reopenDatabase(t *testing.T, db *Database, fn HashFunc) *Database {
+	triedb, err := NewDatabaseWithHasher(db.DiskDB(), 0, fn)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	return triedb
+}
+
+// mustEncodeRoot returns the encoding of the root node of a trie.
+func mustEncodeRoot(t *testing.T, trie *Trie) []byte {
+	proof := memorydb.New()
+	if err := trie.Prove(nil, 0, proof); err != nil {
+		t.Fatalf("failed to prove root: %v", err)
+	}
+	root := trie.Hash()
+	enc, err := proof.Get(root[:])
+	if err != nil {
+		t.Fatalf("root node missing from proof: %v", err)
+	}
+	return enc
+}
+
+// hashWith calculates the hash of a blob with the given hash function.
+func hashWith(fn HashFunc, blob []byte) []byte {
+	h := fn()
+	h.Write(blob)
+	return h.Sum(nil)
+}
@@ -0,0 +1,85 @@
+// Package tree
+//
+// @author: xwc1125
+package tree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// journalEntry is a modification of a trie, recording the state of the trie
+// before the change. The nodes of a trie are never modified in place, so the old
+// root node still holds the complete old content.
+type journalEntry struct {
+	root     node // Root node of the trie before the modification
+	unhashed int  // Number of unhashed leaves before the modification
+}
+
+// revision is a snapshot of a trie, identified by its id and pointing to the
+// first journal entry made after it.
+type revision struct {
+	id           int
+	journalIndex int
+}
+
+// journal contains the list of trie modifications applied since the oldest live
+// snapshot, allowing the trie to be reverted to any of the snapshots.
+type journal struct {
+	entries        []journalEntry // Current changes tracked by the journal
+	validRevisions []revision     // Live snapshots, in creation order
+	nextRevisionId int            // Identifier of the next snapshot
+}
+
+// append records a trie modification, if there is any live snapshot to revert to.
+func (j *journal) append(entry journalEntry) {
+	if j == nil || len(j.validRevisions) == 0 {
+		return
+	}
+	j.entries = append(j.entries, entry)
+}
+
+// snapshot creates a new revision at the current end of the journal.
+func (j *journal) snapshot() int {
+	id := j.nextRevisionId
+	j.nextRevisionId++
+	j.validRevisions = append(j.validRevisions, revision{id, len(j.entries)})
+	return id
+}
+
+// revert discards the given revision along with all the later ones and the
+// modifications made since, returning the state the trie needs to be reset to.
+// If no modification was made since the revision, false is returned.
+func (j *journal) revert(revid int) (journalEntry, bool) {
+	// Find the snapshot in the stack of valid snapshots.
+	idx := sort.Search(len(j.validRevisions), func(i int) bool {
+		return j.validRevisions[i].id >= revid
+	})
+	if idx == len(j.validRevisions) || j.validRevisions[idx].id != revid {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	index := j.validRevisions[idx].journalIndex
+	j.validRevisions = j.validRevisions[:idx]
+
+	if index == len(j.entries) {
+		return journalEntry{}, false
+	}
+	entry := j.entries[index]
+	for i := index; i < len(j.entries); i++ {
+		j.entries[i] = journalEntry{} // Release the old nodes
+	}
+	j.entries = j.entries[:index]
+	return entry, true
+}
+
+// copy returns a deep copy of the journal.
+func (j *journal) copy() *journal {
+	if j == nil {
+		return nil
+	}
+	return &journal{
+		entries:        append([]journalEntry(nil), j.entries...),
+		validRevisions: append([]revision(nil), j.validRevisions...),
+		nextRevisionId: j.nextRevisionId,
+	}
+}
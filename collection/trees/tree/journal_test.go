@@ -0,0 +1,163 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+func TestSnapshotRevert(t *testing.T) {
+	triedb, root, content := makeHashedTrie(t, nil)
+	trie, _ := New(root, triedb)
+
+	// Apply a few rounds of changes, taking nested snapshots in between
+	var (
+		revids []int
+		hashes []types.Hash
+	)
+	for round := 0; round < 4; round++ {
+		revids = append(revids, trie.Snapshot())
+		hashes = append(hashes, trie.Hash())
+
+		for i := 0; i < 50; i++ {
+			key := []byte(fmt.Sprintf("key-%04d", round*50+i))
+			if i%3 == 0 {
+				trie.Delete(key)
+			} else {
+				trie.Update(key, []byte(fmt.Sprintf("round-%d", round)))
+			}
+		}
+		trie.Update([]byte(fmt.Sprintf("new-%d", round)), []byte("new"))
+	}
+	// Revert the snapshots one by one, checking the content at each
+	for round := len(revids) - 1; round >= 0; round-- {
+		trie.RevertToSnapshot(revids[round])
+		if have := trie.Hash(); have != hashes[round] {
+			t.Fatalf("round %d: root mismatch after revert: have %x, want %x", round, have, hashes[round])
+		}
+		if have := trie.Get([]byte(fmt.Sprintf("new-%d", round))); have != nil {
+			t.Fatalf("round %d: reverted insertion retained: %q", round, have)
+		}
+	}
+	for key, val := range content {
+		if have := trie.Get([]byte(key)); !bytes.Equal(have, val) {
+			t.Fatalf("entry %s: content mismatch after revert: have %q, want %q", key, have, val)
+		}
+	}
+	if have := trie.Hash(); have != root {
+		t.Fatalf("root mismatch after full revert: have %x, want %x", have, root)
+	}
+}
+
+func TestSnapshotRevertSkipped(t *testing.T) {
+	trie := newEmpty()
+	trie.Update([]byte("a"), []byte("1"))
+
+	outer := trie.Snapshot()
+	trie.Update([]byte("b"), []byte("2"))
+	middle := trie.Snapshot()
+	trie.Update([]byte("c"), []byte("3"))
+	inner := trie.Snapshot()
+
+	// Reverting an outer snapshot discards the inner ones as well
+	trie.RevertToSnapshot(middle)
+	if have := trie.Get([]byte("c")); have != nil {
+		t.Fatalf("reverted value retained: %q", have)
+	}
+	if have := trie.Get([]byte("b")); string(have) != "2" {
+		t.Fatalf("earlier value lost: %q", have)
+	}
+	checkRevertPanics(t, trie, inner)
+	checkRevertPanics(t, trie, middle)
+
+	// A snapshot without changes reverts to the same content
+	empty := trie.Snapshot()
+	trie.RevertToSnapshot(empty)
+	if have := trie.Get([]byte("b")); string(have) != "2" {
+		t.Fatalf("value lost by empty revert: %q", have)
+	}
+	trie.RevertToSnapshot(outer)
+	if have := trie.Get([]byte("b")); have != nil {
+		t.Fatalf("reverted value retained: %q", have)
+	}
+	checkRevertPanics(t, trie, 100)
+}
+
+func TestSnapshotCommit(t *testing.T) {
+	trie := newEmpty()
+	revid := trie.Snapshot()
+	trie.Update([]byte("a"), []byte("1"))
+	if _, err := trie.Commit(nil); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	checkRevertPanics(t, trie, revid)
+
+	// New snapshots work after committing
+	revid = trie.Snapshot()
+	trie.Delete([]byte("a"))
+	trie.RevertToSnapshot(revid)
+	if have := trie.Get([]byte("a")); string(have) != "1" {
+		t.Fatalf("value mismatch after revert: %q", have)
+	}
+}
+
+func TestSecureSnapshotRevert(t *testing.T) {
+	trie, _ := NewSecure(types.Hash{}, NewDatabase(memorydb.New()))
+	trie.Update([]byte("foo"), []byte("bar"))
+	root := trie.Hash()
+
+	revid := trie.Snapshot()
+	trie.Update([]byte("foo"), []byte("baz"))
+	trie.Update([]byte("new"), []byte("value"))
+
+	// Reverting a copy must leave the original intact
+	cpy := trie.Copy()
+	cpy.RevertToSnapshot(revid)
+	if have := cpy.Hash(); have != root {
+		t.Fatalf("copy root mismatch after revert: have %x, want %x", have, root)
+	}
+	if have := trie.Get([]byte("foo")); string(have) != "baz" {
+		t.Fatalf("original modified by reverting copy: %q", have)
+	}
+	trie.RevertToSnapshot(revid)
+	if have := trie.Get([]byte("foo")); string(have) != "bar" {
+		t.Fatalf("value mismatch after revert: %q", have)
+	}
+	if have := trie.Hash(); have != root {
+		t.Fatalf("root mismatch after revert: have %x, want %x", have, root)
+	}
+}
+
+func checkRevertPanics(t *testing.T, trie *Trie, revid int) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("revert to invalid snapshot %d succeeded", revid)
+		}
+	}()
+	trie.RevertToSnapshot(revid)
+}
+
+func BenchmarkSnapshotRevert(b *testing.B) {
+	trie := newEmpty()
+	for i := 0; i < 10000; i++ {
+		trie.Update(randBytes(32), randBytes(32))
+	}
+	trie.Hash()
+
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = randBytes(32)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		revid := trie.Snapshot()
+		for _, key := range keys {
+			trie.Update(key, key)
+		}
+		trie.RevertToSnapshot(revid)
+	}
+}
@@ -20,11 +20,13 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/chain5j/chain5j-pkg/crypto/keccak"
 	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
 	"github.com/chain5j/chain5j-pkg/util/hexutil"
 )
 
@@ -67,7 +69,7 @@ func TestProof(t *testing.T) {
 			}
 			val, _, err := VerifyProof(root, kv.k, proof)
 			if err != nil {
-				t.Fatalf("prover %d: failed to verify proof for key %x: %v\nraw proof: %x", i, kv.k, err, proof)
+				t.Fatalf("prover %d: failed to verify proof for key %x: %v\nraw proof: %v", i, kv.k, err, proof)
 			}
 			if !bytes.Equal(val, kv.v) {
 				t.Fatalf("prover %d: verified value mismatch for key %x: have %x, want %x", i, kv.k, val, kv.v)
@@ -89,7 +91,7 @@ func TestOneElementProof(t *testing.T) {
 		}
 		val, _, err := VerifyProof(trie.Hash(), []byte("k"), proof)
 		if err != nil {
-			t.Fatalf("prover %d: failed to verify proof: %v\nraw proof: %x", i, err, proof)
+			t.Fatalf("prover %d: failed to verify proof: %v\nraw proof: %v", i, err, proof)
 		}
 		if !bytes.Equal(val, []byte("v")) {
 			t.Fatalf("prover %d: verified value mismatch: have %x, want 'k'", i, val)
@@ -140,7 +142,7 @@ func TestMissingKeyProof(t *testing.T) {
 		}
 		val, _, err := VerifyProof(trie.Hash(), []byte(key), proof)
 		if err != nil {
-			t.Fatalf("test %d: failed to verify proof: %v\nraw proof: %x", i, err, proof)
+			t.Fatalf("test %d: failed to verify proof: %v\nraw proof: %v", i, err, proof)
 		}
 		if val != nil {
 			t.Fatalf("test %d: verified value mismatch: have %x, want nil", i, val)
@@ -149,6 +151,420 @@ func TestMissingKeyProof(t *testing.T) {
 }
 
 // mutateByte changes one byte in b.
+type entrySlice []*kv
+
+func (p entrySlice) Len() int           { return len(p) }
+func (p entrySlice) Less(i, j int) bool { return bytes.Compare(p[i].k, p[j].k) < 0 }
+func (p entrySlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// sortedEntries returns the entries of a random trie sorted by key.
+func sortedEntries(vals map[string]*kv) entrySlice {
+	var entries entrySlice
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Sort(entries)
+	return entries
+}
+
+// rangeKeyValues splits a slice of entries into the keys and values.
+func rangeKeyValues(entries entrySlice) ([][]byte, [][]byte) {
+	var keys, vals [][]byte
+	for _, entry := range entries {
+		keys = append(keys, entry.k)
+		vals = append(vals, entry.v)
+	}
+	return keys, vals
+}
+
+// TestRangeProof tests normal range proof with both edge proofs
+// as the existent proof. The test cases are generated randomly.
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		proof := memorydb.New()
+		if err := trie.ProveRange(entries[start].k, entries[end-1].k, proof); err != nil {
+			t.Fatalf("Failed to prove the range: %v", err)
+		}
+		keys, vals := rangeKeyValues(entries[start:end])
+		hasMore, err := VerifyRangeProof(trie.Hash(), keys[0], keys[len(keys)-1], keys, vals, proof)
+		if err != nil {
+			t.Fatalf("Case %d(%d->%d) expect no error, got %v", i, start, end-1, err)
+		}
+		if hasMore != (end < len(entries)) {
+			t.Fatalf("Case %d(%d->%d) more elements mismatch: have %t", i, start, end-1, hasMore)
+		}
+	}
+}
+
+// TestRangeProofWithNonExistentProof tests normal range proof with two non-existent proofs.
+// The test cases are generated randomly.
+func TestRangeProofWithNonExistentProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		// Short circuit if the decreased key is same with the previous key
+		first := decreaseKey(hexutil.CopyBytes(entries[start].k))
+		if start != 0 && bytes.Equal(first, entries[start-1].k) {
+			continue
+		}
+		// Short circuit if the decreased key is underflow
+		if bytes.Compare(first, entries[start].k) > 0 {
+			continue
+		}
+		// Short circuit if the increased key is same with the next key
+		last := increaseKey(hexutil.CopyBytes(entries[end-1].k))
+		if end != len(entries) && bytes.Equal(last, entries[end].k) {
+			continue
+		}
+		// Short circuit if the increased key is overflow
+		if bytes.Compare(last, entries[end-1].k) < 0 {
+			continue
+		}
+		proof := memorydb.New()
+		if err := trie.ProveRange(first, last, proof); err != nil {
+			t.Fatalf("Failed to prove the range: %v", err)
+		}
+		keys, vals := rangeKeyValues(entries[start:end])
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, vals, proof); err != nil {
+			t.Fatalf("Case %d(%d->%d) expect no error, got %v", i, start, end-1, err)
+		}
+	}
+	// Special case, two edge proofs for two edge key.
+	proof := memorydb.New()
+	first := types.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000000").Bytes()
+	last := types.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").Bytes()
+	if err := trie.ProveRange(first, last, proof); err != nil {
+		t.Fatalf("Failed to prove the range: %v", err)
+	}
+	keys, values := rangeKeyValues(entries)
+	hasMore, err := VerifyRangeProof(trie.Hash(), first, last, keys, values, proof)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if hasMore {
+		t.Fatal("More entries reported for the whole trie")
+	}
+}
+
+// TestOneElementRangeProof tests the proof with only one
+// element. The first edge proof can be existent one or
+// non-existent one.
+func TestOneElementRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+
+	// One element with existent edge proof, both edge proofs
+	// point to the SAME key.
+	start := 1000
+	proof := memorydb.New()
+	if err := trie.Prove(entries[start].k, 0, proof); err != nil {
+		t.Fatalf("Failed to prove the first node %v", err)
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), entries[start].k, entries[start].k, [][]byte{entries[start].k}, [][]byte{entries[start].v}, proof); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// One element with left non-existent edge proof
+	first := decreaseKey(hexutil.CopyBytes(entries[start].k))
+	proof = memorydb.New()
+	if err := trie.ProveRange(first, entries[start].k, proof); err != nil {
+		t.Fatalf("Failed to prove the range: %v", err)
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), first, entries[start].k, [][]byte{entries[start].k}, [][]byte{entries[start].v}, proof); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// One element with right non-existent edge proof
+	last := increaseKey(hexutil.CopyBytes(entries[start].k))
+	proof = memorydb.New()
+	if err := trie.ProveRange(entries[start].k, last, proof); err != nil {
+		t.Fatalf("Failed to prove the range: %v", err)
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), entries[start].k, last, [][]byte{entries[start].k}, [][]byte{entries[start].v}, proof); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Test the mini trie with only a single element.
+	tinyTrie := new(Trie)
+	entry := &kv{randBytes(32), randBytes(20), false}
+	tinyTrie.Update(entry.k, entry.v)
+
+	first = types.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000000").Bytes()
+	last = entry.k
+	proof = memorydb.New()
+	if err := tinyTrie.ProveRange(first, last, proof); err != nil {
+		t.Fatalf("Failed to prove the range: %v", err)
+	}
+	if _, err := VerifyRangeProof(tinyTrie.Hash(), first, last, [][]byte{entry.k}, [][]byte{entry.v}, proof); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// TestAllElementsProof tests the range proof with all elements.
+// The edge proofs can be nil.
+func TestAllElementsProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	keys, values := rangeKeyValues(sortedEntries(vals))
+
+	hasMore, err := VerifyRangeProof(trie.Hash(), nil, nil, keys, values, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if hasMore {
+		t.Fatal("More entries reported for the whole trie")
+	}
+	// A missing element must be detected without edge proofs
+	if _, err := VerifyRangeProof(trie.Hash(), nil, nil, keys[1:], values[1:], nil); err == nil {
+		t.Fatal("Expected error for incomplete trie, got nil")
+	}
+	// With edge proofs, it should still work.
+	proof := memorydb.New()
+	if err := trie.ProveRange(keys[0], keys[len(keys)-1], proof); err != nil {
+		t.Fatalf("Failed to prove the range: %v", err)
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), keys[0], keys[len(keys)-1], keys, values, proof); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// TestEmptyRangeProof tests the range proof with "no" element.
+// The first edge proof must be a non-existent proof.
+func TestEmptyRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+
+	var cases = []struct {
+		pos int
+		err bool
+	}{
+		{len(entries) - 1, false},
+		{500, true},
+	}
+	for _, c := range cases {
+		proof := memorydb.New()
+		first := increaseKey(hexutil.CopyBytes(entries[c.pos].k))
+		if err := trie.Prove(first, 0, proof); err != nil {
+			t.Fatalf("Failed to prove the first node %v", err)
+		}
+		_, err := VerifyRangeProof(trie.Hash(), first, nil, nil, nil, proof)
+		if c.err && err == nil {
+			t.Fatalf("Expected error, got nil")
+		}
+		if !c.err && err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+}
+
+// TestBadRangeProof tests a few cases which the proof is wrong.
+// The prover is expected to detect the error.
+func TestBadRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+		proof := memorydb.New()
+		if err := trie.ProveRange(entries[start].k, entries[end-1].k, proof); err != nil {
+			t.Fatalf("Failed to prove the range: %v", err)
+		}
+		keys, vals := rangeKeyValues(entries[start:end])
+		var first, last = keys[0], keys[len(keys)-1]
+		testcase := mrand.Intn(5)
+		switch testcase {
+		case 0:
+			// Modified key
+			keys[mrand.Intn(end-start)] = randBytes(32) // In theory it can't be same
+		case 1:
+			// Modified val
+			vals[mrand.Intn(end-start)] = randBytes(20) // In theory it can't be same
+		case 2:
+			// Gapped entry slice
+			index := mrand.Intn(end - start)
+			if (index == 0 && start < 100) || (index == end-start-1 && end <= 100) {
+				continue
+			}
+			keys = append(keys[:index], keys[index+1:]...)
+			vals = append(vals[:index], vals[index+1:]...)
+		case 3:
+			// Out of order
+			index1 := mrand.Intn(end - start)
+			index2 := mrand.Intn(end - start)
+			if index1 == index2 {
+				continue
+			}
+			keys[index1], keys[index2] = keys[index2], keys[index1]
+			vals[index1], vals[index2] = vals[index2], vals[index1]
+		case 4:
+			// Set random value to nil, deletion
+			vals[mrand.Intn(end-start)] = nil
+		}
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, vals, proof); err == nil {
+			t.Fatalf("%d Case %d range: (%d->%d) expect error, got nil", i, testcase, start, end-1)
+		}
+	}
+}
+
+// TestRangeProofOutOfRangeKey tests that keys outside of the proven edges
+// are rejected, even if they are genuine leaves of the trie.
+func TestRangeProofOutOfRangeKey(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries)-2) + 1
+		end := mrand.Intn(len(entries)-start-1) + start + 1
+
+		proof := memorydb.New()
+		first, last := entries[start].k, entries[end-1].k
+		if err := trie.ProveRange(first, last, proof); err != nil {
+			t.Fatalf("Failed to prove the range: %v", err)
+		}
+		keys, vals := rangeKeyValues(entries[start:end])
+		if mrand.Intn(2) == 0 {
+			keys = append([][]byte{entries[start-1].k}, keys...)
+			vals = append([][]byte{entries[start-1].v}, vals...)
+		} else {
+			keys = append(keys, entries[end].k)
+			vals = append(vals, entries[end].v)
+		}
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, vals, proof); err == nil {
+			t.Fatalf("Case %d(%d->%d) expect error for out of range key, got nil", i, start, end-1)
+		}
+	}
+}
+
+// forgedRootProof returns a proof mapping rootHash to the root node of a trie
+// holding only the given leaf.
+func forgedRootProof(t *testing.T, rootHash types.Hash, key, value []byte) *memorydb.Database {
+	forged := new(Trie)
+	forged.Update(key, value)
+
+	proof := memorydb.New()
+	if err := forged.Prove(key, 0, proof); err != nil {
+		t.Fatalf("Failed to prove the forged trie: %v", err)
+	}
+	forgedRoot := forged.Hash()
+	blob, err := proof.Get(forgedRoot[:])
+	if err != nil {
+		t.Fatalf("Forged root node missing: %v", err)
+	}
+	proof = memorydb.New()
+	proof.Put(rootHash[:], blob)
+	return proof
+}
+
+// TestForgedRangeProof tests that range proofs with proof nodes not matching
+// their hashes are rejected, including the single element and empty ranges.
+func TestForgedRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	// Single element range with a forged value
+	key := entries[10].k
+	proof := forgedRootProof(t, root, key, []byte("forged"))
+	if _, err := VerifyRangeProof(root, key, key, [][]byte{key}, [][]byte{[]byte("forged")}, proof); err == nil {
+		t.Error("Forged single element proof accepted")
+	}
+	// Empty range hiding the entries on the right
+	proof = forgedRootProof(t, root, entries[0].k, entries[0].v)
+	if _, err := VerifyRangeProof(root, key, nil, nil, nil, proof); err == nil {
+		t.Error("Forged empty range proof accepted")
+	}
+}
+
+// TestHasRightElement tests the more elements indicator of the range proofs.
+func TestHasRightElement(t *testing.T) {
+	trie := new(Trie)
+	var entries entrySlice
+	for i := 0; i < 4096; i++ {
+		value := &kv{randBytes(32), randBytes(20), false}
+		trie.Update(value.k, value.v)
+		entries = append(entries, value)
+	}
+	sort.Sort(entries)
+
+	var cases = []struct {
+		start   int
+		end     int
+		hasMore bool
+	}{
+		{-1, 1, true}, // single element with non-existent left proof
+		{0, 1, true},  // single element with existent left proof
+		{0, 10, true},
+		{50, 100, true},
+		{50, len(entries), false},               // No more element expected
+		{len(entries) - 1, len(entries), false}, // Single last element with two existent proofs(point to same key)
+		{len(entries) - 1, -1, false},           // Single last element with non-existent right proof
+		{0, len(entries), false},                // The whole set with existent left proof
+		{-1, len(entries), false},               // The whole set with non-existent left proof
+		{-1, -1, false},                         // The whole set with non-existent left/right proof
+	}
+	for _, c := range cases {
+		var (
+			firstKey []byte
+			lastKey  []byte
+			start    = c.start
+			end      = c.end
+			proof    = memorydb.New()
+		)
+		if c.start == -1 {
+			firstKey, start = types.Hash{}.Bytes(), 0
+		} else {
+			firstKey = entries[c.start].k
+		}
+		if c.end == -1 {
+			lastKey, end = types.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").Bytes(), len(entries)
+		} else {
+			lastKey = entries[c.end-1].k
+		}
+		if err := trie.ProveRange(firstKey, lastKey, proof); err != nil {
+			t.Fatalf("Failed to prove the range: %v", err)
+		}
+		keys, vals := rangeKeyValues(entries[start:end])
+		hasMore, err := VerifyRangeProof(trie.Hash(), firstKey, lastKey, keys, vals, proof)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if hasMore != c.hasMore {
+			t.Fatalf("Wrong hasMore indicator, want %t, got %t", c.hasMore, hasMore)
+		}
+	}
+}
+
+// decreaseKey returns the key right before the given one, treating it as a
+// big endian number.
+func decreaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]--
+		if key[i] != 0xff {
+			break
+		}
+	}
+	return key
+}
+
+// increaseKey returns the key right after the given one, treating it as a
+// big endian number.
+func increaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]++
+		if key[i] != 0x0 {
+			break
+		}
+	}
+	return key
+}
+
 func mutateByte(b []byte) {
 	for r := mrand.Intn(len(b)); ; {
 		new := byte(mrand.Intn(255))
@@ -0,0 +1,347 @@
+// Package tree
+//
+// @author: xwc1125
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/steakknife/bloomfilter"
+)
+
+// prunerStateKey is the database key used to persist the progress of an ongoing
+// pruning, allowing it to be resumed after an interruption.
+var prunerStateKey = []byte("trie-pruner-state")
+
+// prunerLogInterval specifies how often the pruner reports its progress.
+const prunerLogInterval = 8 * time.Second
+
+// ErrPruningInProgress is returned if a new pruning is requested while an earlier
+// one was interrupted and has not been resumed to completion yet.
+var ErrPruningInProgress = errors.New("interrupted pruning needs to be resumed")
+
+// PrunerConfig contains the settings of a trie pruner.
+type PrunerConfig struct {
+	// BloomSize is the size of the bloom filter (in megabytes) used to mark the
+	// live nodes. False positives only ever retain some garbage. If zero, an
+	// exact set is used, which is faster for small states but unbounded in size.
+	BloomSize uint64
+
+	// Resolver is called for every leaf of the live tries, returning the hashes
+	// of any data referenced by the leaf (e.g. the roots of nested storage tries
+	// or the hashes of contract code). Referenced trie nodes are walked as well.
+	Resolver func(leaf []byte) []types.Hash
+
+	// Progress is called periodically, and once more at the end of every phase,
+	// with the current statistics of the pruning.
+	Progress func(progress PruneProgress)
+}
+
+// PruneProgress contains the statistics of a pruning run.
+type PruneProgress struct {
+	Phase       string            // Current phase of the pruning, "mark" or "sweep"
+	Marked      uint64            // Number of live nodes marked
+	Scanned     uint64            // Number of database entries checked while sweeping
+	Deleted     uint64            // Number of unreachable nodes deleted
+	DeletedSize types.StorageSize // Storage size of the unreachable nodes deleted
+	Cursor      []byte            // Database key the sweep arrived at
+}
+
+// prunerState is the persisted progress of a pruning run.
+type prunerState struct {
+	Roots  []types.Hash // Live roots the pruning is retaining
+	Cursor []byte       // Database key to resume the sweep from
+}
+
+// Pruner is a mark-and-sweep garbage collector for the trie nodes persisted into
+// the disk database. It marks all the nodes reachable from a set of live roots,
+// then deletes every other trie node from disk.
+//
+// Only keys of hash length whose content hashes to the key itself (with the hash
+// function of the database) are treated as trie nodes, every other entry of the
+// disk database is left untouched. The
+// hashes returned by the resolver are retained too, so content addressed data
+// (e.g. contract code) must be surfaced through it to survive the pruning.
+//
+// Pruning is safe to run while the trie database is in use, as long as every
+// root still referenced (including tries only present in the memory cache) is
+// passed as a live root and no new trie is committed until pruning finishes.
+type Pruner struct {
+	db     *Database
+	config PrunerConfig
+
+	progress PruneProgress
+	logged   time.Time
+}
+
+// NewPruner creates a pruner for the trie nodes of the given database.
+func NewPruner(db *Database, config PrunerConfig) *Pruner {
+	return &Pruner{
+		db:     db,
+		config: config,
+	}
+}
+
+// Prune deletes every trie node from the disk database which is not reachable
+// from the given live roots. The progress is persisted along the way, so that
+// an interrupted pruning can be finished via Resume.
+func (p *Pruner) Prune(roots []types.Hash) error {
+	if state, err := p.state(); err != nil {
+		return err
+	} else if state != nil {
+		return ErrPruningInProgress
+	}
+	state := &prunerState{Roots: roots}
+	if err := p.writeState(p.db.diskdb, state); err != nil {
+		return err
+	}
+	return p.run(state)
+}
+
+// Resume continues an interrupted pruning. If there is no pruning in progress,
+// the method does nothing.
+func (p *Pruner) Resume() error {
+	state, err := p.state()
+	if err != nil || state == nil {
+		return err
+	}
+	logger().Info("Resuming interrupted pruning", "roots", len(state.Roots), "cursor", fmt.Sprintf("%x", state.Cursor))
+	return p.run(state)
+}
+
+// Progress returns the statistics of the last pruning run.
+func (p *Pruner) Progress() PruneProgress {
+	return p.progress
+}
+
+// PruningInterrupted returns whether an interrupted pruning was found in the
+// database, which needs to be resumed before the next pruning can start.
+func PruningInterrupted(db kvstore.KeyValueReader) bool {
+	has, _ := db.Has(prunerStateKey)
+	return has
+}
+
+// state retrieves the persisted pruning progress, or nil if none is stored.
+func (p *Pruner) state() (*prunerState, error) {
+	if !PruningInterrupted(p.db.diskdb) {
+		return nil, nil
+	}
+	blob, err := p.db.diskdb.Get(prunerStateKey)
+	if err != nil {
+		return nil, err
+	}
+	state := new(prunerState)
+	if err := rlp.DecodeBytes(blob, state); err != nil {
+		return nil, fmt.Errorf("invalid pruner state: %v", err)
+	}
+	return state, nil
+}
+
+// writeState persists the pruning progress into the given writer.
+func (p *Pruner) writeState(w kvstore.KeyValueWriter, state *prunerState) error {
+	blob, err := rlp.EncodeToBytes(state)
+	if err != nil {
+		return err
+	}
+	return w.Put(prunerStateKey, blob)
+}
+
+// run executes the mark and sweep phases of a pruning. Marking is always done
+// from scratch, as the live nodes are never deleted, while the sweep continues
+// from the persisted cursor.
+func (p *Pruner) run(state *prunerState) error {
+	start := time.Now()
+	p.progress = PruneProgress{Phase: "mark", Cursor: state.Cursor}
+	p.logged = time.Now()
+
+	var marker prunerMarker
+	if p.config.BloomSize > 0 {
+		bloom, err := bloomfilter.New(p.config.BloomSize*1024*1024*8, 4)
+		if err != nil {
+			return err
+		}
+		marker = &bloomMarker{bloom: bloom}
+	} else {
+		marker = make(setMarker)
+	}
+	for _, root := range state.Roots {
+		if err := p.mark(root, marker); err != nil {
+			return err
+		}
+	}
+	p.report(true)
+
+	p.progress.Phase = "sweep"
+	if err := p.sweep(state, marker); err != nil {
+		return err
+	}
+	p.report(true)
+
+	logger().Info("Pruned trie database", "marked", p.progress.Marked, "deleted", p.progress.Deleted,
+		"size", p.progress.DeletedSize, "elapsed", time.Since(start))
+	return nil
+}
+
+// mark walks the trie of the given root and every trie or blob referenced from
+// its leaves, marking all of them as live.
+func (p *Pruner) mark(root types.Hash, marker prunerMarker) error {
+	if root == (types.Hash{}) || root == p.db.scheme.emptyRoot {
+		return nil
+	}
+	// With an exact set, shared subtries only need to be walked once
+	if marker.contains(root[:]) && marker.exact() {
+		return nil
+	}
+	// The referenced hash might be a trie or a plain blob, only walk tries
+	blob, err := p.db.Node(root)
+	if err != nil || blob == nil {
+		return &MissingNodeError{NodeHash: root}
+	}
+	if _, err := decodeNode(root[:], blob); err != nil {
+		p.markHash(root[:], marker)
+		return nil
+	}
+	trie, err := New(root, p.db)
+	if err != nil {
+		return err
+	}
+	var (
+		it      = trie.NodeIterator(nil)
+		descend = true
+	)
+	for it.Next(descend) {
+		descend = true
+
+		hash := it.Hash()
+		if hash != (types.Hash{}) {
+			if marker.exact() && marker.contains(hash[:]) {
+				descend = false
+				continue
+			}
+			p.markHash(hash[:], marker)
+		}
+		if it.Leaf() && p.config.Resolver != nil {
+			for _, ref := range p.config.Resolver(it.LeafBlob()) {
+				if err := p.mark(ref, marker); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return it.Error()
+}
+
+// markHash marks a single hash as live.
+func (p *Pruner) markHash(hash []byte, marker prunerMarker) {
+	marker.add(hash)
+	p.progress.Marked++
+	p.report(false)
+}
+
+// sweep iterates over the disk database from the persisted cursor, deleting all
+// the trie nodes that were not marked as live. The progress is written in the
+// same batch as the deletions, so an interruption never loses track of them.
+func (p *Pruner) sweep(state *prunerState, marker prunerMarker) error {
+	var (
+		diskdb = p.db.diskdb
+		batch  = diskdb.NewBatch()
+		hasher = p.db.scheme.fn()
+		hash   = make([]byte, types.HashLength)
+		size   int // Deleted key sizes, backends don't agree on accounting deletions
+	)
+	it := diskdb.NewIteratorWithStart(state.Cursor)
+	defer it.Release()
+
+	for it.Next() {
+		key, blob := it.Key(), it.Value()
+		p.progress.Scanned++
+
+		if len(key) == types.HashLength && !marker.contains(key) {
+			hasher.Reset()
+			hasher.Write(blob)
+			if bytes.Equal(hasher.Sum(hash[:0]), key) {
+				if err := batch.Delete(key); err != nil {
+					return err
+				}
+				size += len(key)
+				if p.db.cleans != nil {
+					p.db.cleans.Del(key)
+				}
+				p.progress.Deleted++
+				p.progress.DeletedSize += types.StorageSize(len(key) + len(blob))
+			}
+		}
+		if size >= kvstore.IdealBatchSize {
+			state.Cursor = append(state.Cursor[:0], key...)
+			state.Cursor = append(state.Cursor, 0x00) // resume right after the current key
+			if err := p.writeState(batch, state); err != nil {
+				return err
+			}
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+			size = 0
+
+			p.progress.Cursor = state.Cursor
+			p.report(false)
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	// Sweep finished, drop the progress marker along with the last deletions
+	if err := batch.Delete(prunerStateKey); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	p.progress.Cursor = nil
+	return nil
+}
+
+// report logs the progress of the pruning and calls the progress callback,
+// either if forced or if enough time has passed since the last report.
+func (p *Pruner) report(force bool) {
+	if !force && time.Since(p.logged) < prunerLogInterval {
+		return
+	}
+	p.logged = time.Now()
+
+	logger().Info("Pruning trie database", "phase", p.progress.Phase, "marked", p.progress.Marked,
+		"scanned", p.progress.Scanned, "deleted", p.progress.Deleted, "size", p.progress.DeletedSize)
+	if p.config.Progress != nil {
+		p.config.Progress(p.progress)
+	}
+}
+
+// prunerMarker is the set of live hashes collected in the mark phase.
+type prunerMarker interface {
+	add(hash []byte)
+	contains(hash []byte) bool
+	exact() bool // Whether contains can be trusted to have no false positives
+}
+
+// setMarker is an exact set of live hashes.
+type setMarker map[types.Hash]struct{}
+
+func (m setMarker) add(hash []byte)           { m[types.BytesToHash(hash)] = struct{}{} }
+func (m setMarker) contains(hash []byte) bool { _, ok := m[types.BytesToHash(hash)]; return ok }
+func (m setMarker) exact() bool               { return true }
+
+// bloomMarker is a probabilistic set of live hashes, trading a few retained
+// garbage nodes for bounded memory usage.
+type bloomMarker struct {
+	bloom *bloomfilter.Filter
+}
+
+func (m *bloomMarker) add(hash []byte)           { m.bloom.Add(syncBloomHasher(hash)) }
+func (m *bloomMarker) contains(hash []byte) bool { return m.bloom.Contains(syncBloomHasher(hash)) }
+func (m *bloomMarker) exact() bool               { return false }
@@ -0,0 +1,261 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+	"golang.org/x/crypto/sha3"
+)
+
+// makePrunerTries creates two versions of a trie on disk, the second one sharing
+// only part of its nodes with the first.
+func makePrunerTries(t *testing.T, diskdb kvstore.KeyValueStore, items int) ([]types.Hash, []map[string][]byte) {
+	triedb := NewDatabase(diskdb)
+	trie, _ := New(types.Hash{}, triedb)
+
+	var (
+		roots    []types.Hash
+		contents []map[string][]byte
+	)
+	content := make(map[string][]byte)
+	for version := 0; version < 2; version++ {
+		// Overwrite half of the entries in the second version, keep the rest
+		for i := 0; i < items; i++ {
+			if version == 1 && i%2 == 0 {
+				continue
+			}
+			key, val := []byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d-%d", version, i))
+			trie.Update(key, val)
+			content[string(key)] = val
+		}
+		root, err := trie.Commit(nil)
+		if err != nil {
+			t.Fatalf("failed to commit trie: %v", err)
+		}
+		if err := triedb.Commit(root, false); err != nil {
+			t.Fatalf("failed to flush trie: %v", err)
+		}
+		snapshot := make(map[string][]byte)
+		for k, v := range content {
+			snapshot[k] = v
+		}
+		roots = append(roots, root)
+		contents = append(contents, snapshot)
+	}
+	return roots, contents
+}
+
+// countTrieNodes counts the number of trie nodes stored on disk.
+func countTrieNodes(db kvstore.Iteratee) int {
+	var (
+		nodes  int
+		hasher = sha3.NewLegacyKeccak256()
+	)
+	it := db.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		hasher.Reset()
+		hasher.Write(it.Value())
+		if bytes.Equal(hasher.Sum(nil), it.Key()) {
+			nodes++
+		}
+	}
+	return nodes
+}
+
+// countReachableNodes counts the number of hashed nodes reachable from a root.
+func countReachableNodes(db *Database, root types.Hash) int {
+	trie, _ := New(root, db)
+
+	nodes := 0
+	for it := trie.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (types.Hash{}) {
+			nodes++
+		}
+	}
+	return nodes
+}
+
+func TestPrunerSet(t *testing.T)   { testPruner(t, 0) }
+func TestPrunerBloom(t *testing.T) { testPruner(t, 1) }
+
+func testPruner(t *testing.T, bloomSize uint64) {
+	diskdb := memorydb.New()
+	roots, contents := makePrunerTries(t, diskdb, 1000)
+
+	// Add some data unrelated to the trie, which must survive the pruning
+	unrelated := map[string][]byte{
+		string(bytes.Repeat([]byte{0xff}, types.HashLength)): []byte("hash-length-key"),
+		"some-other-key": []byte("some-other-value"),
+	}
+	for k, v := range unrelated {
+		diskdb.Put([]byte(k), v)
+	}
+	var reports []PruneProgress
+	pruner := NewPruner(NewDatabase(diskdb), PrunerConfig{
+		BloomSize: bloomSize,
+		Progress:  func(progress PruneProgress) { reports = append(reports, progress) },
+	})
+	if err := pruner.Prune(roots[1:]); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	// Ensure the live trie is intact and the stale one got deleted
+	triedb := NewDatabase(diskdb)
+	checkTrieContents(t, triedb, roots[1][:], contents[1])
+
+	if have, want := countTrieNodes(diskdb), countReachableNodes(triedb, roots[1]); have != want {
+		t.Errorf("trie node count mismatch: have %d, want %d", have, want)
+	}
+	if has, _ := diskdb.Has(roots[0][:]); has {
+		t.Errorf("stale root retained")
+	}
+	for k, v := range unrelated {
+		if have, _ := diskdb.Get([]byte(k)); !bytes.Equal(have, v) {
+			t.Errorf("unrelated entry %x: have %x, want %x", k, have, v)
+		}
+	}
+	// Ensure the progress was reported for both phases
+	if len(reports) != 2 || reports[0].Phase != "mark" || reports[1].Phase != "sweep" {
+		t.Fatalf("progress reports mismatch: %v", reports)
+	}
+	progress := pruner.Progress()
+	if progress.Deleted == 0 || progress.Marked == 0 || progress.DeletedSize == 0 {
+		t.Errorf("incomplete progress: %+v", progress)
+	}
+	if PruningInterrupted(diskdb) {
+		t.Errorf("pruning marker left in the database")
+	}
+}
+
+// Tests that tries and blobs referenced from the leaves of live tries are
+// retained via the resolver.
+func TestPrunerResolver(t *testing.T) {
+	diskdb := memorydb.New()
+	triedb := NewDatabase(diskdb)
+
+	// Create a nested trie and a blob, both referenced from the main trie
+	nested, _ := New(types.Hash{}, triedb)
+	for i := 0; i < 100; i++ {
+		nested.Update([]byte(fmt.Sprintf("nested-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	nestedRoot, _ := nested.Commit(nil)
+	triedb.Commit(nestedRoot, false)
+
+	blob := []byte("content addressed blob")
+	blobHash := types.BytesToHash(hashBytes(blob))
+	diskdb.Put(blobHash[:], blob)
+
+	main, _ := New(types.Hash{}, triedb)
+	main.Update([]byte("nested"), nestedRoot[:])
+	main.Update([]byte("blob"), blobHash[:])
+	root, _ := main.Commit(nil)
+	triedb.Commit(root, false)
+
+	pruner := NewPruner(triedb, PrunerConfig{
+		Resolver: func(leaf []byte) []types.Hash {
+			if len(leaf) != types.HashLength {
+				return nil
+			}
+			return []types.Hash{types.BytesToHash(leaf)}
+		},
+	})
+	if err := pruner.Prune([]types.Hash{root}); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if err := checkTrieConsistency(NewDatabase(diskdb), nestedRoot); err != nil {
+		t.Fatalf("nested trie pruned: %v", err)
+	}
+	if have, _ := diskdb.Get(blobHash[:]); !bytes.Equal(have, blob) {
+		t.Fatalf("referenced blob pruned")
+	}
+	// Without the resolver, the references are garbage
+	pruner = NewPruner(NewDatabase(diskdb), PrunerConfig{})
+	if err := pruner.Prune([]types.Hash{root}); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if has, _ := diskdb.Has(nestedRoot[:]); has {
+		t.Fatalf("unreferenced nested trie retained")
+	}
+	if has, _ := diskdb.Has(blobHash[:]); has {
+		t.Fatalf("unreferenced blob retained")
+	}
+}
+
+// Tests that an interrupted pruning can be resumed and finishes the job.
+func TestPrunerResume(t *testing.T) {
+	diskdb := memorydb.New()
+	roots, contents := makePrunerTries(t, diskdb, 20000)
+
+	// Run a pruning which fails after the first flushed batch
+	faulty := &faultyDB{KeyValueStore: diskdb, writes: 2} // state + first sweep batch
+	if err := NewPruner(NewDatabase(faulty), PrunerConfig{}).Prune(roots[1:]); err == nil {
+		t.Fatalf("faulty pruning succeeded")
+	}
+	if !PruningInterrupted(diskdb) {
+		t.Fatalf("interrupted pruning not detected")
+	}
+	pruner := NewPruner(NewDatabase(diskdb), PrunerConfig{})
+	if state, err := pruner.state(); err != nil || len(state.Cursor) == 0 {
+		t.Fatalf("sweep progress not persisted: %v, %v", state, err)
+	}
+	if err := pruner.Prune(roots[:1]); !errors.Is(err, ErrPruningInProgress) {
+		t.Fatalf("pruning started while interrupted: %v", err)
+	}
+	// Resume the pruning and ensure the result is the same as a full run
+	if err := pruner.Resume(); err != nil {
+		t.Fatalf("failed to resume pruning: %v", err)
+	}
+	if PruningInterrupted(diskdb) {
+		t.Fatalf("pruning marker left in the database")
+	}
+	triedb := NewDatabase(diskdb)
+	checkTrieContents(t, triedb, roots[1][:], contents[1])
+
+	if have, want := countTrieNodes(diskdb), countReachableNodes(triedb, roots[1]); have != want {
+		t.Errorf("trie node count mismatch: have %d, want %d", have, want)
+	}
+}
+
+// faultyDB is a database whose batches start failing after a number of writes.
+type faultyDB struct {
+	kvstore.KeyValueStore
+	writes int
+}
+
+func (db *faultyDB) Put(key []byte, value []byte) error {
+	if db.writes == 0 {
+		return errors.New("write failed")
+	}
+	db.writes--
+	return db.KeyValueStore.Put(key, value)
+}
+
+func (db *faultyDB) NewBatch() kvstore.Batch {
+	return &faultyBatch{Batch: db.KeyValueStore.NewBatch(), db: db}
+}
+
+type faultyBatch struct {
+	kvstore.Batch
+	db *faultyDB
+}
+
+func (b *faultyBatch) Write() error {
+	if b.db.writes == 0 {
+		return errors.New("write failed")
+	}
+	b.db.writes--
+	return b.Batch.Write()
+}
+
+// hashBytes calculates the keccak256 hash of a blob.
+func hashBytes(blob []byte) []byte {
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(blob)
+	return hasher.Sum(nil)
+}
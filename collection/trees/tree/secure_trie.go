@@ -24,7 +24,8 @@ import (
 )
 
 // SecureTrie wraps a trie with key hashing. In a secure trie, all
-// access operations hash the key using keccak256. This prevents
+// access operations hash the key using the hash function of the trie,
+// keccak256 by default. This prevents
 // calling code from creating long chains of nodes that
 // increase the access time.
 //
@@ -62,6 +63,21 @@ func NewSecure(root types.Hash, db *Database) (*SecureTrie, error) {
 	return &SecureTrie{trie: *trie}, nil
 }
 
+// NewSecureWithHasher creates a secure trie with an existing root node from a
+// backing database, hashing both its keys and nodes with the given hash
+// function instead of the one of the database. If fn is nil, the hash function
+// of the database is used.
+func NewSecureWithHasher(root types.Hash, db *Database, fn HashFunc) (*SecureTrie, error) {
+	if db == nil {
+		panic("trie.NewSecureWithHasher called without a database")
+	}
+	trie, err := NewWithHasher(root, db, fn)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureTrie{trie: *trie}, nil
+}
+
 // Get returns the value for key stored in the trie.
 // The value bytes must not be modified by the caller.
 func (t *SecureTrie) Get(key []byte) []byte {
@@ -160,9 +176,38 @@ func (t *SecureTrie) Hash() types.Hash {
 	return t.trie.Hash()
 }
 
-// Copy returns a copy of SecureTrie.
+// SetParallelThreshold sets the number of updates since the last hashing above
+// which the children of the root node are hashed concurrently. See the Trie
+// method of the same name for details.
+func (t *SecureTrie) SetParallelThreshold(threshold int) {
+	t.trie.SetParallelThreshold(threshold)
+}
+
+// HashFunc returns the hash function used for hashing the keys and nodes.
+func (t *SecureTrie) HashFunc() HashFunc {
+	return t.trie.HashFunc()
+}
+
+// Snapshot creates a checkpoint of the current content of the trie and returns
+// its identifier, to be passed to RevertToSnapshot. Snapshots can be nested.
+func (t *SecureTrie) Snapshot() int {
+	return t.trie.Snapshot()
+}
+
+// RevertToSnapshot reverts all the modifications made since the given snapshot
+// was taken. The snapshot and all the later ones are discarded.
+func (t *SecureTrie) RevertToSnapshot(revid int) {
+	t.trie.RevertToSnapshot(revid)
+}
+
+// Copy returns a copy of SecureTrie. The snapshots of the trie and the witness
+// being recorded are copied along, reverting the copy leaves the original intact.
 func (t *SecureTrie) Copy() *SecureTrie {
 	cpy := *t
+	cpy.trie.journal = t.trie.journal.copy()
+	if t.trie.witness != nil {
+		cpy.trie.witness = t.trie.Witness()
+	}
 	return &cpy
 }
 
@@ -176,7 +221,7 @@ func (t *SecureTrie) NodeIterator(start []byte) NodeIterator {
 // The caller must not hold onto the return value because it will become
 // invalid on the next call to hashKey or secKey.
 func (t *SecureTrie) hashKey(key []byte) []byte {
-	h := newHasher(nil)
+	h := t.trie.hashScheme().newHasher(nil)
 	h.sha.Reset()
 	h.sha.Write(key)
 	buf := h.sha.Sum(t.hashKeyBuf[:0])
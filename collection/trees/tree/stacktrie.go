@@ -0,0 +1,367 @@
+// Package tree
+//
+// @author: xwc1125
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+)
+
+var (
+	// errStackTrieUnsorted is returned if a key is inserted into a stack trie
+	// which is not strictly larger than all the previously inserted ones.
+	errStackTrieUnsorted = errors.New("stack trie keys not in strictly increasing order")
+
+	// errStackTrieDeletion is returned if an empty value is inserted into a stack
+	// trie, as it doesn't support deletions.
+	errStackTrieDeletion = errors.New("stack trie doesn't support deletions")
+
+	// errStackTriePrefix is returned if a key is inserted into a stack trie which
+	// has the previously inserted key as its prefix. Values can't be stored in the
+	// branches of a stack trie.
+	errStackTriePrefix = errors.New("stack trie keys must be prefix-free")
+)
+
+// NodeWriteFunc is the callback invoked by the stack trie for every trie node
+// hashed and ready to be persisted.
+type NodeWriteFunc func(hash types.Hash, blob []byte)
+
+// Node types of the stack trie.
+const (
+	emptyNode = iota
+	branchNode
+	extNode
+	leafNode
+	hashedNode
+)
+
+// StackTrie is a trie implementation that expects keys to be inserted in strictly
+// increasing order. Once a subtrie is known to be complete, as a larger key was
+// inserted into a sibling, it is hashed and dropped from memory, so the memory
+// usage is proportional to the depth of the trie instead of its size.
+//
+// The resulting root hash is the same as the one of a Trie with the same
+// content. Every hashed node can be handed to an optional write callback,
+// allowing it to be persisted.
+type StackTrie struct {
+	nodeType  uint8          // Node type (as in branch, ext, leaf, hashed)
+	val       []byte         // Value contained by this node if it's a leaf
+	key       []byte         // Key chunk covered by this (ext|leaf) node, in nibbles
+	keyOffset int            // Offset of the key chunk inside a full key
+	children  [16]*StackTrie // List of children (for branches and exts)
+	collapsed node           // Collapsed form of the node once hashed: hash or embedded node
+
+	writeFn NodeWriteFunc // Callback for persisting the hashed nodes, may be nil
+	scheme  *hashScheme   // Hash scheme of the trie
+	last    []byte        // Last inserted key, only tracked by the root
+}
+
+// NewStackTrie allocates and initializes an empty trie. The write callback is
+// optional, it's invoked for every node that is hashed.
+func NewStackTrie(writeFn NodeWriteFunc) *StackTrie {
+	return &StackTrie{writeFn: writeFn, scheme: keccakScheme}
+}
+
+// NewStackTrieWithHasher allocates and initializes an empty trie, hashing its
+// nodes with the given hash function instead of Keccak256.
+func NewStackTrieWithHasher(writeFn NodeWriteFunc, fn HashFunc) (*StackTrie, error) {
+	scheme, err := hashSchemeOf(fn)
+	if err != nil {
+		return nil, err
+	}
+	return &StackTrie{writeFn: writeFn, scheme: scheme}, nil
+}
+
+// newLeaf creates a leaf node covering the key from the given nibble offset on.
+func (st *StackTrie) newLeaf(offset int, key, val []byte) *StackTrie {
+	return &StackTrie{
+		nodeType:  leafNode,
+		keyOffset: offset,
+		key:       append([]byte{}, key[offset:]...),
+		val:       val,
+		writeFn:   st.writeFn,
+		scheme:    st.scheme,
+	}
+}
+
+// newExt creates an extension node with the given key chunk and child.
+func (st *StackTrie) newExt(offset int, key []byte, child *StackTrie) *StackTrie {
+	ext := &StackTrie{
+		nodeType:  extNode,
+		keyOffset: offset,
+		key:       key,
+		writeFn:   st.writeFn,
+		scheme:    st.scheme,
+	}
+	ext.children[0] = child
+	return ext
+}
+
+// Update inserts a (key, value) pair into the stack trie. The key must be larger
+// than all the previously inserted keys.
+func (st *StackTrie) Update(key, value []byte) {
+	if err := st.TryUpdate(key, value); err != nil {
+		logger().Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryUpdate inserts a (key, value) pair into the stack trie. The key must be
+// larger than all the previously inserted keys without having any of them as a
+// prefix, and the value must not be empty, as deletions are not supported.
+func (st *StackTrie) TryUpdate(key, value []byte) error {
+	if len(value) == 0 {
+		return errStackTrieDeletion
+	}
+	if st.last != nil && string(key) <= string(st.last) {
+		return errStackTrieUnsorted
+	}
+	if st.last != nil && bytes.HasPrefix(key, st.last) {
+		return errStackTriePrefix
+	}
+	if st.nodeType == hashedNode {
+		return errStackTrieUnsorted // Already hashed, nothing can be added
+	}
+	st.last = append(st.last[:0], key...)
+
+	k := keybytesToHex(key)
+	st.insert(k[:len(k)-1], hexutil.CopyBytes(value)) // Drop the terminator
+	return nil
+}
+
+// Reset resets the stack trie object to empty state.
+func (st *StackTrie) Reset() {
+	*st = StackTrie{writeFn: st.writeFn, scheme: st.scheme}
+}
+
+// getDiffIndex returns the index at which the chunk pointed by st.keyOffset is
+// different from the key chunk of the node.
+func (st *StackTrie) getDiffIndex(key []byte) int {
+	diffindex := 0
+	for ; diffindex < len(st.key) && st.key[diffindex] == key[st.keyOffset+diffindex]; diffindex++ {
+	}
+	return diffindex
+}
+
+// insert adds a key (in nibbles, without terminator) and value to the subtrie.
+func (st *StackTrie) insert(key, value []byte) {
+	switch st.nodeType {
+	case branchNode:
+		idx := int(key[st.keyOffset])
+
+		// The key is larger than anything in the elder siblings, hash them
+		for i := idx - 1; i >= 0; i-- {
+			if st.children[i] != nil {
+				if st.children[i].nodeType != hashedNode {
+					st.children[i].hash()
+				}
+				break
+			}
+		}
+		// Add the new child or recurse into the existing one
+		if st.children[idx] == nil {
+			st.children[idx] = st.newLeaf(st.keyOffset+1, key, value)
+		} else {
+			st.children[idx].insert(key, value)
+		}
+
+	case extNode:
+		// Compare both key chunks and see where they differ
+		diffidx := st.getDiffIndex(key)
+
+		// If the chunks are identical, recurse into the child node. Otherwise the
+		// key has to be split into 1) an optional common prefix, 2) the branch
+		// representing the two differing paths, and 3) a leaf for each of the
+		// differentiated subtrees.
+		if diffidx == len(st.key) {
+			st.children[0].insert(key, value)
+			return
+		}
+		// Save the original part. Depending if the break is at the extension's
+		// last nibble or not, create an intermediate extension or use the
+		// extension's child node directly. Either way, it's complete now.
+		var n *StackTrie
+		if diffidx < len(st.key)-1 {
+			n = st.newExt(st.keyOffset+diffidx+1, st.key[diffidx+1:], st.children[0])
+		} else {
+			n = st.children[0]
+		}
+		n.hash()
+
+		var p *StackTrie
+		if diffidx == 0 {
+			// The break is on the first nibble, so the current node is converted
+			// into a branch node.
+			st.children[0] = nil
+			st.nodeType = branchNode
+			p = st
+		} else {
+			// The common prefix is at least one nibble long, insert a new
+			// intermediate branch node.
+			st.children[0] = &StackTrie{
+				nodeType:  branchNode,
+				keyOffset: st.keyOffset + diffidx,
+				writeFn:   st.writeFn,
+				scheme:    st.scheme,
+			}
+			p = st.children[0]
+		}
+		// Insert both children where they belong
+		origIdx, newIdx := st.key[diffidx], key[st.keyOffset+diffidx]
+		p.children[origIdx] = n
+		p.children[newIdx] = st.newLeaf(st.keyOffset+diffidx+1, key, value)
+		st.key = st.key[:diffidx]
+
+	case leafNode:
+		// Compare both key chunks and see where they differ
+		diffidx := st.getDiffIndex(key)
+
+		// Overwriting a key isn't supported, which means that the current leaf
+		// is expected to be split into 1) an optional extension for the common
+		// prefix of these 2 keys, 2) a branch selecting the path on which the
+		// keys differ, and 3) one leaf for the differentiated component of each
+		// key.
+		if diffidx >= len(st.key) {
+			panic("trying to insert into existing key")
+		}
+		var p *StackTrie
+		if diffidx == 0 {
+			// Convert current leaf into a branch
+			st.nodeType = branchNode
+			p = st
+		} else {
+			// Convert current node into an ext, and insert a child branch node
+			st.nodeType = extNode
+			st.children[0] = &StackTrie{
+				nodeType:  branchNode,
+				keyOffset: st.keyOffset + diffidx,
+				writeFn:   st.writeFn,
+				scheme:    st.scheme,
+			}
+			p = st.children[0]
+		}
+		// Create the two child leaves: one containing the original value and
+		// another containing the new value. The original leaf is complete, so
+		// it's hashed directly in order to free up some memory.
+		origIdx := st.key[diffidx]
+		orig := &StackTrie{
+			nodeType:  leafNode,
+			keyOffset: st.keyOffset + diffidx + 1,
+			key:       st.key[diffidx+1:],
+			val:       st.val,
+			writeFn:   st.writeFn,
+			scheme:    st.scheme,
+		}
+		orig.hash()
+		p.children[origIdx] = orig
+
+		newIdx := key[st.keyOffset+diffidx]
+		p.children[newIdx] = st.newLeaf(p.keyOffset+1, key, value)
+
+		// Finally, cut off the key part that has been passed over to the children
+		st.key = st.key[:diffidx]
+		st.val = nil
+
+	case emptyNode:
+		st.nodeType = leafNode
+		st.key = append([]byte{}, key[st.keyOffset:]...)
+		st.val = value
+
+	case hashedNode:
+		panic("trying to insert into hash")
+
+	default:
+		panic("invalid type")
+	}
+}
+
+// hash collapses the subtrie into its hash (or into an embedded node if its
+// encoding is shorter than a hash), handing all the hashed nodes to the write
+// callback and releasing the children.
+func (st *StackTrie) hash() {
+	var n node
+	switch st.nodeType {
+	case hashedNode:
+		return
+
+	case emptyNode:
+		st.collapsed = hashNode(st.scheme.emptyRoot.Bytes())
+		st.nodeType = hashedNode
+		return
+
+	case branchNode:
+		var full rawFullNode
+		for i, child := range st.children {
+			if child == nil {
+				continue
+			}
+			child.hash()
+			full[i] = child.collapsed
+			st.children[i] = nil
+		}
+		n = full
+
+	case extNode:
+		st.children[0].hash()
+		n = &rawShortNode{Key: hexToCompact(st.key), Val: st.children[0].collapsed}
+		st.children[0] = nil
+
+	case leafNode:
+		n = &rawShortNode{Key: hexToCompact(append(append([]byte{}, st.key...), 16)), Val: valueNode(st.val)}
+
+	default:
+		panic("invalid node type")
+	}
+	blob, err := rlp.EncodeToBytes(n)
+	if err != nil {
+		panic("encode error: " + err.Error())
+	}
+	st.nodeType, st.key, st.val = hashedNode, nil, nil
+
+	// Nodes smaller than 32 bytes are embedded into their parent
+	if len(blob) < 32 {
+		st.collapsed = n
+		return
+	}
+	hash := st.scheme.hash(blob)
+	st.collapsed = hashNode(hash[:])
+	if st.writeFn != nil {
+		st.writeFn(hash, blob)
+	}
+}
+
+// Hash returns the hash of the current node. No more keys can be inserted
+// afterwards.
+func (st *StackTrie) Hash() types.Hash {
+	st.hash()
+
+	// The root is always hashed, even if its encoding is shorter than a hash
+	if hash, ok := st.collapsed.(hashNode); ok {
+		return types.BytesToHash(hash)
+	}
+	blob, _ := rlp.EncodeToBytes(st.collapsed)
+	return st.scheme.hash(blob)
+}
+
+// Commit hashes the whole trie, handing every node (including the root, even if
+// its encoding is shorter than a hash) to the write callback, and returns the
+// root hash. No more keys can be inserted afterwards.
+func (st *StackTrie) Commit() (types.Hash, error) {
+	if st.writeFn == nil {
+		return types.Hash{}, errors.New("no write callback configured")
+	}
+	st.hash()
+
+	if hash, ok := st.collapsed.(hashNode); ok {
+		return types.BytesToHash(hash), nil
+	}
+	blob, _ := rlp.EncodeToBytes(st.collapsed)
+	hash := st.scheme.hash(blob)
+	st.writeFn(hash, blob)
+	return hash, nil
+}
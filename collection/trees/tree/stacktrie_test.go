@@ -0,0 +1,167 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+func TestStackTrieEmpty(t *testing.T) {
+	if have, want := NewStackTrie(nil).Hash(), emptyRoot; have != want {
+		t.Fatalf("empty stack trie hash mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that the stack trie produces the same root hash as the trie for small
+// contents, where most of the nodes (and possibly the root) are embedded.
+func TestStackTrieSmall(t *testing.T) {
+	tests := [][]kv{
+		{{k: []byte("a"), v: []byte("b")}},
+		{{k: []byte("a"), v: []byte("b")}, {k: []byte("b"), v: []byte("c")}},
+		{{k: []byte("doe"), v: []byte("reindeer")}, {k: []byte("dog"), v: []byte("puppy")}, {k: []byte("horse"), v: []byte("stallion")}},
+		{{k: []byte{0x00, 0x01}, v: []byte{0x01}}, {k: []byte{0x00, 0x02}, v: []byte{0x02}}, {k: []byte{0x10, 0x00}, v: []byte{0x03}}},
+	}
+	for i, entries := range tests {
+		if have, want := stackTrieRoot(entries), trieRoot(entries); have != want {
+			t.Errorf("test %d: root mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
+
+// Tests that the stack trie produces the same root hash as the trie for lists
+// keyed by their RLP encoded index, as used for deriving list roots.
+func TestStackTrieIndexKeys(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 16, 127, 128, 129, 256, 1000} {
+		entries := make([]kv, n)
+		for i := range entries {
+			key, _ := rlp.EncodeToBytes(uint(i))
+			entries[i] = kv{k: key, v: []byte(fmt.Sprintf("item-%d", i))}
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+
+		if have, want := stackTrieRoot(entries), trieRoot(entries); have != want {
+			t.Errorf("%d items: root mismatch: have %x, want %x", n, have, want)
+		}
+	}
+}
+
+// Tests that the stack trie produces the same root hash as the trie for random
+// contents, and that the written nodes are exactly the ones the trie persists.
+func TestStackTrieRandom(t *testing.T) {
+	for _, n := range []int{10, 100, 1000} {
+		for _, size := range []int{1, 20, 64} {
+			entries := make([]kv, n)
+			for i := range entries {
+				entries[i] = kv{k: randBytes(32), v: randBytes(size)}
+			}
+			sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+
+			// Commit the entries into a trie and flush it to disk
+			diskdb := memorydb.New()
+			triedb := NewDatabase(diskdb)
+			trie, _ := New(types.Hash{}, triedb)
+			for _, entry := range entries {
+				trie.Update(entry.k, entry.v)
+			}
+			want, _ := trie.Commit(nil)
+			triedb.Commit(want, false)
+
+			// Insert the same entries into the stack trie, collecting the nodes
+			nodes := make(map[types.Hash][]byte)
+			st := NewStackTrie(func(hash types.Hash, blob []byte) {
+				nodes[hash] = append([]byte{}, blob...)
+			})
+			for _, entry := range entries {
+				if err := st.TryUpdate(entry.k, entry.v); err != nil {
+					t.Fatalf("failed to insert %x: %v", entry.k, err)
+				}
+			}
+			have, err := st.Commit()
+			if err != nil {
+				t.Fatalf("failed to commit stack trie: %v", err)
+			}
+			if have != want {
+				t.Fatalf("%d items of %d bytes: root mismatch: have %x, want %x", n, size, have, want)
+			}
+			if diskdb.Len() != len(nodes) {
+				t.Fatalf("%d items of %d bytes: node count mismatch: have %d, want %d", n, size, len(nodes), diskdb.Len())
+			}
+			for hash, blob := range nodes {
+				if stored, _ := diskdb.Get(hash[:]); !bytes.Equal(stored, blob) {
+					t.Fatalf("%d items of %d bytes: node %x mismatch: have %x, want %x", n, size, hash, blob, stored)
+				}
+			}
+		}
+	}
+}
+
+// Tests that invalid insertions are rejected without corrupting the stack trie.
+func TestStackTrieInvalid(t *testing.T) {
+	st := NewStackTrie(nil)
+	if err := st.TryUpdate([]byte("b"), []byte("1")); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if err := st.TryUpdate([]byte("a"), []byte("2")); err != errStackTrieUnsorted {
+		t.Errorf("smaller key error mismatch: have %v, want %v", err, errStackTrieUnsorted)
+	}
+	if err := st.TryUpdate([]byte("b"), []byte("2")); err != errStackTrieUnsorted {
+		t.Errorf("duplicate key error mismatch: have %v, want %v", err, errStackTrieUnsorted)
+	}
+	if err := st.TryUpdate([]byte("bc"), []byte("2")); err != errStackTriePrefix {
+		t.Errorf("prefixed key error mismatch: have %v, want %v", err, errStackTriePrefix)
+	}
+	if err := st.TryUpdate([]byte("c"), nil); err != errStackTrieDeletion {
+		t.Errorf("empty value error mismatch: have %v, want %v", err, errStackTrieDeletion)
+	}
+	if err := st.TryUpdate([]byte("c"), []byte("3")); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if have, want := st.Hash(), trieRoot([]kv{{k: []byte("b"), v: []byte("1")}, {k: []byte("c"), v: []byte("3")}}); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	if err := st.TryUpdate([]byte("d"), []byte("4")); err == nil {
+		t.Errorf("insertion succeeded after hashing")
+	}
+	if _, err := st.Commit(); err == nil {
+		t.Errorf("commit succeeded without write callback")
+	}
+	// Resetting the stack trie must allow reusing it
+	st.Reset()
+	if have, want := st.Hash(), emptyRoot; have != want {
+		t.Fatalf("reset stack trie hash mismatch: have %x, want %x", have, want)
+	}
+}
+
+func stackTrieRoot(entries []kv) types.Hash {
+	st := NewStackTrie(nil)
+	for _, entry := range entries {
+		st.Update(entry.k, entry.v)
+	}
+	return st.Hash()
+}
+
+func trieRoot(entries []kv) types.Hash {
+	trie := newEmpty()
+	for _, entry := range entries {
+		trie.Update(entry.k, entry.v)
+	}
+	return trie.Hash()
+}
+
+func BenchmarkStackTrieHash(b *testing.B) {
+	entries := make([]kv, 10000)
+	for i := range entries {
+		entries[i] = kv{k: randBytes(32), v: randBytes(32)}
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stackTrieRoot(entries)
+	}
+}
@@ -33,6 +33,10 @@ var ErrNotRequested = errors.New("not requested")
 // node it already processed previously.
 var ErrAlreadyProcessed = errors.New("already processed")
 
+// ErrHashMismatch is returned by the trie sync when it's requested to process a
+// trie node whose data doesn't hash to the requested hash.
+var ErrHashMismatch = errors.New("node hash mismatch")
+
 // request represents a scheduled or already in-flight state retrieval request.
 type request struct {
 	hash types.Hash // Hash of the node data content to retrieve
@@ -57,6 +61,7 @@ type SyncResult struct {
 // persisted data items.
 type syncMemBatch struct {
 	batch map[types.Hash][]byte // In-memory membatch of recently completed items
+	size  uint64                // Estimated batch-size of in-memory data
 }
 
 // newSyncMemBatch allocates a new memory-buffer for not-yet persisted trie nodes.
@@ -75,16 +80,33 @@ type Sync struct {
 	requests map[types.Hash]*request // Pending requests pertaining to a key hash
 	queue    *prque.Prque            // Priority queue with the pending requests
 	bloom    *SyncBloom              // Bloom filter for fast node existence checks
+	scheme   *hashScheme             // Hash scheme of the trie being synced
 }
 
 // NewSync creates a new trie data download scheduler.
 func NewSync(root types.Hash, database kvstore.KeyValueReader, callback LeafCallback, bloom *SyncBloom) *Sync {
+	return newSync(root, database, callback, bloom, keccakScheme)
+}
+
+// NewSyncWithHasher creates a new trie data download scheduler for a trie hashing
+// its nodes with the given hash function instead of Keccak256.
+func NewSyncWithHasher(root types.Hash, database kvstore.KeyValueReader, callback LeafCallback, bloom *SyncBloom, fn HashFunc) (*Sync, error) {
+	scheme, err := hashSchemeOf(fn)
+	if err != nil {
+		return nil, err
+	}
+	return newSync(root, database, callback, bloom, scheme), nil
+}
+
+// newSync creates a new trie data download scheduler with the given hash scheme.
+func newSync(root types.Hash, database kvstore.KeyValueReader, callback LeafCallback, bloom *SyncBloom, scheme *hashScheme) *Sync {
 	ts := &Sync{
 		database: database,
 		membatch: newSyncMemBatch(),
 		requests: make(map[types.Hash]*request),
 		queue:    prque.New(),
 		bloom:    bloom,
+		scheme:   scheme,
 	}
 	ts.AddSubTrie(root, 0, types.Hash{}, callback)
 	return ts
@@ -93,7 +115,7 @@ func NewSync(root types.Hash, database kvstore.KeyValueReader, callback LeafCall
 // AddSubTrie registers a new trie to the sync code, rooted at the designated parent.
 func (s *Sync) AddSubTrie(root types.Hash, depth int, parent types.Hash, callback LeafCallback) {
 	// Short circuit if the trie is empty or already known
-	if root == emptyRoot {
+	if root == s.scheme.emptyRoot {
 		return
 	}
 	if _, ok := s.membatch.batch[root]; ok {
@@ -130,7 +152,7 @@ func (s *Sync) AddSubTrie(root types.Hash, depth int, parent types.Hash, callbac
 // contract code).
 func (s *Sync) AddRawEntry(hash types.Hash, depth int, parent types.Hash) {
 	// Short circuit if the entry is empty or already known
-	if hash == emptyState {
+	if hash == s.scheme.emptyState {
 		return
 	}
 	if _, ok := s.membatch.batch[hash]; ok {
@@ -191,7 +213,10 @@ func (s *Sync) Process(results []SyncResult) (bool, int, error) {
 			committed = true
 			continue
 		}
-		// Decode the node data content and update the request
+		// Verify and decode the node data content and update the request
+		if s.scheme.hash(item.Data) != item.Hash {
+			return committed, i, ErrHashMismatch
+		}
 		node, err := decodeNode(item.Hash[:], item.Data)
 		if err != nil {
 			return committed, i, err
@@ -231,6 +256,11 @@ func (s *Sync) Commit(dbw kvstore.Batch) error {
 	return nil
 }
 
+// MemSize returns an estimated size (in bytes) of the data held in the membatch.
+func (s *Sync) MemSize() uint64 {
+	return s.membatch.size
+}
+
 // Pending returns the number of state entries currently pending for download.
 func (s *Sync) Pending() int {
 	return len(s.requests)
@@ -321,6 +351,7 @@ func (s *Sync) children(req *request, object node) ([]*request, error) {
 func (s *Sync) commit(req *request) (err error) {
 	// Write the node content to the membatch
 	s.membatch.batch[req.hash] = req.data
+	s.membatch.size += types.HashLength + uint64(len(req.data))
 
 	delete(s.requests, req.hash)
 
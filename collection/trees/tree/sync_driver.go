@@ -0,0 +1,321 @@
+// Package tree
+//
+// @author: xwc1125
+package tree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-pkg/util/dateutil"
+)
+
+var (
+	// errSyncUnavailable is reported for the items a fetcher did not deliver.
+	errSyncUnavailable = errors.New("data not delivered")
+
+	// errSyncStalled is returned if the scheduler still has pending requests,
+	// but none of them can be retrieved.
+	errSyncStalled = errors.New("trie sync stalled")
+)
+
+// SyncFetcher retrieves the data of the given trie nodes or raw entries from any
+// source (e.g. a set of remote peers). The returned items correspond to the
+// requested hashes by position, nil or missing trailing items mark data that
+// could not be retrieved, which is requested again later.
+type SyncFetcher func(ctx context.Context, hashes []types.Hash) ([][]byte, error)
+
+// SyncDriverConfig contains the settings of a trie sync driver. Zero fields are
+// replaced by their defaults.
+type SyncDriverConfig struct {
+	Workers       int           // Number of concurrent fetches (default 4)
+	BatchSize     int           // Maximum number of hashes requested per fetch (default 128)
+	Retries       int           // Number of times an item is retried before aborting (default 3)
+	RetryDelay    time.Duration // Delay before fetching the items being retried (default 100ms)
+	CommitSize    uint64        // Size of the membatch to flush into the database (default kvstore.IdealBatchSize)
+	StateInterval time.Duration // Minimum time between persisting the scheduler state (default 30s)
+}
+
+// DefaultSyncDriverConfig contains the default settings of a trie sync driver.
+var DefaultSyncDriverConfig = SyncDriverConfig{
+	Workers:       4,
+	BatchSize:     128,
+	Retries:       3,
+	RetryDelay:    100 * time.Millisecond,
+	CommitSize:    kvstore.IdealBatchSize,
+	StateInterval: 30 * time.Second,
+}
+
+// sanitize returns a copy of the config with the unset fields defaulted.
+func (c *SyncDriverConfig) sanitize() SyncDriverConfig {
+	conf := DefaultSyncDriverConfig
+	if c == nil {
+		return conf
+	}
+	if c.Workers > 0 {
+		conf.Workers = c.Workers
+	}
+	if c.BatchSize > 0 {
+		conf.BatchSize = c.BatchSize
+	}
+	if c.Retries > 0 {
+		conf.Retries = c.Retries
+	}
+	if c.RetryDelay > 0 {
+		conf.RetryDelay = c.RetryDelay
+	}
+	if c.CommitSize > 0 {
+		conf.CommitSize = c.CommitSize
+	}
+	if c.StateInterval > 0 {
+		conf.StateInterval = c.StateInterval
+	}
+	return conf
+}
+
+// syncTask is a batch of hashes assigned to a fetch worker.
+type syncTask struct {
+	hashes []types.Hash
+	delay  time.Duration // Time to wait before fetching, if retrying
+}
+
+// syncResponse is the outcome of a syncTask.
+type syncResponse struct {
+	hashes []types.Hash
+	data   [][]byte
+	err    error
+}
+
+// syncDriver is the state of a running RunSync.
+type syncDriver struct {
+	sched  *Sync
+	db     kvstore.Batcher
+	config SyncDriverConfig
+
+	retries  []types.Hash       // Items waiting to be fetched again
+	failures map[types.Hash]int // Number of failed retrievals per item
+	saved    time.Time          // Time the scheduler state was last persisted
+
+	fetched uint64 // Number of items delivered by the fetcher
+	retried uint64 // Number of failed retrievals
+}
+
+// RunSync drives the trie sync scheduler to completion, retrieving the missing
+// items with the given fetcher from a number of concurrent workers and feeding
+// them into the scheduler, whose membatch is committed into db along the way.
+// Failed retrievals are retried up to the configured limit.
+//
+// The scheduler state is persisted periodically along with the committed data,
+// and once more if the sync is aborted or the context is cancelled, so that it
+// can be resumed via LoadSync (and LoadSyncBloom). Once the sync completes, the
+// persisted state is deleted.
+func RunSync(ctx context.Context, sched *Sync, db kvstore.Batcher, fetch SyncFetcher, config *SyncDriverConfig) error {
+	d := &syncDriver{
+		sched:    sched,
+		db:       db,
+		config:   config.sanitize(),
+		failures: make(map[types.Hash]int),
+		saved:    time.Now(),
+	}
+	// Start the fetch workers, reporting back into a channel large enough to
+	// never block them
+	ctx, cancel := context.WithCancel(ctx)
+	var (
+		tasks     = make(chan *syncTask)
+		responses = make(chan *syncResponse, d.config.Workers)
+		pend      sync.WaitGroup
+	)
+	for i := 0; i < d.config.Workers; i++ {
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+			for task := range tasks {
+				responses <- runSyncTask(ctx, fetch, task)
+			}
+		}()
+	}
+	defer func() {
+		cancel()
+		close(tasks)
+		pend.Wait()
+	}()
+
+	var (
+		start    = time.Now()
+		inflight int
+	)
+	for {
+		// Assign work to all the idle workers, retries first
+		for inflight < d.config.Workers {
+			task := d.nextTask()
+			if task == nil {
+				break
+			}
+			tasks <- task
+			inflight++
+		}
+		if inflight == 0 {
+			break
+		}
+		// Wait for a response and feed it into the scheduler
+		select {
+		case <-ctx.Done():
+			return d.abort(ctx.Err())
+		case res := <-responses:
+			inflight--
+			if err := d.process(res); err != nil {
+				return d.abort(err)
+			}
+		}
+		if d.sched.MemSize() >= d.config.CommitSize {
+			if err := d.flush(time.Since(d.saved) >= d.config.StateInterval); err != nil {
+				return d.abort(err)
+			}
+		}
+	}
+	if pending := d.sched.Pending(); pending > 0 {
+		return d.abort(fmt.Errorf("%w: %d requests pending", errSyncStalled, pending))
+	}
+	// Sync finished, commit the remainder and drop the persisted state
+	batch := d.db.NewBatch()
+	if err := d.sched.Commit(batch); err != nil {
+		return err
+	}
+	if err := DeleteSyncState(batch); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	logger().Info("Trie sync completed", "fetched", d.fetched, "retried", d.retried, "elapsed", dateutil.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// runSyncTask executes a fetch task, waiting out its delay first.
+func runSyncTask(ctx context.Context, fetch SyncFetcher, task *syncTask) *syncResponse {
+	res := &syncResponse{hashes: task.hashes}
+	if task.delay > 0 {
+		timer := time.NewTimer(task.delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			res.err = ctx.Err()
+			return res
+		case <-timer.C:
+		}
+	}
+	res.data, res.err = fetch(ctx, task.hashes)
+	return res
+}
+
+// nextTask assembles the next batch of hashes to fetch, or returns nil if there
+// is nothing to retrieve at the moment.
+func (d *syncDriver) nextTask() *syncTask {
+	if len(d.retries) > 0 {
+		n := len(d.retries)
+		if n > d.config.BatchSize {
+			n = d.config.BatchSize
+		}
+		task := &syncTask{
+			hashes: append([]types.Hash(nil), d.retries[:n]...),
+			delay:  d.config.RetryDelay,
+		}
+		d.retries = d.retries[n:]
+		return task
+	}
+	if hashes := d.sched.Missing(d.config.BatchSize); len(hashes) > 0 {
+		return &syncTask{hashes: hashes}
+	}
+	return nil
+}
+
+// process feeds the delivered items of a response into the scheduler, marking
+// the others for retrieval again.
+func (d *syncDriver) process(res *syncResponse) error {
+	results := make([]SyncResult, 0, len(res.hashes))
+	for i, hash := range res.hashes {
+		if res.err != nil || i >= len(res.data) || res.data[i] == nil {
+			err := res.err
+			if err == nil {
+				err = errSyncUnavailable
+			}
+			if err := d.retry(hash, err); err != nil {
+				return err
+			}
+			continue
+		}
+		results = append(results, SyncResult{Hash: hash, Data: res.data[i]})
+	}
+	d.fetched += uint64(len(results))
+
+	for len(results) > 0 {
+		_, index, err := d.sched.Process(results)
+		if err == nil {
+			break
+		}
+		// Invalid data (e.g. a hash mismatch) leaves the request untouched to be
+		// retried, any other failure is fatal
+		hash := results[index].Hash
+		if req := d.sched.requests[hash]; req == nil || req.data != nil {
+			return fmt.Errorf("failed to process %x: %v", hash, err)
+		}
+		if err := d.retry(hash, err); err != nil {
+			return err
+		}
+		results = results[index+1:]
+	}
+	return nil
+}
+
+// retry schedules a failed item for retrieval again, unless it ran out of its
+// retries.
+func (d *syncDriver) retry(hash types.Hash, err error) error {
+	d.retried++
+	d.failures[hash]++
+	if attempts := d.failures[hash]; attempts > d.config.Retries {
+		return fmt.Errorf("failed to retrieve %x after %d attempts: %v", hash, attempts, err)
+	}
+	d.retries = append(d.retries, hash)
+	return nil
+}
+
+// flush commits the membatch of the scheduler into the database, along with the
+// scheduler state if requested.
+func (d *syncDriver) flush(save bool) error {
+	batch := d.db.NewBatch()
+	if err := d.sched.Commit(batch); err != nil {
+		return err
+	}
+	if save {
+		if err := d.sched.Save(batch); err != nil {
+			return err
+		}
+		d.saved = time.Now()
+	}
+	logger().Debug("Committed trie sync data", "size", types.StorageSize(batch.ValueSize()), "pending", d.sched.Pending())
+	return batch.Write()
+}
+
+// abort persists the scheduler state along with the bloom filter and returns the
+// error the sync was aborted with.
+func (d *syncDriver) abort(err error) error {
+	if ferr := d.flush(true); ferr != nil {
+		logger().Error("Failed to persist trie sync state", "err", ferr)
+		return err
+	}
+	if d.sched.bloom != nil {
+		batch := d.db.NewBatch()
+		if berr := d.sched.bloom.Save(batch); berr == nil {
+			if berr := batch.Write(); berr != nil {
+				logger().Error("Failed to persist trie sync bloom", "err", berr)
+			}
+		}
+	}
+	logger().Info("Trie sync interrupted", "pending", d.sched.Pending(), "fetched", d.fetched, "err", err)
+	return err
+}
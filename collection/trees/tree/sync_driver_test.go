@@ -0,0 +1,155 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// flakyFetcher serves trie nodes from a database, randomly failing whole fetches,
+// dropping items and corrupting data.
+func flakyFetcher(db *Database, seed int64) SyncFetcher {
+	var (
+		lock sync.Mutex
+		rnd  = rand.New(rand.NewSource(seed))
+	)
+	return func(ctx context.Context, hashes []types.Hash) ([][]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if rnd.Intn(10) == 0 {
+			return nil, errors.New("peer dropped")
+		}
+		// Deliver a random prefix of the items, some of them invalid
+		data := make([][]byte, rnd.Intn(len(hashes)+1))
+		for i := range data {
+			blob, err := db.Node(hashes[i])
+			if err != nil {
+				return nil, err
+			}
+			switch rnd.Intn(10) {
+			case 0:
+				// Leave the item undelivered
+			case 1:
+				data[i] = append(blob[:len(blob):len(blob)], 0x00)
+			default:
+				data[i] = blob
+			}
+		}
+		return data, nil
+	}
+}
+
+// Tests that the sync driver completes a sync through an unreliable fetcher.
+func TestRunSync(t *testing.T) {
+	srcDb, srcTrie, srcData := makeTestTrie()
+
+	diskdb := memorydb.New()
+	sched := NewSync(srcTrie.Hash(), diskdb, nil, NewSyncBloom(1, diskdb))
+	config := &SyncDriverConfig{
+		BatchSize:     16,
+		Retries:       100,
+		RetryDelay:    1,
+		CommitSize:    1024,
+		StateInterval: 1,
+	}
+	if err := RunSync(context.Background(), sched, diskdb, flakyFetcher(srcDb, 1), config); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	checkTrieContents(t, NewDatabase(diskdb), srcTrie.Hash().Bytes(), srcData)
+
+	if has, _ := diskdb.Has(syncStateKey); has {
+		t.Fatalf("sync state retained after completion")
+	}
+}
+
+// Tests that an interrupted sync persists its state, from which it can be resumed
+// to completion.
+func TestRunSyncResume(t *testing.T) {
+	srcDb, srcTrie, srcData := makeTestTrie()
+
+	diskdb := memorydb.New()
+	bloom := NewSyncBloom(1, diskdb)
+	sched := NewSync(srcTrie.Hash(), diskdb, nil, bloom)
+
+	// Cancel the sync after a few fetches
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		fetches int
+		lock    sync.Mutex
+	)
+	fetcher := func(ctx context.Context, hashes []types.Hash) ([][]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if fetches++; fetches == 10 {
+			cancel()
+		}
+		data := make([][]byte, len(hashes))
+		for i, hash := range hashes {
+			data[i], _ = srcDb.Node(hash)
+		}
+		return data, nil
+	}
+	config := &SyncDriverConfig{BatchSize: 8, CommitSize: 1024}
+	if err := RunSync(ctx, sched, diskdb, fetcher, config); err != context.Canceled {
+		t.Fatalf("interrupted sync error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	bloom.Close()
+
+	// Resume the sync with a fresh fetcher
+	bloom, err := LoadSyncBloom(diskdb)
+	if err != nil {
+		bloom = NewSyncBloom(1, diskdb) // Interrupted before the bloom initialized
+	}
+	defer bloom.Close()
+
+	resumed, err := LoadSync(diskdb, nil, bloom, nil)
+	if err != nil {
+		t.Fatalf("failed to load sync state: %v", err)
+	}
+	if resumed.Pending() == 0 {
+		t.Fatalf("no requests pending after interruption")
+	}
+	if err := RunSync(context.Background(), resumed, diskdb, flakyFetcher(srcDb, 2), &SyncDriverConfig{Retries: 100, RetryDelay: 1}); err != nil {
+		t.Fatalf("failed to resume sync: %v", err)
+	}
+	checkTrieContents(t, NewDatabase(diskdb), srcTrie.Hash().Bytes(), srcData)
+}
+
+// Tests that the sync driver aborts if an item cannot be retrieved, persisting
+// the state for later.
+func TestRunSyncFailure(t *testing.T) {
+	srcDb, srcTrie, _ := makeTestTrie()
+
+	diskdb := memorydb.New()
+	sched := NewSync(srcTrie.Hash(), diskdb, nil, NewSyncBloom(1, diskdb))
+
+	// Serve everything but the root's children
+	root, _ := srcDb.Node(srcTrie.Hash())
+	fetcher := func(ctx context.Context, hashes []types.Hash) ([][]byte, error) {
+		data := make([][]byte, len(hashes))
+		for i, hash := range hashes {
+			if hash == srcTrie.Hash() {
+				data[i] = root
+			}
+		}
+		return data, nil
+	}
+	err := RunSync(context.Background(), sched, diskdb, fetcher, &SyncDriverConfig{Retries: 2, RetryDelay: 1})
+	if err == nil {
+		t.Fatalf("sync succeeded with missing data")
+	}
+	resumed, err := LoadSync(diskdb, nil, NewSyncBloom(1, diskdb), nil)
+	if err != nil {
+		t.Fatalf("failed to load sync state: %v", err)
+	}
+	if resumed.Pending() != sched.Pending() || resumed.Pending() == 0 {
+		t.Fatalf("pending requests mismatch: have %d, want %d", resumed.Pending(), sched.Pending())
+	}
+}
@@ -0,0 +1,217 @@
+// Package tree
+//
+// @author: xwc1125
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	prque "github.com/chain5j/chain5j-pkg/collection/queues/preque"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/steakknife/bloomfilter"
+)
+
+var (
+	// syncStateKey is the database key used to persist the scheduler state of an
+	// ongoing trie sync, allowing it to be resumed after a restart.
+	syncStateKey = []byte("trie-sync-state")
+
+	// syncBloomKey is the database key used to persist the bloom filter of an
+	// ongoing trie sync, sparing its reinitialization from the database.
+	syncBloomKey = []byte("trie-sync-bloom")
+)
+
+var (
+	// ErrNoSyncState is returned if a trie sync is to be resumed, but there is no
+	// persisted state to resume from.
+	ErrNoSyncState = errors.New("no persisted sync state")
+
+	// errSyncBloomUninited is returned if a sync bloom is to be persisted before
+	// its initialization from the database finished.
+	errSyncBloomUninited = errors.New("sync bloom not initialized")
+)
+
+// syncStateRequest is the persisted form of a pending retrieval request.
+type syncStateRequest struct {
+	Hash     types.Hash
+	Data     []byte       // Data content of the node if retrieved, empty otherwise
+	Raw      bool         // Whether this is a raw entry (code) or a trie node
+	Callback bool         // Whether the leaf callback is invoked on this branch
+	Depth    uint64       // Depth level within the trie the node is located
+	Deps     uint64       // Number of dependencies before allowed to commit the node
+	Parents  []types.Hash // Parent requests referencing this entry
+}
+
+// syncStateEntry is a persisted membatch item.
+type syncStateEntry struct {
+	Hash types.Hash
+	Data []byte
+}
+
+// syncState is the persisted state of a trie sync scheduler.
+type syncState struct {
+	Requests []syncStateRequest
+	Membatch []syncStateEntry
+}
+
+// Save persists the state of the scheduler (the pending requests and the not yet
+// committed membatch) into the given writer, from which LoadSync can resume the
+// sync. Requests handed out by Missing but not yet processed are saved as pending
+// and will be scheduled for retrieval again.
+//
+// Writing the state into the same batch the membatch is committed to keeps the
+// persisted state consistent with the database.
+func (s *Sync) Save(w kvstore.KeyValueWriter) error {
+	state := &syncState{
+		Requests: make([]syncStateRequest, 0, len(s.requests)),
+		Membatch: make([]syncStateEntry, 0, len(s.membatch.batch)),
+	}
+	for _, req := range s.requests {
+		item := syncStateRequest{
+			Hash:     req.hash,
+			Data:     req.data,
+			Raw:      req.raw,
+			Callback: req.callback != nil,
+			Depth:    uint64(req.depth),
+			Deps:     uint64(req.deps),
+		}
+		for _, parent := range req.parents {
+			item.Parents = append(item.Parents, parent.hash)
+		}
+		state.Requests = append(state.Requests, item)
+	}
+	for hash, data := range s.membatch.batch {
+		state.Membatch = append(state.Membatch, syncStateEntry{Hash: hash, Data: data})
+	}
+	blob, err := rlp.EncodeToBytes(state)
+	if err != nil {
+		return err
+	}
+	return w.Put(syncStateKey, blob)
+}
+
+// LoadSync recreates a trie sync scheduler from the state persisted into the
+// database by Save, or returns ErrNoSyncState if there is none. The nodes are
+// hashed with the given hash function (Keccak256 if nil), which must match the
+// one of the interrupted sync.
+//
+// Leaf callbacks cannot be persisted, so the given callback is reinstated on all
+// the branches which had one. Syncs using different callbacks for different
+// sub-tries cannot be resumed this way.
+func LoadSync(database kvstore.KeyValueReader, callback LeafCallback, bloom *SyncBloom, fn HashFunc) (*Sync, error) {
+	scheme, err := hashSchemeOf(fn)
+	if err != nil {
+		return nil, err
+	}
+	if has, _ := database.Has(syncStateKey); !has {
+		return nil, ErrNoSyncState
+	}
+	blob, err := database.Get(syncStateKey)
+	if err != nil {
+		return nil, err
+	}
+	state := new(syncState)
+	if err := rlp.DecodeBytes(blob, state); err != nil {
+		return nil, fmt.Errorf("invalid sync state: %v", err)
+	}
+	s := &Sync{
+		database: database,
+		membatch: newSyncMemBatch(),
+		requests: make(map[types.Hash]*request, len(state.Requests)),
+		queue:    prque.New(),
+		bloom:    bloom,
+		scheme:   scheme,
+	}
+	for _, entry := range state.Membatch {
+		s.membatch.batch[entry.Hash] = entry.Data
+		s.membatch.size += types.HashLength + uint64(len(entry.Data))
+	}
+	for _, item := range state.Requests {
+		req := &request{
+			hash:  item.Hash,
+			raw:   item.Raw,
+			depth: int(item.Depth),
+			deps:  int(item.Deps),
+		}
+		if len(item.Data) > 0 {
+			req.data = item.Data
+		}
+		if item.Callback {
+			req.callback = callback
+		}
+		s.requests[req.hash] = req
+	}
+	// Link the requests to their parents and schedule everything not retrieved
+	for _, item := range state.Requests {
+		req := s.requests[item.Hash]
+		for _, hash := range item.Parents {
+			parent := s.requests[hash]
+			if parent == nil {
+				return nil, fmt.Errorf("invalid sync state: parent %x of %x not pending", hash, item.Hash)
+			}
+			req.parents = append(req.parents, parent)
+		}
+		if req.data == nil {
+			s.queue.Push(req.hash, float32(req.depth))
+		}
+	}
+	logger().Info("Resumed trie sync", "pending", len(s.requests), "membatch", len(s.membatch.batch))
+	return s, nil
+}
+
+// DeleteSyncState removes the persisted state of a trie sync, including the
+// bloom filter, once the sync finished or is abandoned.
+func DeleteSyncState(w kvstore.KeyValueWriter) error {
+	if err := w.Delete(syncStateKey); err != nil {
+		return err
+	}
+	return w.Delete(syncBloomKey)
+}
+
+// Save persists the content of the bloom filter into the given writer, from which
+// LoadSyncBloom can restore it without iterating over the database again. The
+// bloom can only be saved once its initialization finished.
+//
+// Nodes written to the database after saving are missing from the restored
+// bloom, which only causes them to be retrieved again if still referenced.
+func (b *SyncBloom) Save(w kvstore.KeyValueWriter) error {
+	if atomic.LoadUint32(&b.inited) == 0 {
+		return errSyncBloomUninited
+	}
+	blob, err := b.bloom.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.Put(syncBloomKey, blob)
+}
+
+// LoadSyncBloom restores a bloom filter persisted into the database by Save, or
+// returns ErrNoSyncState if there is none. The restored bloom is live right away.
+func LoadSyncBloom(database kvstore.KeyValueReader) (*SyncBloom, error) {
+	if has, _ := database.Has(syncBloomKey); !has {
+		return nil, ErrNoSyncState
+	}
+	blob, err := database.Get(syncBloomKey)
+	if err != nil {
+		return nil, err
+	}
+	bloom := new(bloomfilter.Filter)
+	if err := bloom.UnmarshalBinary(blob); err != nil {
+		return nil, fmt.Errorf("invalid sync bloom: %v", err)
+	}
+	b := &SyncBloom{
+		bloom:  bloom,
+		inited: 1,
+	}
+	b.pend.Add(1)
+	go func() {
+		defer b.pend.Done()
+		b.meter()
+	}()
+	logger().Info("Restored fast sync bloom", "items", bloom.N(), "errorrate", b.errorRate())
+	return b, nil
+}
@@ -0,0 +1,148 @@
+package tree
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// Tests that a trie sync can be persisted midway, with requests in flight and
+// data not yet committed, and resumed to completion from the database.
+func TestSyncStateResume(t *testing.T) {
+	// Sync a secure trie, all the leaves of which are reported to the callback
+	srcDb, srcTrie, srcData := makeTestSecureTrie()
+
+	diskdb := memorydb.New()
+	leaves := 0
+	callback := func(leaf []byte, parent types.Hash) error {
+		leaves++
+		return nil
+	}
+	sched := NewSync(srcTrie.Hash(), diskdb, callback, NewSyncBloom(1, diskdb))
+
+	// Sync a few rounds, answering only half of the requests and committing the
+	// data only every other round
+	queue := sched.Missing(100)
+	for round := 0; round < 6; round++ {
+		results := make([]SyncResult, len(queue)/2+1)
+		for i, hash := range queue[:len(results)] {
+			data, err := srcDb.Node(hash)
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x: %v", hash, err)
+			}
+			results[i] = SyncResult{hash, data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if round%2 == 0 {
+			batch := diskdb.NewBatch()
+			if err := sched.Commit(batch); err != nil {
+				t.Fatalf("failed to commit data: %v", err)
+			}
+			batch.Write()
+		}
+		queue = append(queue[len(results):], sched.Missing(100)...)
+	}
+	if len(queue) == 0 || len(sched.membatch.batch) == 0 {
+		t.Fatalf("nothing in flight or uncommitted before persisting")
+	}
+	if err := sched.Save(diskdb); err != nil {
+		t.Fatalf("failed to save sync state: %v", err)
+	}
+	// Resume the sync from the database and run it to completion
+	resumed, err := LoadSync(diskdb, callback, NewSyncBloom(1, diskdb), nil)
+	if err != nil {
+		t.Fatalf("failed to load sync state: %v", err)
+	}
+	if resumed.Pending() != sched.Pending() {
+		t.Fatalf("pending requests mismatch: have %d, want %d", resumed.Pending(), sched.Pending())
+	}
+	if resumed.MemSize() != sched.MemSize() {
+		t.Fatalf("membatch size mismatch: have %d, want %d", resumed.MemSize(), sched.MemSize())
+	}
+	for queue := resumed.Missing(100); len(queue) > 0; queue = resumed.Missing(100) {
+		results := make([]SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := srcDb.Node(hash)
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x: %v", hash, err)
+			}
+			results[i] = SyncResult{hash, data}
+		}
+		if _, index, err := resumed.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		batch := diskdb.NewBatch()
+		if err := resumed.Commit(batch); err != nil {
+			t.Fatalf("failed to commit data: %v", err)
+		}
+		batch.Write()
+	}
+	if resumed.Pending() != 0 {
+		t.Fatalf("requests left pending: %d", resumed.Pending())
+	}
+	if leaves != len(srcData) {
+		t.Fatalf("leaf callback count mismatch: have %d, want %d", leaves, len(srcData))
+	}
+	trie, err := NewSecure(srcTrie.Hash(), NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("failed to open synced trie: %v", err)
+	}
+	for key, val := range srcData {
+		if have := trie.Get([]byte(key)); !bytes.Equal(have, val) {
+			t.Fatalf("entry %x: content mismatch: have %x, want %x", key, have, val)
+		}
+	}
+	// Deleting the state prevents resuming again
+	if err := DeleteSyncState(diskdb); err != nil {
+		t.Fatalf("failed to delete sync state: %v", err)
+	}
+	if _, err := LoadSync(diskdb, nil, NewSyncBloom(1, diskdb), nil); err != ErrNoSyncState {
+		t.Fatalf("sync state loaded after deletion: %v", err)
+	}
+}
+
+// Tests that the sync bloom can be persisted once initialized and restored from
+// the database.
+func TestSyncBloomSaveLoad(t *testing.T) {
+	diskdb := memorydb.New()
+	var keys [][]byte
+	for i := 0; i < 100; i++ {
+		key := randBytes(types.HashLength)
+		diskdb.Put(key, []byte{0x01})
+		keys = append(keys, key)
+	}
+	bloom := NewSyncBloom(1, diskdb)
+	for atomic.LoadUint32(&bloom.inited) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	added := randBytes(types.HashLength)
+	bloom.Add(added)
+
+	if err := bloom.Save(diskdb); err != nil {
+		t.Fatalf("failed to save bloom: %v", err)
+	}
+	bloom.Close()
+	if err := bloom.Save(diskdb); err != errSyncBloomUninited {
+		t.Fatalf("closed bloom saved: %v", err)
+	}
+	restored, err := LoadSyncBloom(diskdb)
+	if err != nil {
+		t.Fatalf("failed to load bloom: %v", err)
+	}
+	defer restored.Close()
+
+	for _, key := range append(keys, added) {
+		if !restored.Contains(key) {
+			t.Fatalf("restored bloom misses %x", key)
+		}
+	}
+	if _, err := LoadSyncBloom(memorydb.New()); err != ErrNoSyncState {
+		t.Fatalf("bloom loaded from empty database: %v", err)
+	}
+}
@@ -26,13 +26,17 @@ import (
 )
 
 var (
-	// emptyRoot is the known root hash of an empty trie.
+	// emptyRoot is the known root hash of an empty trie with the default hash.
 	emptyRoot = types.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
 
-	// emptyState is the known hash of an empty state trie entry.
+	// emptyState is the known hash of an empty state trie entry with the default hash.
 	emptyState = keccak.Keccak256Hash(nil)
 )
 
+// parallelHashThreshold is the default number of updates since the last hashing
+// above which the children of the root node are hashed concurrently.
+const parallelHashThreshold = 100
+
 // LeafCallback is a callback type invoked when a trie operation reaches a leaf
 // node. It's used by state sync and commit to allow handling external references
 // between account and storage tries.
@@ -44,8 +48,25 @@ type LeafCallback func(leaf []byte, parent types.Hash) error
 //
 // Trie is not safe for concurrent use.
 type Trie struct {
-	db   *Database
-	root node
+	db     *Database
+	root   node
+	scheme *hashScheme // Hash scheme of the trie, nil for the default one
+
+	// Keep track of the number of leaves which have been inserted since the last
+	// hashing operation. This number will not directly map to the number of
+	// actually unhashed nodes.
+	unhashed int
+
+	// parallelThreshold overrides parallelHashThreshold if non-zero. Negative
+	// values disable parallel hashing.
+	parallelThreshold int
+
+	// journal tracks the modifications since the oldest live snapshot, nil if no
+	// snapshot was ever taken.
+	journal *journal
+
+	// witness holds the nodes resolved since StartWitness, nil if not recording.
+	witness map[types.Hash][]byte
 }
 
 // newFlag returns the cache flag value for a newly created node.
@@ -66,10 +87,38 @@ func NewWithGenesis(root types.Hash, db *Database, genesisRoot types.Hash) (*Tri
 	if db == nil {
 		panic("trie.New called without a database")
 	}
+	return newTrie(root, db, genesisRoot, db.scheme)
+}
+
+// NewWithHasher creates a trie with an existing root node from db, hashing its
+// nodes with the given hash function instead of the one of the database. The
+// hash function must produce 32 byte digests. If fn is nil, the hash function
+// of the database is used, as with New.
+//
+// If root is the zero hash or the hash of an empty string, the trie is
+// initially empty. Otherwise, NewWithHasher will panic if db is nil and returns
+// a MissingNodeError if root does not exist in the database.
+func NewWithHasher(root types.Hash, db *Database, fn HashFunc) (*Trie, error) {
+	if db == nil {
+		panic("trie.NewWithHasher called without a database")
+	}
+	if fn == nil {
+		return newTrie(root, db, types.Hash{}, db.scheme)
+	}
+	scheme, err := newHashScheme(fn)
+	if err != nil {
+		return nil, err
+	}
+	return newTrie(root, db, types.Hash{}, scheme)
+}
+
+// newTrie creates a trie with the given hash scheme, resolving its root from db.
+func newTrie(root types.Hash, db *Database, genesisRoot types.Hash, scheme *hashScheme) (*Trie, error) {
 	trie := &Trie{
-		db: db,
+		db:     db,
+		scheme: scheme,
 	}
-	if root != (types.Hash{}) && root != emptyRoot && root != genesisRoot {
+	if root != (types.Hash{}) && root != scheme.emptyRoot && root != genesisRoot {
 		rootnode, err := trie.resolveHash(root[:], nil)
 		if err != nil {
 			return nil, err
@@ -79,6 +128,20 @@ func NewWithGenesis(root types.Hash, db *Database, genesisRoot types.Hash) (*Tri
 	return trie, nil
 }
 
+// hashScheme returns the hash scheme of the trie, the Keccak one for the zero
+// value trie.
+func (t *Trie) hashScheme() *hashScheme {
+	if t.scheme == nil {
+		return keccakScheme
+	}
+	return t.scheme
+}
+
+// HashFunc returns the hash function used for hashing the trie nodes.
+func (t *Trie) HashFunc() HashFunc {
+	return t.hashScheme().fn
+}
+
 // NodeIterator returns an iterator that returns nodes of the trie. Iteration starts at
 // the key after the given start key.
 func (t *Trie) NodeIterator(start []byte) NodeIterator {
@@ -164,6 +227,8 @@ func (t *Trie) Update(key, value []byte) {
 //
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *Trie) TryUpdate(key, value []byte) error {
+	t.journal.append(journalEntry{root: t.root, unhashed: t.unhashed})
+	t.unhashed++
 	k := keybytesToHex(key)
 	if len(value) != 0 {
 		_, n, err := t.insert(t.root, nil, k, valueNode(value))
@@ -260,6 +325,8 @@ func (t *Trie) Delete(key []byte) {
 // TryDelete removes any existing value for key from the trie.
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *Trie) TryDelete(key []byte) error {
+	t.journal.append(journalEntry{root: t.root, unhashed: t.unhashed})
+	t.unhashed++
 	k := keybytesToHex(key)
 	_, n, err := t.delete(t.root, nil, k)
 	if err != nil {
@@ -397,7 +464,10 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := types.BytesToHash(n)
-	if node := t.db.node(hash); node != nil {
+	if node, blob := t.db.node(hash, t.witness != nil); node != nil {
+		if t.witness != nil {
+			t.witness[hash] = blob
+		}
 		return node, nil
 	}
 	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
@@ -412,7 +482,8 @@ func (t *Trie) Hash() types.Hash {
 }
 
 // Commit writes all nodes to the trie's memory database, tracking the internal
-// and external (for account tries) references.
+// and external (for account tries) references. All the snapshots of the trie
+// are discarded.
 func (t *Trie) Commit(onleaf LeafCallback) (root types.Hash, err error) {
 	if t.db == nil {
 		panic("commit called on trie with nil database")
@@ -422,14 +493,58 @@ func (t *Trie) Commit(onleaf LeafCallback) (root types.Hash, err error) {
 		return types.Hash{}, err
 	}
 	t.root = cached
+	t.journal = nil
 	return types.BytesToHash(hash.(hashNode)), nil
 }
 
+// Snapshot creates a checkpoint of the current content of the trie and returns
+// its identifier, to be passed to RevertToSnapshot. Snapshots can be nested.
+//
+// Taking a snapshot is cheap: as trie nodes are never modified in place, the
+// journal only records the root node replaced by each update.
+func (t *Trie) Snapshot() int {
+	if t.journal == nil {
+		t.journal = new(journal)
+	}
+	return t.journal.snapshot()
+}
+
+// RevertToSnapshot reverts all the modifications made since the given snapshot
+// was taken. The snapshot and all the later ones are discarded, the earlier ones
+// remain valid. It panics if the snapshot is unknown or was already discarded.
+func (t *Trie) RevertToSnapshot(revid int) {
+	if t.journal == nil {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	if entry, ok := t.journal.revert(revid); ok {
+		t.root, t.unhashed = entry.root, entry.unhashed
+	}
+}
+
+// SetParallelThreshold sets the number of updates since the last hashing above
+// which Hash and Commit process the children of the root node concurrently. A
+// zero threshold restores the default, a negative one disables parallel hashing.
+//
+// The results are identical to sequential hashing, parallelism only pays off if
+// there are enough dirty nodes to amortize the goroutine overhead.
+func (t *Trie) SetParallelThreshold(threshold int) {
+	t.parallelThreshold = threshold
+}
+
 func (t *Trie) hashRoot(db *Database, onleaf LeafCallback) (node, node, error) {
+	scheme := t.hashScheme()
 	if t.root == nil {
-		return hashNode(emptyRoot.Bytes()), nil, nil
+		return hashNode(scheme.emptyRoot.Bytes()), nil, nil
+	}
+	threshold := parallelHashThreshold
+	if t.parallelThreshold != 0 {
+		threshold = t.parallelThreshold
 	}
-	h := newHasher(onleaf)
-	defer returnHasherToPool(h)
+	h := scheme.newHasher(onleaf)
+	h.parallel = threshold > 0 && t.unhashed >= threshold
+	defer func() {
+		returnHasherToPool(h)
+		t.unhashed = 0
+	}()
 	return h.hash(t.root, db, true)
 }
@@ -566,3 +566,70 @@ func TestRang(t *testing.T) {
 	updateString(trie, "1", "1")
 	t.Logf("错序处理：%s", trie.Hash().Hex())
 }
+
+// Tests that parallel hashing and committing yields exactly the same trie as the
+// sequential one, both in root hash and in the nodes written to the database.
+func TestParallelHashing(t *testing.T) {
+	var (
+		seqdb = NewDatabase(memorydb.New())
+		pardb = NewDatabase(memorydb.New())
+	)
+	seq, _ := New(types.Hash{}, seqdb)
+	seq.SetParallelThreshold(-1)
+	par, _ := New(types.Hash{}, pardb)
+	par.SetParallelThreshold(1)
+
+	var seqLeaves, parLeaves int
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 1000; i++ {
+			key, val := randBytes(32), randBytes(20)
+			if i%10 == 0 {
+				val = nil // sprinkle some deletions around
+			}
+			seq.Update(key, val)
+			par.Update(key, val)
+		}
+		if seqHash, parHash := seq.Hash(), par.Hash(); seqHash != parHash {
+			t.Fatalf("round %d: hash mismatch: sequential %x, parallel %x", round, seqHash, parHash)
+		}
+		seqRoot, _ := seq.Commit(func(leaf []byte, parent types.Hash) error { seqLeaves++; return nil })
+		parRoot, _ := par.Commit(func(leaf []byte, parent types.Hash) error { parLeaves++; return nil })
+		if seqRoot != parRoot {
+			t.Fatalf("round %d: root mismatch: sequential %x, parallel %x", round, seqRoot, parRoot)
+		}
+		if seqLeaves != parLeaves {
+			t.Fatalf("round %d: leaf callback mismatch: sequential %d, parallel %d", round, seqLeaves, parLeaves)
+		}
+	}
+	// Ensure the very same nodes were collected into the databases
+	seqNodes, parNodes := seqdb.Nodes(), pardb.Nodes()
+	if len(seqNodes) != len(parNodes) {
+		t.Fatalf("node count mismatch: sequential %d, parallel %d", len(seqNodes), len(parNodes))
+	}
+	for _, hash := range seqNodes {
+		seqBlob, _ := seqdb.Node(hash)
+		parBlob, err := pardb.Node(hash)
+		if err != nil || !bytes.Equal(seqBlob, parBlob) {
+			t.Fatalf("node %x mismatch: sequential %x, parallel %x (%v)", hash, seqBlob, parBlob, err)
+		}
+	}
+}
+
+func BenchmarkHashSequential(b *testing.B) { benchmarkHashParallel(b, -1) }
+func BenchmarkHashParallel(b *testing.B)   { benchmarkHashParallel(b, 1) }
+
+func benchmarkHashParallel(b *testing.B, threshold int) {
+	keys, vals := make([][]byte, 10000), make([][]byte, 10000)
+	for i := range keys {
+		keys[i], vals[i] = randBytes(32), randBytes(32)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie := new(Trie)
+		trie.SetParallelThreshold(threshold)
+		for j := range keys {
+			trie.Update(keys[j], vals[j])
+		}
+		trie.Hash()
+	}
+}
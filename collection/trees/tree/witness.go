@@ -0,0 +1,133 @@
+// Package tree
+//
+// @author: xwc1125
+package tree
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// StartWitness starts recording every trie node accessed through the database,
+// whether served from the caches or loaded from disk, discarding any previously
+// recorded witness. The recording covers all the tries opened over the database,
+// which makes it suitable for collecting the witness of nested tries.
+func (db *Database) StartWitness() {
+	db.witnessLock.Lock()
+	defer db.witnessLock.Unlock()
+
+	db.witness = make(map[types.Hash][]byte)
+	atomic.StoreUint32(&db.recording, 1)
+}
+
+// StopWitness stops recording the accessed trie nodes, discarding the witness.
+func (db *Database) StopWitness() {
+	db.witnessLock.Lock()
+	defer db.witnessLock.Unlock()
+
+	atomic.StoreUint32(&db.recording, 0)
+	db.witness = nil
+}
+
+// Witness returns the trie nodes accessed since StartWitness, keyed by hash.
+func (db *Database) Witness() map[types.Hash][]byte {
+	db.witnessLock.Lock()
+	defer db.witnessLock.Unlock()
+
+	witness := make(map[types.Hash][]byte, len(db.witness))
+	for hash, blob := range db.witness {
+		witness[hash] = blob
+	}
+	return witness
+}
+
+// witnessing reports whether the accessed trie nodes are being recorded.
+func (db *Database) witnessing() bool {
+	return atomic.LoadUint32(&db.recording) != 0
+}
+
+// recordWitness adds an accessed trie node to the witness, if recording.
+func (db *Database) recordWitness(hash types.Hash, blob []byte) {
+	if !db.witnessing() {
+		return
+	}
+	db.witnessLock.Lock()
+	defer db.witnessLock.Unlock()
+
+	if db.witness != nil {
+		db.witness[hash] = blob
+	}
+}
+
+// StartWitness starts recording every trie node resolved by the trie, discarding
+// any previously recorded witness.
+//
+// Nodes already resolved are kept in memory and would not be recorded again, so
+// if the trie has no uncommitted changes, they are dropped to be resolved anew.
+// Otherwise, the witness should be started right after opening the trie.
+func (t *Trie) StartWitness() {
+	t.witness = make(map[types.Hash][]byte)
+	if t.root == nil {
+		return
+	}
+	if hash, dirty := t.root.cache(); hash != nil && !dirty {
+		t.root = hash
+	}
+}
+
+// StopWitness stops recording the resolved trie nodes, discarding the witness.
+func (t *Trie) StopWitness() {
+	t.witness = nil
+}
+
+// Witness returns the trie nodes resolved since StartWitness, keyed by hash. A
+// trie opened over a database holding only these nodes (see
+// NewDatabaseFromWitness) serves all the accesses made since, yielding the same
+// results.
+func (t *Trie) Witness() map[types.Hash][]byte {
+	witness := make(map[types.Hash][]byte, len(t.witness))
+	for hash, blob := range t.witness {
+		witness[hash] = blob
+	}
+	return witness
+}
+
+// StartWitness starts recording every trie node resolved by the trie. See the
+// Trie method of the same name for details.
+func (t *SecureTrie) StartWitness() {
+	t.trie.StartWitness()
+}
+
+// StopWitness stops recording the resolved trie nodes, discarding the witness.
+func (t *SecureTrie) StopWitness() {
+	t.trie.StopWitness()
+}
+
+// Witness returns the trie nodes resolved since StartWitness, keyed by hash.
+func (t *SecureTrie) Witness() map[types.Hash][]byte {
+	return t.trie.Witness()
+}
+
+// NewDatabaseFromWitness creates a trie database over an in-memory store holding
+// only the nodes of a witness, for stateless verification. Every node is checked
+// to match its hash, computed with the given hash function (Keccak256 if nil).
+func NewDatabaseFromWitness(witness map[types.Hash][]byte, fn HashFunc) (*Database, error) {
+	scheme, err := hashSchemeOf(fn)
+	if err != nil {
+		return nil, err
+	}
+	diskdb := memorydb.New()
+	for hash, blob := range witness {
+		if have := scheme.hash(blob); have != hash {
+			return nil, fmt.Errorf("witness node %x hash mismatch: have %x", hash, have)
+		}
+		if _, err := decodeNode(hash[:], blob); err != nil {
+			return nil, fmt.Errorf("invalid witness node %x: %v", hash, err)
+		}
+		diskdb.Put(hash[:], blob)
+	}
+	return newDatabase(diskdb, 0, scheme), nil
+}
@@ -0,0 +1,203 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+)
+
+// witnessOps applies a fixed set of reads, updates and deletions to a trie and
+// returns the values read along with the resulting root.
+func witnessOps(t *testing.T, trie *Trie) ([][]byte, types.Hash) {
+	var reads [][]byte
+	for i := 0; i < 500; i += 37 {
+		val, err := trie.TryGet([]byte(fmt.Sprintf("key-%04d", i)))
+		if err != nil {
+			t.Fatalf("failed to read key %d: %v", i, err)
+		}
+		reads = append(reads, val)
+	}
+	for i := 3; i < 500; i += 61 {
+		if err := trie.TryUpdate([]byte(fmt.Sprintf("key-%04d", i)), []byte("updated")); err != nil {
+			t.Fatalf("failed to update key %d: %v", i, err)
+		}
+		if err := trie.TryDelete([]byte(fmt.Sprintf("key-%04d", i+1))); err != nil {
+			t.Fatalf("failed to delete key %d: %v", i+1, err)
+		}
+	}
+	if err := trie.TryUpdate([]byte("key-new"), []byte("new")); err != nil {
+		t.Fatalf("failed to insert key: %v", err)
+	}
+	return reads, trie.Hash()
+}
+
+func TestTrieWitness(t *testing.T) {
+	for name, fn := range map[string]HashFunc{"keccak": nil, "sm3": SM3} {
+		triedb, root, _ := makeHashedTrie(t, fn)
+		triedb.Commit(root, false)
+
+		// Warm up the trie before starting the witness, which must not matter
+		trie, _ := New(root, triedb)
+		trie.Get([]byte("key-0000"))
+		trie.StartWitness()
+
+		reads, want := witnessOps(t, trie)
+		witness := trie.Witness()
+		if len(witness) == 0 || len(witness) >= triedb.DiskDB().(*memorydb.Database).Len() {
+			t.Fatalf("%s: witness size mismatch: %d nodes", name, len(witness))
+		}
+		if _, ok := witness[root]; !ok {
+			t.Fatalf("%s: root missing from witness", name)
+		}
+		// Replay the same operations over the witness alone
+		witnessDb, err := NewDatabaseFromWitness(witness, fn)
+		if err != nil {
+			t.Fatalf("%s: failed to create witness database: %v", name, err)
+		}
+		stateless, err := New(root, witnessDb)
+		if err != nil {
+			t.Fatalf("%s: failed to open stateless trie: %v", name, err)
+		}
+		haveReads, have := witnessOps(t, stateless)
+		if have != want {
+			t.Fatalf("%s: stateless root mismatch: have %x, want %x", name, have, want)
+		}
+		for i := range reads {
+			if !bytes.Equal(haveReads[i], reads[i]) {
+				t.Fatalf("%s: stateless read %d mismatch: have %q, want %q", name, i, haveReads[i], reads[i])
+			}
+		}
+		// Accesses outside of the witness must fail
+		stateless, _ = New(root, witnessDb)
+		var missing *MissingNodeError
+		found := false
+		for i := 0; i < 500 && !found; i++ {
+			if _, err := stateless.TryGet([]byte(fmt.Sprintf("key-%04d", i))); errors.As(err, &missing) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("%s: witness covers the whole trie", name)
+		}
+		trie.StopWitness()
+		trie.Get([]byte("key-0001"))
+		if len(trie.Witness()) != 0 {
+			t.Fatalf("%s: nodes recorded after stopping the witness", name)
+		}
+	}
+}
+
+// countingDB counts the reads of the underlying database.
+type countingDB struct {
+	*memorydb.Database
+	reads int
+}
+
+func (db *countingDB) Get(key []byte) ([]byte, error) {
+	db.reads++
+	return db.Database.Get(key)
+}
+
+// Tests that recording the witness doesn't load the resolved nodes again.
+func TestTrieWitnessReads(t *testing.T) {
+	triedb, root, _ := makeHashedTrie(t, nil)
+	triedb.Commit(root, false)
+
+	diskdb := &countingDB{Database: triedb.DiskDB().(*memorydb.Database)}
+	trie, _ := New(root, NewDatabase(diskdb))
+	trie.StartWitness()
+	diskdb.reads = 0
+
+	witnessOps(t, trie)
+	if have, want := diskdb.reads, len(trie.Witness()); have != want {
+		t.Fatalf("disk reads mismatch: have %d, want %d", have, want)
+	}
+}
+
+// Tests that a copied secure trie records its witness independently.
+func TestSecureTrieWitnessCopy(t *testing.T) {
+	triedb, src, content := makeTestSecureTrie()
+	root, _ := src.Commit(nil)
+	triedb.Commit(root, false)
+
+	trie, _ := NewSecure(root, triedb)
+	trie.StartWitness()
+	trie.Get(hexutil.LeftPadBytes([]byte{1, 0}, 32))
+	recorded := len(trie.Witness())
+
+	cpy := trie.Copy()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for key := range content {
+			cpy.Get([]byte(key))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		trie.Get(randBytes(32))
+	}
+	<-done
+
+	if len(cpy.Witness()) <= recorded {
+		t.Fatalf("copy witness not recorded: %d nodes", len(cpy.Witness()))
+	}
+}
+
+func TestDatabaseWitness(t *testing.T) {
+	triedb, root, _ := makeHashedTrie(t, nil)
+
+	// Record the accesses of a couple of tries, including the dirty nodes
+	triedb.StartWitness()
+	first, _ := New(root, triedb)
+	reads, want := witnessOps(t, first)
+
+	witness := triedb.Witness()
+	if _, ok := witness[root]; !ok {
+		t.Fatalf("root missing from witness")
+	}
+	witnessDb, err := NewDatabaseFromWitness(witness, nil)
+	if err != nil {
+		t.Fatalf("failed to create witness database: %v", err)
+	}
+	stateless, _ := New(root, witnessDb)
+	haveReads, have := witnessOps(t, stateless)
+	if have != want {
+		t.Fatalf("stateless root mismatch: have %x, want %x", have, want)
+	}
+	for i := range reads {
+		if !bytes.Equal(haveReads[i], reads[i]) {
+			t.Fatalf("stateless read %d mismatch: have %q, want %q", i, haveReads[i], reads[i])
+		}
+	}
+	triedb.StopWitness()
+	New(root, triedb)
+	if len(triedb.Witness()) != 0 {
+		t.Fatalf("nodes recorded after stopping the witness")
+	}
+}
+
+func TestWitnessInvalid(t *testing.T) {
+	triedb, root, _ := makeHashedTrie(t, nil)
+	trie, _ := New(root, triedb)
+	trie.StartWitness()
+	witnessOps(t, trie)
+
+	witness := trie.Witness()
+	for hash, blob := range witness {
+		corrupt := append([]byte{}, blob...)
+		corrupt[len(corrupt)-1] ^= 0x01
+		witness[hash] = corrupt
+		break
+	}
+	if _, err := NewDatabaseFromWitness(witness, nil); err == nil {
+		t.Fatalf("corrupted witness accepted")
+	}
+	if _, err := NewDatabaseFromWitness(trie.Witness(), SM3); err == nil {
+		t.Fatalf("witness accepted with mismatching hash function")
+	}
+}
@@ -17,6 +17,9 @@
 package hashalg
 
 import (
+	"bytes"
+	"sort"
+
 	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
 	"github.com/chain5j/chain5j-pkg/types"
 )
@@ -28,13 +31,37 @@ type DerivableList interface {
 	Item(i int) []byte
 }
 
-// RootHash get list root
+// RootHash get list root. The items are streamed into a stack trie ordered by
+// their keys, falling back to a full in-memory trie if the keys can't be inserted
+// into a stack trie (duplicate or prefixed keys, or empty items).
 func RootHash(list DerivableList) types.Hash {
-	trie := new(tree.Trie)
-	if list != nil {
-		for i := 0; i < list.Len(); i++ {
-			trie.Update(list.Key(i), list.Item(i))
+	if list == nil || list.Len() == 0 {
+		return new(tree.Trie).Hash()
+	}
+	// Encode every key once, the comparisons of the sort would do it many times
+	keys := make([][]byte, list.Len())
+	order := make([]int, list.Len())
+	for i := range order {
+		keys[i], order[i] = list.Key(i), i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return bytes.Compare(keys[order[i]], keys[order[j]]) < 0
+	})
+	st := tree.NewStackTrie(nil)
+	for _, i := range order {
+		if err := st.TryUpdate(keys[i], list.Item(i)); err != nil {
+			return trieRootHash(list)
 		}
 	}
+	return st.Hash()
+}
+
+// trieRootHash get list root by inserting the items into a full in-memory trie,
+// in their original order.
+func trieRootHash(list DerivableList) types.Hash {
+	trie := new(tree.Trie)
+	for i := 0; i < list.Len(); i++ {
+		trie.Update(list.Key(i), list.Item(i))
+	}
 	return trie.Hash()
 }
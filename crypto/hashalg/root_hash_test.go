@@ -0,0 +1,57 @@
+package hashalg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+)
+
+// testList is a derivable list keyed by the RLP encoded item indexes.
+type testList [][]byte
+
+func (l testList) Len() int { return len(l) }
+
+func (l testList) Key(i int) []byte {
+	key, _ := rlp.EncodeToBytes(uint(i))
+	return key
+}
+
+func (l testList) Item(i int) []byte { return l[i] }
+
+// keyedList is a derivable list with explicit keys.
+type keyedList struct{ keys, items [][]byte }
+
+func (l keyedList) Len() int          { return len(l.keys) }
+func (l keyedList) Key(i int) []byte  { return l.keys[i] }
+func (l keyedList) Item(i int) []byte { return l.items[i] }
+
+func TestRootHash(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 127, 128, 129, 500} {
+		list := make(testList, n)
+		for i := range list {
+			list[i] = []byte(fmt.Sprintf("item-%d", i))
+		}
+		if have, want := RootHash(list), trieRootHash(list); have != want {
+			t.Errorf("%d items: root mismatch: have %x, want %x", n, have, want)
+		}
+	}
+	if have, want := RootHash(nil), trieRootHash(testList{}); have != want {
+		t.Errorf("nil list: root mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that lists which can't be streamed into a stack trie still yield the
+// root of the full trie.
+func TestRootHashFallback(t *testing.T) {
+	tests := []keyedList{
+		{keys: [][]byte{[]byte("a"), []byte("ab")}, items: [][]byte{[]byte("1"), []byte("2")}},
+		{keys: [][]byte{[]byte("b"), []byte("a"), []byte("b")}, items: [][]byte{[]byte("1"), []byte("2"), []byte("3")}},
+		{keys: [][]byte{[]byte("a"), []byte("b")}, items: [][]byte{[]byte("1"), nil}},
+	}
+	for i, list := range tests {
+		if have, want := RootHash(list), trieRootHash(list); have != want {
+			t.Errorf("test %d: root mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package freezer
+//
+// @author: xwc1125
+package freezer
+
+import (
+	"fmt"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+)
+
+// KeyFunc maps an item number of a freezer table to the key the item is stored
+// under in the key-value store before it's migrated into the freezer.
+type KeyFunc func(kind string, number uint64) []byte
+
+// Database is a key-value store combined with a freezer. Recent items live in the
+// key-value store, and are migrated into the append-only freezer once they become
+// old enough, routing every item access to the store currently holding it.
+//
+// Apart from the item based accessors, the Database is a full kvstore.Database
+// serving the key-value store, as well as a kvstore.AncientStore serving the
+// freezer directly.
+type Database struct {
+	kvstore.KeyValueStore
+	*Freezer
+
+	keyFn KeyFunc // Key scheme of the items in the key-value store
+}
+
+// NewDatabase creates a combined database over the given key-value store and
+// freezer. The keyFn defines the keys of the items not yet frozen.
+func NewDatabase(db kvstore.KeyValueStore, freezer *Freezer, keyFn KeyFunc) *Database {
+	return &Database{
+		KeyValueStore: db,
+		Freezer:       freezer,
+		keyFn:         keyFn,
+	}
+}
+
+// HasItem retrieves if an item of the given table is present either in the
+// freezer or in the key-value store.
+func (db *Database) HasItem(kind string, number uint64) (bool, error) {
+	if frozen, err := db.Freezer.HasAncient(kind, number); err != nil || frozen {
+		return frozen, err
+	}
+	return db.KeyValueStore.Has(db.keyFn(kind, number))
+}
+
+// ReadItem retrieves an item of the given table, from the freezer if it was
+// already migrated, or from the key-value store otherwise.
+func (db *Database) ReadItem(kind string, number uint64) ([]byte, error) {
+	if frozen, _ := db.Freezer.HasAncient(kind, number); frozen {
+		return db.Freezer.Ancient(kind, number)
+	}
+	return db.KeyValueStore.Get(db.keyFn(kind, number))
+}
+
+// WriteItem inserts a recent item of the given table into the key-value store.
+// Items already migrated into the freezer are immutable and cannot be written.
+func (db *Database) WriteItem(kind string, number uint64, data []byte) error {
+	if frozen, _ := db.Freezer.Ancients(); number < frozen {
+		return fmt.Errorf("%w: item %d already frozen", errReadOnly, number)
+	}
+	return db.KeyValueStore.Put(db.keyFn(kind, number), data)
+}
+
+// Freeze migrates all the items below the given limit from the key-value store
+// into the freezer. Every table must hold all the items being migrated. The
+// freezer is synced before the migrated items are deleted from the key-value
+// store, so a crash can at worst leave stale duplicates behind, which are never
+// read since the freezer takes precedence.
+func (db *Database) Freeze(limit uint64) error {
+	from, err := db.Freezer.Ancients()
+	if err != nil {
+		return err
+	}
+	if limit <= from {
+		return nil
+	}
+	for number := from; number < limit; number++ {
+		kinds := make(map[string][]byte, len(db.Freezer.tables))
+		for kind := range db.Freezer.tables {
+			data, err := db.KeyValueStore.Get(db.keyFn(kind, number))
+			if err != nil {
+				return fmt.Errorf("failed to retrieve %s item %d: %v", kind, number, err)
+			}
+			kinds[kind] = data
+		}
+		if err := db.Freezer.AppendAncient(number, kinds); err != nil {
+			return err
+		}
+	}
+	if err := db.Freezer.Sync(); err != nil {
+		return err
+	}
+	// Wipe out the migrated items from the key-value store
+	batch := db.KeyValueStore.NewBatch()
+	for number := from; number < limit; number++ {
+		for kind := range db.Freezer.tables {
+			if err := batch.Delete(db.keyFn(kind, number)); err != nil {
+				return err
+			}
+		}
+		if batch.ValueSize() >= kvstore.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return batch.Write()
+}
+
+// Close closes both the freezer and the key-value store.
+func (db *Database) Close() error {
+	var errs []error
+	if err := db.Freezer.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := db.KeyValueStore.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+var (
+	_ kvstore.Database     = (*Database)(nil)
+	_ kvstore.AncientStore = (*Database)(nil)
+)
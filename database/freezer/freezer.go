@@ -0,0 +1,278 @@
+// Package freezer
+//
+// @author: xwc1125
+package freezer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/logger"
+)
+
+var (
+	// errUnknownTable is returned if the user attempts to read from a table that is
+	// not tracked by the freezer.
+	errUnknownTable = errors.New("unknown table")
+
+	// errMissingTable is returned if an append does not carry data for every table
+	// tracked by the freezer.
+	errMissingTable = errors.New("missing table data")
+)
+
+// freezerTableSize defines the maximum size of freezer data files.
+const freezerTableSize = 2 * 1000 * 1000 * 1000
+
+// Freezer is an append-only database to store immutable ordered data into flat
+// files:
+//
+//   - The append-only nature ensures that disk writes are minimized.
+//   - The in-order data ensures that disk reads are always optimized.
+//
+// Every table of the freezer holds exactly one item per item number, so that the
+// tables always stay aligned with each other.
+type Freezer struct {
+	frozen uint64 // Number of items already frozen (atomic)
+	tail   uint64 // Number of the first stored item in the freezer (atomic)
+
+	readonly bool
+	tables   map[string]*table // Data tables for storing everything
+
+	writeLock sync.Mutex // Lock preventing concurrent modifications of the tables
+	closeOnce sync.Once
+	log       logger.Logger // Contextual logger tracking the database path
+}
+
+// New creates a freezer instance for maintaining immutable ordered data according
+// to the given parameters. The tables argument defines the data tables, mapping
+// the table name to whether snappy compression is disabled for it. The namespace
+// is the prefix that the metrics reporting should use for surfacing internal stats.
+func New(datadir string, namespace string, readonly bool, maxTableSize uint32, tables map[string]bool) (*Freezer, error) {
+	if maxTableSize == 0 {
+		maxTableSize = freezerTableSize
+	}
+	freezer := &Freezer{
+		readonly: readonly,
+		tables:   make(map[string]*table),
+		log:      logger.New("freezer"),
+	}
+	// Create the tables
+	for name, disableSnappy := range tables {
+		table, err := newTable(datadir, name, disableSnappy, maxTableSize, readonly)
+		if err != nil {
+			for _, table := range freezer.tables {
+				table.Close()
+			}
+			return nil, err
+		}
+		freezer.tables[name] = table
+	}
+	// Truncate all tables to the common length
+	if err := freezer.repair(); err != nil {
+		for _, table := range freezer.tables {
+			table.Close()
+		}
+		return nil, err
+	}
+	freezer.log.Info("Opened ancient database", "database", datadir, "readonly", readonly, "items", freezer.frozen, "tail", freezer.tail)
+	return freezer, nil
+}
+
+// repair truncates all data tables to the same length, as a crash might have
+// interrupted an append or a truncation half way through the tables.
+func (f *Freezer) repair() error {
+	var (
+		head = uint64(math.MaxUint64)
+		tail = uint64(0)
+	)
+	for _, table := range f.tables {
+		if items := table.Items(); head > items {
+			head = items
+		}
+		if t := table.Tail(); t > tail {
+			tail = t
+		}
+	}
+	if len(f.tables) == 0 {
+		head = 0
+	}
+	for name, table := range f.tables {
+		if table.Items() == head && table.Tail() == tail {
+			continue
+		}
+		if f.readonly {
+			return fmt.Errorf("freezer table %s is not aligned: items %d, tail %d, want items %d, tail %d", name, table.Items(), table.Tail(), head, tail)
+		}
+		if err := table.TruncateHead(head); err != nil {
+			return err
+		}
+		if err := table.TruncateTail(tail); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, head)
+	atomic.StoreUint64(&f.tail, tail)
+	return nil
+}
+
+// Close terminates the chain freezer, closing all the data files.
+func (f *Freezer) Close() error {
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	var errs []error
+	f.closeOnce.Do(func() {
+		for _, table := range f.tables {
+			if err := table.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists
+// in the freezer.
+func (f *Freezer) HasAncient(kind string, number uint64) (bool, error) {
+	if _, ok := f.tables[kind]; !ok {
+		return false, nil
+	}
+	return number >= atomic.LoadUint64(&f.tail) && number < atomic.LoadUint64(&f.frozen), nil
+}
+
+// Ancient retrieves an ancient binary blob from the append-only immutable files.
+func (f *Freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Retrieve(number)
+	}
+	return nil, errUnknownTable
+}
+
+// Ancients returns the length of the frozen items.
+func (f *Freezer) Ancients() (uint64, error) {
+	return atomic.LoadUint64(&f.frozen), nil
+}
+
+// Tail returns the number of first stored item in the freezer.
+func (f *Freezer) Tail() (uint64, error) {
+	return atomic.LoadUint64(&f.tail), nil
+}
+
+// AncientSize returns the ancient size of the specified category.
+func (f *Freezer) AncientSize(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Size()
+	}
+	return 0, errUnknownTable
+}
+
+// AppendAncient injects all binary blobs belonging to the item number at the end
+// of the append-only immutable tables. If any table fails to accept the data,
+// all the tables are rolled back to the previous length.
+func (f *Freezer) AppendAncient(number uint64, kinds map[string][]byte) (err error) {
+	if f.readonly {
+		return errReadOnly
+	}
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	// Ensure the binary blobs we are appending is continuous with freezer.
+	if frozen := atomic.LoadUint64(&f.frozen); frozen != number {
+		return fmt.Errorf("%w: want %d, have %d", errOutOrderInsertion, frozen, number)
+	}
+	if len(kinds) != len(f.tables) {
+		return fmt.Errorf("%w: have %d tables, want %d", errMissingTable, len(kinds), len(f.tables))
+	}
+	for kind := range kinds {
+		if _, ok := f.tables[kind]; !ok {
+			return fmt.Errorf("%w: %s", errUnknownTable, kind)
+		}
+	}
+	// Rollback all inserted data if any insertion below failed to ensure
+	// the tables won't out of sync.
+	defer func() {
+		if err != nil {
+			for _, table := range f.tables {
+				if rerr := table.TruncateHead(number); rerr != nil {
+					f.log.Error("Failed to rollback freezer table", "err", rerr)
+				}
+			}
+		}
+	}()
+	for kind, blob := range kinds {
+		if err := f.tables[kind].Append(number, blob); err != nil {
+			return err
+		}
+	}
+	atomic.AddUint64(&f.frozen, 1)
+	return nil
+}
+
+// TruncateHead discards any recent data above the provided threshold number.
+func (f *Freezer) TruncateHead(items uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	if atomic.LoadUint64(&f.frozen) <= items {
+		return nil
+	}
+	for _, table := range f.tables {
+		if err := table.TruncateHead(items); err != nil {
+			return err
+		}
+	}
+	if tail := atomic.LoadUint64(&f.tail); items < tail {
+		items = tail
+	}
+	atomic.StoreUint64(&f.frozen, items)
+	return nil
+}
+
+// TruncateTail discards any data below the provided threshold number.
+func (f *Freezer) TruncateTail(tail uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	if atomic.LoadUint64(&f.tail) >= tail {
+		return nil
+	}
+	if frozen := atomic.LoadUint64(&f.frozen); tail > frozen {
+		tail = frozen
+	}
+	for _, table := range f.tables {
+		if err := table.TruncateTail(tail); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.tail, tail)
+	return nil
+}
+
+// Sync flushes all data tables to disk.
+func (f *Freezer) Sync() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+var _ kvstore.AncientStore = (*Freezer)(nil)
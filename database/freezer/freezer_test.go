@@ -0,0 +1,187 @@
+package freezer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/dbtest"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+)
+
+var freezerTestTables = map[string]bool{"a": true, "b": false}
+
+// Tests that appends are aligned over all tables, and that a failing append is
+// rolled back from every table.
+func TestFreezerAppend(t *testing.T) {
+	f, err := New(t.TempDir(), "", false, 50, freezerTestTables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for i := uint64(0); i < 10; i++ {
+		if err := f.AppendAncient(i, map[string][]byte{"a": getChunk(10, int(i)), "b": getChunk(20, int(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.AppendAncient(11, map[string][]byte{"a": nil, "b": nil}); !errors.Is(err, errOutOrderInsertion) {
+		t.Fatalf("out of order append: have %v, want %v", err, errOutOrderInsertion)
+	}
+	if err := f.AppendAncient(10, map[string][]byte{"a": nil}); !errors.Is(err, errMissingTable) {
+		t.Fatalf("partial append: have %v, want %v", err, errMissingTable)
+	}
+	if err := f.AppendAncient(10, map[string][]byte{"a": nil, "c": nil}); !errors.Is(err, errUnknownTable) {
+		t.Fatalf("unknown table append: have %v, want %v", err, errUnknownTable)
+	}
+	// Break one table behind the freezer's back and ensure the append rolls back
+	f.tables["b"].Append(10, nil)
+	if err := f.AppendAncient(10, map[string][]byte{"a": nil, "b": nil}); err == nil {
+		t.Fatalf("append over misaligned table succeeded")
+	}
+	for name, table := range f.tables {
+		if items := table.Items(); items != 10 {
+			t.Fatalf("table %s not rolled back: have %d items, want 10", name, items)
+		}
+	}
+	if frozen, _ := f.Ancients(); frozen != 10 {
+		t.Fatalf("frozen count mismatch: have %d, want 10", frozen)
+	}
+	for i := uint64(0); i < 10; i++ {
+		if blob, err := f.Ancient("b", i); err != nil || !bytes.Equal(blob, getChunk(20, int(i))) {
+			t.Fatalf("item %d mismatch: %x, %v", i, blob, err)
+		}
+	}
+	if has, _ := f.HasAncient("a", 10); has {
+		t.Fatalf("item beyond head reported present")
+	}
+	if _, err := f.Ancient("c", 0); err != errUnknownTable {
+		t.Fatalf("unknown table read: have %v, want %v", err, errUnknownTable)
+	}
+}
+
+// Tests that tables left misaligned by a crash are repaired on open.
+func TestFreezerRepair(t *testing.T) {
+	dir := t.TempDir()
+	f, err := New(dir, "", false, 50, freezerTestTables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		f.AppendAncient(i, map[string][]byte{"a": getChunk(10, int(i)), "b": getChunk(10, int(i))})
+	}
+	// Simulate an interrupted append and an interrupted tail truncation
+	f.tables["a"].Append(10, nil)
+	f.tables["b"].TruncateTail(3)
+	f.Close()
+
+	// A readonly freezer must refuse to open the misaligned tables
+	if _, err := New(dir, "", true, 50, freezerTestTables); err == nil {
+		t.Fatalf("readonly freezer opened misaligned tables")
+	}
+	f, err = New(dir, "", false, 50, freezerTestTables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if frozen, _ := f.Ancients(); frozen != 10 {
+		t.Fatalf("frozen count mismatch: have %d, want 10", frozen)
+	}
+	if tail, _ := f.Tail(); tail != 3 {
+		t.Fatalf("tail mismatch: have %d, want 3", tail)
+	}
+	for name, table := range f.tables {
+		if table.Items() != 10 || table.Tail() != 3 {
+			t.Fatalf("table %s misaligned: items %d, tail %d", name, table.Items(), table.Tail())
+		}
+	}
+	if _, err := f.Ancient("a", 2); err != errOutOfBounds {
+		t.Fatalf("deleted item read: have %v, want %v", err, errOutOfBounds)
+	}
+	// Truncating the head and tail must keep the tables aligned
+	if err := f.TruncateHead(8); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.TruncateTail(5); err != nil {
+		t.Fatal(err)
+	}
+	if frozen, _ := f.Ancients(); frozen != 8 {
+		t.Fatalf("frozen count mismatch: have %d, want 8", frozen)
+	}
+	for i := uint64(5); i < 8; i++ {
+		if has, _ := f.HasAncient("a", i); !has {
+			t.Fatalf("item %d missing", i)
+		}
+	}
+	if has, _ := f.HasAncient("a", 4); has {
+		t.Fatalf("deleted item %d present", 4)
+	}
+}
+
+// testKey is the key scheme of the items in the combined database tests.
+func testKey(kind string, number uint64) []byte {
+	return []byte(fmt.Sprintf("item-%s-%d", kind, number))
+}
+
+// Tests that the combined database routes the items to the store holding them,
+// and migrates items into the freezer.
+func TestDatabaseFreeze(t *testing.T) {
+	f, err := New(t.TempDir(), "", false, 50, freezerTestTables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewDatabase(memorydb.New(), f, testKey)
+	defer db.Close()
+
+	for i := uint64(0); i < 10; i++ {
+		for kind := range freezerTestTables {
+			if err := db.WriteItem(kind, i, getChunk(10, int(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Freeze(6); err != nil {
+		t.Fatal(err)
+	}
+	if frozen, _ := db.Ancients(); frozen != 6 {
+		t.Fatalf("frozen count mismatch: have %d, want 6", frozen)
+	}
+	// Frozen items must be gone from the key-value store, but readable
+	for i := uint64(0); i < 10; i++ {
+		for kind := range freezerTestTables {
+			has, _ := db.Has(testKey(kind, i))
+			if want := i >= 6; has != want {
+				t.Errorf("%s item %d key-value presence mismatch: have %t, want %t", kind, i, has, want)
+			}
+			if has, err := db.HasItem(kind, i); err != nil || !has {
+				t.Errorf("%s item %d missing: %v", kind, i, err)
+			}
+			if blob, err := db.ReadItem(kind, i); err != nil || !bytes.Equal(blob, getChunk(10, int(i))) {
+				t.Errorf("%s item %d mismatch: %x, %v", kind, i, blob, err)
+			}
+		}
+	}
+	// Frozen items are immutable, and items must be complete to be frozen
+	if err := db.WriteItem("a", 3, nil); err == nil {
+		t.Errorf("overwriting frozen item succeeded")
+	}
+	db.Delete(testKey("b", 8))
+	if err := db.Freeze(10); err == nil {
+		t.Errorf("freezing incomplete item succeeded")
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() kvstore.KeyValueStore {
+			f, err := New(t.TempDir(), "", false, 0, freezerTestTables)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return NewDatabase(memorydb.New(), f, testKey)
+		})
+	})
+}
@@ -0,0 +1,743 @@
+// Package freezer implements an append-only store of immutable, sequentially
+// numbered items, backed by flat files.
+//
+// @author: xwc1125
+package freezer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/chain5j/logger"
+	"github.com/golang/snappy"
+)
+
+var (
+	// errClosed is returned if an operation attempts to read from or write to the
+	// freezer table after it has already been closed.
+	errClosed = errors.New("closed")
+
+	// errOutOfBounds is returned if the item requested is not contained within the
+	// freezer table.
+	errOutOfBounds = errors.New("out of bounds")
+
+	// errOutOrderInsertion is returned if the user attempts to inject out-of-order
+	// binary blobs into the freezer.
+	errOutOrderInsertion = errors.New("the append operation is out-order")
+
+	// errReadOnly is returned if the freezer is opened in read only mode. All the
+	// mutations are disallowed.
+	errReadOnly = errors.New("read only")
+
+	// errCorruptIndex is returned if the index file is damaged beyond repair.
+	errCorruptIndex = errors.New("corrupted index file")
+)
+
+const (
+	// indexHeaderSize is the size of the index file header, holding the number of
+	// the first retained item and the position it starts at.
+	indexHeaderSize = 16
+
+	// indexEntrySize is the size of a single index entry, holding the position
+	// the item ends at.
+	indexEntrySize = 8
+)
+
+// indexEntry contains the number/id of the file that the data resides in, as well
+// as the offset within the file to the end of the data.
+type indexEntry struct {
+	filenum uint32 // stored as uint32 ( 4 bytes )
+	offset  uint32 // stored as uint32 ( 4 bytes )
+}
+
+// unmarshalBinary deserializes binary b into the rawIndex entry.
+func (i *indexEntry) unmarshalBinary(b []byte) {
+	i.filenum = binary.BigEndian.Uint32(b[:4])
+	i.offset = binary.BigEndian.Uint32(b[4:8])
+}
+
+// append adds the encoded entry to the end of b.
+func (i *indexEntry) append(b []byte) []byte {
+	var enc [indexEntrySize]byte
+	binary.BigEndian.PutUint32(enc[:4], i.filenum)
+	binary.BigEndian.PutUint32(enc[4:], i.offset)
+	return append(b, enc[:]...)
+}
+
+// indexHeader is the leading record of the index file. Items below tail have
+// been deleted, the item at tail starts at the position of the first entry.
+type indexHeader struct {
+	tail  uint64
+	first indexEntry
+}
+
+// unmarshalBinary deserializes binary b into the index header.
+func (h *indexHeader) unmarshalBinary(b []byte) {
+	h.tail = binary.BigEndian.Uint64(b[:8])
+	h.first.unmarshalBinary(b[8:indexHeaderSize])
+}
+
+// marshalBinary serializes the index header into binary.
+func (h *indexHeader) marshalBinary() []byte {
+	b := make([]byte, 8, indexHeaderSize)
+	binary.BigEndian.PutUint64(b, h.tail)
+	return h.first.append(b)
+}
+
+// table represents a single chained data table within the freezer (e.g. blocks).
+// It consists of a data file (snappy encoded arbitrary data blobs) and an index
+// file (uncompressed 8 byte positions into the data file).
+//
+// The index file starts with a header containing the number of the first item
+// still present in the table and the position the data of this item starts at.
+// Every following entry contains the file number and the end offset of an item,
+// the start of an item being the end of the previous one (or the beginning of
+// the file, if the previous item resides in another file).
+type table struct {
+	items uint64 // Number of items stored in the table (including items removed from tail)
+
+	noCompression bool   // if true, disables snappy compression. Note: does not work retroactively
+	readonly      bool   // if true, all mutations are disallowed
+	maxFileSize   uint32 // Max file size for data-files
+	name          string // Name of the table, used to name the files
+	path          string // Folder containing the files
+
+	header    indexHeader         // Cached index header, the position of the tail item
+	index     *os.File            // File descriptor for the indexEntry file of the table
+	head      *os.File            // File descriptor for the data head of the table
+	headId    uint32              // Number of the currently active head file
+	headBytes int64               // Number of bytes written to the head file
+	files     map[uint32]*os.File // open files
+
+	log  logger.Logger // Logger with database path and table name embedded
+	lock sync.RWMutex  // Mutex protecting the data file descriptors
+}
+
+// newTable opens a freezer table, creating the data and index files if they are
+// non-existent. Both files are truncated to the shortest common length to ensure
+// they don't go out of sync.
+func newTable(path string, name string, noCompression bool, maxFileSize uint32, readonly bool) (*table, error) {
+	// Ensure the containing directory exists and open the indexEntry file
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	idxName := fmt.Sprintf("%s.ridx", name)
+	if !noCompression {
+		idxName = fmt.Sprintf("%s.cidx", name)
+	}
+	var (
+		index *os.File
+		err   error
+	)
+	if readonly {
+		index, err = os.OpenFile(filepath.Join(path, idxName), os.O_RDONLY, 0644)
+	} else {
+		index, err = os.OpenFile(filepath.Join(path, idxName), os.O_RDWR|os.O_CREATE, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Create the table and repair any past inconsistency
+	tab := &table{
+		noCompression: noCompression,
+		readonly:      readonly,
+		maxFileSize:   maxFileSize,
+		name:          name,
+		path:          path,
+		index:         index,
+		files:         make(map[uint32]*os.File),
+		log:           logger.New("freezer").New("table", name),
+	}
+	if err := tab.repair(); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	return tab, nil
+}
+
+// repair cross-checks the head and the index file and truncates them to be in
+// sync with each other after a potential crash / data loss.
+func (t *table) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	// Initialize a fresh index with an empty header, and reject a damaged one
+	offsetsSize := stat.Size()
+	if offsetsSize == 0 {
+		if t.readonly {
+			return errCorruptIndex
+		}
+		if _, err := t.index.WriteAt(new(indexHeader).marshalBinary(), 0); err != nil {
+			return err
+		}
+		offsetsSize = indexHeaderSize
+	}
+	if offsetsSize < indexHeaderSize {
+		return errCorruptIndex
+	}
+	buf := make([]byte, indexHeaderSize)
+	if _, err := t.index.ReadAt(buf, 0); err != nil {
+		return err
+	}
+	t.header.unmarshalBinary(buf)
+
+	// Ensure the index is a multiple of indexEntrySize bytes, a partially written
+	// entry is the leftover of an interrupted append
+	if overflow := (offsetsSize - indexHeaderSize) % indexEntrySize; overflow != 0 {
+		offsetsSize -= overflow
+		if !t.readonly {
+			if err := t.truncateIndex(offsetsSize); err != nil {
+				return err
+			}
+		}
+	}
+	// Retrieve the last index entry and open the head file it points to
+	count := uint64(offsetsSize-indexHeaderSize) / indexEntrySize
+	lastIndex, err := t.lastEntry(count)
+	if err != nil {
+		return err
+	}
+	if err := t.openHead(lastIndex.filenum); err != nil {
+		return err
+	}
+	stat, err = t.head.Stat()
+	if err != nil {
+		return err
+	}
+	contentSize := stat.Size()
+
+	// Keep truncating both files until they come in sync
+	contentExp := int64(lastIndex.offset)
+	for contentExp != contentSize {
+		if t.readonly {
+			return fmt.Errorf("freezer table %s is inconsistent: data %d, index %d", t.name, contentSize, contentExp)
+		}
+		// Truncate the head file to the last offset pointer
+		if contentExp < contentSize {
+			t.log.Warn("Truncating dangling head", "indexed", contentExp, "stored", contentSize)
+			if err := t.head.Truncate(contentExp); err != nil {
+				return err
+			}
+			contentSize = contentExp
+		}
+		// Truncate the index to point within the head file
+		if contentExp > contentSize {
+			if count == 0 {
+				return errCorruptIndex
+			}
+			t.log.Warn("Truncating dangling indexes", "indexed", contentExp, "stored", contentSize)
+			count--
+			if err := t.truncateIndex(indexHeaderSize + int64(count)*indexEntrySize); err != nil {
+				return err
+			}
+			// We might have slipped back into an earlier head-file here
+			newLastIndex, err := t.lastEntry(count)
+			if err != nil {
+				return err
+			}
+			if newLastIndex.filenum != lastIndex.filenum {
+				t.releaseFile(t.headId)
+				if err := t.openHead(newLastIndex.filenum); err != nil {
+					return err
+				}
+				if stat, err = t.head.Stat(); err != nil {
+					return err
+				}
+				contentSize = stat.Size()
+			}
+			lastIndex = newLastIndex
+			contentExp = int64(lastIndex.offset)
+		}
+	}
+	// Ensure all reparation changes have been written to disk
+	if !t.readonly {
+		if err := t.index.Sync(); err != nil {
+			return err
+		}
+		if err := t.head.Sync(); err != nil {
+			return err
+		}
+		// Delete the leftovers of interrupted truncations on both ends
+		if err := t.removeStaleFiles(t.header.first.filenum, lastIndex.filenum); err != nil {
+			return err
+		}
+	}
+	t.items = t.header.tail + count
+	t.headBytes = contentSize
+
+	// Open all the data files holding retained items
+	for i := t.header.first.filenum; i < t.headId; i++ {
+		if _, err := t.openFile(i, os.O_RDONLY); err != nil {
+			return err
+		}
+	}
+	t.log.Debug("Chain freezer table opened", "items", t.items, "tail", t.header.tail, "size", t.headBytes)
+	return nil
+}
+
+// lastEntry returns the index entry of the last item, given the number of the
+// entries in the index file. With no entries, the header position is returned.
+func (t *table) lastEntry(count uint64) (indexEntry, error) {
+	if count == 0 {
+		return t.header.first, nil
+	}
+	var (
+		entry indexEntry
+		buf   = make([]byte, indexEntrySize)
+	)
+	if _, err := t.index.ReadAt(buf, indexHeaderSize+int64(count-1)*indexEntrySize); err != nil {
+		return entry, err
+	}
+	entry.unmarshalBinary(buf)
+	return entry, nil
+}
+
+// truncateIndex truncates the index file to the given size and moves the write
+// position to its end.
+func (t *table) truncateIndex(size int64) error {
+	if err := t.index.Truncate(size); err != nil {
+		return err
+	}
+	_, err := t.index.Seek(size, io.SeekStart)
+	return err
+}
+
+// removeStaleFiles deletes all the data files of the table outside of the given
+// [first, last] file number range.
+func (t *table) removeStaleFiles(first, last uint32) error {
+	matches, err := filepath.Glob(filepath.Join(t.path, fmt.Sprintf("%s.*.%s", t.name, t.dataExt())))
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		var num uint32
+		if _, err := fmt.Sscanf(filepath.Base(match), t.name+".%04d."+t.dataExt(), &num); err != nil {
+			continue
+		}
+		if num < first || num > last {
+			t.log.Warn("Removing stale data file", "file", match)
+			if err := os.Remove(match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dataExt returns the extension of the data files, depending on compression.
+func (t *table) dataExt() string {
+	if t.noCompression {
+		return "rdat"
+	}
+	return "cdat"
+}
+
+// openHead opens the given data file as the head for appending.
+func (t *table) openHead(num uint32) error {
+	flag := os.O_RDWR | os.O_CREATE
+	if t.readonly {
+		flag = os.O_RDONLY
+	}
+	head, err := t.openFile(num, flag)
+	if err != nil {
+		return err
+	}
+	t.head, t.headId = head, num
+	return nil
+}
+
+// openFile assumes that the write-lock is held by the caller.
+func (t *table) openFile(num uint32, flag int) (f *os.File, err error) {
+	var exist bool
+	if f, exist = t.files[num]; !exist {
+		name := filepath.Join(t.path, fmt.Sprintf("%s.%04d.%s", t.name, num, t.dataExt()))
+		f, err = os.OpenFile(name, flag, 0644)
+		if err != nil {
+			return nil, err
+		}
+		t.files[num] = f
+	}
+	return f, err
+}
+
+// releaseFile closes a file, and removes it from the open file cache. Assumes
+// that the caller holds the write lock.
+func (t *table) releaseFile(num uint32) {
+	if f, exist := t.files[num]; exist {
+		delete(t.files, num)
+		f.Close()
+	}
+}
+
+// releaseFilesBefore closes and deletes all data files with a number smaller
+// than the given one. Assumes that the caller holds the write lock.
+func (t *table) releaseFilesBefore(num uint32) error {
+	for fnum, f := range t.files {
+		if fnum < num {
+			delete(t.files, fnum)
+			f.Close()
+			if err := os.Remove(f.Name()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseFilesAfter closes and deletes all data files with a number larger than
+// the given one. Assumes that the caller holds the write lock.
+func (t *table) releaseFilesAfter(num uint32) error {
+	for fnum, f := range t.files {
+		if fnum > num {
+			delete(t.files, fnum)
+			f.Close()
+			if err := os.Remove(f.Name()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Items returns the number of items stored in the table, including the ones
+// already deleted from the tail.
+func (t *table) Items() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.items
+}
+
+// Tail returns the number of the first item retained in the table.
+func (t *table) Tail() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.header.tail
+}
+
+// Append injects a binary blob at the end of the freezer table. The item number
+// is a precautionary parameter to ensure data correctness, but the table will
+// reject already existing data.
+func (t *table) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Ensure the table is still accessible
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if t.readonly {
+		return errReadOnly
+	}
+	// Ensure only the next item can be written, nothing else
+	if t.items != item {
+		return fmt.Errorf("%w: appending unexpected item: want %d, have %d", errOutOrderInsertion, t.items, item)
+	}
+	// Encode the blob and write it into the data file
+	if !t.noCompression {
+		blob = snappy.Encode(nil, blob)
+	}
+	bLen := int64(len(blob))
+	if t.headBytes+bLen > int64(t.maxFileSize) && t.headBytes > 0 {
+		// Writing would overflow, so we need to open a new data file. If the
+		// current head holds no data, the item is kept there regardless.
+		if err := t.head.Sync(); err != nil {
+			return err
+		}
+		// Reopen the old head as readonly, it is never written again
+		t.releaseFile(t.headId)
+		if _, err := t.openFile(t.headId, os.O_RDONLY); err != nil {
+			return err
+		}
+		if err := t.openHead(t.headId + 1); err != nil {
+			return err
+		}
+		t.headBytes = 0
+	}
+	if bLen > 0 && t.headBytes+bLen > 1<<32-1 {
+		return fmt.Errorf("freezer item %d too large: %d bytes", item, bLen)
+	}
+	if _, err := t.head.WriteAt(blob, t.headBytes); err != nil {
+		return err
+	}
+	t.headBytes += bLen
+
+	// Write the index entry only after the data, so a crash can be repaired by
+	// discarding the dangling data
+	entry := indexEntry{filenum: t.headId, offset: uint32(t.headBytes)}
+	pos := indexHeaderSize + int64(t.items-t.header.tail)*indexEntrySize
+	if _, err := t.index.WriteAt(entry.append(nil), pos); err != nil {
+		return err
+	}
+	t.items++
+	return nil
+}
+
+// Retrieve looks up the data offset of an item with the given number and retrieves
+// the raw binary blob from the data file.
+func (t *table) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	// Ensure the table and the item is accessible
+	if t.index == nil || t.head == nil {
+		return nil, errClosed
+	}
+	if item < t.header.tail || item >= t.items {
+		return nil, errOutOfBounds
+	}
+	// Retrieve the positions of the item within the data files
+	start, end, err := t.bounds(item)
+	if err != nil {
+		return nil, err
+	}
+	dataFile, exist := t.files[end.filenum]
+	if !exist {
+		return nil, fmt.Errorf("missing data file %d", end.filenum)
+	}
+	blob := make([]byte, end.offset-start.offset)
+	if _, err := dataFile.ReadAt(blob, int64(start.offset)); err != nil {
+		return nil, err
+	}
+	if t.noCompression {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// bounds returns the start and end positions of the given item. If the item is
+// the first one of a data file, the start is moved to the beginning of the file.
+func (t *table) bounds(item uint64) (indexEntry, indexEntry, error) {
+	var (
+		start, end indexEntry
+		rel        = item - t.header.tail
+	)
+	if rel == 0 {
+		start = t.header.first
+		buf := make([]byte, indexEntrySize)
+		if _, err := t.index.ReadAt(buf, indexHeaderSize); err != nil {
+			return start, end, err
+		}
+		end.unmarshalBinary(buf)
+	} else {
+		buf := make([]byte, 2*indexEntrySize)
+		if _, err := t.index.ReadAt(buf, indexHeaderSize+int64(rel-1)*indexEntrySize); err != nil {
+			return start, end, err
+		}
+		start.unmarshalBinary(buf[:indexEntrySize])
+		end.unmarshalBinary(buf[indexEntrySize:])
+	}
+	if start.filenum != end.filenum {
+		// The item is the first one of a new data file
+		start = indexEntry{filenum: end.filenum}
+	}
+	return start, end, nil
+}
+
+// TruncateHead discards any recent data above the provided threshold number.
+// Truncating below the tail removes all the retained items.
+func (t *table) TruncateHead(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if t.readonly {
+		return errReadOnly
+	}
+	// If our item count is correct, don't do anything
+	if t.items <= items {
+		return nil
+	}
+	if items < t.header.tail {
+		items = t.header.tail
+	}
+	t.log.Warn("Truncating freezer table", "items", t.items, "limit", items)
+
+	// Truncate the index file first, the dangling data is repaired on crash
+	count := items - t.header.tail
+	if err := t.truncateIndex(indexHeaderSize + int64(count)*indexEntrySize); err != nil {
+		return err
+	}
+	// Calculate the new expected size of the data file and truncate it
+	expected, err := t.lastEntry(count)
+	if err != nil {
+		return err
+	}
+	// We might need to truncate back to older files
+	if expected.filenum != t.headId {
+		if err := t.releaseFilesAfter(expected.filenum); err != nil {
+			return err
+		}
+		t.releaseFile(expected.filenum)
+		if err := t.openHead(expected.filenum); err != nil {
+			return err
+		}
+	}
+	if err := t.head.Truncate(int64(expected.offset)); err != nil {
+		return err
+	}
+	t.headBytes = int64(expected.offset)
+	t.items = items
+	return nil
+}
+
+// TruncateTail discards any data below the provided threshold number. The index
+// file is rewritten atomically, data files fully below the new tail are deleted.
+func (t *table) TruncateTail(tail uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if t.readonly {
+		return errReadOnly
+	}
+	// If our tail is already beyond the threshold, don't do anything
+	if t.header.tail >= tail {
+		return nil
+	}
+	if tail > t.items {
+		tail = t.items
+	}
+	// Resolve the position of the new tail item: the end of its predecessor
+	rel := tail - t.header.tail
+	first, err := t.lastEntry(rel)
+	if err != nil {
+		return err
+	}
+	// Assemble the new index file: header and the entries of the retained items
+	count := t.items - tail
+	entries := make([]byte, count*indexEntrySize)
+	if count > 0 {
+		if _, err := t.index.ReadAt(entries, indexHeaderSize+int64(rel)*indexEntrySize); err != nil {
+			return err
+		}
+	}
+	// If the new tail item starts a new data file, point the header to the start
+	// of that file, so the file of its predecessor can be removed as well.
+	if count > 0 {
+		var next indexEntry
+		next.unmarshalBinary(entries[:indexEntrySize])
+		if next.filenum != first.filenum {
+			first = indexEntry{filenum: next.filenum}
+		}
+	}
+	header := indexHeader{tail: tail, first: first}
+	if err := t.replaceIndex(append(header.marshalBinary(), entries...)); err != nil {
+		return err
+	}
+	t.header = header
+
+	// Delete the data files not referenced anymore
+	return t.releaseFilesBefore(first.filenum)
+}
+
+// replaceIndex atomically replaces the content of the index file with the given
+// data, by writing it into a temporary file and moving it into place.
+func (t *table) replaceIndex(data []byte) error {
+	name := t.index.Name()
+	tmp, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := t.index.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	index, err := os.OpenFile(name, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	t.index = index
+	return nil
+}
+
+// Size returns the total data size in the freezer table.
+func (t *table) Size() (uint64, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil || t.head == nil {
+		return 0, errClosed
+	}
+	stat, err := t.index.Stat()
+	if err != nil {
+		return 0, err
+	}
+	total := uint64(stat.Size())
+	for _, f := range t.files {
+		stat, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		total += uint64(stat.Size())
+	}
+	return total, nil
+}
+
+// Sync pushes any pending data from memory out to disk. This is an expensive
+// operation, so use it with care.
+func (t *table) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if t.readonly {
+		return nil
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	return t.head.Sync()
+}
+
+// Close closes all opened files.
+func (t *table) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	if t.index != nil {
+		if err := t.index.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.index = nil
+	}
+	for _, f := range t.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t.files = make(map[uint32]*os.File)
+	t.head = nil
+
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package freezer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// getChunk returns a chunk of data of the given size, filled with the given byte.
+func getChunk(size int, b int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(b)
+	}
+	return data
+}
+
+// checkRetrieve verifies that the table holds exactly the given items.
+func checkRetrieve(t *testing.T, f *table, tail, items uint64) {
+	t.Helper()
+	if have := f.Items(); have != items {
+		t.Fatalf("item count mismatch: have %d, want %d", have, items)
+	}
+	if have := f.Tail(); have != tail {
+		t.Fatalf("tail mismatch: have %d, want %d", have, tail)
+	}
+	for y := uint64(0); y < items; y++ {
+		blob, err := f.Retrieve(y)
+		if y < tail {
+			if err != errOutOfBounds {
+				t.Fatalf("deleted item %d: have %v, want %v", y, err, errOutOfBounds)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", y, err)
+		}
+		if want := getChunk(15, int(y)); !bytes.Equal(blob, want) {
+			t.Fatalf("item %d mismatch: have %x, want %x", y, blob, want)
+		}
+	}
+	if _, err := f.Retrieve(items); err != errOutOfBounds {
+		t.Fatalf("item %d beyond head: have %v, want %v", items, err, errOutOfBounds)
+	}
+}
+
+// Tests that appending and retrieving data works across data file boundaries,
+// both with and without compression, and survives a reopen.
+func TestTableAppendRetrieve(t *testing.T) {
+	for _, noCompression := range []bool{true, false} {
+		t.Run(fmt.Sprintf("noCompression=%t", noCompression), func(t *testing.T) {
+			dir := t.TempDir()
+			f, err := newTable(dir, "test", noCompression, 50, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for x := 0; x < 255; x++ {
+				if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Append(100, getChunk(15, 100)); err == nil {
+				t.Fatalf("out of order append succeeded")
+			}
+			checkRetrieve(t, f, 0, 255)
+			f.Close()
+
+			// Reopen the table and check the content again
+			f, err = newTable(dir, "test", noCompression, 50, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			checkRetrieve(t, f, 0, 255)
+		})
+	}
+}
+
+// Tests that a table whose index file lost its last entries (e.g. crash between
+// data and index writes) is repaired by discarding the dangling data.
+func TestTableRepairDanglingData(t *testing.T) {
+	dir := t.TempDir()
+	f, err := newTable(dir, "test", true, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 10; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	f.Close()
+
+	// Chop off the last index entry and half of the one before it
+	idx := filepath.Join(dir, "test.ridx")
+	stat, _ := os.Stat(idx)
+	if err := os.Truncate(idx, stat.Size()-indexEntrySize-indexEntrySize/2); err != nil {
+		t.Fatal(err)
+	}
+	f, err = newTable(dir, "test", true, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, 0, 8)
+
+	// Appending must continue seamlessly after the repair
+	for x := 8; x < 12; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRetrieve(t, f, 0, 12)
+	f.Close()
+}
+
+// Tests that a table whose data file lost content (e.g. the index was flushed
+// but the data not) is repaired by discarding the dangling index entries, even
+// if that means moving back to an earlier data file.
+func TestTableRepairDanglingIndex(t *testing.T) {
+	dir := t.TempDir()
+	f, err := newTable(dir, "test", true, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 items per data file, 10 items in 4 files
+	for x := 0; x < 10; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	f.Close()
+
+	// Delete the last data file and cut the one before it
+	os.Remove(filepath.Join(dir, "test.0003.rdat"))
+	if err := os.Truncate(filepath.Join(dir, "test.0002.rdat"), 20); err != nil {
+		t.Fatal(err)
+	}
+	f, err = newTable(dir, "test", true, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checkRetrieve(t, f, 0, 7)
+}
+
+// Tests that truncating the head of the table removes the items and data files,
+// and appending continues afterwards.
+func TestTableTruncateHead(t *testing.T) {
+	dir := t.TempDir()
+	f, err := newTable(dir, "test", false, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 30; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	if err := f.TruncateHead(10); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, 0, 10)
+
+	for x := 10; x < 20; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRetrieve(t, f, 0, 20)
+	f.Close()
+
+	f, err = newTable(dir, "test", false, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checkRetrieve(t, f, 0, 20)
+}
+
+// Tests that truncating the tail of the table hides the deleted items, removes
+// the data files no longer needed and persists across reopens.
+func TestTableTruncateTail(t *testing.T) {
+	dir := t.TempDir()
+	f, err := newTable(dir, "test", true, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 10; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	// Truncate within the first data file, nothing to delete yet
+	if err := f.TruncateTail(1); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, 1, 10)
+
+	// Truncate to the first item of the third data file
+	if err := f.TruncateTail(6); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, 6, 10)
+	for _, num := range []int{0, 1} {
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("test.%04d.rdat", num))); !os.IsNotExist(err) {
+			t.Errorf("data file %d not deleted: %v", num, err)
+		}
+	}
+	// Truncating backwards is a noop
+	if err := f.TruncateTail(2); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, 6, 10)
+	f.Close()
+
+	f, err = newTable(dir, "test", true, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, 6, 10)
+
+	// Wipe everything, then append and truncate the head below the tail
+	if err := f.TruncateTail(10); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, 10, 10)
+	for x := 10; x < 15; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRetrieve(t, f, 10, 15)
+	if err := f.TruncateHead(5); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, 10, 10)
+	f.Close()
+
+	f, err = newTable(dir, "test", true, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checkRetrieve(t, f, 10, 10)
+}
+
+// Tests that a readonly table serves data but rejects any mutation.
+func TestTableReadonly(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newTable(dir, "test", true, 50, true); err == nil {
+		t.Fatalf("readonly open of missing table succeeded")
+	}
+	f, err := newTable(dir, "test", true, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 5; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	f.Close()
+
+	f, err = newTable(dir, "test", true, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checkRetrieve(t, f, 0, 5)
+	if err := f.Append(5, getChunk(15, 5)); err != errReadOnly {
+		t.Fatalf("append error mismatch: have %v, want %v", err, errReadOnly)
+	}
+}
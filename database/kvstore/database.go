@@ -76,3 +76,49 @@ type Database interface {
 	Compacter
 	io.Closer
 }
+
+// AncientReader contains the methods required to read from immutable ancient
+// data, i.e. the items migrated into the chain freezer.
+type AncientReader interface {
+	// HasAncient returns an indicator whether the specified data exists in the
+	// ancient store.
+	HasAncient(kind string, number uint64) (bool, error)
+
+	// Ancient retrieves an ancient binary blob from the append-only immutable files.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the ancient item numbers in the ancient store, i.e. the
+	// number of the next item to be appended.
+	Ancients() (uint64, error)
+
+	// Tail returns the number of first stored item in the freezer. Items below
+	// the tail were deleted and are not accessible anymore.
+	Tail() (uint64, error)
+
+	// AncientSize returns the ancient size of the specified category.
+	AncientSize(kind string) (uint64, error)
+}
+
+// AncientWriter contains the methods required to write to immutable ancient data.
+type AncientWriter interface {
+	// AppendAncient injects all binary blobs belonging to the item number at the
+	// end of the append-only immutable tables. Every category must be present.
+	AppendAncient(number uint64, kinds map[string][]byte) error
+
+	// TruncateHead discards all but the first n ancient data from the ancient store.
+	TruncateHead(n uint64) error
+
+	// TruncateTail discards the first n ancient data from the ancient store.
+	TruncateTail(n uint64) error
+
+	// Sync flushes all in-memory ancient store data to disk.
+	Sync() error
+}
+
+// AncientStore contains all the methods required to allow handling different
+// ancient data stores backing immutable chain data store.
+type AncientStore interface {
+	AncientReader
+	AncientWriter
+	io.Closer
+}
@@ -0,0 +1,708 @@
+// Package dbtest contains the shared conformance tests that every key-value
+// store backend is expected to pass.
+//
+// @author: xwc1125
+package dbtest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+)
+
+// TestDatabaseSuite runs a suite of tests against a KeyValueStore database
+// implementation. The New function is invoked once per test case and must
+// return a fresh, empty database.
+func TestDatabaseSuite(t *testing.T, New func() kvstore.KeyValueStore) {
+	t.Run("Iterator", func(t *testing.T) {
+		tests := []struct {
+			content map[string]string
+			prefix  string
+			start   string
+			order   []string
+		}{
+			// Empty databases should be iterable
+			{map[string]string{}, "", "", nil},
+			{map[string]string{}, "non-existent-prefix", "", nil},
+			{map[string]string{}, "", "non-existent-start", nil},
+
+			// Single-item databases should be iterable
+			{map[string]string{"key": "val"}, "", "", []string{"key"}},
+			{map[string]string{"key": "val"}, "k", "", []string{"key"}},
+			{map[string]string{"key": "val"}, "l", "", nil},
+			{map[string]string{"key": "val"}, "", "k", []string{"key"}},
+			{map[string]string{"key": "val"}, "", "key", []string{"key"}},
+			{map[string]string{"key": "val"}, "", "kez", nil},
+
+			// Multi-item databases should be fully iterable
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"k", "",
+				[]string{"k1", "k2", "k3", "k4", "k5"},
+			},
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"l", "",
+				nil,
+			},
+			// Multi-item databases should be prefix-iterable
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"ka", "",
+				[]string{"ka1", "ka2", "ka3", "ka4", "ka5"},
+			},
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"kc", "",
+				nil,
+			},
+			// Multi-item databases should be start-iterable
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"", "kb",
+				[]string{"kb1", "kb2", "kb3", "kb4", "kb5"},
+			},
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"", "ka3",
+				[]string{"ka3", "ka4", "ka5", "kb1", "kb2", "kb3", "kb4", "kb5"},
+			},
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"", "kc",
+				nil,
+			},
+			// Prefixes ending in 0xff must not overflow into the next key range
+			{
+				map[string]string{"a\xff": "1", "a\xff\x00": "2", "a\xff\xff": "3", "b": "4"},
+				"a\xff", "",
+				[]string{"a\xff", "a\xff\x00", "a\xff\xff"},
+			},
+			{
+				map[string]string{"\xff": "1", "\xff\xff": "2", "\xfe": "3"},
+				"\xff", "",
+				[]string{"\xff", "\xff\xff"},
+			},
+		}
+		for i, tt := range tests {
+			// Create the key-value data store
+			db := New()
+			for key, val := range tt.content {
+				if err := db.Put([]byte(key), []byte(val)); err != nil {
+					t.Fatalf("test %d: failed to insert item %s:%s into database: %v", i, key, val, err)
+				}
+			}
+			// Iterate over the database with the given configs and verify the results
+			var it kvstore.Iterator
+			switch {
+			case tt.prefix == "" && tt.start == "":
+				it = db.NewIterator()
+			case tt.prefix != "":
+				it = db.NewIteratorWithPrefix([]byte(tt.prefix))
+			default:
+				it = db.NewIteratorWithStart([]byte(tt.start))
+			}
+			idx := 0
+			for it.Next() {
+				if len(tt.order) <= idx {
+					t.Errorf("test %d: prefix=%q start=%q more items than expected: checking idx=%d (key %q), expecting len=%d", i, tt.prefix, tt.start, idx, it.Key(), len(tt.order))
+					break
+				}
+				if !bytes.Equal(it.Key(), []byte(tt.order[idx])) {
+					t.Errorf("test %d: item %d: key mismatch: have %q, want %q", i, idx, it.Key(), tt.order[idx])
+				}
+				if !bytes.Equal(it.Value(), []byte(tt.content[tt.order[idx]])) {
+					t.Errorf("test %d: item %d: value mismatch: have %q, want %q", i, idx, it.Value(), tt.content[tt.order[idx]])
+				}
+				idx++
+			}
+			if err := it.Error(); err != nil {
+				t.Errorf("test %d: iteration failed: %v", i, err)
+			}
+			if idx != len(tt.order) {
+				t.Errorf("test %d: iteration terminated prematurely: have %d, want %d", i, idx, len(tt.order))
+			}
+			it.Release()
+			db.Close()
+		}
+	})
+
+	t.Run("IteratorEmptyPrefixAndStart", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		keys := []string{"1", "2", "3", "4", "6", "10", "11", "12", "20", "21", "22"}
+		for _, k := range keys {
+			db.Put([]byte(k), nil)
+		}
+		sort.Strings(keys)
+
+		// An empty (or nil) prefix and an empty (or nil) start must both yield
+		// the whole keyspace, exactly like NewIterator.
+		for name, it := range map[string]kvstore.Iterator{
+			"all":          db.NewIterator(),
+			"nil-prefix":   db.NewIteratorWithPrefix(nil),
+			"empty-prefix": db.NewIteratorWithPrefix([]byte{}),
+			"nil-start":    db.NewIteratorWithStart(nil),
+			"empty-start":  db.NewIteratorWithStart([]byte{}),
+		} {
+			if got := iterateKeys(it); !equalStrings(got, keys) {
+				t.Errorf("%s: keys mismatch: have %v, want %v", name, got, keys)
+			}
+		}
+		// Start and prefix seeks should land on the correct positions
+		if got, want := iterateKeys(db.NewIteratorWithStart([]byte("2"))), []string{"2", "20", "21", "22", "3", "4", "6"}; !equalStrings(got, want) {
+			t.Errorf("start: keys mismatch: have %v, want %v", got, want)
+		}
+		if got, want := iterateKeys(db.NewIteratorWithStart([]byte("5"))), []string{"6"}; !equalStrings(got, want) {
+			t.Errorf("start: keys mismatch: have %v, want %v", got, want)
+		}
+		if got, want := iterateKeys(db.NewIteratorWithPrefix([]byte("1"))), []string{"1", "10", "11", "12"}; !equalStrings(got, want) {
+			t.Errorf("prefix: keys mismatch: have %v, want %v", got, want)
+		}
+	})
+
+	t.Run("RangeIterator", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		ranger, ok := db.(kvstore.RangeIteratee)
+		if !ok {
+			t.Skip("range iteration not supported")
+		}
+		keys := []string{"a", "b", "b\x00", "c", "d", "e\xff", "f"}
+		for _, k := range keys {
+			if err := db.Put([]byte(k), []byte("v"+k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tests := []struct {
+			start, limit []byte
+			reverse      bool
+			want         []string
+		}{
+			{nil, nil, false, keys},
+			{nil, nil, true, []string{"f", "e\xff", "d", "c", "b\x00", "b", "a"}},
+			{[]byte("b"), []byte("d"), false, []string{"b", "b\x00", "c"}},
+			{[]byte("b"), []byte("d"), true, []string{"c", "b\x00", "b"}},
+			{[]byte("b\x00"), []byte("c"), false, []string{"b\x00"}},
+			{[]byte("bb"), nil, false, []string{"c", "d", "e\xff", "f"}},
+			{[]byte("bb"), nil, true, []string{"f", "e\xff", "d", "c"}},
+			{nil, []byte("c"), true, []string{"b\x00", "b", "a"}},
+			{nil, []byte("a"), false, nil},
+			{nil, []byte("a"), true, nil},
+			{[]byte("g"), nil, true, nil},
+			{[]byte("c"), []byte("c"), false, nil},
+			{[]byte("d"), []byte("b"), true, nil},
+		}
+		for i, tt := range tests {
+			it := ranger.NewRangeIterator(tt.start, tt.limit, tt.reverse)
+			var got []string
+			for it.Next() {
+				if want := "v" + string(it.Key()); string(it.Value()) != want {
+					t.Errorf("test %d: value mismatch for %q: have %q, want %q", i, it.Key(), it.Value(), want)
+				}
+				got = append(got, string(it.Key()))
+			}
+			if err := it.Error(); err != nil {
+				t.Errorf("test %d: iteration failed: %v", i, err)
+			}
+			it.Release()
+			if !equalStrings(got, tt.want) {
+				t.Errorf("test %d: range [%q, %q) reverse=%t: have %q, want %q", i, tt.start, tt.limit, tt.reverse, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("IteratorBeforeNext", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		if err := db.Put([]byte("key"), []byte("val")); err != nil {
+			t.Fatal(err)
+		}
+		it := db.NewIterator()
+		defer it.Release()
+
+		// Key and Value must be nil until the iterator is positioned
+		if it.Key() != nil || it.Value() != nil {
+			t.Fatalf("unpositioned iterator: have %q:%q, want nil", it.Key(), it.Value())
+		}
+		if !it.Next() {
+			t.Fatalf("iterator exhausted prematurely")
+		}
+		if it.Next() {
+			t.Fatalf("iterator not exhausted")
+		}
+		if it.Key() != nil || it.Value() != nil {
+			t.Fatalf("exhausted iterator: have %q:%q, want nil", it.Key(), it.Value())
+		}
+		// Release must be idempotent
+		it.Release()
+		it.Release()
+	})
+
+	t.Run("IteratorSnapshot", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		for _, k := range []string{"a", "b", "c"} {
+			db.Put([]byte(k), []byte(k))
+		}
+		it := db.NewIterator()
+		defer it.Release()
+
+		// Writes done after the creation of the iterator must not be visible
+		db.Put([]byte("b"), []byte("changed"))
+		db.Put([]byte("d"), []byte("d"))
+		db.Delete([]byte("a"))
+
+		var got []string
+		for it.Next() {
+			got = append(got, string(it.Key())+"="+string(it.Value()))
+		}
+		if want := []string{"a=a", "b=b", "c=c"}; !equalStrings(got, want) {
+			t.Fatalf("iterator content mismatch: have %v, want %v", got, want)
+		}
+	})
+
+	t.Run("KeyValueOperations", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		key := []byte("foo")
+
+		if got, err := db.Has(key); err != nil {
+			t.Error(err)
+		} else if got {
+			t.Errorf("wrong value: %t", got)
+		}
+		if _, err := db.Get(key); err == nil {
+			t.Errorf("expected error for missing key")
+		}
+
+		value := []byte("hello world")
+		if err := db.Put(key, value); err != nil {
+			t.Error(err)
+		}
+		if got, err := db.Has(key); err != nil {
+			t.Error(err)
+		} else if !got {
+			t.Errorf("wrong value: %t", got)
+		}
+		if got, err := db.Get(key); err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(got, value) {
+			t.Errorf("wrong value: %q", got)
+		}
+		// Mutating the inserted or retrieved slices must not affect the database
+		value[0] = 'x'
+		if got, err := db.Get(key); err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(got, []byte("hello world")) {
+			t.Errorf("database retained caller slice: %q", got)
+		} else {
+			got[0] = 'y'
+		}
+		if got, _ := db.Get(key); !bytes.Equal(got, []byte("hello world")) {
+			t.Errorf("database returned internal slice: %q", got)
+		}
+		if err := db.Delete(key); err != nil {
+			t.Error(err)
+		}
+		if got, err := db.Has(key); err != nil {
+			t.Error(err)
+		} else if got {
+			t.Errorf("wrong value: %t", got)
+		}
+		// Deleting a missing key is not an error
+		if err := db.Delete([]byte("missing")); err != nil {
+			t.Errorf("failed to delete missing key: %v", err)
+		}
+	})
+
+	t.Run("NilValue", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		// Nil and empty values are both stored as empty values
+		for _, val := range [][]byte{nil, {}} {
+			key := []byte(fmt.Sprintf("key-%d", len(val)))
+			if err := db.Put(key, val); err != nil {
+				t.Fatalf("failed to put empty value: %v", err)
+			}
+			if has, err := db.Has(key); err != nil || !has {
+				t.Fatalf("empty value not present: %t, %v", has, err)
+			}
+			if got, err := db.Get(key); err != nil {
+				t.Fatalf("failed to get empty value: %v", err)
+			} else if len(got) != 0 {
+				t.Fatalf("wrong value: have %x, want empty", got)
+			}
+		}
+		it := db.NewIterator()
+		defer it.Release()
+		for it.Next() {
+			if len(it.Value()) != 0 {
+				t.Fatalf("wrong value for %q: have %x, want empty", it.Key(), it.Value())
+			}
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		b := db.NewBatch()
+		for _, k := range []string{"1", "2", "3", "4"} {
+			if err := b.Put([]byte(k), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if has, err := db.Has([]byte("1")); err != nil {
+			t.Fatal(err)
+		} else if has {
+			t.Error("db contains element before batch write")
+		}
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := iterateKeys(db.NewIterator()), []string{"1", "2", "3", "4"}; !equalStrings(got, want) {
+			t.Errorf("got: %v; want: %v", got, want)
+		}
+
+		// Reset the batch and make sure previous operations are not re-applied
+		b.Reset()
+		if b.ValueSize() != 0 {
+			t.Errorf("batch size not reset: %d", b.ValueSize())
+		}
+		for _, k := range []string{"1", "3", "4"} {
+			if err := b.Delete([]byte(k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if b.ValueSize() == 0 {
+			t.Errorf("batch size not tracked for deletions")
+		}
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := iterateKeys(db.NewIterator()), []string{"2"}; !equalStrings(got, want) {
+			t.Errorf("got: %v; want: %v", got, want)
+		}
+
+		// Operations on the same key must be applied in insertion order
+		b.Reset()
+		b.Put([]byte("5"), []byte("first"))
+		b.Delete([]byte("5"))
+		b.Put([]byte("6"), []byte("first"))
+		b.Put([]byte("6"), []byte("second"))
+		b.Delete([]byte("7"))
+		b.Put([]byte("7"), []byte("third"))
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+		if has, _ := db.Has([]byte("5")); has {
+			t.Errorf("deleted key present")
+		}
+		if got, _ := db.Get([]byte("6")); !bytes.Equal(got, []byte("second")) {
+			t.Errorf("wrong value: have %q, want %q", got, "second")
+		}
+		if got, _ := db.Get([]byte("7")); !bytes.Equal(got, []byte("third")) {
+			t.Errorf("wrong value: have %q, want %q", got, "third")
+		}
+	})
+
+	t.Run("BatchReplay", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		want := []string{"1", "2", "3", "4"}
+		b := db.NewBatch()
+		for _, k := range want {
+			if err := b.Put([]byte(k), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b.Delete([]byte("5"))
+
+		b2 := db.NewBatch()
+		if err := b.Replay(b2); err != nil {
+			t.Fatal(err)
+		}
+		if err := b2.Replay(db); err != nil {
+			t.Fatal(err)
+		}
+		if got := iterateKeys(db.NewIterator()); !equalStrings(got, want) {
+			t.Errorf("got: %v; want: %v", got, want)
+		}
+
+		// Replaying a reset batch must not emit any operation
+		b.Reset()
+		rec := new(recorder)
+		if err := b.Replay(rec); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.ops) != 0 {
+			t.Errorf("reset batch replayed %d operations: %v", len(rec.ops), rec.ops)
+		}
+		// A reused batch must only replay the operations done after the reset
+		b.Put([]byte("a"), []byte("1"))
+		b.Delete([]byte("b"))
+		if err := b.Replay(rec); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"put a=1", "del b"}; !equalStrings(rec.ops, want) {
+			t.Errorf("replayed operations mismatch: have %v, want %v", rec.ops, want)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		const items = 64
+		for i := 0; i < items; i++ {
+			key := []byte(fmt.Sprintf("key-%03d", i))
+			if err := db.Put(key, key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var (
+			wg   sync.WaitGroup
+			errc = make(chan error, 16)
+		)
+		// Concurrent readers and iterators must always see consistent entries
+		for r := 0; r < 8; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < items; i++ {
+					key := []byte(fmt.Sprintf("key-%03d", i))
+					val, err := db.Get(key)
+					if err != nil {
+						errc <- err
+						return
+					}
+					if !bytes.Equal(key, val) {
+						errc <- fmt.Errorf("value mismatch for %s: %q", key, val)
+						return
+					}
+				}
+				it := db.NewIteratorWithPrefix([]byte("key-"))
+				defer it.Release()
+				for it.Next() {
+					if !bytes.Equal(it.Key(), it.Value()) {
+						errc <- fmt.Errorf("iterator mismatch for %s: %q", it.Key(), it.Value())
+						return
+					}
+				}
+			}()
+		}
+		// Concurrent writer, touching a disjoint part of the keyspace
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				key := []byte(fmt.Sprintf("other-%03d", i))
+				if err := db.Put(key, key); err != nil {
+					errc <- err
+					return
+				}
+			}
+		}()
+		wg.Wait()
+		close(errc)
+		for err := range errc {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		for i := 0; i < 16; i++ {
+			db.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte("value"))
+		}
+		for i := 0; i < 8; i++ {
+			db.Delete([]byte(fmt.Sprintf("key-%02d", i)))
+		}
+		if err := db.Compact(nil, nil); err != nil {
+			t.Fatalf("failed to compact whole database: %v", err)
+		}
+		if err := db.Compact([]byte("key-04"), []byte("key-12")); err != nil {
+			t.Fatalf("failed to compact range: %v", err)
+		}
+		if got := len(iterateKeys(db.NewIterator())); got != 8 {
+			t.Fatalf("wrong item count after compaction: have %d, want 8", got)
+		}
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		snapshotter, ok := db.(kvstore.Snapshotter)
+		if !ok {
+			t.Skip("snapshots not supported")
+		}
+		for _, k := range []string{"a1", "a2", "b1"} {
+			if err := db.Put([]byte(k), []byte("v"+k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		snap, err := snapshotter.NewSnapshot()
+		if err != nil {
+			t.Fatalf("failed to create snapshot: %v", err)
+		}
+		// Mutate the database both directly and via batches
+		db.Put([]byte("a1"), []byte("changed"))
+		db.Delete([]byte("a2"))
+		b := db.NewBatch()
+		b.Put([]byte("a3"), []byte("va3"))
+		b.Delete([]byte("b1"))
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+		// The snapshot must still serve the original content
+		for _, k := range []string{"a1", "a2", "b1"} {
+			if has, err := snap.Has([]byte(k)); err != nil || !has {
+				t.Errorf("snapshot missing %s: %t, %v", k, has, err)
+			}
+			if val, err := snap.Get([]byte(k)); err != nil || string(val) != "v"+k {
+				t.Errorf("snapshot value mismatch for %s: %q, %v", k, val, err)
+			}
+		}
+		if has, _ := snap.Has([]byte("a3")); has {
+			t.Errorf("snapshot contains later insertion")
+		}
+		if got, want := iterateKeys(snap.NewIterator()), []string{"a1", "a2", "b1"}; !equalStrings(got, want) {
+			t.Errorf("snapshot iterator mismatch: have %v, want %v", got, want)
+		}
+		if got, want := iterateKeys(snap.NewIteratorWithStart([]byte("a2"))), []string{"a2", "b1"}; !equalStrings(got, want) {
+			t.Errorf("snapshot start iterator mismatch: have %v, want %v", got, want)
+		}
+		if got, want := iterateKeys(snap.NewIteratorWithPrefix([]byte("a"))), []string{"a1", "a2"}; !equalStrings(got, want) {
+			t.Errorf("snapshot prefix iterator mismatch: have %v, want %v", got, want)
+		}
+		// The database itself must serve the new content
+		if got, want := iterateKeys(db.NewIterator()), []string{"a1", "a3"}; !equalStrings(got, want) {
+			t.Errorf("database iterator mismatch: have %v, want %v", got, want)
+		}
+		// A snapshot wrapped into a store must be readable but not writable
+		store := kvstore.NewSnapshotStore(snap)
+		if val, err := store.Get([]byte("a1")); err != nil || string(val) != "va1" {
+			t.Errorf("snapshot store value mismatch: %q, %v", val, err)
+		}
+		if err := store.Put([]byte("a1"), nil); err != kvstore.ErrSnapshotReadOnly {
+			t.Errorf("snapshot store write error mismatch: have %v, want %v", err, kvstore.ErrSnapshotReadOnly)
+		}
+		// Released snapshots must refuse access
+		store.Close()
+		snap.Release()
+		if _, err := snap.Get([]byte("a1")); err == nil {
+			t.Errorf("released snapshot served data")
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		db := New()
+		db.Put([]byte("key"), []byte("val"))
+		b := db.NewBatch()
+		b.Put([]byte("batched"), []byte("val"))
+
+		if err := db.Close(); err != nil {
+			t.Fatalf("failed to close database: %v", err)
+		}
+		if _, err := db.Has([]byte("key")); err == nil {
+			t.Error("Has succeeded on closed database")
+		}
+		if _, err := db.Get([]byte("key")); err == nil {
+			t.Error("Get succeeded on closed database")
+		}
+		if err := db.Put([]byte("key"), []byte("val")); err == nil {
+			t.Error("Put succeeded on closed database")
+		}
+		if err := db.Delete([]byte("key")); err == nil {
+			t.Error("Delete succeeded on closed database")
+		}
+		if err := b.Write(); err == nil {
+			t.Error("batch Write succeeded on closed database")
+		}
+		it := db.NewIterator()
+		if it.Next() {
+			t.Error("iterator yielded items on closed database")
+		}
+		if it.Error() == nil {
+			t.Error("iterator on closed database reported no error")
+		}
+		it.Release()
+
+		// Closing twice must not panic
+		db.Close()
+	})
+}
+
+// recorder is a key-value writer which records every operation in a textual
+// form, used to inspect batch replays.
+type recorder struct {
+	ops []string
+}
+
+// Put records an insertion.
+func (r *recorder) Put(key []byte, value []byte) error {
+	r.ops = append(r.ops, fmt.Sprintf("put %s=%s", key, value))
+	return nil
+}
+
+// Delete records a removal.
+func (r *recorder) Delete(key []byte) error {
+	r.ops = append(r.ops, fmt.Sprintf("del %s", key))
+	return nil
+}
+
+// iterateKeys iterates over the given iterator, collects and returns all keys
+// and releases the iterator.
+func iterateKeys(it kvstore.Iterator) []string {
+	defer it.Release()
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	return keys
+}
+
+// equalStrings reports whether two string slices are equal, treating nil and
+// empty slices as equal.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
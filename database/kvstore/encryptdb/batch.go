@@ -0,0 +1,76 @@
+// Package encryptdb
+//
+// @author: xwc1125
+package encryptdb
+
+import "github.com/chain5j/chain5j-pkg/database/kvstore"
+
+// batch is a wrapper around a database batch that encrypts each entry before
+// queueing it up.
+type batch struct {
+	batch kvstore.Batch
+	c     *crypter
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *batch) Put(key, value []byte) error {
+	enc, err := b.c.encryptValue(key, value)
+	if err != nil {
+		return err
+	}
+	return b.batch.Put(b.c.encryptKey(key), enc)
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	return b.batch.Delete(b.c.encryptKey(key))
+}
+
+// ValueSize retrieves the amount of data queued up for writing, including the
+// encryption overhead.
+func (b *batch) ValueSize() int {
+	return b.batch.ValueSize()
+}
+
+// Write flushes any accumulated data to disk.
+func (b *batch) Write() error {
+	return b.batch.Write()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.batch.Reset()
+}
+
+// Replay replays the batch contents, decrypted.
+func (b *batch) Replay(w kvstore.KeyValueWriter) error {
+	return b.batch.Replay(&replayer{w: w, c: b.c})
+}
+
+// replayer is a wrapper around a batch replayer which decrypts the entries
+// before passing them on.
+type replayer struct {
+	w kvstore.KeyValueWriter
+	c *crypter
+}
+
+// Put implements the interface KeyValueWriter.
+func (r *replayer) Put(key []byte, value []byte) error {
+	key, err := r.c.decryptKey(key)
+	if err != nil {
+		return err
+	}
+	if value, err = r.c.decryptValue(key, value); err != nil {
+		return err
+	}
+	return r.w.Put(key, value)
+}
+
+// Delete implements the interface KeyValueWriter.
+func (r *replayer) Delete(key []byte) error {
+	key, err := r.c.decryptKey(key)
+	if err != nil {
+		return err
+	}
+	return r.w.Delete(key)
+}
@@ -0,0 +1,218 @@
+// Package encryptdb
+//
+// @author: xwc1125
+package encryptdb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+// Algorithm is the block cipher used, in Galois/Counter mode, to encrypt the data.
+type Algorithm string
+
+const (
+	AES Algorithm = "aes-gcm" // AES-128/192/256 in GCM mode, selected by the key length
+	SM4 Algorithm = "sm4-gcm" // SM4 in GCM mode, requires a 16 byte key
+)
+
+var (
+	// ErrUnknownAlgorithm is returned if the configured cipher is not supported.
+	ErrUnknownAlgorithm = errors.New("unknown encryption algorithm")
+
+	// ErrInvalidKey is returned if the master key does not fit the cipher.
+	ErrInvalidKey = errors.New("invalid encryption key")
+
+	// ErrCorrupted is returned if a stored key or value fails to authenticate,
+	// meaning it was tampered with, moved or encrypted under a different key.
+	ErrCorrupted = errors.New("encrypted data corrupted")
+)
+
+// Sub-key derivation labels, ensuring the different uses of the master key never
+// share cipher keys.
+var (
+	valueKeyLabel = []byte("chain5j-encryptdb-value")
+	keyKeyLabel   = []byte("chain5j-encryptdb-key")
+	sivKeyLabel   = []byte("chain5j-encryptdb-siv")
+)
+
+// crypter encrypts and decrypts database entries.
+//
+// Values are sealed with a random nonce, authenticating the plaintext key as
+// additional data so values cannot be swapped between keys:
+//
+//	nonce || AEAD(value, ad=key)
+//
+// Keys, if enabled, are sealed deterministically so that point lookups keep
+// working: the nonce is a keyed HMAC of the plaintext key (synthetic IV), hence
+// equal keys always map to equal ciphertexts:
+//
+//	HMAC(key)[:nonceSize] || AEAD(key)
+type crypter struct {
+	values *aeadPool // Cipher sealing the values
+	keys   *aeadPool // Cipher sealing the keys, nil if keys are stored in plain
+	siv    []byte    // HMAC key deriving the synthetic key nonces
+}
+
+// aeadPool hands out AEAD instances for exclusive use. Some block ciphers, such
+// as the SM4 implementation of gmsm, keep mutable state and must not be shared
+// between goroutines.
+type aeadPool struct {
+	pool      sync.Pool
+	nonceSize int
+	overhead  int
+}
+
+// newAEADPool creates a pool of the ciphers built by newAEAD, failing if the
+// cipher cannot be created.
+func newAEADPool(newAEAD func() (cipher.AEAD, error)) (*aeadPool, error) {
+	aead, err := newAEAD()
+	if err != nil {
+		return nil, err
+	}
+	p := &aeadPool{nonceSize: aead.NonceSize(), overhead: aead.Overhead()}
+	p.pool.New = func() interface{} {
+		aead, err := newAEAD()
+		if err != nil {
+			panic(err) // Cannot happen, the same cipher was created above
+		}
+		return aead
+	}
+	p.pool.Put(aead)
+	return p, nil
+}
+
+// seal encrypts and authenticates the plaintext, see cipher.AEAD.
+func (p *aeadPool) seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	aead := p.pool.Get().(cipher.AEAD)
+	defer p.pool.Put(aead)
+
+	return aead.Seal(dst, nonce, plaintext, additionalData)
+}
+
+// open decrypts and authenticates the ciphertext, see cipher.AEAD.
+func (p *aeadPool) open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	aead := p.pool.Get().(cipher.AEAD)
+	defer p.pool.Put(aead)
+
+	return aead.Open(dst, nonce, ciphertext, additionalData)
+}
+
+// newCrypter derives the sub-keys from the master key and creates the ciphers.
+func newCrypter(algo Algorithm, key []byte, encryptKeys bool) (*crypter, error) {
+	var newBlock func([]byte) (cipher.Block, error)
+	switch algo {
+	case AES, "":
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("%w: aes needs 16, 24 or 32 bytes, have %d", ErrInvalidKey, n)
+		}
+		newBlock = aes.NewCipher
+	case SM4:
+		if n := len(key); n != sm4.BlockSize {
+			return nil, fmt.Errorf("%w: sm4 needs %d bytes, have %d", ErrInvalidKey, sm4.BlockSize, n)
+		}
+		newBlock = sm4.NewCipher
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algo)
+	}
+	newAEAD := func(label []byte) (*aeadPool, error) {
+		subkey := derive(key, label)[:len(key)]
+		return newAEADPool(func() (cipher.AEAD, error) {
+			block, err := newBlock(subkey)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewGCM(block)
+		})
+	}
+	values, err := newAEAD(valueKeyLabel)
+	if err != nil {
+		return nil, err
+	}
+	c := &crypter{values: values}
+	if encryptKeys {
+		if c.keys, err = newAEAD(keyKeyLabel); err != nil {
+			return nil, err
+		}
+		c.siv = derive(key, sivKeyLabel)
+	}
+	return c, nil
+}
+
+// derive calculates a sub-key of the master key for the given use.
+func derive(key []byte, label []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(label)
+	return mac.Sum(nil)
+}
+
+// encryptKey converts a plaintext key into its stored form.
+func (c *crypter) encryptKey(key []byte) []byte {
+	if c.keys == nil {
+		return key
+	}
+	mac := hmac.New(sha256.New, c.siv)
+	mac.Write(key)
+	nonce := mac.Sum(nil)[:c.keys.nonceSize]
+
+	return c.keys.seal(nonce, nonce, key, nil)
+}
+
+// decryptKey converts a stored key back into its plaintext form.
+func (c *crypter) decryptKey(enc []byte) ([]byte, error) {
+	if c.keys == nil {
+		return enc, nil
+	}
+	size := c.keys.nonceSize
+	if len(enc) < size+c.keys.overhead {
+		return nil, ErrCorrupted
+	}
+	key, err := c.keys.open(nil, enc[:size], enc[size:], nil)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	if key == nil {
+		key = []byte{}
+	}
+	// Ensure the key is in its canonical form, otherwise lookups would miss it
+	if !bytes.Equal(c.encryptKey(key), enc) {
+		return nil, ErrCorrupted
+	}
+	return key, nil
+}
+
+// encryptValue seals a value stored under the given plaintext key.
+func (c *crypter) encryptValue(key []byte, value []byte) ([]byte, error) {
+	size := c.values.nonceSize
+
+	enc := make([]byte, size, size+len(value)+c.values.overhead)
+	if _, err := rand.Read(enc); err != nil {
+		return nil, err
+	}
+	return c.values.seal(enc, enc, value, key), nil
+}
+
+// decryptValue opens a value stored under the given plaintext key.
+func (c *crypter) decryptValue(key []byte, enc []byte) ([]byte, error) {
+	size := c.values.nonceSize
+	if len(enc) < size+c.values.overhead {
+		return nil, ErrCorrupted
+	}
+	value, err := c.values.open(nil, enc[:size], enc[size:], key)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return value, nil
+}
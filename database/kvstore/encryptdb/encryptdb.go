@@ -0,0 +1,224 @@
+// Package encryptdb implements an encryption-at-rest decorator for key-value
+// stores.
+//
+// Values are always encrypted with an AEAD cipher (AES-GCM or SM4-GCM) under a
+// random nonce, bound to their key. Keys are optionally encrypted too, in which
+// case a deterministic (synthetic IV) construction is used so that point
+// lookups by key keep working. Deterministic key encryption leaks equality of
+// keys (but not their contents) to anyone with access to the raw data.
+//
+// Ordering: with plaintext keys, iterators stream from the wrapped database in
+// the usual binary-alphabetical key order. With encrypted keys the on-disk order
+// is random, so iterators load and decrypt every entry of the database, filter
+// and sort them in memory before returning the first item. This keeps iteration
+// order correct, but costs a full scan and memory proportional to the matching
+// entries, so encrypted keys are best suited to stores accessed by key, such as
+// the trie node database.
+//
+// The wrapped database must be dedicated to the encrypted store, every entry in
+// it is expected to be encrypted under the same configuration.
+//
+// @author: xwc1125
+package encryptdb
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+)
+
+// errSnapshotUnsupported is returned if a snapshot is requested from a database
+// wrapping a store without snapshot support.
+var errSnapshotUnsupported = errors.New("snapshot not supported by the wrapped database")
+
+// Config is the encryption configuration of a database.
+type Config struct {
+	Algorithm   Algorithm // Cipher used for encryption, AES by default
+	Key         []byte    // Master key: 16, 24 or 32 bytes for AES, 16 bytes for SM4
+	EncryptKeys bool      // Whether to deterministically encrypt the keys too
+}
+
+// Database is a key-value store encrypting all data before handing it to the
+// wrapped database, and decrypting it transparently on retrieval.
+type Database struct {
+	db kvstore.KeyValueStore
+	c  *crypter
+}
+
+// New wraps a key-value store into an encrypting database.
+func New(db kvstore.KeyValueStore, config Config) (*Database, error) {
+	c, err := newCrypter(config.Algorithm, config.Key, config.EncryptKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &Database{db: db, c: c}, nil
+}
+
+// Close closes the wrapped database.
+func (db *Database) Close() error {
+	return db.db.Close()
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	return db.db.Has(db.c.encryptKey(key))
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	return get(db.db, db.c, key)
+}
+
+// Put inserts the given value into the key-value store.
+func (db *Database) Put(key []byte, value []byte) error {
+	enc, err := db.c.encryptValue(key, value)
+	if err != nil {
+		return err
+	}
+	return db.db.Put(db.c.encryptKey(key), enc)
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.db.Delete(db.c.encryptKey(key))
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called, encrypting all entries on insertion.
+func (db *Database) NewBatch() kvstore.Batch {
+	return &batch{batch: db.db.NewBatch(), c: db.c}
+}
+
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the key-value database.
+func (db *Database) NewIterator() kvstore.Iterator {
+	return newIterator(db.db, db.c, nil, nil)
+}
+
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// database content starting at a particular initial key (or after, if it does
+// not exist).
+func (db *Database) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return newIterator(db.db, db.c, nil, start)
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix.
+func (db *Database) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return newIterator(db.db, db.c, prefix, nil)
+}
+
+// NewRangeIterator creates a binary-alphabetical iterator over the keys in the
+// range [start, limit), walked forward or in reverse order.
+//
+// If the keys are stored in plain and the wrapped database supports range
+// iteration, the call is delegated down, otherwise the range is loaded and
+// sorted in memory.
+func (db *Database) NewRangeIterator(start, limit []byte, reverse bool) kvstore.Iterator {
+	if ranger, ok := db.db.(kvstore.RangeIteratee); ok && db.c.keys == nil {
+		return &iterator{iter: ranger.NewRangeIterator(start, limit, reverse), c: db.c}
+	}
+	var it kvstore.Iterator
+	if db.c.keys == nil {
+		it = db.db.NewIteratorWithStart(start)
+	} else {
+		it = db.db.NewIterator()
+	}
+	return collect(it, db.c, func(key []byte) bool {
+		return (start == nil || string(key) >= string(start)) && (limit == nil || string(key) < string(limit))
+	}, reverse)
+}
+
+// Stat returns a particular internal stat of the wrapped database.
+func (db *Database) Stat(property string) (string, error) {
+	return db.db.Stat(property)
+}
+
+// Compact flattens the underlying data store for the given key range. If keys
+// are encrypted, plaintext ranges cannot be mapped to the stored ones and the
+// entire wrapped database is compacted.
+func (db *Database) Compact(start []byte, limit []byte) error {
+	if db.c.keys != nil {
+		return db.db.Compact(nil, nil)
+	}
+	return db.db.Compact(start, limit)
+}
+
+// NewSnapshot creates a database snapshot based on the current state, if the
+// wrapped database supports snapshots.
+func (db *Database) NewSnapshot() (kvstore.Snapshot, error) {
+	snapper, ok := db.db.(kvstore.Snapshotter)
+	if !ok {
+		return nil, errSnapshotUnsupported
+	}
+	snap, err := snapper.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{snap: snap, c: db.c}, nil
+}
+
+// get retrieves and decrypts the value of the given key from the reader.
+func get(r kvstore.KeyValueReader, c *crypter, key []byte) ([]byte, error) {
+	enc, err := r.Get(c.encryptKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return c.decryptValue(key, enc)
+}
+
+// newIterator creates a decrypting iterator over the given prefix and start
+// position of the source.
+func newIterator(src kvstore.Iteratee, c *crypter, prefix []byte, start []byte) kvstore.Iterator {
+	if c.keys == nil {
+		if start != nil {
+			return &iterator{iter: src.NewIteratorWithStart(start), c: c}
+		}
+		return &iterator{iter: src.NewIteratorWithPrefix(prefix), c: c}
+	}
+	return collect(src.NewIterator(), c, func(key []byte) bool {
+		return string(key) >= string(start) && bytes.HasPrefix(key, prefix)
+	}, false)
+}
+
+// snapshot wraps a snapshot of the wrapped database, decrypting the data read
+// from it.
+type snapshot struct {
+	snap kvstore.Snapshot
+	c    *crypter
+}
+
+// Has retrieves if a key is present in the snapshot.
+func (snap *snapshot) Has(key []byte) (bool, error) {
+	return snap.snap.Has(snap.c.encryptKey(key))
+}
+
+// Get retrieves the given key if it's present in the snapshot.
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	return get(snap.snap, snap.c, key)
+}
+
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the snapshot.
+func (snap *snapshot) NewIterator() kvstore.Iterator {
+	return newIterator(snap.snap, snap.c, nil, nil)
+}
+
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// snapshot content starting at a particular initial key (or after, if it does
+// not exist).
+func (snap *snapshot) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return newIterator(snap.snap, snap.c, nil, start)
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of snapshot content with a particular key prefix.
+func (snap *snapshot) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return newIterator(snap.snap, snap.c, prefix, nil)
+}
+
+// Release releases associated resources.
+func (snap *snapshot) Release() {
+	snap.snap.Release()
+}
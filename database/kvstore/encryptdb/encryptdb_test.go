@@ -0,0 +1,144 @@
+package encryptdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/collection/trees/tree"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/dbtest"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+var testConfigs = map[string]Config{
+	"AES-128":      {Algorithm: AES, Key: bytes.Repeat([]byte{1}, 16)},
+	"AES-256-Keys": {Algorithm: AES, Key: bytes.Repeat([]byte{2}, 32), EncryptKeys: true},
+	"SM4":          {Algorithm: SM4, Key: bytes.Repeat([]byte{3}, 16)},
+	"SM4-Keys":     {Algorithm: SM4, Key: bytes.Repeat([]byte{4}, 16), EncryptKeys: true},
+}
+
+func TestEncryptDB(t *testing.T) {
+	for name, config := range testConfigs {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			dbtest.TestDatabaseSuite(t, func() kvstore.KeyValueStore {
+				db, err := New(memorydb.New(), config)
+				if err != nil {
+					t.Fatalf("failed to create database: %v", err)
+				}
+				return db
+			})
+		})
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		config Config
+		err    error
+	}{
+		{Config{Algorithm: AES, Key: make([]byte, 15)}, ErrInvalidKey},
+		{Config{Algorithm: SM4, Key: make([]byte, 32)}, ErrInvalidKey},
+		{Config{Algorithm: "des", Key: make([]byte, 16)}, ErrUnknownAlgorithm},
+	}
+	for i, tt := range tests {
+		if _, err := New(memorydb.New(), tt.config); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that no plaintext leaks into the wrapped database and that tampering with
+// the stored data is detected.
+func TestEncryptionAtRest(t *testing.T) {
+	for name, config := range testConfigs {
+		raw := memorydb.New()
+		db, _ := New(raw, config)
+
+		key, value := []byte("secret-key"), []byte("secret-value")
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("%s: failed to put: %v", name, err)
+		}
+		it := raw.NewIterator()
+		for it.Next() {
+			if bytes.Contains(it.Value(), value) {
+				t.Errorf("%s: plaintext value stored", name)
+			}
+			if config.EncryptKeys && bytes.Contains(it.Key(), key) {
+				t.Errorf("%s: plaintext key stored", name)
+			}
+			// Flip a bit of the stored value and ensure it's rejected
+			tampered := copyBytes(it.Value())
+			tampered[len(tampered)-1] ^= 1
+			raw.Put(copyBytes(it.Key()), tampered)
+		}
+		it.Release()
+
+		if _, err := db.Get(key); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: tampered value accepted: %v", name, err)
+		}
+		// Values must be bound to their keys, not be movable across them
+		db.Put([]byte("other"), value)
+		enc, _ := raw.Get(db.c.encryptKey([]byte("other")))
+		raw.Put(db.c.encryptKey(key), enc)
+		if _, err := db.Get(key); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: moved value accepted: %v", name, err)
+		}
+		// Keys are deterministic, values are not
+		if config.EncryptKeys && !bytes.Equal(db.c.encryptKey(key), db.c.encryptKey(key)) {
+			t.Errorf("%s: key encryption not deterministic", name)
+		}
+		enc1, _ := db.c.encryptValue(key, value)
+		enc2, _ := db.c.encryptValue(key, value)
+		if bytes.Equal(enc1, enc2) {
+			t.Errorf("%s: value encryption deterministic", name)
+		}
+	}
+}
+
+// Tests that a trie database can be run on top of an encrypted database.
+func TestTrieDatabase(t *testing.T) {
+	for name, config := range testConfigs {
+		raw := memorydb.New()
+		db, _ := New(raw, config)
+
+		triedb := tree.NewDatabase(db)
+		trie, _ := tree.New(types.Hash{}, triedb)
+		for i := 0; i < 100; i++ {
+			trie.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+		}
+		root, err := trie.Commit(nil)
+		if err != nil {
+			t.Fatalf("%s: failed to commit trie: %v", name, err)
+		}
+		if err := triedb.Commit(root, false); err != nil {
+			t.Fatalf("%s: failed to commit database: %v", name, err)
+		}
+		// Reopen the trie from disk, both through the encrypted and the raw store
+		reopened, err := tree.New(root, tree.NewDatabase(db))
+		if err != nil {
+			t.Fatalf("%s: failed to reopen trie: %v", name, err)
+		}
+		for i := 0; i < 100; i++ {
+			if have, want := reopened.Get([]byte(fmt.Sprintf("key-%d", i))), fmt.Sprintf("value-%d", i); string(have) != want {
+				t.Fatalf("%s: value mismatch: have %s, want %s", name, have, want)
+			}
+		}
+		// The root node must only be stored in its encrypted form
+		blob, err := db.Get(root[:])
+		if err != nil {
+			t.Fatalf("%s: failed to retrieve root node: %v", name, err)
+		}
+		if enc, _ := raw.Get(root[:]); bytes.Equal(enc, blob) {
+			t.Fatalf("%s: root node stored in plain", name)
+		}
+	}
+}
+
+// copyBytes returns a copy of the given byte slice.
+func copyBytes(b []byte) []byte {
+	return append([]byte{}, b...)
+}
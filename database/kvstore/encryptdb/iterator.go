@@ -0,0 +1,144 @@
+// Package encryptdb
+//
+// @author: xwc1125
+package encryptdb
+
+import (
+	"sort"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+)
+
+// iterator is a wrapper around a database iterator over plaintext keys which
+// decrypts the values on access.
+type iterator struct {
+	iter  kvstore.Iterator
+	c     *crypter
+	value []byte
+	err   error
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted. Iteration stops at the first value failing to decrypt.
+func (it *iterator) Next() bool {
+	if it.err != nil || !it.iter.Next() {
+		it.value = nil
+		return false
+	}
+	if it.value, it.err = it.c.decryptValue(it.iter.Key(), it.iter.Value()); it.err != nil {
+		return false
+	}
+	return true
+}
+
+// Error returns any accumulated error. Exhausting all the key/value pairs
+// is not considered to be an error.
+func (it *iterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.iter.Error()
+}
+
+// Key returns the key of the current key/value pair, or nil if done. The caller
+// should not modify the contents of the returned slice, and its contents may
+// change on the next call to Next.
+func (it *iterator) Key() []byte {
+	if it.value == nil {
+		return nil
+	}
+	return it.iter.Key()
+}
+
+// Value returns the decrypted value of the current key/value pair, or nil if
+// done.
+func (it *iterator) Value() []byte {
+	return it.value
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (it *iterator) Release() {
+	it.iter.Release()
+}
+
+// collect drains the given iterator, decrypting all the entries and keeping the
+// ones accepted by the filter, and returns an iterator over them in sorted order.
+func collect(it kvstore.Iterator, c *crypter, filter func(key []byte) bool, reverse bool) kvstore.Iterator {
+	defer it.Release()
+
+	var (
+		keys   []string
+		values = make(map[string][]byte)
+	)
+	for it.Next() {
+		key, err := c.decryptKey(it.Key())
+		if err != nil {
+			return &sliceIterator{err: err}
+		}
+		if !filter(key) {
+			continue
+		}
+		value, err := c.decryptValue(key, it.Value())
+		if err != nil {
+			return &sliceIterator{err: err}
+		}
+		keys = append(keys, string(key))
+		values[string(key)] = value
+	}
+	if err := it.Error(); err != nil {
+		return &sliceIterator{err: err}
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	} else {
+		sort.Strings(keys)
+	}
+	return &sliceIterator{keys: keys, values: values, index: -1}
+}
+
+// sliceIterator is an iterator over a decrypted, sorted set of entries.
+type sliceIterator struct {
+	keys   []string
+	values map[string][]byte
+	index  int
+	err    error
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted.
+func (it *sliceIterator) Next() bool {
+	if it.index >= len(it.keys) {
+		return false
+	}
+	it.index++
+	return it.index < len(it.keys)
+}
+
+// Error returns any accumulated error. Exhausting all the key/value pairs
+// is not considered to be an error.
+func (it *sliceIterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *sliceIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *sliceIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.keys[it.index]]
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (it *sliceIterator) Release() {
+	it.keys, it.values = nil, nil
+}
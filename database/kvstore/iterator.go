@@ -51,3 +51,17 @@ type Iteratee interface {
 	// of database content with a particular key prefix.
 	NewIteratorWithPrefix(prefix []byte) Iterator
 }
+
+// RangeIteratee wraps the NewRangeIterator method of a backing data store. It is
+// an optional extension of Iteratee, callers should type assert the database to
+// check whether bounded and reverse iteration is supported natively.
+type RangeIteratee interface {
+	// NewRangeIterator creates a binary-alphabetical iterator over the subset of
+	// database content within the [start, limit) key range. A nil start is treated
+	// as a key before all keys in the data store; a nil limit is treated as a key
+	// after all keys in the data store.
+	//
+	// If reverse is set, the keys are iterated in descending order, starting with
+	// the largest key smaller than limit.
+	NewRangeIterator(start []byte, limit []byte, reverse bool) Iterator
+}
@@ -8,12 +8,14 @@ import (
 	"time"
 
 	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/metrics"
 	"github.com/chain5j/chain5j-pkg/types"
 	"github.com/chain5j/chain5j-pkg/util/hexutil"
 	"github.com/chain5j/logger"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
@@ -47,6 +49,21 @@ type Database struct {
 	fn string      // filename for reporting
 	db *leveldb.DB // LevelDB instance
 
+	compTimeMeter      *metrics.Meter     // Meter for measuring the total time spent in database compaction
+	compReadMeter      *metrics.Meter     // Meter for measuring the data read during compaction
+	compWriteMeter     *metrics.Meter     // Meter for measuring the data written during compaction
+	writeDelayNMeter   *metrics.Meter     // Meter for measuring the write delay number due to database compaction
+	writeDelayMeter    *metrics.Meter     // Meter for measuring the write delay duration due to database compaction
+	diskSizeGauge      *metrics.Gauge     // Gauge for tracking the size of all the levels in the database
+	diskReadMeter      *metrics.Meter     // Meter for measuring the effective amount of data read
+	diskWriteMeter     *metrics.Meter     // Meter for measuring the effective amount of data written
+	memCompGauge       *metrics.Gauge     // Gauge for tracking the number of memory compaction
+	level0CompGauge    *metrics.Gauge     // Gauge for tracking the number of table compaction in level0
+	nonlevel0CompGauge *metrics.Gauge     // Gauge for tracking the number of table compaction in non0 level
+	seekCompGauge      *metrics.Gauge     // Gauge for tracking the number of table compaction caused by read opt
+	getTimer           *metrics.Histogram // Histogram for measuring the latency of database reads
+	putTimer           *metrics.Histogram // Histogram for measuring the latency of database writes
+
 	quitLock sync.Mutex      // Mutex protecting the quit channel access
 	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
 
@@ -88,6 +105,20 @@ func New(file string, cache int, handles int, namespace string) (*Database, erro
 		log:      logger,
 		quitChan: make(chan chan error),
 	}
+	ldb.compTimeMeter = metrics.NewRegisteredMeter(namespace+"compact/time", nil)
+	ldb.compReadMeter = metrics.NewRegisteredMeter(namespace+"compact/input", nil)
+	ldb.compWriteMeter = metrics.NewRegisteredMeter(namespace+"compact/output", nil)
+	ldb.diskSizeGauge = metrics.NewRegisteredGauge(namespace+"disk/size", nil)
+	ldb.diskReadMeter = metrics.NewRegisteredMeter(namespace+"disk/read", nil)
+	ldb.diskWriteMeter = metrics.NewRegisteredMeter(namespace+"disk/write", nil)
+	ldb.writeDelayMeter = metrics.NewRegisteredMeter(namespace+"compact/writedelay/duration", nil)
+	ldb.writeDelayNMeter = metrics.NewRegisteredMeter(namespace+"compact/writedelay/counter", nil)
+	ldb.memCompGauge = metrics.NewRegisteredGauge(namespace+"compact/memory", nil)
+	ldb.level0CompGauge = metrics.NewRegisteredGauge(namespace+"compact/level0", nil)
+	ldb.nonlevel0CompGauge = metrics.NewRegisteredGauge(namespace+"compact/nonlevel0", nil)
+	ldb.seekCompGauge = metrics.NewRegisteredGauge(namespace+"compact/seek", nil)
+	ldb.getTimer = metrics.NewRegisteredHistogram(namespace+"get/time", nil, nil)
+	ldb.putTimer = metrics.NewRegisteredHistogram(namespace+"put/time", nil, nil)
 
 	// Start up the metrics gathering and return
 	go ldb.meter(metricsGatheringInterval)
@@ -118,6 +149,7 @@ func (db *Database) Has(key []byte) (bool, error) {
 
 // Get retrieves the given key if it's present in the key-value store.
 func (db *Database) Get(key []byte) ([]byte, error) {
+	defer db.getTimer.UpdateSince(time.Now())
 	dat, err := db.db.Get(key, nil)
 	if err != nil {
 		return nil, err
@@ -130,6 +162,7 @@ func (db *Database) Get(key []byte) ([]byte, error) {
 
 // Put inserts the given value into the key-value store.
 func (db *Database) Put(key []byte, value []byte) error {
+	defer db.putTimer.UpdateSince(time.Now())
 	return db.db.Put(key, value, nil)
 }
 
@@ -166,6 +199,27 @@ func (db *Database) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
 	return db.db.NewIterator(util.BytesPrefix(prefix), nil)
 }
 
+// NewRangeIterator creates a binary-alphabetical iterator over the [start, limit)
+// subset of database content, in descending order if reverse is set.
+func (db *Database) NewRangeIterator(start []byte, limit []byte, reverse bool) kvstore.Iterator {
+	iter := db.db.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+	if reverse {
+		return &reverseIterator{Iterator: iter}
+	}
+	return iter
+}
+
+// NewSnapshot creates a database snapshot based on the current state. The created
+// snapshot will not be affected by all following mutations that happen on the
+// database. Note, the snapshot must be released after use.
+func (db *Database) NewSnapshot() (kvstore.Snapshot, error) {
+	snap, err := db.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{db: snap}, nil
+}
+
 // Stat returns a particular internal stat of the database.
 func (db *Database) Stat(property string) (string, error) {
 	return db.db.GetProperty(property)
@@ -265,6 +319,12 @@ func (db *Database) meter(refresh time.Duration) {
 				compactions[i%2][idx] += value
 			}
 		}
+		// Update all the requested meters
+		db.diskSizeGauge.Update(int64(compactions[i%2][0] * 1024 * 1024))
+		db.compTimeMeter.Mark(int64((compactions[i%2][1] - compactions[(i-1)%2][1]) * 1000 * 1000 * 1000))
+		db.compReadMeter.Mark(int64((compactions[i%2][2] - compactions[(i-1)%2][2]) * 1024 * 1024))
+		db.compWriteMeter.Mark(int64((compactions[i%2][3] - compactions[(i-1)%2][3]) * 1024 * 1024))
+
 		// Retrieve the write delay statistic
 		writedelay, err := db.db.GetProperty("leveldb.writedelay")
 		if err != nil {
@@ -296,6 +356,8 @@ func (db *Database) meter(refresh time.Duration) {
 			db.log.Warn("Database compacting, degraded performance")
 			lastWritePaused = time.Now()
 		}
+		db.writeDelayNMeter.Mark(delayN - delaystats[0])
+		db.writeDelayMeter.Mark(duration.Nanoseconds() - delaystats[1])
 		delaystats[0], delaystats[1] = delayN, duration.Nanoseconds()
 
 		// Retrieve the database iostats.
@@ -322,6 +384,8 @@ func (db *Database) meter(refresh time.Duration) {
 			merr = err
 			continue
 		}
+		db.diskReadMeter.Mark(int64((nRead - iostats[0]) * 1024 * 1024))
+		db.diskWriteMeter.Mark(int64((nWrite - iostats[1]) * 1024 * 1024))
 		iostats[0], iostats[1] = nRead, nWrite
 
 		compCount, err := db.db.GetProperty("leveldb.compcount")
@@ -342,6 +406,10 @@ func (db *Database) meter(refresh time.Duration) {
 			merr = err
 			continue
 		}
+		db.memCompGauge.Update(int64(memComp))
+		db.level0CompGauge.Update(int64(level0Comp))
+		db.nonlevel0CompGauge.Update(int64(nonLevel0Comp))
+		db.seekCompGauge.Update(int64(seekComp))
 
 		// Sleep a bit, then repeat the stats collection
 		select {
@@ -358,6 +426,48 @@ func (db *Database) meter(refresh time.Duration) {
 	errc <- merr
 }
 
+// snapshot wraps a leveldb snapshot for implementing the Snapshot interface.
+type snapshot struct {
+	db *leveldb.Snapshot
+}
+
+// Has retrieves if a key is present in the snapshot backing by a key-value
+// data store.
+func (snap *snapshot) Has(key []byte) (bool, error) {
+	return snap.db.Has(key, nil)
+}
+
+// Get retrieves the given key if it's present in the snapshot backing by
+// key-value data store.
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	return snap.db.Get(key, nil)
+}
+
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the snapshot.
+func (snap *snapshot) NewIterator() kvstore.Iterator {
+	return snap.db.NewIterator(new(util.Range), nil)
+}
+
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// snapshot content starting at a particular initial key (or after, if it does
+// not exist).
+func (snap *snapshot) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return snap.db.NewIterator(&util.Range{Start: start}, nil)
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of snapshot content with a particular key prefix.
+func (snap *snapshot) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return snap.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (snap *snapshot) Release() {
+	snap.db.Release()
+}
+
 // batch is a write-only leveldb batch that commits changes to its host database
 // when Write is called. A batch cannot be used concurrently.
 type batch struct {
@@ -424,3 +534,20 @@ func (r *replayer) Delete(key []byte) {
 	}
 	r.failure = r.writer.Delete(key)
 }
+
+// reverseIterator wraps a leveldb iterator, walking it backwards from the last
+// key of its range.
+type reverseIterator struct {
+	iterator.Iterator
+	moved bool
+}
+
+// Next moves the iterator to the previous key/value pair. It returns whether the
+// iterator is exhausted.
+func (it *reverseIterator) Next() bool {
+	if !it.moved {
+		it.moved = true
+		return it.Iterator.Last()
+	}
+	return it.Iterator.Prev()
+}
@@ -0,0 +1,20 @@
+package leveldb
+
+import (
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/dbtest"
+)
+
+func TestLevelDB(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() kvstore.KeyValueStore {
+			db, err := New(t.TempDir(), 0, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+}
@@ -35,14 +35,19 @@ var (
 	// errMemorydbNotFound is returned if a key is requested that is not found in
 	// the provided memory database.
 	errMemorydbNotFound = errors.New("not found")
+
+	// errSnapshotReleased is returned if a memory database snapshot was already
+	// released at the invocation of a data access operation.
+	errSnapshotReleased = errors.New("snapshot released")
 )
 
 // Database is an ephemeral key-value store. Apart from basic data storage
 // functionality it also supports batch writes and iterating over the keyspace in
 // binary-alphabetical order.
 type Database struct {
-	db   map[string][]byte
-	lock sync.RWMutex
+	db     map[string][]byte
+	shared bool // Flag whether the map is referenced by a snapshot
+	lock   sync.RWMutex
 }
 
 // New returns a wrapped map with all the required database interface methods
@@ -105,6 +110,7 @@ func (db *Database) Put(key []byte, value []byte) error {
 	if db.db == nil {
 		return errMemorydbClosed
 	}
+	db.unshare()
 	db.db[string(key)] = hexutil.CopyBytes(value)
 	return nil
 }
@@ -117,6 +123,7 @@ func (db *Database) Delete(key []byte) error {
 	if db.db == nil {
 		return errMemorydbClosed
 	}
+	db.unshare()
 	delete(db.db, string(key))
 	return nil
 }
@@ -142,26 +149,10 @@ func (db *Database) NewIteratorWithStart(start []byte) kvstore.Iterator {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
-	var (
-		st     = string(start)
-		keys   = make([]string, 0, len(db.db))
-		values = make([][]byte, 0, len(db.db))
-	)
-	// Collect the keys from the memory database corresponding to the given start
-	for key := range db.db {
-		if key >= st {
-			keys = append(keys, key)
-		}
-	}
-	// Sort the items and retrieve the associated values
-	sort.Strings(keys)
-	for _, key := range keys {
-		values = append(values, db.db[key])
-	}
-	return &iterator{
-		keys:   keys,
-		values: values,
+	if db.db == nil {
+		return &iterator{err: errMemorydbClosed}
 	}
+	return newIterator(db.db, start, nil, false)
 }
 
 // NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
@@ -170,26 +161,54 @@ func (db *Database) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
-	var (
-		pr     = string(prefix)
-		keys   = make([]string, 0, len(db.db))
-		values = make([][]byte, 0, len(db.db))
-	)
-	// Collect the keys from the memory database corresponding to the given prefix
-	for key := range db.db {
-		if strings.HasPrefix(key, pr) {
-			keys = append(keys, key)
-		}
+	if db.db == nil {
+		return &iterator{err: errMemorydbClosed}
 	}
-	// Sort the items and retrieve the associated values
-	sort.Strings(keys)
-	for _, key := range keys {
-		values = append(values, db.db[key])
+	return newPrefixIterator(db.db, prefix)
+}
+
+// NewRangeIterator creates a binary-alphabetical iterator over the [start, limit)
+// subset of database content, in descending order if reverse is set.
+func (db *Database) NewRangeIterator(start []byte, limit []byte, reverse bool) kvstore.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return &iterator{err: errMemorydbClosed}
 	}
-	return &iterator{
-		keys:   keys,
-		values: values,
+	return newIterator(db.db, start, limit, reverse)
+}
+
+// NewSnapshot creates a database snapshot based on the current state. The created
+// snapshot will not be affected by all following mutations that happen on the
+// database.
+//
+// The snapshot shares the current map with the database, which is copied on the
+// next mutation instead (copy-on-write). Taking many snapshots without writes
+// in between is therefore free.
+func (db *Database) NewSnapshot() (kvstore.Snapshot, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.db == nil {
+		return nil, errMemorydbClosed
 	}
+	db.shared = true
+	return &snapshot{db: db.db}, nil
+}
+
+// unshare copies the backing map if it is referenced by a live snapshot, so that
+// the upcoming mutation doesn't leak into the frozen view. The write lock must
+// be held by the caller.
+func (db *Database) unshare() {
+	if !db.shared {
+		return
+	}
+	cpy := make(map[string][]byte, len(db.db))
+	for key, value := range db.db {
+		cpy[key] = value
+	}
+	db.db, db.shared = cpy, false
 }
 
 // Stat returns a particular internal stat of the database.
@@ -254,6 +273,10 @@ func (b *batch) Write() error {
 	b.db.lock.Lock()
 	defer b.db.lock.Unlock()
 
+	if b.db.db == nil {
+		return errMemorydbClosed
+	}
+	b.db.unshare()
 	for _, keyvalue := range b.writes {
 		if keyvalue.delete {
 			delete(b.db.db, string(keyvalue.key))
@@ -286,6 +309,135 @@ func (b *batch) Replay(w kvstore.KeyValueWriter) error {
 	return nil
 }
 
+// newIterator collects the entries of the given map within the [start, limit)
+// key range into a sorted iterator, descending if reverse is set. A nil limit
+// is treated as a key after all keys in the map.
+func newIterator(db map[string][]byte, start []byte, limit []byte, reverse bool) *iterator {
+	var (
+		st     = string(start)
+		lt     = string(limit)
+		keys   = make([]string, 0, len(db))
+		values = make([][]byte, 0, len(db))
+	)
+	// Collect the keys from the memory database corresponding to the given range
+	for key := range db {
+		if key >= st && (limit == nil || key < lt) {
+			keys = append(keys, key)
+		}
+	}
+	// Sort the items in the requested order and retrieve the associated values
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	} else {
+		sort.Strings(keys)
+	}
+	for _, key := range keys {
+		values = append(values, db[key])
+	}
+	return &iterator{
+		keys:   keys,
+		values: values,
+	}
+}
+
+// newPrefixIterator collects the entries of the given map with a particular key
+// prefix into a sorted iterator.
+func newPrefixIterator(db map[string][]byte, prefix []byte) *iterator {
+	var (
+		pr     = string(prefix)
+		keys   = make([]string, 0, len(db))
+		values = make([][]byte, 0, len(db))
+	)
+	// Collect the keys from the memory database corresponding to the given prefix
+	for key := range db {
+		if strings.HasPrefix(key, pr) {
+			keys = append(keys, key)
+		}
+	}
+	// Sort the items and retrieve the associated values
+	sort.Strings(keys)
+	for _, key := range keys {
+		values = append(values, db[key])
+	}
+	return &iterator{
+		keys:   keys,
+		values: values,
+	}
+}
+
+// snapshot is a frozen view of a memory database. It references the map of the
+// database at the time of creation, which is never mutated afterwards.
+type snapshot struct {
+	db   map[string][]byte
+	lock sync.RWMutex
+}
+
+// Has retrieves if a key is present in the snapshot.
+func (snap *snapshot) Has(key []byte) (bool, error) {
+	snap.lock.RLock()
+	defer snap.lock.RUnlock()
+
+	if snap.db == nil {
+		return false, errSnapshotReleased
+	}
+	_, ok := snap.db[string(key)]
+	return ok, nil
+}
+
+// Get retrieves the given key if it's present in the snapshot.
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	snap.lock.RLock()
+	defer snap.lock.RUnlock()
+
+	if snap.db == nil {
+		return nil, errSnapshotReleased
+	}
+	if entry, ok := snap.db[string(key)]; ok {
+		return hexutil.CopyBytes(entry), nil
+	}
+	return nil, errMemorydbNotFound
+}
+
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the snapshot.
+func (snap *snapshot) NewIterator() kvstore.Iterator {
+	return snap.NewIteratorWithStart(nil)
+}
+
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// snapshot content starting at a particular initial key (or after, if it does
+// not exist).
+func (snap *snapshot) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	snap.lock.RLock()
+	defer snap.lock.RUnlock()
+
+	if snap.db == nil {
+		return &iterator{err: errSnapshotReleased}
+	}
+	return newIterator(snap.db, start, nil, false)
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of snapshot content with a particular key prefix.
+func (snap *snapshot) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	snap.lock.RLock()
+	defer snap.lock.RUnlock()
+
+	if snap.db == nil {
+		return &iterator{err: errSnapshotReleased}
+	}
+	return newPrefixIterator(snap.db, prefix)
+}
+
+// Release releases the reference to the frozen map, any consecutive data access
+// fails with an error.
+func (snap *snapshot) Release() {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+
+	snap.db = nil
+}
+
 // iterator can walk over the (potentially partial) keyspace of a memory key
 // value store. Internally it is a deep copy of the entire iterated state,
 // sorted by keys.
@@ -293,6 +445,7 @@ type iterator struct {
 	inited bool
 	keys   []string
 	values [][]byte
+	err    error
 }
 
 // Next moves the iterator to the next key/value pair. It returns whether the
@@ -312,16 +465,17 @@ func (it *iterator) Next() bool {
 }
 
 // Error returns any accumulated error. Exhausting all the key/value pairs
-// is not considered to be an error. A memory iterator cannot encounter errors.
+// is not considered to be an error. A memory iterator can only fail if it was
+// created on a closed database.
 func (it *iterator) Error() error {
-	return nil
+	return it.err
 }
 
 // Key returns the key of the current key/value pair, or nil if done. The caller
 // should not modify the contents of the returned slice, and its contents may
 // change on the next call to Next.
 func (it *iterator) Key() []byte {
-	if len(it.keys) > 0 {
+	if it.inited && len(it.keys) > 0 {
 		return []byte(it.keys[0])
 	}
 	return nil
@@ -331,7 +485,7 @@ func (it *iterator) Key() []byte {
 // caller should not modify the contents of the returned slice, and its contents
 // may change on the next call to Next.
 func (it *iterator) Value() []byte {
-	if len(it.values) > 0 {
+	if it.inited && len(it.values) > 0 {
 		return it.values[0]
 	}
 	return nil
@@ -0,0 +1,16 @@
+package memorydb
+
+import (
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/dbtest"
+)
+
+func TestMemoryDB(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() kvstore.KeyValueStore {
+			return New()
+		})
+	})
+}
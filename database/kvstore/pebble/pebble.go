@@ -0,0 +1,685 @@
+// Package pebble implements the key-value database layer based on pebble.
+//
+// @author: xwc1125
+package pebble
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/metrics"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+	"github.com/chain5j/logger"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
+)
+
+// errSnapshotReleased is returned if a snapshot was already released at the
+// invocation of a data access operation.
+var errSnapshotReleased = errors.New("snapshot released")
+
+const (
+	// degradationWarnInterval specifies how often warning should be printed if the
+	// pebble database cannot keep up with requested writes.
+	degradationWarnInterval = time.Minute
+
+	// minCache is the minimum amount of memory in megabytes to allocate to pebble
+	// read and write caching, split half and half.
+	minCache = 16
+
+	// minHandles is the minimum number of files handles to allocate to the open
+	// database files.
+	minHandles = 16
+
+	// maxMemTableSize is the upper bound of the pebble memory table size, any
+	// larger value is rejected by the engine.
+	maxMemTableSize = 4<<30 - 1
+
+	// metricsGatheringInterval specifies the interval to retrieve pebble database
+	// compaction, io and pause stats to report to the user.
+	metricsGatheringInterval = 3 * time.Second
+)
+
+// Database is a persistent key-value store based on the pebble storage engine.
+// Apart from basic data storage functionality it also supports batch writes and
+// iterating over the keyspace in binary-alphabetical order.
+type Database struct {
+	fn string     // filename for reporting
+	db *pebble.DB // Underlying pebble storage engine
+
+	quitLock sync.RWMutex // Mutex protecting the closed flag against concurrent access
+	closed   bool         // Flag whether the database was already closed
+
+	compTimeMeter      *metrics.Meter     // Meter for measuring the total time spent in database compaction
+	compReadMeter      *metrics.Meter     // Meter for measuring the data read during compaction
+	compWriteMeter     *metrics.Meter     // Meter for measuring the data written during compaction
+	writeDelayNMeter   *metrics.Meter     // Meter for measuring the write delay number due to database compaction
+	writeDelayMeter    *metrics.Meter     // Meter for measuring the write delay duration due to database compaction
+	diskSizeGauge      *metrics.Gauge     // Gauge for tracking the size of all the levels in the database
+	diskReadMeter      *metrics.Meter     // Meter for measuring the effective amount of data read
+	diskWriteMeter     *metrics.Meter     // Meter for measuring the effective amount of data written
+	memCompGauge       *metrics.Gauge     // Gauge for tracking the number of memory compaction
+	level0CompGauge    *metrics.Gauge     // Gauge for tracking the number of table compaction in level0
+	nonlevel0CompGauge *metrics.Gauge     // Gauge for tracking the number of table compaction in non0 level
+	seekCompGauge      *metrics.Gauge     // Gauge for tracking the number of table compaction caused by read opt
+	getTimer           *metrics.Histogram // Histogram for measuring the latency of database reads
+	putTimer           *metrics.Histogram // Histogram for measuring the latency of database writes
+
+	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
+
+	writeDelayStartTime time.Time // The start time of the latest write stall
+	writeDelayCount     int64     // Total number of write stalls (atomic)
+	writeDelayTime      int64     // Total duration of the write stalls in nanoseconds (atomic)
+	lastWritePaused     time.Time // The time of the latest degradation warning
+
+	log logger.Logger // Contextual logger tracking the database path
+}
+
+// New returns a wrapped pebble DB object. The namespace is the prefix that the
+// metrics reporting should use for surfacing internal stats.
+func New(file string, cache int, handles int, namespace string) (*Database, error) {
+	// Ensure we have some minimal caching and file guarantees
+	if cache < minCache {
+		cache = minCache
+	}
+	if handles < minHandles {
+		handles = minHandles
+	}
+	logger := logger.New("pebble")
+	logger.Debug("Allocated cache and file handles", "database", file, "cache", types.StorageSize(cache*1024*1024), "handles", handles)
+
+	// The memory table size is the half of the allocated cache, split between
+	// two tables so that one can be flushed while the other is being filled.
+	memTableLimit := 2
+	memTableSize := cache * 1024 * 1024 / 2 / memTableLimit
+	if memTableSize > maxMemTableSize {
+		memTableSize = maxMemTableSize
+	}
+	db := &Database{
+		fn:       file,
+		log:      logger,
+		quitChan: make(chan chan error),
+	}
+	blockCache := pebble.NewCache(int64(cache * 1024 * 1024))
+	defer blockCache.Unref()
+
+	opts := &pebble.Options{
+		Cache:                       blockCache,
+		MaxOpenFiles:                handles,
+		MemTableSize:                uint64(memTableSize),
+		MemTableStopWritesThreshold: memTableLimit,
+		MaxConcurrentCompactions:    func() int { return runtime.NumCPU() },
+		Levels: []pebble.LevelOptions{
+			{TargetFileSize: 2 * 1024 * 1024, FilterPolicy: bloom.FilterPolicy(10)},
+			{TargetFileSize: 4 * 1024 * 1024, FilterPolicy: bloom.FilterPolicy(10)},
+			{TargetFileSize: 8 * 1024 * 1024, FilterPolicy: bloom.FilterPolicy(10)},
+			{TargetFileSize: 16 * 1024 * 1024, FilterPolicy: bloom.FilterPolicy(10)},
+			{TargetFileSize: 32 * 1024 * 1024, FilterPolicy: bloom.FilterPolicy(10)},
+			{TargetFileSize: 64 * 1024 * 1024, FilterPolicy: bloom.FilterPolicy(10)},
+			{TargetFileSize: 128 * 1024 * 1024, FilterPolicy: bloom.FilterPolicy(10)},
+		},
+		EventListener: &pebble.EventListener{
+			WriteStallBegin: db.onWriteStallBegin,
+			WriteStallEnd:   db.onWriteStallEnd,
+		},
+	}
+	// Disable seek compaction explicitly, the same as the leveldb backend does.
+	opts.Experimental.ReadSamplingMultiplier = -1
+
+	// Open the db and recover any potential corruptions
+	innerDB, err := pebble.Open(file, opts)
+	if err != nil {
+		logger.Error("pebble.Open err", "err", err)
+		return nil, err
+	}
+	db.db = innerDB
+
+	// Register all the metrics, the same as the leveldb backend does
+	db.compTimeMeter = metrics.NewRegisteredMeter(namespace+"compact/time", nil)
+	db.compReadMeter = metrics.NewRegisteredMeter(namespace+"compact/input", nil)
+	db.compWriteMeter = metrics.NewRegisteredMeter(namespace+"compact/output", nil)
+	db.diskSizeGauge = metrics.NewRegisteredGauge(namespace+"disk/size", nil)
+	db.diskReadMeter = metrics.NewRegisteredMeter(namespace+"disk/read", nil)
+	db.diskWriteMeter = metrics.NewRegisteredMeter(namespace+"disk/write", nil)
+	db.writeDelayMeter = metrics.NewRegisteredMeter(namespace+"compact/writedelay/duration", nil)
+	db.writeDelayNMeter = metrics.NewRegisteredMeter(namespace+"compact/writedelay/counter", nil)
+	db.memCompGauge = metrics.NewRegisteredGauge(namespace+"compact/memory", nil)
+	db.level0CompGauge = metrics.NewRegisteredGauge(namespace+"compact/level0", nil)
+	db.nonlevel0CompGauge = metrics.NewRegisteredGauge(namespace+"compact/nonlevel0", nil)
+	db.seekCompGauge = metrics.NewRegisteredGauge(namespace+"compact/seek", nil)
+	db.getTimer = metrics.NewRegisteredHistogram(namespace+"get/time", nil, nil)
+	db.putTimer = metrics.NewRegisteredHistogram(namespace+"put/time", nil, nil)
+
+	// Start up the metrics gathering and return
+	go db.meter(metricsGatheringInterval)
+	return db, nil
+}
+
+// onWriteStallBegin records the start of a write stall and warns the user that
+// the database is compacting, at most once per degradationWarnInterval.
+func (db *Database) onWriteStallBegin(info pebble.WriteStallBeginInfo) {
+	db.writeDelayStartTime = time.Now()
+	if time.Now().After(db.lastWritePaused.Add(degradationWarnInterval)) {
+		db.log.Warn("Database compacting, degraded performance", "reason", info.Reason)
+		db.lastWritePaused = time.Now()
+	}
+}
+
+// onWriteStallEnd reports the duration of the finished write stall.
+func (db *Database) onWriteStallEnd() {
+	elapsed := time.Since(db.writeDelayStartTime)
+	atomic.AddInt64(&db.writeDelayCount, 1)
+	atomic.AddInt64(&db.writeDelayTime, int64(elapsed))
+	db.log.Debug("Database write stall finished", "elapsed", elapsed)
+}
+
+// meter periodically retrieves internal pebble counters and reports them to
+// the metrics subsystem. Pebble doesn't track the bytes read by user requests,
+// so the effective disk reads are those of the compactions.
+func (db *Database) meter(refresh time.Duration) {
+	var (
+		errc chan error
+
+		compTime, compRead, compWrite int64
+		diskWrite                     int64
+		delayCount, delayTime         int64
+	)
+	for errc == nil {
+		stats := db.db.Metrics()
+
+		var nCompRead, nCompWrite, nDiskWrite int64
+		for _, level := range stats.Levels {
+			nCompRead += int64(level.BytesRead)
+			nCompWrite += int64(level.BytesCompacted)
+			nDiskWrite += int64(level.BytesCompacted + level.BytesFlushed)
+		}
+		nDiskWrite += int64(stats.WAL.BytesWritten)
+		nCompTime := int64(stats.Compact.Duration)
+		nDelayCount := atomic.LoadInt64(&db.writeDelayCount)
+		nDelayTime := atomic.LoadInt64(&db.writeDelayTime)
+
+		db.diskSizeGauge.Update(int64(stats.DiskSpaceUsage()))
+		db.compTimeMeter.Mark(nCompTime - compTime)
+		db.compReadMeter.Mark(nCompRead - compRead)
+		db.compWriteMeter.Mark(nCompWrite - compWrite)
+		db.diskReadMeter.Mark(nCompRead - compRead)
+		db.diskWriteMeter.Mark(nDiskWrite - diskWrite)
+		db.writeDelayNMeter.Mark(nDelayCount - delayCount)
+		db.writeDelayMeter.Mark(nDelayTime - delayTime)
+
+		db.memCompGauge.Update(stats.Flush.Count)
+		db.level0CompGauge.Update(int64(stats.Levels[0].TablesCompacted))
+		db.nonlevel0CompGauge.Update(stats.Compact.Count - int64(stats.Levels[0].TablesCompacted))
+		db.seekCompGauge.Update(stats.Compact.ReadCount)
+
+		compTime, compRead, compWrite = nCompTime, nCompRead, nCompWrite
+		diskWrite, delayCount, delayTime = nDiskWrite, nDelayCount, nDelayTime
+
+		// Sleep a bit, then repeat the stats collection
+		select {
+		case errc = <-db.quitChan:
+			// Quit requesting, stop hammering the database
+		case <-time.After(refresh):
+			// Timeout, gather a new set of stats
+		}
+	}
+	errc <- nil
+}
+
+// Close flushes any pending data to disk and closes all io accesses to the
+// underlying key-value store.
+func (db *Database) Close() error {
+	db.quitLock.Lock()
+	defer db.quitLock.Unlock()
+
+	// Allow double closing, simplifies things
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	if db.quitChan != nil {
+		errc := make(chan error)
+		db.quitChan <- errc
+		if err := <-errc; err != nil {
+			db.log.Error("Metrics collection failed", "err", err)
+		}
+		db.quitChan = nil
+	}
+	return db.db.Close()
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	db.quitLock.RLock()
+	defer db.quitLock.RUnlock()
+
+	if db.closed {
+		return false, pebble.ErrClosed
+	}
+	_, closer, err := db.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	db.quitLock.RLock()
+	defer db.quitLock.RUnlock()
+
+	if db.closed {
+		return nil, pebble.ErrClosed
+	}
+	defer db.getTimer.UpdateSince(time.Now())
+	dat, closer, err := db.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	// The returned slice is only valid until the closer is invoked
+	ret := hexutil.CopyBytes(dat)
+	closer.Close()
+	return ret, nil
+}
+
+// Put inserts the given value into the key-value store.
+func (db *Database) Put(key []byte, value []byte) error {
+	db.quitLock.RLock()
+	defer db.quitLock.RUnlock()
+
+	if db.closed {
+		return pebble.ErrClosed
+	}
+	defer db.putTimer.UpdateSince(time.Now())
+	return db.db.Set(key, value, pebble.NoSync)
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	db.quitLock.RLock()
+	defer db.quitLock.RUnlock()
+
+	if db.closed {
+		return pebble.ErrClosed
+	}
+	return db.db.Delete(key, pebble.NoSync)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() kvstore.Batch {
+	return &batch{
+		b:  db.db.NewBatch(),
+		db: db,
+	}
+}
+
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the pebble database.
+func (db *Database) NewIterator() kvstore.Iterator {
+	return db.newIterator(nil, nil, false)
+}
+
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// database content starting at a particular initial key (or after, if it does
+// not exist).
+func (db *Database) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return db.newIterator(start, nil, false)
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix.
+func (db *Database) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return db.newIterator(prefix, upperBound(prefix), false)
+}
+
+// NewRangeIterator creates a binary-alphabetical iterator over the [start, limit)
+// subset of database content, in descending order if reverse is set.
+func (db *Database) NewRangeIterator(start []byte, limit []byte, reverse bool) kvstore.Iterator {
+	return db.newIterator(start, limit, reverse)
+}
+
+// newIterator creates a binary-alphabetical iterator over the [lower, upper)
+// range of the keyspace, walking it backwards if reverse is set. A nil bound is
+// treated as unbounded.
+func (db *Database) newIterator(lower, upper []byte, reverse bool) kvstore.Iterator {
+	db.quitLock.RLock()
+	defer db.quitLock.RUnlock()
+
+	if db.closed {
+		return &pebbleIterator{err: pebble.ErrClosed}
+	}
+	iter, err := db.db.NewIter(&pebble.IterOptions{
+		LowerBound: lower,
+		UpperBound: upper,
+	})
+	if err != nil {
+		return &pebbleIterator{err: err}
+	}
+	if reverse {
+		iter.Last()
+	} else {
+		iter.First()
+	}
+	return &pebbleIterator{iter: iter, moved: true, reverse: reverse}
+}
+
+// NewSnapshot creates a database snapshot based on the current state. The created
+// snapshot will not be affected by all following mutations that happen on the
+// database. Note, the snapshot must be released after use.
+func (db *Database) NewSnapshot() (kvstore.Snapshot, error) {
+	db.quitLock.RLock()
+	defer db.quitLock.RUnlock()
+
+	if db.closed {
+		return nil, pebble.ErrClosed
+	}
+	return &snapshot{db: db.db.NewSnapshot()}, nil
+}
+
+// Stat returns a particular internal stat of the database.
+func (db *Database) Stat(property string) (string, error) {
+	db.quitLock.RLock()
+	defer db.quitLock.RUnlock()
+
+	if db.closed {
+		return "", pebble.ErrClosed
+	}
+	if property != "pebble.stats" {
+		return "", errors.New("unknown property")
+	}
+	return db.db.Metrics().String(), nil
+}
+
+// Compact flattens the underlying data store for the given key range. In essence,
+// deleted and overwritten versions are discarded, and the data is rearranged to
+// reduce the cost of operations needed to access them.
+//
+// A nil start is treated as a key before all keys in the data store; a nil limit
+// is treated as a key after all keys in the data store. If both is nil then it
+// will compact entire data store.
+func (db *Database) Compact(start []byte, limit []byte) error {
+	db.quitLock.RLock()
+	defer db.quitLock.RUnlock()
+
+	if db.closed {
+		return pebble.ErrClosed
+	}
+	// There is no special flag to represent the end of key range in pebble (nil
+	// in leveldb), so use the key right after the last one of the store.
+	if limit == nil {
+		iter, err := db.db.NewIter(nil)
+		if err != nil {
+			return err
+		}
+		if iter.Last() {
+			limit = append(hexutil.CopyBytes(iter.Key()), 0x00)
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+		// Nothing to compact if the store is empty or the range is past its end
+		if limit == nil || (start != nil && bytes.Compare(start, limit) >= 0) {
+			return nil
+		}
+	}
+	return db.db.Compact(start, limit, true)
+}
+
+// Path returns the path to the database directory.
+func (db *Database) Path() string {
+	return db.fn
+}
+
+// upperBound returns the upper bound for the given prefix, i.e. the smallest key
+// that is larger than every key starting with the prefix. Nil is returned if no
+// such key exists (empty prefix or all 0xff bytes).
+func upperBound(prefix []byte) (limit []byte) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		c := prefix[i]
+		if c == 0xff {
+			continue
+		}
+		limit = make([]byte, i+1)
+		copy(limit, prefix)
+		limit[i] = c + 1
+		break
+	}
+	return limit
+}
+
+// snapshot wraps a pebble snapshot for implementing the Snapshot interface.
+type snapshot struct {
+	db       *pebble.Snapshot
+	lock     sync.Mutex
+	released bool
+}
+
+// Has retrieves if a key is present in the snapshot backing by a key-value
+// data store.
+func (snap *snapshot) Has(key []byte) (bool, error) {
+	_, closer, err := snap.get(key)
+	if err == pebble.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+// Get retrieves the given key if it's present in the snapshot backing by
+// key-value data store.
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	dat, closer, err := snap.get(key)
+	if err != nil {
+		return nil, err
+	}
+	ret := hexutil.CopyBytes(dat)
+	closer.Close()
+	return ret, nil
+}
+
+// get retrieves the given key from the snapshot, failing if it was released.
+func (snap *snapshot) get(key []byte) ([]byte, io.Closer, error) {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+
+	if snap.released {
+		return nil, nil, errSnapshotReleased
+	}
+	return snap.db.Get(key)
+}
+
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the snapshot.
+func (snap *snapshot) NewIterator() kvstore.Iterator {
+	return snap.newIterator(nil, nil)
+}
+
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// snapshot content starting at a particular initial key (or after, if it does
+// not exist).
+func (snap *snapshot) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return snap.newIterator(start, nil)
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of snapshot content with a particular key prefix.
+func (snap *snapshot) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return snap.newIterator(prefix, upperBound(prefix))
+}
+
+// newIterator creates a binary-alphabetical iterator over the [lower, upper)
+// range of the snapshot. A nil bound is treated as unbounded.
+func (snap *snapshot) newIterator(lower, upper []byte) kvstore.Iterator {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+
+	if snap.released {
+		return &pebbleIterator{err: errSnapshotReleased}
+	}
+	iter, err := snap.db.NewIter(&pebble.IterOptions{
+		LowerBound: lower,
+		UpperBound: upper,
+	})
+	if err != nil {
+		return &pebbleIterator{err: err}
+	}
+	iter.First()
+	return &pebbleIterator{iter: iter, moved: true}
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (snap *snapshot) Release() {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+
+	if !snap.released {
+		snap.db.Close()
+		snap.released = true
+	}
+}
+
+// batch is a write-only pebble batch that commits changes to its host database
+// when Write is called. A batch cannot be used concurrently.
+type batch struct {
+	b    *pebble.Batch
+	db   *Database
+	size int
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *batch) Put(key, value []byte) error {
+	b.b.Set(key, value, nil)
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.b.Delete(key, nil)
+	b.size += len(key)
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Write flushes any accumulated data to disk.
+func (b *batch) Write() error {
+	b.db.quitLock.RLock()
+	defer b.db.quitLock.RUnlock()
+
+	if b.db.closed {
+		return pebble.ErrClosed
+	}
+	return b.b.Commit(pebble.NoSync)
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
+// Replay replays the batch contents.
+func (b *batch) Replay(w kvstore.KeyValueWriter) error {
+	reader := b.b.Reader()
+	for {
+		kind, k, v, ok, err := reader.Next()
+		if !ok || err != nil {
+			return err
+		}
+		// The (k,v) slices might be overwritten if the batch is reset/reused,
+		// and the receiver should copy them if they are to be retained long-term.
+		switch kind {
+		case pebble.InternalKeyKindSet:
+			err = w.Put(k, v)
+		case pebble.InternalKeyKindDelete:
+			err = w.Delete(k)
+		default:
+			err = errors.New("unhandled operation")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pebbleIterator is a wrapper of underlying iterator in storage engine. The
+// purpose of this structure is to implement the missing APIs.
+type pebbleIterator struct {
+	iter     *pebble.Iterator
+	moved    bool
+	reverse  bool
+	released bool
+	err      error
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted.
+func (iter *pebbleIterator) Next() bool {
+	if iter.iter == nil {
+		return false
+	}
+	if iter.moved {
+		iter.moved = false
+		return iter.iter.Valid()
+	}
+	if iter.reverse {
+		return iter.iter.Prev()
+	}
+	return iter.iter.Next()
+}
+
+// Error returns any accumulated error. Exhausting all the key/value pairs
+// is not considered to be an error.
+func (iter *pebbleIterator) Error() error {
+	if iter.iter == nil || iter.released {
+		return iter.err
+	}
+	return iter.iter.Error()
+}
+
+// Key returns the key of the current key/value pair, or nil if done. The caller
+// should not modify the contents of the returned slice, and its contents may
+// change on the next call to Next.
+func (iter *pebbleIterator) Key() []byte {
+	if iter.iter == nil || iter.released || iter.moved || !iter.iter.Valid() {
+		return nil
+	}
+	return iter.iter.Key()
+}
+
+// Value returns the value of the current key/value pair, or nil if done. The
+// caller should not modify the contents of the returned slice, and its contents
+// may change on the next call to Next.
+func (iter *pebbleIterator) Value() []byte {
+	if iter.iter == nil || iter.released || iter.moved || !iter.iter.Valid() {
+		return nil
+	}
+	return iter.iter.Value()
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (iter *pebbleIterator) Release() {
+	if iter.iter != nil && !iter.released {
+		iter.iter.Close()
+		iter.released = true
+	}
+}
@@ -0,0 +1,77 @@
+package pebble
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/dbtest"
+	"github.com/chain5j/chain5j-pkg/metrics"
+)
+
+func TestPebbleDB(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() kvstore.KeyValueStore {
+			db, err := New(t.TempDir(), 0, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+}
+
+func TestPebbleMetrics(t *testing.T) {
+	db, err := New(t.TempDir(), 0, 0, "test/pebble/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"test/pebble/get/time", "test/pebble/put/time"} {
+		timer, ok := metrics.DefaultRegistry.Get(name).(*metrics.Histogram)
+		if !ok {
+			t.Fatalf("metric %s not registered", name)
+		}
+		if timer.Count() == 0 {
+			t.Fatalf("metric %s not updated", name)
+		}
+	}
+	if _, ok := metrics.DefaultRegistry.Get("test/pebble/disk/size").(*metrics.Gauge); !ok {
+		t.Fatalf("disk size gauge not registered")
+	}
+}
+
+// Tests that compacting the whole store covers keys longer than a hash, even if
+// they start with 0xff bytes.
+func TestPebbleCompactLongKeys(t *testing.T) {
+	db, err := New(t.TempDir(), 0, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := append(bytes.Repeat([]byte{0xff}, 32), 0x01)
+	if err := db.Put(key, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.db.Metrics().Levels[0].NumFiles; n != 0 {
+		t.Fatalf("level 0 not compacted: %d files", n)
+	}
+	// Compacting an empty range is a no-op
+	if err := db.Compact(append(key, 0x00), nil); err != nil {
+		t.Fatalf("failed to compact past the last key: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import "errors"
+
+// ErrSnapshotReadOnly is returned if a write operation is attempted on a
+// database view backed by a snapshot.
+var ErrSnapshotReadOnly = errors.New("snapshot is read only")
+
+// Snapshot is a frozen, read-only view of a key-value data store at a particular
+// point in time. Writes done to the host database after the creation of the
+// snapshot are not visible through it.
+type Snapshot interface {
+	KeyValueReader
+	Iteratee
+
+	// Release releases associated resources. Release should always succeed and can
+	// be called multiple times without causing error. Any data access after the
+	// release will fail.
+	Release()
+}
+
+// Snapshotter wraps the NewSnapshot method of a backing data store.
+type Snapshotter interface {
+	// NewSnapshot creates a database snapshot based on the current state. The
+	// created snapshot will not be affected by all following mutations that
+	// happen on the database. Note, the snapshot must be released after use.
+	NewSnapshot() (Snapshot, error)
+}
+
+// snapshotStore is a read-only KeyValueStore backed by a snapshot, allowing the
+// frozen view to be used by consumers expecting a full database.
+type snapshotStore struct {
+	Snapshot
+}
+
+// NewSnapshotStore wraps a snapshot into a read-only KeyValueStore. Reads and
+// iterations are served from the snapshot, writes fail with ErrSnapshotReadOnly.
+// Closing the returned store releases the snapshot.
+func NewSnapshotStore(snap Snapshot) KeyValueStore {
+	return &snapshotStore{Snapshot: snap}
+}
+
+// Put rejects the insertion, a snapshot is immutable.
+func (s *snapshotStore) Put(key []byte, value []byte) error {
+	return ErrSnapshotReadOnly
+}
+
+// Delete rejects the removal, a snapshot is immutable.
+func (s *snapshotStore) Delete(key []byte) error {
+	return ErrSnapshotReadOnly
+}
+
+// NewBatch creates a batch which can be filled and replayed, but never written
+// into the snapshot.
+func (s *snapshotStore) NewBatch() Batch {
+	return new(snapshotBatch)
+}
+
+// Stat returns a particular internal stat of the database. Snapshots do not
+// track any stats.
+func (s *snapshotStore) Stat(property string) (string, error) {
+	return "", errors.New("unknown property")
+}
+
+// Compact is a noop, a snapshot cannot be compacted.
+func (s *snapshotStore) Compact(start []byte, limit []byte) error {
+	return nil
+}
+
+// Close releases the underlying snapshot.
+func (s *snapshotStore) Close() error {
+	s.Snapshot.Release()
+	return nil
+}
+
+// snapshotKeyValue is a key-value tuple tagged with a deletion field to allow
+// replaying the operations of a snapshot batch.
+type snapshotKeyValue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// snapshotBatch is a write-only batch on top of a read-only snapshot. It can be
+// replayed into other writers, but never written.
+type snapshotBatch struct {
+	writes []snapshotKeyValue
+	size   int
+}
+
+// Put inserts the given value into the batch for later replaying.
+func (b *snapshotBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, snapshotKeyValue{append([]byte{}, key...), append([]byte{}, value...), false})
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later replaying.
+func (b *snapshotBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, snapshotKeyValue{append([]byte{}, key...), nil, true})
+	b.size += len(key)
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *snapshotBatch) ValueSize() int {
+	return b.size
+}
+
+// Write rejects flushing the batch, a snapshot is immutable.
+func (b *snapshotBatch) Write() error {
+	return ErrSnapshotReadOnly
+}
+
+// Reset resets the batch for reuse.
+func (b *snapshotBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+// Replay replays the batch contents.
+func (b *snapshotBatch) Replay(w KeyValueWriter) error {
+	for _, kv := range b.writes {
+		if kv.delete {
+			if err := w.Delete(kv.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(kv.key, kv.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
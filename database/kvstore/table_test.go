@@ -0,0 +1,87 @@
+package kvstore_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/dbtest"
+	"github.com/chain5j/chain5j-pkg/database/kvstore/memorydb"
+)
+
+// closingTable is a table which also closes its backing database, so that the
+// closed-database checks of the test suite can be exercised.
+type closingTable struct {
+	kvstore.Database
+	backing kvstore.Database
+}
+
+func (t *closingTable) Close() error {
+	return t.backing.Close()
+}
+
+func TestTableDatabase(t *testing.T) {
+	for _, prefix := range []string{"", "prefix-", "\xff", "a\xff\xff"} {
+		t.Run(fmt.Sprintf("DatabaseSuite/prefix=%q", prefix), func(t *testing.T) {
+			dbtest.TestDatabaseSuite(t, func() kvstore.KeyValueStore {
+				db := memorydb.New()
+
+				// Populate the backing database around the table, these entries
+				// must never leak into the table view
+				if prefix != "" {
+					for _, key := range []string{prefix[:len(prefix)-1], "b", "zzz"} {
+						db.Put([]byte(key), []byte("outside"))
+					}
+				}
+				return &closingTable{Database: kvstore.NewTable(db, prefix), backing: db}
+			})
+		})
+	}
+}
+
+func TestTableIsolation(t *testing.T) {
+	db := memorydb.New()
+	chain := kvstore.NewTable(db, "c")
+	state := kvstore.NewTable(db, "s")
+
+	chain.Put([]byte("key"), []byte("chain"))
+	state.Put([]byte("key"), []byte("state"))
+
+	b := state.NewBatch()
+	b.Put([]byte("other"), []byte("batched"))
+	b.Delete([]byte("key"))
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	// The keys must be physically prefixed in the backing database
+	for key, want := range map[string]string{"ckey": "chain", "sother": "batched"} {
+		if val, err := db.Get([]byte(key)); err != nil || string(val) != want {
+			t.Errorf("backing value mismatch for %s: have %q, %v, want %q", key, val, err, want)
+		}
+	}
+	if has, _ := db.Has([]byte("skey")); has {
+		t.Errorf("deleted key present in backing database")
+	}
+	// Iterators must only see the table content, with the prefix stripped
+	it := chain.NewIteratorWithStart(nil)
+	var keys [][]byte
+	for it.Next() {
+		keys = append(keys, append([]byte{}, it.Key()...))
+	}
+	it.Release()
+	if len(keys) != 1 || !bytes.Equal(keys[0], []byte("key")) {
+		t.Errorf("chain table keys mismatch: have %q, want [key]", keys)
+	}
+	// Batch replays must strip the prefix as well
+	replay := memorydb.New()
+	if err := b.Replay(replay); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := replay.Get([]byte("other")); err != nil || string(val) != "batched" {
+		t.Errorf("replayed value mismatch: have %q, %v", val, err)
+	}
+	if err := chain.Compact(nil, nil); err != nil {
+		t.Errorf("failed to compact table: %v", err)
+	}
+}
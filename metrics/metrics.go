@@ -0,0 +1,331 @@
+// Package metrics provides counters, gauges, meters and histograms, collected
+// into registries which can be exported in the Prometheus text format.
+//
+// @author: xwc1125
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter holds an int64 value that can be incremented and decremented.
+type Counter struct {
+	count int64
+}
+
+// NewCounter constructs a new Counter.
+func NewCounter() *Counter {
+	return new(Counter)
+}
+
+// Inc increments the counter by the given amount.
+func (c *Counter) Inc(i int64) {
+	atomic.AddInt64(&c.count, i)
+}
+
+// Dec decrements the counter by the given amount.
+func (c *Counter) Dec(i int64) {
+	atomic.AddInt64(&c.count, -i)
+}
+
+// Clear sets the counter to zero.
+func (c *Counter) Clear() {
+	atomic.StoreInt64(&c.count, 0)
+}
+
+// Count returns the current count.
+func (c *Counter) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+// Gauge holds an int64 value that can be set arbitrarily.
+type Gauge struct {
+	value int64
+}
+
+// NewGauge constructs a new Gauge.
+func NewGauge() *Gauge {
+	return new(Gauge)
+}
+
+// Update updates the gauge's value.
+func (g *Gauge) Update(v int64) {
+	atomic.StoreInt64(&g.value, v)
+}
+
+// Inc increments the gauge's current value by the given amount.
+func (g *Gauge) Inc(i int64) {
+	atomic.AddInt64(&g.value, i)
+}
+
+// Dec decrements the gauge's current value by the given amount.
+func (g *Gauge) Dec(i int64) {
+	atomic.AddInt64(&g.value, -i)
+}
+
+// Value returns the gauge's current value.
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+// meterTickInterval is the interval the moving averages of meters are updated in.
+const meterTickInterval = 5 * time.Second
+
+// Meter counts events to produce exponentially-weighted moving average rates
+// at one-, five-, and fifteen-minutes and a mean rate.
+//
+// The moving averages are ticked lazily whenever the meter is accessed, so no
+// background goroutine is needed to keep them up to date.
+type Meter struct {
+	lock      sync.Mutex
+	count     int64
+	uncounted int64
+	start     time.Time
+	lastTick  time.Time
+	a1        *ewma
+	a5        *ewma
+	a15       *ewma
+}
+
+// NewMeter constructs a new Meter.
+func NewMeter() *Meter {
+	now := time.Now()
+	return &Meter{
+		start:    now,
+		lastTick: now,
+		a1:       newEWMA(1),
+		a5:       newEWMA(5),
+		a15:      newEWMA(15),
+	}
+}
+
+// Mark records the occurrence of n events.
+func (m *Meter) Mark(n int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.tick(time.Now())
+	m.count += n
+	m.uncounted += n
+}
+
+// Count returns the number of events recorded.
+func (m *Meter) Count() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.count
+}
+
+// Rate1 returns the one-minute moving average rate of events per second.
+func (m *Meter) Rate1() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.tick(time.Now())
+	return m.a1.rate
+}
+
+// Rate5 returns the five-minute moving average rate of events per second.
+func (m *Meter) Rate5() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.tick(time.Now())
+	return m.a5.rate
+}
+
+// Rate15 returns the fifteen-minute moving average rate of events per second.
+func (m *Meter) Rate15() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.tick(time.Now())
+	return m.a15.rate
+}
+
+// RateMean returns the meter's mean rate of events per second.
+func (m *Meter) RateMean() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	elapsed := time.Since(m.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(m.count) / elapsed
+}
+
+// tick advances the moving averages over all the tick intervals elapsed since
+// the last update. The lock must be held by the caller.
+func (m *Meter) tick(now time.Time) {
+	for now.Sub(m.lastTick) >= meterTickInterval {
+		m.a1.update(m.uncounted)
+		m.a5.update(m.uncounted)
+		m.a15.update(m.uncounted)
+		m.uncounted = 0
+		m.lastTick = m.lastTick.Add(meterTickInterval)
+	}
+}
+
+// ewma is an exponentially-weighted moving average ticked every meterTickInterval.
+type ewma struct {
+	alpha float64
+	rate  float64
+	init  bool
+}
+
+// newEWMA constructs a moving average over the given number of minutes.
+func newEWMA(minutes float64) *ewma {
+	return &ewma{alpha: 1 - math.Exp(-meterTickInterval.Seconds()/60/minutes)}
+}
+
+// update folds the events of a tick interval into the average.
+func (a *ewma) update(count int64) {
+	instantRate := float64(count) / meterTickInterval.Seconds()
+	if a.init {
+		a.rate += a.alpha * (instantRate - a.rate)
+	} else {
+		a.init = true
+		a.rate = instantRate
+	}
+}
+
+// DefBuckets are the default histogram buckets, tailored to measure latencies
+// in seconds, from half a millisecond up to ten seconds.
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into configurable buckets, tracking the total
+// count and sum of all observed values.
+type Histogram struct {
+	lock    sync.Mutex
+	bounds  []float64 // Upper bounds of the buckets, sorted ascending
+	buckets []uint64  // Non-cumulative observation counts per bucket
+	count   uint64
+	sum     float64
+	min     float64
+	max     float64
+}
+
+// NewHistogram constructs a new Histogram with the given bucket upper bounds. If
+// no bounds are given, DefBuckets is used.
+func NewHistogram(bounds []float64) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefBuckets
+	}
+	sorted := append([]float64{}, bounds...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		bounds:  sorted,
+		buckets: make([]uint64, len(sorted)),
+	}
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.buckets[i]++
+	}
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+}
+
+// UpdateSince observes the elapsed time since the given start, in seconds.
+func (h *Histogram) UpdateSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.count
+}
+
+// Sum returns the sum of all observations.
+func (h *Histogram) Sum() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.sum
+}
+
+// Mean returns the mean of all observations.
+func (h *Histogram) Mean() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / float64(h.count)
+}
+
+// Min returns the smallest observation.
+func (h *Histogram) Min() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.min
+}
+
+// Max returns the largest observation.
+func (h *Histogram) Max() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.max
+}
+
+// Buckets returns the bucket upper bounds with the cumulative number of
+// observations less than or equal to each of them.
+func (h *Histogram) Buckets() ([]float64, []uint64) {
+	snap := h.Snapshot()
+	return snap.Bounds, snap.Buckets
+}
+
+// HistogramSnapshot is a consistent copy of the state of a Histogram.
+type HistogramSnapshot struct {
+	Bounds  []float64 // Upper bounds of the buckets, sorted ascending
+	Buckets []uint64  // Cumulative observation counts per bucket
+	Count   uint64
+	Sum     float64
+	Min     float64
+	Max     float64
+}
+
+// Snapshot returns a copy of the histogram taken under a single lock, so that
+// the buckets, count and sum agree with each other.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	cumulative := make([]uint64, len(h.buckets))
+	var total uint64
+	for i, n := range h.buckets {
+		total += n
+		cumulative[i] = total
+	}
+	return HistogramSnapshot{
+		Bounds:  append([]float64{}, h.bounds...),
+		Buckets: cumulative,
+		Count:   h.count,
+		Sum:     h.sum,
+		Min:     h.min,
+		Max:     h.max,
+	}
+}
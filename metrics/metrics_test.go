@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter()
+	c.Inc(5)
+	c.Dec(2)
+	if count := c.Count(); count != 3 {
+		t.Fatalf("count mismatch: have %d, want %d", count, 3)
+	}
+	c.Clear()
+	if count := c.Count(); count != 0 {
+		t.Fatalf("count mismatch after clear: have %d, want %d", count, 0)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge()
+	g.Update(47)
+	g.Inc(3)
+	g.Dec(10)
+	if v := g.Value(); v != 40 {
+		t.Fatalf("value mismatch: have %d, want %d", v, 40)
+	}
+}
+
+func TestMeter(t *testing.T) {
+	m := NewMeter()
+	m.Mark(47)
+	if count := m.Count(); count != 47 {
+		t.Fatalf("count mismatch: have %d, want %d", count, 47)
+	}
+	// Force a tick and check the moving averages picked up the marks
+	m.lock.Lock()
+	m.tick(m.lastTick.Add(meterTickInterval))
+	m.lock.Unlock()
+
+	want := 47 / meterTickInterval.Seconds()
+	if rate := m.Rate1(); rate != want {
+		t.Fatalf("1 minute rate mismatch: have %v, want %v", rate, want)
+	}
+	if rate := m.Rate15(); rate != want {
+		t.Fatalf("15 minute rate mismatch: have %v, want %v", rate, want)
+	}
+	// A silent interval must decay the averages, the shortest one the fastest
+	m.lock.Lock()
+	m.tick(m.lastTick.Add(meterTickInterval))
+	m.lock.Unlock()
+
+	if r1, r15 := m.Rate1(), m.Rate15(); r1 >= r15 || r15 >= want {
+		t.Fatalf("rates not decaying: 1m %v, 15m %v, initial %v", r1, r15, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{10, 1, 5})
+	for _, v := range []float64{0.5, 1, 3, 7, 20} {
+		h.Observe(v)
+	}
+	if count := h.Count(); count != 5 {
+		t.Fatalf("count mismatch: have %d, want %d", count, 5)
+	}
+	if sum := h.Sum(); sum != 31.5 {
+		t.Fatalf("sum mismatch: have %v, want %v", sum, 31.5)
+	}
+	if min, max := h.Min(), h.Max(); min != 0.5 || max != 20 {
+		t.Fatalf("bounds mismatch: have [%v, %v], want [%v, %v]", min, max, 0.5, 20)
+	}
+	bounds, counts := h.Buckets()
+	wantBounds, wantCounts := []float64{1, 5, 10}, []uint64{2, 3, 4}
+	for i := range wantBounds {
+		if bounds[i] != wantBounds[i] || counts[i] != wantCounts[i] {
+			t.Fatalf("bucket %d mismatch: have %v:%d, want %v:%d", i, bounds[i], counts[i], wantBounds[i], wantCounts[i])
+		}
+	}
+}
+
+func TestHistogramSnapshotConsistent(t *testing.T) {
+	h := NewHistogram([]float64{1})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10000; i++ {
+			h.Observe(1)
+		}
+	}()
+	for {
+		snap := h.Snapshot()
+		if snap.Buckets[0] != snap.Count || snap.Sum != float64(snap.Count) {
+			t.Fatalf("inconsistent snapshot: bucket %d, count %d, sum %v", snap.Buckets[0], snap.Count, snap.Sum)
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+func TestHistogramUpdateSince(t *testing.T) {
+	h := NewHistogram(nil)
+	h.UpdateSince(time.Now().Add(-time.Second))
+	if sum := h.Sum(); sum < 1 {
+		t.Fatalf("elapsed time not recorded: have %v, want >= 1", sum)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	c := NewRegisteredCounter("foo", r)
+	if other := NewRegisteredCounter("foo", r); other != c {
+		t.Fatalf("counter re-registered instead of reused")
+	}
+	if err := r.Register("foo", NewGauge()); err == nil {
+		t.Fatalf("duplicate registration succeeded")
+	}
+	if err := r.Register("bar", 47); err == nil {
+		t.Fatalf("unsupported metric registered")
+	}
+	NewRegisteredMeter("baz", r)
+
+	var names []string
+	r.Each(func(name string, metric interface{}) { names = append(names, name) })
+	if len(names) != 2 || names[0] != "baz" || names[1] != "foo" {
+		t.Fatalf("iteration mismatch: have %v, want [baz foo]", names)
+	}
+	r.Unregister("foo")
+	if r.Get("foo") != nil {
+		t.Fatalf("metric not unregistered")
+	}
+}
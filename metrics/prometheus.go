@@ -0,0 +1,81 @@
+// Package metrics
+//
+// @author: xwc1125
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WritePrometheus writes all the metrics of the registry into the writer in the
+// Prometheus text exposition format. Metric names are sanitized, replacing every
+// character not allowed by Prometheus with an underscore.
+//
+// Counters and gauges are exported as is, meters as a counter of the events
+// (suffixed with _total) and histograms as cumulative buckets.
+func WritePrometheus(w io.Writer, r *Registry) error {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	bw := bufio.NewWriter(w)
+	r.Each(func(name string, metric interface{}) {
+		name = SanitizeName(name)
+		switch m := metric.(type) {
+		case *Counter:
+			fmt.Fprintf(bw, "# TYPE %s counter\n%s %d\n", name, name, m.Count())
+		case *Gauge:
+			fmt.Fprintf(bw, "# TYPE %s gauge\n%s %d\n", name, name, m.Value())
+		case *Meter:
+			fmt.Fprintf(bw, "# TYPE %s_total counter\n%s_total %d\n", name, name, m.Count())
+		case *Histogram:
+			snap := m.Snapshot()
+			fmt.Fprintf(bw, "# TYPE %s histogram\n", name)
+			for i, bound := range snap.Bounds {
+				fmt.Fprintf(bw, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), snap.Buckets[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n", name, snap.Count)
+			fmt.Fprintf(bw, "%s_sum %s\n", name, formatFloat(snap.Sum))
+			fmt.Fprintf(bw, "%s_count %d\n", name, snap.Count)
+		}
+	})
+	return bw.Flush()
+}
+
+// Handler returns an HTTP handler serving the metrics of the registry in the
+// Prometheus text exposition format.
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w, r)
+	})
+}
+
+// SanitizeName converts a metric name into a valid Prometheus metric name,
+// e.g. "chain/db/compact/time" into "chain_db_compact_time".
+func SanitizeName(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// formatFloat formats a float the way Prometheus expects it.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("chain/db/counter", r).Inc(3)
+	NewRegisteredGauge("chain/db/disk.size", r).Update(1024)
+	NewRegisteredMeter("chain/db/compact/time", r).Mark(7)
+	NewRegisteredHistogram("chain/db/get/time", r, []float64{0.1, 1}).Observe(0.5)
+
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, r); err != nil {
+		t.Fatalf("failed to export metrics: %v", err)
+	}
+	want := `# TYPE chain_db_compact_time_total counter
+chain_db_compact_time_total 7
+# TYPE chain_db_counter counter
+chain_db_counter 3
+# TYPE chain_db_disk_size gauge
+chain_db_disk_size 1024
+# TYPE chain_db_get_time histogram
+chain_db_get_time_bucket{le="0.1"} 0
+chain_db_get_time_bucket{le="1"} 1
+chain_db_get_time_bucket{le="+Inf"} 1
+chain_db_get_time_sum 0.5
+chain_db_get_time_count 1
+`
+	if have := buf.String(); have != want {
+		t.Fatalf("export mismatch:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGauge("gauge", r).Update(1)
+
+	rec := httptest.NewRecorder()
+	Handler(r).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); body != "# TYPE gauge gauge\ngauge 1\n" {
+		t.Fatalf("response mismatch: have %q", body)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := map[string]string{
+		"chain/db/get":  "chain_db_get",
+		"0x/size":       "_0x_size",
+		"a:b_c-d.e":     "a:b_c_d_e",
+		"already_valid": "already_valid",
+	}
+	for in, want := range tests {
+		if have := SanitizeName(in); have != want {
+			t.Errorf("sanitize %q: have %q, want %q", in, have, want)
+		}
+	}
+}
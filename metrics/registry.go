@@ -0,0 +1,138 @@
+// Package metrics
+//
+// @author: xwc1125
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultRegistry is the registry used by the NewRegistered constructors if no
+// other registry is given.
+var DefaultRegistry = NewRegistry()
+
+// Registry holds references to a set of metrics by name.
+type Registry struct {
+	metrics map[string]interface{}
+	lock    sync.RWMutex
+}
+
+// NewRegistry creates a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]interface{})}
+}
+
+// Get the metric by the given name or nil if none is registered.
+func (r *Registry) Get(name string) interface{} {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.metrics[name]
+}
+
+// GetOrRegister gets an existing metric or registers the one created by the given
+// constructor. The interface can be the metric to register if not found in the
+// registry, or a function returning the metric for lazy instantiation.
+func (r *Registry) GetOrRegister(name string, metric interface{}) interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if existing, ok := r.metrics[name]; ok {
+		return existing
+	}
+	switch ctor := metric.(type) {
+	case func() *Counter:
+		metric = ctor()
+	case func() *Gauge:
+		metric = ctor()
+	case func() *Meter:
+		metric = ctor()
+	case func() *Histogram:
+		metric = ctor()
+	}
+	r.metrics[name] = metric
+	return metric
+}
+
+// Register the given metric under the given name. Returns an error if a metric
+// by the given name is already registered.
+func (r *Registry) Register(name string, metric interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		return fmt.Errorf("duplicate metric: %s", name)
+	}
+	switch metric.(type) {
+	case *Counter, *Gauge, *Meter, *Histogram:
+		r.metrics[name] = metric
+		return nil
+	default:
+		return fmt.Errorf("unsupported metric type %T: %s", metric, name)
+	}
+}
+
+// Unregister the metric with the given name.
+func (r *Registry) Unregister(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.metrics, name)
+}
+
+// Each calls the given function for each registered metric, in the order of
+// their names.
+func (r *Registry) Each(fn func(name string, metric interface{})) {
+	r.lock.RLock()
+	names := make([]string, 0, len(r.metrics))
+	metrics := make(map[string]interface{}, len(r.metrics))
+	for name, metric := range r.metrics {
+		names = append(names, name)
+		metrics[name] = metric
+	}
+	r.lock.RUnlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		fn(name, metrics[name])
+	}
+}
+
+// NewRegisteredCounter constructs and registers a new Counter, or returns the
+// already registered one with the same name. A nil registry means the default.
+func NewRegisteredCounter(name string, r *Registry) *Counter {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, NewCounter).(*Counter)
+}
+
+// NewRegisteredGauge constructs and registers a new Gauge, or returns the
+// already registered one with the same name. A nil registry means the default.
+func NewRegisteredGauge(name string, r *Registry) *Gauge {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, NewGauge).(*Gauge)
+}
+
+// NewRegisteredMeter constructs and registers a new Meter, or returns the
+// already registered one with the same name. A nil registry means the default.
+func NewRegisteredMeter(name string, r *Registry) *Meter {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, NewMeter).(*Meter)
+}
+
+// NewRegisteredHistogram constructs and registers a new Histogram with the given
+// bucket bounds, or returns the already registered one with the same name. A nil
+// registry means the default.
+func NewRegisteredHistogram(name string, r *Registry, bounds []float64) *Histogram {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() *Histogram { return NewHistogram(bounds) }).(*Histogram)
+}
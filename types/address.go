@@ -139,6 +139,20 @@ func (a *Address) UnmarshalJSON(input []byte) error {
 	return hexutil.UnmarshalFixedJSON(addressT, input, a[:])
 }
 
+// MarshalBinary returns the bytes of a.
+func (a Address) MarshalBinary() ([]byte, error) {
+	return a[:], nil
+}
+
+// UnmarshalBinary sets a to the bytes of input, which must be exactly AddressLength long.
+func (a *Address) UnmarshalBinary(input []byte) error {
+	if len(input) != AddressLength {
+		return fmt.Errorf("invalid length %d for Address, want %d", len(input), AddressLength)
+	}
+	copy(a[:], input)
+	return nil
+}
+
 // Scan implements Scanner for database/sql.
 func (a *Address) Scan(src interface{}) error {
 	srcB, ok := src.([]byte)
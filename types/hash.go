@@ -117,6 +117,20 @@ func IsEmptyHash(h Hash) bool {
 	return h == Hash{}
 }
 
+// MarshalBinary returns the bytes of h.
+func (h Hash) MarshalBinary() ([]byte, error) {
+	return h[:], nil
+}
+
+// UnmarshalBinary sets h to the bytes of input, which must be exactly HashLength long.
+func (h *Hash) UnmarshalBinary(input []byte) error {
+	if len(input) != HashLength {
+		return fmt.Errorf("invalid length %d for Hash, want %d", len(input), HashLength)
+	}
+	copy(h[:], input)
+	return nil
+}
+
 // Scan implements Scanner for database/sql.
 func (h *Hash) Scan(src interface{}) error {
 	srcB, ok := src.([]byte)